@@ -0,0 +1,494 @@
+// Package config gathers the bridge's settings in one place. Load starts from
+// the defaults, applies an optional JSON file (CONFIG_PATH), then lets any
+// environment variable that is set override the file, and validates the
+// result before anything starts. Each setting's file key and env var are in
+// its struct tags; the components receive their part as an explicit struct
+// (see StoreConfig, EngineConfig and WatcherConfig).
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent-bridge/internal/matching"
+	"agent-bridge/internal/store"
+	"agent-bridge/internal/watcher"
+)
+
+// Config is every setting, grouped by the component that uses it.
+type Config struct {
+	Server  Server  `json:"server"`
+	Store   Store   `json:"store"`
+	Watcher Watcher `json:"watcher"`
+	Soroban Soroban `json:"soroban"`
+	Engine  Engine  `json:"engine"`
+	Signal  Signal  `json:"signal"`
+}
+
+// Server configures HTTP serving, persistence and admin access.
+type Server struct {
+	Port          string `json:"port" env:"PORT"`
+	AdminPort     string `json:"adminPort" env:"ADMIN_PORT"` // "" = admin routes on Port
+	FrontendURL   string `json:"frontendUrl" env:"FRONTEND_URL"`
+	AllowedOrigin string `json:"allowedOrigin" env:"ALLOWED_ORIGIN"`
+	GzipMinBytes  int    `json:"gzipMinBytes" env:"GZIP_MIN_BYTES"`
+	DBPath        string `json:"dbPath" env:"DB_PATH"`
+
+	// AdminSecret may be an op:// 1Password reference; main resolves it.
+	AdminSecret       string `json:"adminSecret" env:"ADMIN_SECRET"`
+	AdminIPAllowlist  string `json:"adminIpAllowlist" env:"ADMIN_IP_ALLOWLIST"`
+	TrustForwardedFor bool   `json:"trustForwardedFor" env:"TRUST_FORWARDED_FOR"`
+
+	TLSCert          string `json:"tlsCert" env:"TLS_CERT"`
+	TLSKey           string `json:"tlsKey" env:"TLS_KEY"`
+	AutocertDomains  string `json:"autocertDomains" env:"AUTOCERT_DOMAINS"`
+	AutocertCacheDir string `json:"autocertCacheDir" env:"AUTOCERT_CACHE_DIR"`
+	AdminTLSCert     string `json:"adminTlsCert" env:"ADMIN_TLS_CERT"` // ADMIN_PORT certificate; "" = TLS_CERT
+	AdminTLSKey      string `json:"adminTlsKey" env:"ADMIN_TLS_KEY"`
+
+	SSEMaxLifetimeSec       int    `json:"sseMaxLifetimeSec" env:"SSE_MAX_LIFETIME_SEC"`
+	BookSnapshotMaxDepth    int    `json:"bookSnapshotMaxDepth" env:"BOOK_SNAPSHOT_MAX_DEPTH"`
+	BridgeExtraPaths        string `json:"bridgeExtraPaths" env:"BRIDGE_EXTRA_PATHS"`
+	ProxyBreakerFailures    int    `json:"proxyBreakerFailures" env:"PROXY_BREAKER_FAILURES"`
+	ProxyBreakerCooldownSec int    `json:"proxyBreakerCooldownSec" env:"PROXY_BREAKER_COOLDOWN_SEC"`
+	StrictContentType       bool   `json:"strictContentType" env:"STRICT_CONTENT_TYPE"` // refuse JSON bodies without a Content-Type
+}
+
+// Store configures sessions and their SSE streams.
+type Store struct {
+	MaxSubscribersPerToken  int     `json:"maxSubscribersPerToken" env:"MAX_SUBSCRIBERS_PER_TOKEN"`
+	SSEBlockTimeoutMS       int     `json:"sseBlockTimeoutMs" env:"SSE_BLOCK_TIMEOUT_MS"`
+	InsightCooldownSec      int     `json:"insightCooldownSec" env:"INSIGHT_COOLDOWN_SEC"`
+	InsightCooldownOverride float64 `json:"insightCooldownOverride" env:"INSIGHT_COOLDOWN_OVERRIDE"`
+	MaxAccountWatchers      int     `json:"maxAccountWatchers" env:"MAX_ACCOUNT_WATCHERS"`
+	DefaultNetwork          string  `json:"defaultNetwork" env:"DEFAULT_NETWORK"`
+	DefaultPair             string  `json:"defaultPair" env:"DEFAULT_PAIR"`
+}
+
+// Watcher configures the Horizon account and order-book watchers.
+type Watcher struct {
+	HorizonMainnetURL string `json:"horizonMainnetUrl" env:"HORIZON_MAINNET_URL"`
+	HorizonTestnetURL string `json:"horizonTestnetUrl" env:"HORIZON_TESTNET_URL"`
+	PollMainnetSec    int    `json:"pollMainnetSec" env:"OB_POLL_MAINNET_SEC"`
+	PollTestnetSec    int    `json:"pollTestnetSec" env:"OB_POLL_TESTNET_SEC"`
+	PollAdaptive      bool   `json:"pollAdaptive" env:"OB_POLL_ADAPTIVE"`
+	PriceMode         string `json:"priceMode" env:"OB_PRICE_MODE"`
+	WallConfirmPolls  int    `json:"wallConfirmPolls" env:"WALL_CONFIRM_POLLS"`
+	// MarkNetwork feeds that network's book price into the engine's mark
+	// price; empty = off.
+	MarkNetwork string `json:"markNetwork" env:"OB_MARK_NETWORK"`
+}
+
+// Soroban configures on-chain settlement and the SDEX client.
+type Soroban struct {
+	RPCURL            string `json:"rpcUrl" env:"SOROBAN_RPC_URL"`
+	HorizonURL        string `json:"horizonUrl" env:"HORIZON_URL"`
+	NetworkPassphrase string `json:"networkPassphrase" env:"NETWORK_PASSPHRASE"`
+	AgentVaultID      string `json:"agentVaultId" env:"AGENT_VAULT_ID"`
+	LeveragePoolID    string `json:"leveragePoolId" env:"LEVERAGE_POOL_ID"`
+	SettlementToken   string `json:"settlementToken" env:"SETTLEMENT_TOKEN"`
+	USDCIssuer        string `json:"usdcIssuer" env:"USDC_ISSUER"`
+}
+
+// Engine configures the matching engine, mock price feed and liquidations.
+type Engine struct {
+	// SettleURL defaults to FrontendURL + /api/admin/settle; see
+	// SettleConfigured.
+	SettleURL         string `json:"settleUrl" env:"SETTLE_URL"`
+	SettleForceEnable bool   `json:"settleForceEnable" env:"SETTLE_FORCE_ENABLE"`
+	SettleDLQPath     string `json:"settleDlqPath" env:"SETTLE_DLQ_PATH"`
+	// TradableSymbols is comma-separated; empty = the watched pairs.
+	TradableSymbols  string  `json:"tradableSymbols" env:"TRADABLE_SYMBOLS"`
+	MinOrderNotional float64 `json:"minOrderNotional" env:"MIN_ORDER_NOTIONAL"`
+	// SymbolMaxLeverage caps leverage per symbol, "BTC/USDC=10,XLM/USDC=5";
+	// others get matching.MaxLeverage.
+	SymbolMaxLeverage string `json:"symbolMaxLeverage" env:"SYMBOL_MAX_LEVERAGE"`
+	// SymbolMinNotional overrides MinOrderNotional per symbol,
+	// "XLM/USDC=5,BTC/USDC=10".
+	SymbolMinNotional string `json:"symbolMinNotional" env:"SYMBOL_MIN_NOTIONAL"`
+	MaxOrdersPerToken int    `json:"maxOrdersPerToken" env:"MAX_ORDERS_PER_TOKEN"`
+	MaxBookDepth      int    `json:"maxBookDepth" env:"MAX_BOOK_DEPTH"`
+	BookDepthPolicy   string `json:"bookDepthPolicy" env:"BOOK_DEPTH_POLICY"`
+	FillPricePolicy   string `json:"fillPricePolicy" env:"FILL_PRICE_POLICY"`
+
+	MaxPositionsPerToken  int    `json:"maxPositionsPerToken" env:"MAX_POSITIONS_PER_TOKEN"`
+	SettleMaxAttempts     int    `json:"settleMaxAttempts" env:"SETTLE_MAX_ATTEMPTS"`
+	LiquidationGraceTicks int    `json:"liquidationGraceTicks" env:"LIQUIDATION_GRACE_TICKS"`
+	LiquidationGraceSec   int    `json:"liquidationGraceSec" env:"LIQUIDATION_GRACE_SEC"`
+	MarginMode            string `json:"marginMode" env:"MARGIN_MODE"`
+
+	MockPriceSeeds string `json:"mockPriceSeeds" env:"MOCK_PRICE_SEEDS"`
+	MockPriceBands string `json:"mockPriceBands" env:"MOCK_PRICE_BANDS"`
+
+	PriceBreakerMaxMovePct int    `json:"priceBreakerMaxMovePct" env:"PRICE_BREAKER_MAX_MOVE_PCT"`
+	PriceBreakerWindowSec  int    `json:"priceBreakerWindowSec" env:"PRICE_BREAKER_WINDOW_SEC"`
+	PriceBreakerMode       string `json:"priceBreakerMode" env:"PRICE_BREAKER_MODE"`
+	PriceBreakerStableSec  int    `json:"priceBreakerStableSec" env:"PRICE_BREAKER_STABLE_SEC"`
+
+	// TradePublisher selects where fills are fanned out: "none" or "http"
+	// (POST to TradePublishURL).
+	TradePublisher     string `json:"tradePublisher" env:"TRADE_PUBLISHER"`
+	TradePublishURL    string `json:"tradePublishUrl" env:"TRADE_PUBLISH_URL"`
+	TradePublishBuffer int    `json:"tradePublishBuffer" env:"TRADE_PUBLISH_BUFFER"`
+}
+
+// Signal configures TradingView alerts and the signal-to-order bridge.
+type Signal struct {
+	AlertMapping   string `json:"alertMapping" env:"TRADINGVIEW_ALERT_MAPPING"`
+	Enabled        bool   `json:"enabled" env:"SIGNAL_TRADING_ENABLED"`
+	Webhooks       string `json:"webhooks" env:"SIGNAL_WEBHOOKS"`
+	MaxSlippageBps int    `json:"maxSlippageBps" env:"SIGNAL_MAX_SLIPPAGE_BPS"`
+}
+
+// Default returns the settings used when neither the file nor the
+// environment says otherwise.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:                    "8090",
+			FrontendURL:             "http://localhost:3000",
+			AllowedOrigin:           "*",
+			GzipMinBytes:            1024,
+			DBPath:                  "bridge.db",
+			AutocertCacheDir:        "autocert-cache",
+			BookSnapshotMaxDepth:    matching.DefaultMaxSnapshotDepth,
+			ProxyBreakerFailures:    5,
+			ProxyBreakerCooldownSec: 30,
+		},
+		Store: Store{
+			MaxSubscribersPerToken:  10,
+			SSEBlockTimeoutMS:       int(store.DefaultBlockTimeout / time.Millisecond),
+			InsightCooldownSec:      30,
+			InsightCooldownOverride: store.DefaultInsightOverride,
+			MaxAccountWatchers:      200,
+			DefaultNetwork:          "TESTNET",
+			DefaultPair:             "XLM/USDC",
+		},
+		Watcher: Watcher{
+			PollMainnetSec:   int(watcher.DefaultPollInterval / time.Second),
+			PollTestnetSec:   int(watcher.DefaultPollInterval / time.Second),
+			PriceMode:        string(watcher.PriceMid),
+			WallConfirmPolls: watcher.DefaultWallConfirmations,
+		},
+		Soroban: Soroban{
+			RPCURL:            "https://soroban-testnet.stellar.org",
+			HorizonURL:        "https://horizon-testnet.stellar.org",
+			NetworkPassphrase: "Test SDF Network ; September 2015",
+			AgentVaultID:      "CCNK5O3FFCOC5KEBRK6ORUUPPHYDUITTH2XCLLG7P2IBQRX2L6HXJFWG",
+			LeveragePoolID:    "CCNF3JMO7MO5PSR7AS4GT3DKZU7MLDN5WS2ML7RWOGMGPLXTT7HXRY7L",
+			// USDC on testnet (C... contract address)
+			SettlementToken: "CBIELTK6YBZJU5UP2WWQEUCYKLPU6AUNZ2BQ4WWFEIE3USCIHMXQDAMA",
+		},
+		Engine: Engine{
+			MinOrderNotional:      matching.DefaultMinNotional,
+			MaxOrdersPerToken:     200,
+			BookDepthPolicy:       string(matching.DepthReject),
+			FillPricePolicy:       string(matching.FillAtMaker),
+			MaxPositionsPerToken:  20,
+			SettleMaxAttempts:     matching.DefaultMaxSettleAttempts,
+			LiquidationGraceTicks: 1,
+			PriceBreakerWindowSec: 60,
+			TradePublisher:        "none",
+			TradePublishBuffer:    matching.DefaultPublishBuffer,
+		},
+		Signal: Signal{
+			MaxSlippageBps: 200,
+		},
+	}
+}
+
+// Load builds the configuration: Default, then the JSON file at path if path
+// is not empty, then every env var getenv reports as set. Unknown file keys
+// and unparseable values are errors, as is a result that fails Validate.
+func Load(path string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("config file: %w", err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return Config{}, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), getenv); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overwrites each field of v carrying an env tag whose variable is
+// set, recursing into nested structs.
+func applyEnv(v reflect.Value, getenv func(string) string) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		f, sf := v.Field(i), v.Type().Field(i)
+		if f.Kind() == reflect.Struct {
+			if err := applyEnv(f, getenv); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		key := sf.Tag.Get("env")
+		raw := getenv(key)
+		if key == "" || raw == "" {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(raw)
+		case reflect.Int:
+			n, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q is not an integer", key, raw))
+				continue
+			}
+			f.SetInt(int64(n))
+		case reflect.Float64:
+			x, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q is not a number", key, raw))
+				continue
+			}
+			f.SetFloat(x)
+		case reflect.Bool:
+			// Only "true" enables, as before: "1" or "yes" read as false.
+			f.SetBool(raw == "true")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks what can be checked before anything starts, reporting
+// every problem at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "PORT %q must be a TCP port number", c.Server.Port)
+	if c.Server.AdminPort != "" {
+		adminPort, err := strconv.Atoi(c.Server.AdminPort)
+		check(err == nil && adminPort > 0 && adminPort < 65536, "ADMIN_PORT %q must be a TCP port number", c.Server.AdminPort)
+		check(err != nil || adminPort != port, "ADMIN_PORT must differ from PORT")
+	}
+	check(absoluteURL(c.Server.FrontendURL), "FRONTEND_URL %q must be an absolute http(s) URL", c.Server.FrontendURL)
+	check(c.Engine.SettleURL == "" || absoluteURL(c.Engine.SettleURL), "SETTLE_URL %q must be an absolute http(s) URL", c.Engine.SettleURL)
+	check(c.Server.DBPath != "", "DB_PATH is required")
+	check((c.Server.TLSCert == "") == (c.Server.TLSKey == ""), "TLS_CERT and TLS_KEY must be set together")
+	check((c.Server.AdminTLSCert == "") == (c.Server.AdminTLSKey == ""), "ADMIN_TLS_CERT and ADMIN_TLS_KEY must be set together")
+	// Autocert never covers the admin listener, so without a certificate of
+	// its own it would quietly serve the secret-bearing routes over HTTP.
+	check(c.Server.AdminPort == "" || c.Server.AutocertDomains == "" || c.Server.TLSCert != "" || c.Server.AdminTLSCert != "",
+		"ADMIN_PORT with AUTOCERT_DOMAINS needs ADMIN_TLS_CERT and ADMIN_TLS_KEY; autocert certificates are not used on the admin listener")
+	check(c.Signal.Webhooks != "" || !c.Signal.Enabled, "SIGNAL_TRADING_ENABLED=true but SIGNAL_WEBHOOKS is empty")
+	for _, n := range []struct {
+		key string
+		v   int
+	}{
+		{"GZIP_MIN_BYTES", c.Server.GzipMinBytes},
+		{"SSE_MAX_LIFETIME_SEC", c.Server.SSEMaxLifetimeSec},
+		{"BOOK_SNAPSHOT_MAX_DEPTH", c.Server.BookSnapshotMaxDepth},
+		{"MAX_SUBSCRIBERS_PER_TOKEN", c.Store.MaxSubscribersPerToken},
+		{"INSIGHT_COOLDOWN_SEC", c.Store.InsightCooldownSec},
+		{"MAX_ACCOUNT_WATCHERS", c.Store.MaxAccountWatchers},
+		{"MAX_ORDERS_PER_TOKEN", c.Engine.MaxOrdersPerToken},
+		{"MAX_BOOK_DEPTH", c.Engine.MaxBookDepth},
+		{"MAX_POSITIONS_PER_TOKEN", c.Engine.MaxPositionsPerToken},
+		{"LIQUIDATION_GRACE_SEC", c.Engine.LiquidationGraceSec},
+		{"PRICE_BREAKER_MAX_MOVE_PCT", c.Engine.PriceBreakerMaxMovePct},
+		{"PRICE_BREAKER_WINDOW_SEC", c.Engine.PriceBreakerWindowSec},
+		{"PRICE_BREAKER_STABLE_SEC", c.Engine.PriceBreakerStableSec},
+		{"TRADE_PUBLISH_BUFFER", c.Engine.TradePublishBuffer},
+	} {
+		check(n.v >= 0, "%s must not be negative, got %d", n.key, n.v)
+	}
+	check(c.Watcher.PollMainnetSec > 0, "OB_POLL_MAINNET_SEC must be positive, got %d", c.Watcher.PollMainnetSec)
+	check(c.Watcher.PollTestnetSec > 0, "OB_POLL_TESTNET_SEC must be positive, got %d", c.Watcher.PollTestnetSec)
+	check(c.Engine.MinOrderNotional >= 0, "MIN_ORDER_NOTIONAL must not be negative, got %g", c.Engine.MinOrderNotional)
+	check(c.Store.InsightCooldownOverride > 1, "INSIGHT_COOLDOWN_OVERRIDE must be greater than 1, got %g", c.Store.InsightCooldownOverride)
+	mark := c.Watcher.MarkNetwork
+	check(mark == "" || mark == "MAINNET" || mark == "TESTNET", "OB_MARK_NETWORK %q must be MAINNET or TESTNET", mark)
+
+	if _, err := c.StoreConfig(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := c.EngineConfig(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := c.SymbolConfigs(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func absoluteURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// StoreConfig is the store's part, with DEFAULT_NETWORK and DEFAULT_PAIR
+// normalised.
+func (c Config) StoreConfig() (store.Config, error) {
+	sc := c.Store
+	network := strings.ToUpper(strings.TrimSpace(sc.DefaultNetwork))
+	if network != "MAINNET" && network != "TESTNET" {
+		return store.Config{}, fmt.Errorf("DEFAULT_NETWORK %q must be MAINNET or TESTNET", sc.DefaultNetwork)
+	}
+	pair, err := matching.NormalizeSymbol(sc.DefaultPair)
+	if err != nil {
+		return store.Config{}, fmt.Errorf("DEFAULT_PAIR: %w", err)
+	}
+	return store.Config{
+		MaxSubscribers:  sc.MaxSubscribersPerToken,
+		BlockTimeout:    time.Duration(sc.SSEBlockTimeoutMS) * time.Millisecond,
+		InsightCooldown: time.Duration(sc.InsightCooldownSec) * time.Second,
+		InsightOverride: sc.InsightCooldownOverride,
+		MaxWatchers:     sc.MaxAccountWatchers,
+		DefaultNetwork:  network,
+		DefaultPair:     pair,
+	}, nil
+}
+
+// WatcherConfig is the watchers' part.
+func (c Config) WatcherConfig() watcher.Config {
+	wc := c.Watcher
+	return watcher.Config{
+		HorizonMainnet: wc.HorizonMainnetURL,
+		HorizonTestnet: wc.HorizonTestnetURL,
+		PollIntervals: map[string]time.Duration{
+			"MAINNET": time.Duration(wc.PollMainnetSec) * time.Second,
+			"TESTNET": time.Duration(wc.PollTestnetSec) * time.Second,
+		},
+		AdaptivePolling:   wc.PollAdaptive,
+		PriceMode:         watcher.PriceMode(wc.PriceMode),
+		WallConfirmations: wc.WallConfirmPolls,
+	}
+}
+
+// EngineConfig is the engine's part, with the mock price seeds and bands
+// parsed. Detect-only follows SettleConfigured.
+func (c Config) EngineConfig() (matching.Config, error) {
+	ec := c.Engine
+	cfg := matching.Config{
+		MaxOrdersPerToken: ec.MaxOrdersPerToken,
+		MaxBookDepth:      ec.MaxBookDepth,
+		DepthPolicy:       matching.DepthPolicy(ec.BookDepthPolicy),
+		FillPrice:         matching.FillPricePolicy(ec.FillPricePolicy),
+		Breaker: matching.PriceBreakerConfig{
+			MaxMove:   float64(ec.PriceBreakerMaxMovePct) / 100,
+			Window:    time.Duration(ec.PriceBreakerWindowSec) * time.Second,
+			Mode:      matching.BreakerMode(ec.PriceBreakerMode),
+			StableFor: time.Duration(ec.PriceBreakerStableSec) * time.Second,
+		},
+		Liquidation: matching.LiquidationConfig{
+			MaxPositionsPerToken: ec.MaxPositionsPerToken,
+			MaxSettleAttempts:    ec.SettleMaxAttempts,
+			GraceTicks:           ec.LiquidationGraceTicks,
+			GraceFor:             time.Duration(ec.LiquidationGraceSec) * time.Second,
+			MarginMode:           matching.MarginMode(ec.MarginMode),
+			DetectOnly:           !c.SettleConfigured(),
+		},
+	}
+	switch ec.TradePublisher {
+	case "", "none":
+	case "http":
+		if !absoluteURL(ec.TradePublishURL) {
+			return matching.Config{}, fmt.Errorf("TRADE_PUBLISHER=http needs TRADE_PUBLISH_URL as an absolute http(s) URL, got %q", ec.TradePublishURL)
+		}
+		cfg.Publisher = &matching.HTTPPublisher{URL: ec.TradePublishURL}
+		cfg.PublishBuffer = ec.TradePublishBuffer
+	default:
+		return matching.Config{}, fmt.Errorf("TRADE_PUBLISHER %q must be none or http", ec.TradePublisher)
+	}
+	var err error
+	if ec.MockPriceSeeds != "" {
+		if cfg.PriceSeeds, err = matching.ParsePriceSeeds(ec.MockPriceSeeds); err != nil {
+			return matching.Config{}, fmt.Errorf("MOCK_PRICE_SEEDS: %w", err)
+		}
+	}
+	if ec.MockPriceBands != "" {
+		if cfg.PriceBands, err = matching.ParsePriceBands(ec.MockPriceBands); err != nil {
+			return matching.Config{}, fmt.Errorf("MOCK_PRICE_BANDS: %w", err)
+		}
+	}
+	// Apply to a scratch engine so a bad policy or mode fails at load, not
+	// half way through boot.
+	if err := matching.NewEngine("", "", nil, nil).Configure(cfg); err != nil {
+		return matching.Config{}, err
+	}
+	return cfg, nil
+}
+
+// SettleConfigured reports whether liquidations have somewhere to settle:
+// on-chain with ADMIN_SECRET, or an explicit SETTLE_URL. Without either they
+// would POST unauthenticated to the frontend default and fail every time, so
+// the engine runs detect-only unless SETTLE_FORCE_ENABLE.
+func (c Config) SettleConfigured() bool {
+	return c.Server.AdminSecret != "" || c.Engine.SettleURL != "" || c.Engine.SettleForceEnable
+}
+
+// SettleURL is where HTTP settlement POSTs go.
+func (c Config) SettleURL() string {
+	if c.Engine.SettleURL != "" {
+		return c.Engine.SettleURL
+	}
+	return c.Server.FrontendURL + "/api/admin/settle"
+}
+
+// SymbolConfigs is the engine's tradable markets: Symbols, each with its
+// SYMBOL_MIN_NOTIONAL (MIN_ORDER_NOTIONAL when it has none) and its
+// SYMBOL_MAX_LEVERAGE cap, if any.
+func (c Config) SymbolConfigs() ([]matching.SymbolConfig, error) {
+	caps, err := matching.ParseLeverageCaps(c.Engine.SymbolMaxLeverage)
+	if err != nil {
+		return nil, fmt.Errorf("SYMBOL_MAX_LEVERAGE: %w", err)
+	}
+	minimums, err := matching.ParseMinNotionals(c.Engine.SymbolMinNotional)
+	if err != nil {
+		return nil, fmt.Errorf("SYMBOL_MIN_NOTIONAL: %w", err)
+	}
+	symbols := c.Symbols()
+	out := make([]matching.SymbolConfig, len(symbols))
+	for i, sym := range symbols {
+		out[i] = matching.NewSymbolConfig(sym)
+		out[i].MinNotional = c.Engine.MinOrderNotional
+		if m, ok := minimums[out[i].Symbol]; ok {
+			out[i].MinNotional = m
+		}
+		out[i].MaxLeverage = caps[out[i].Symbol]
+	}
+	return out, nil
+}
+
+// Symbols is the engine's tradable allowlist: TRADABLE_SYMBOLS, or the pairs
+// the order-book watcher monitors.
+func (c Config) Symbols() []string {
+	if c.Engine.TradableSymbols == "" {
+		return watcher.MonitoredSymbols()
+	}
+	var out []string
+	for _, sym := range strings.Split(c.Engine.TradableSymbols, ",") {
+		if sym = strings.TrimSpace(sym); sym != "" {
+			out = append(out, sym)
+		}
+	}
+	return out
+}
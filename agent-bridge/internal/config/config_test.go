@@ -0,0 +1,168 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envMap(m map[string]string) func(string) string {
+	return func(key string) string { return m[key] }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("", envMap(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != "8090" || cfg.Store.DefaultPair != "XLM/USDC" {
+		t.Fatalf("defaults not applied: %+v", cfg.Server)
+	}
+	if cfg.SettleConfigured() {
+		t.Fatal("no secret or SETTLE_URL should leave settlement unconfigured")
+	}
+	ec, err := cfg.EngineConfig()
+	if err != nil || !ec.Liquidation.DetectOnly {
+		t.Fatalf("EngineConfig = %+v, %v; want detect-only", ec.Liquidation, err)
+	}
+}
+
+func TestLoadFileThenEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.json")
+	file := `{
+		"server": {"port": "9000", "frontendUrl": "https://app.example"},
+		"store": {"maxSubscribersPerToken": 3, "defaultPair": "xlm/usdc"},
+		"watcher": {"pollMainnetSec": 20},
+		"engine": {"mockPriceSeeds": "XLM/USDC=0.1"}
+	}`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path, envMap(map[string]string{
+		"PORT":             "9100",
+		"OB_POLL_ADAPTIVE": "true",
+		"SETTLE_URL":       "https://settle.example/hook",
+	}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != "9100" {
+		t.Fatalf("port %q, want the env value 9100", cfg.Server.Port)
+	}
+	if cfg.Server.FrontendURL != "https://app.example" {
+		t.Fatalf("frontend %q, want the file value", cfg.Server.FrontendURL)
+	}
+	sc, _ := cfg.StoreConfig()
+	if sc.MaxSubscribers != 3 || sc.DefaultPair != "XLM/USDC" {
+		t.Fatalf("store config %+v", sc)
+	}
+	wc := cfg.WatcherConfig()
+	if wc.PollIntervals["MAINNET"] != 20*time.Second || !wc.AdaptivePolling {
+		t.Fatalf("watcher config %+v", wc)
+	}
+	ec, _ := cfg.EngineConfig()
+	if ec.PriceSeeds["XLM/USDC"] != 0.1 || ec.Liquidation.DetectOnly {
+		t.Fatalf("engine config seeds=%v detectOnly=%v", ec.PriceSeeds, ec.Liquidation.DetectOnly)
+	}
+	if got := cfg.SettleURL(); got != "https://settle.example/hook" {
+		t.Fatalf("SettleURL %q", got)
+	}
+}
+
+func TestLoadRejectsUnknownFileKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.json")
+	if err := os.WriteFile(path, []byte(`{"server": {"prot": "9000"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, envMap(nil)); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Fatalf("err = %v, want unknown field", err)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	_, err := Load("", envMap(map[string]string{
+		"PORT":                   "http",
+		"TLS_CERT":               "cert.pem",
+		"SIGNAL_TRADING_ENABLED": "true",
+		"BOOK_DEPTH_POLICY":      "shuffle",
+	}))
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	for _, want := range []string{"PORT", "TLS_KEY", "SIGNAL_WEBHOOKS", "shuffle"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestLoadRejectsUnparseableEnv(t *testing.T) {
+	_, err := Load("", envMap(map[string]string{"MAX_ORDERS_PER_TOKEN": "lots"}))
+	if err == nil || !strings.Contains(err.Error(), "MAX_ORDERS_PER_TOKEN") {
+		t.Fatalf("err = %v, want MAX_ORDERS_PER_TOKEN parse error", err)
+	}
+}
+
+func TestLoadSymbolMinNotional(t *testing.T) {
+	cfg, err := Load("", envMap(map[string]string{
+		"TRADABLE_SYMBOLS":    "XLM/USDC,BTC/USDC",
+		"MIN_ORDER_NOTIONAL":  "1",
+		"SYMBOL_MIN_NOTIONAL": "BTC/USDC:25",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols, _ := cfg.SymbolConfigs()
+	got := map[string]float64{}
+	for _, sc := range symbols {
+		got[sc.Symbol] = sc.MinNotional
+	}
+	if got["BTC/USDC"] != 25 || got["XLM/USDC"] != 1 {
+		t.Fatalf("minimums = %v, want BTC/USDC overridden to 25 and XLM/USDC on the global 1", got)
+	}
+	if _, err := Load("", envMap(map[string]string{"SYMBOL_MIN_NOTIONAL": "BTC/USDC=-1"})); err == nil || !strings.Contains(err.Error(), "SYMBOL_MIN_NOTIONAL") {
+		t.Fatalf("err = %v, want a negative minimum refused", err)
+	}
+}
+
+func TestLoadInsightCooldownOverride(t *testing.T) {
+	cfg, err := Load("", envMap(map[string]string{"INSIGHT_COOLDOWN_OVERRIDE": "1.5"}))
+	if err != nil || cfg.Store.InsightCooldownOverride != 1.5 {
+		t.Fatalf("Load = %v, %v; want override 1.5", cfg.Store.InsightCooldownOverride, err)
+	}
+	if sc, _ := cfg.StoreConfig(); sc.InsightOverride != 1.5 {
+		t.Errorf("store override = %v, want 1.5", sc.InsightOverride)
+	}
+	if _, err := Load("", envMap(map[string]string{"INSIGHT_COOLDOWN_OVERRIDE": "1"})); err == nil || !strings.Contains(err.Error(), "INSIGHT_COOLDOWN_OVERRIDE") {
+		t.Fatalf("err = %v, want an override of 1 refused", err)
+	}
+}
+
+func TestLoadAdminPort(t *testing.T) {
+	cfg, err := Load("", envMap(map[string]string{"ADMIN_PORT": "9091"}))
+	if err != nil || cfg.Server.AdminPort != "9091" {
+		t.Fatalf("Load = %+v, %v; want admin port 9091", cfg.Server, err)
+	}
+	if _, err := Load("", envMap(map[string]string{"ADMIN_PORT": "8090"})); err == nil || !strings.Contains(err.Error(), "ADMIN_PORT must differ") {
+		t.Fatalf("err = %v, want ADMIN_PORT clash with PORT", err)
+	}
+}
+
+func TestLoadAdminPortWithAutocert(t *testing.T) {
+	env := map[string]string{"ADMIN_PORT": "9091", "AUTOCERT_DOMAINS": "bridge.example.com"}
+	if _, err := Load("", envMap(env)); err == nil || !strings.Contains(err.Error(), "ADMIN_TLS_CERT") {
+		t.Fatalf("err = %v, want the plain-HTTP admin listener refused", err)
+	}
+	env["ADMIN_TLS_CERT"], env["ADMIN_TLS_KEY"] = "admin.pem", "admin-key.pem"
+	cfg, err := Load("", envMap(env))
+	if err != nil || cfg.Server.AdminTLSCert != "admin.pem" {
+		t.Fatalf("Load = %+v, %v; want the admin certificate accepted", cfg.Server, err)
+	}
+	delete(env, "ADMIN_TLS_KEY")
+	if _, err := Load("", envMap(env)); err == nil || !strings.Contains(err.Error(), "must be set together") {
+		t.Fatalf("err = %v, want half an admin key pair refused", err)
+	}
+}
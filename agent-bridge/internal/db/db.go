@@ -72,11 +72,11 @@ type Session struct {
 	CreatedAt  time.Time
 }
 
-// InsertSession creates a new session row.
-func (d *DB) InsertSession(token string) error {
+// InsertSession creates a new session row starting on network and pair.
+func (d *DB) InsertSession(token, network, pair string) error {
 	_, err := d.sql.Exec(
-		`INSERT OR IGNORE INTO sessions (token, created_at) VALUES (?, ?)`,
-		token, time.Now().Unix(),
+		`INSERT OR IGNORE INTO sessions (token, network, active_pair, created_at) VALUES (?, ?, ?, ?)`,
+		token, network, pair, time.Now().Unix(),
 	)
 	return err
 }
@@ -99,6 +99,12 @@ func (d *DB) UpdateSessionPair(token, pair, network string) error {
 	return err
 }
 
+// DeleteSession removes a session row by token.
+func (d *DB) DeleteSession(token string) error {
+	_, err := d.sql.Exec(`DELETE FROM sessions WHERE token=?`, token)
+	return err
+}
+
 // AllSessions returns all persisted sessions.
 func (d *DB) AllSessions() ([]Session, error) {
 	rows, err := d.sql.Query(
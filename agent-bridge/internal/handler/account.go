@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"agent-bridge/internal/middleware"
+	"agent-bridge/internal/store"
+	"agent-bridge/internal/watcher"
+)
+
+// Where each part of an account summary came from.
+const (
+	sourceCache       = "cache"       // the watcher's last poll, kept in the store
+	sourceHorizon     = "horizon"     // fetched live for this request
+	sourceUnavailable = "unavailable" // not cached and the live fetch failed
+)
+
+// accountSummary is the GET /api/account/summary body: the context
+// snapshot's account fields, each part filled from the cache or Horizon.
+type accountSummary struct {
+	AccountID    string                  `json:"account_id"`
+	Network      string                  `json:"network"`
+	Balances     []store.BalanceRecord   `json:"balances"`
+	Trustlines   []store.TrustlineRecord `json:"trustlines"`
+	OpenOffers   []store.OfferRecord     `json:"open_offers"`
+	RecentTrades []store.TradeRecord     `json:"recent_trades"`
+	Sources      map[string]string       `json:"sources"` // part -> cache | horizon | unavailable
+}
+
+// fetchAccount is watcher.FetchAccount; tests replace it.
+var fetchAccount = watcher.FetchAccount
+
+// Summary handles GET /api/account/summary — the paired account's
+// balances, trustlines, open offers and recent trades in one call. Parts
+// the watcher has polled are served from the store, even when empty; the
+// rest, and always the recent trades, are fetched from Horizon, so the
+// first call after pairing still answers in full.
+func (h *ContextHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	token := middleware.ConnectionFrom(r.Context()).Token
+	snap := h.Store.GetContextSnapshot(token)
+	if snap == nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "context not found")
+		return
+	}
+	if snap.AccountID == "" {
+		writeJSONError(w, http.StatusUnauthorized, "no_account", "no Stellar address registered for this token — POST /api/context first")
+		return
+	}
+
+	sum := accountSummary{
+		AccountID:    snap.AccountID,
+		Network:      snap.Network,
+		Balances:     snap.Balances,
+		Trustlines:   snap.Trustlines,
+		OpenOffers:   snap.OpenOffers,
+		RecentTrades: snap.RecentTrades,
+		Sources:      map[string]string{"holdings": sourceCache, "open_offers": sourceCache, "recent_trades": sourceCache},
+	}
+	// The store only hears of trades one at a time, never as a full list,
+	// so they are always read live.
+	parts := watcher.AccountParts{
+		Holdings: snap.Polled.Holdings.IsZero(),
+		Offers:   snap.Polled.Offers.IsZero(),
+		Trades:   true,
+	}
+	if parts.Holdings || parts.Offers || parts.Trades {
+		live, err := fetchAccount(r.Context(), snap.AccountID, snap.Network, parts)
+		if err != nil {
+			log.Printf("[account] summary for %s on %s: %v", snap.AccountID, snap.Network, err)
+		}
+		if parts.Holdings {
+			sum.Sources["holdings"] = liveSource(live.Balances != nil)
+			if live.Balances != nil {
+				sum.Balances, sum.Trustlines = live.Balances, live.Trustlines
+			}
+		}
+		if parts.Offers {
+			sum.Sources["open_offers"] = liveSource(live.OpenOffers != nil)
+			if live.OpenOffers != nil {
+				sum.OpenOffers = live.OpenOffers
+			}
+		}
+		if parts.Trades {
+			sum.Sources["recent_trades"] = liveSource(live.RecentTrades != nil)
+			if live.RecentTrades != nil {
+				sum.RecentTrades = live.RecentTrades
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sum)
+}
+
+func liveSource(fetched bool) string {
+	if fetched {
+		return sourceHorizon
+	}
+	return sourceUnavailable
+}
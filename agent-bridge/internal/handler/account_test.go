@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agent-bridge/internal/middleware"
+	"agent-bridge/internal/store"
+	"agent-bridge/internal/watcher"
+)
+
+func TestAccountSummary(t *testing.T) {
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := middleware.RequireToken(s, http.HandlerFunc((&ContextHandler{Store: s}).Summary))
+	get := func() (int, accountSummary) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/account/summary?token="+token, nil))
+		var sum accountSummary
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&sum); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, sum
+	}
+
+	if code, _ := get(); code != http.StatusUnauthorized {
+		t.Fatalf("unpaired token: %d, want 401", code)
+	}
+
+	var asked watcher.AccountParts
+	prev := fetchAccount
+	fetchAccount = func(_ context.Context, accountID, network string, parts watcher.AccountParts) (watcher.AccountState, error) {
+		asked = parts
+		return watcher.AccountState{
+			OpenOffers: []store.OfferRecord{{ID: "7", Selling: "XLM", Buying: "USDC"}},
+		}, errors.New("trades: horizon down")
+	}
+	t.Cleanup(func() { fetchAccount = prev })
+
+	if err := s.SetAccountWatch(token, "GABC", "TESTNET", func() {}); err != nil {
+		t.Fatal(err)
+	}
+	s.SetHoldings(token, "GABC", []store.BalanceRecord{{Asset: "XLM", Balance: "100"}}, []store.TrustlineRecord{})
+
+	code, sum := get()
+	if code != http.StatusOK {
+		t.Fatalf("summary: %d", code)
+	}
+	if asked.Holdings || !asked.Offers || !asked.Trades {
+		t.Errorf("fetched %+v, want only the uncached offers and trades", asked)
+	}
+	if sum.AccountID != "GABC" || len(sum.Balances) != 1 || len(sum.OpenOffers) != 1 {
+		t.Errorf("summary = %+v", sum)
+	}
+	want := map[string]string{"holdings": "cache", "open_offers": "horizon", "recent_trades": "unavailable"}
+	for part, src := range want {
+		if sum.Sources[part] != src {
+			t.Errorf("source of %s = %q, want %q", part, sum.Sources[part], src)
+		}
+	}
+
+	// An unfunded account polls back empty; that is still a cached answer.
+	s.SetHoldings(token, "GABC", []store.BalanceRecord{}, []store.TrustlineRecord{})
+	if _, sum = get(); asked.Holdings || sum.Sources["holdings"] != "cache" || len(sum.Balances) != 0 {
+		t.Errorf("empty polled holdings refetched: asked %+v, summary %+v", asked, sum)
+	}
+
+	// A new account's holdings haven't been polled, however they read.
+	if err := s.SetAccountWatch(token, "GDEF", "TESTNET", func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if get(); !asked.Holdings {
+		t.Errorf("holdings of a new account served from the cache")
+	}
+}
@@ -2,20 +2,44 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
-	"os"
 
+	"agent-bridge/internal/matching"
 	"agent-bridge/internal/soroban"
+	"agent-bridge/internal/store"
+	"agent-bridge/internal/watcher"
 )
 
 // AdminHandler exposes admin-only contract-controller endpoints.
 // Every request must carry the correct Bearer token (ADMIN_SECRET env var).
 //
 //	POST /api/admin/settle          — call AgentVault.settle_pnl
+//	GET  /api/admin/settle/preview  — the settle request a liquidation would send now
 //	POST /api/admin/position        — call LeveragePool.open_synthetic_position
 //	POST /api/admin/position/close  — call LeveragePool.close_position
+//	POST /api/position/margin       — add/remove collateral on a monitored position
+//	GET  /api/admin/connections     — paginated session listing
+//	GET  /api/admin/positions       — paginated liquidation-monitored positions
+//	GET  /api/admin/insight-state   — order-book watcher baselines and last insights
+//	DELETE /api/admin/insight-state — reset them (?network=&symbol= to narrow)
+//	GET  /api/admin/settle-dlq      — liquidations whose settlement failed
+//	POST /api/admin/settle-dlq/retry — replay one of them by nonce
+//	POST /api/admin/orders/clear    — cancel every resting order on a symbol
+//	GET  /api/admin/engine/stats    — book sizes, order/fill counts, match latency
+//	POST /api/admin/prices/pause    — stop the mock price drift
+//	POST /api/admin/prices/resume   — restart it
 type AdminHandler struct {
-	Soroban *soroban.Client
+	Soroban   *soroban.Client
+	Engine    *matching.Engine
+	Store     *store.Store
+	Insights  *watcher.InsightState
+	SettleDLQ *matching.SettleDLQ
+	// AdminSecret is the Bearer token every admin route requires; empty =
+	// development mode.
+	AdminSecret string
 }
 
 // ── Settle PnL ───────────────────────────────────────────────────────────────
@@ -29,29 +53,52 @@ type settleRequest struct {
 	PnL float64 `json:"pnl"`
 	// TokenAddr is the C... contract address of the settlement token.
 	TokenAddr string `json:"tokenAddr"`
+	// Nonce, when set, makes the call idempotent: a settlement already
+	// applied with the same nonce is answered 200 without settling again.
+	Nonce string `json:"nonce,omitempty"`
 }
 
 func (h *AdminHandler) Settle(w http.ResponseWriter, r *http.Request) {
 	if !h.authed(r) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
 		return
 	}
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
 
 	var req settleRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserAddr == "" || req.TokenAddr == "" {
-		http.Error(w, "userAddr, pnl, tokenAddr are required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "userAddr, pnl, tokenAddr are required")
 		return
 	}
 
+	if req.Nonce != "" && h.SettleDLQ != nil {
+		switch err := h.SettleDLQ.BeginSettle(req.Nonce); {
+		case errors.Is(err, matching.ErrAlreadySettled):
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "duplicate": true})
+			return
+		case err != nil:
+			writeJSONError(w, http.StatusConflict, "conflict", err.Error())
+			return
+		}
+	}
+
 	// Scale the float PnL to 7-decimal int64.
 	pnlScaled := int64(req.PnL * float64(soroban.ScaleFactor))
 
-	if err := h.Soroban.SettleTrade(r.Context(), req.UserAddr, pnlScaled, req.TokenAddr); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	settleErr := h.Soroban.SettleTrade(r.Context(), req.UserAddr, pnlScaled, req.TokenAddr)
+	if req.Nonce != "" && h.SettleDLQ != nil {
+		if err := h.SettleDLQ.EndSettle(req.Nonce, settleErr); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal_error",
+				matching.ErrSettledNotRecorded.Error()+": "+err.Error())
+			return
+		}
+	}
+	if settleErr != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", settleErr.Error())
 		return
 	}
 
@@ -59,6 +106,44 @@ func (h *AdminHandler) Settle(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
 }
 
+// ── Settlement preview ───────────────────────────────────────────────────────
+
+// SettlePreview shows the settle request the engine would POST if the
+// position of ?token= in ?symbol= were liquidated at the current mark price,
+// without sending it — for debugging the settlement integration.
+func (h *AdminHandler) SettlePreview(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	fields := fieldErrors{}
+	if q.Get("token") == "" {
+		fields.add("token", "missing")
+	}
+	fields.symbol("symbol", q.Get("symbol"))
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+	symbol, _ := matching.NormalizeSymbol(q.Get("symbol"))
+
+	preview, err := h.Engine.PreviewSettle(q.Get("token"), symbol)
+	if errors.Is(err, matching.ErrNoPosition) {
+		writeJSONError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusConflict, "no_mark_price", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
 // ── Open Synthetic Position ───────────────────────────────────────────────────
 
 type openPositionRequest struct {
@@ -73,19 +158,19 @@ type openPositionRequest struct {
 
 func (h *AdminHandler) OpenPosition(w http.ResponseWriter, r *http.Request) {
 	if !h.authed(r) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
 		return
 	}
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
 
 	var req openPositionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil ||
 		req.User == "" || req.AssetSymbol == "" || req.CollateralToken == "" {
-		http.Error(w, "user, assetSymbol, debtAmount, collateralToken, collateralLocked are required",
-			http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "bad_request",
+			"user, assetSymbol, debtAmount, collateralToken, collateralLocked are required")
 		return
 	}
 
@@ -100,7 +185,7 @@ func (h *AdminHandler) OpenPosition(w http.ResponseWriter, r *http.Request) {
 		req.CollateralToken,
 		collScaled,
 	); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
 		return
 	}
 
@@ -118,22 +203,22 @@ type closePositionRequest struct {
 
 func (h *AdminHandler) ClosePosition(w http.ResponseWriter, r *http.Request) {
 	if !h.authed(r) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
 		return
 	}
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
 
 	var req closePositionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.User == "" || req.CollateralToken == "" {
-		http.Error(w, "user and collateralToken are required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "user and collateralToken are required")
 		return
 	}
 
 	if err := h.Soroban.ClosePosition(r.Context(), req.User, req.CollateralToken, req.ClosePrice); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
 		return
 	}
 
@@ -141,12 +226,437 @@ func (h *AdminHandler) ClosePosition(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
 }
 
+// ── Margin adjustment ────────────────────────────────────────────────────────
+
+type marginRequest struct {
+	Token            string  `json:"token"`            // session token owning the position
+	Symbol           string  `json:"symbol"`           // e.g. "XLM/USDC"
+	AddCollateral    float64 `json:"addCollateral"`    // USDC to add
+	RemoveCollateral float64 `json:"removeCollateral"` // USDC to withdraw
+}
+
+type marginResponse struct {
+	OK                  bool    `json:"ok"`
+	Collateral          float64 `json:"collateral"`
+	MarkPrice           float64 `json:"markPrice"`
+	LiquidationPrice    float64 `json:"liquidationPrice"`
+	LiquidationDistance float64 `json:"liquidationDistance"` // |mark − liq| / mark
+}
+
+// Margin tops up (or withdraws) collateral on a position the liquidation
+// engine is monitoring. It only updates the engine's view: the matching
+// on-chain deposit or withdrawal is made separately.
+func (h *AdminHandler) Margin(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+
+	var req marginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Symbol == "" {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "token and symbol are required")
+		return
+	}
+	if req.AddCollateral < 0 || req.RemoveCollateral < 0 ||
+		(req.AddCollateral > 0) == (req.RemoveCollateral > 0) {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "exactly one of addCollateral or removeCollateral must be positive")
+		return
+	}
+	symbol, err := matching.NormalizeSymbol(req.Symbol)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	mark := h.Engine.Prices.GetMarkPrice(symbol)
+	pos, err := h.Engine.Liquidation.AdjustCollateral(req.Token, symbol, req.AddCollateral-req.RemoveCollateral, mark)
+	switch {
+	case errors.Is(err, matching.ErrNoPosition):
+		writeJSONError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	case errors.Is(err, matching.ErrMaintenanceMargin):
+		writeJSONError(w, http.StatusConflict, "conflict", err.Error())
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	resp := marginResponse{
+		OK:               true,
+		Collateral:       pos.CollateralAmount,
+		MarkPrice:        mark,
+		LiquidationPrice: pos.LiquidationPrice(),
+	}
+	if mark > 0 {
+		resp.LiquidationDistance = math.Abs(mark-resp.LiquidationPrice) / mark
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ── Listings ─────────────────────────────────────────────────────────────────
+//
+// Both listings take ?limit=&cursor= and return {"items": [...], "nextCursor"}
+// with nextCursor omitted on the last page.
+
+type connectionsPage struct {
+	Items      []store.ConnectionInfo `json:"items"`
+	NextCursor string                 `json:"nextCursor,omitempty"`
+}
+
+// Connections lists sessions oldest first.
+func (h *AdminHandler) Connections(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	limit, after, err := pageParams(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	key := func(c store.ConnectionInfo) string {
+		return fmt.Sprintf("%020d\x00%s", c.CreatedAt.UnixNano(), c.Token)
+	}
+	items, next := paginate(h.Store.ListConnections(), key, limit, after)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(connectionsPage{Items: items, NextCursor: next})
+}
+
+type positionsPage struct {
+	Items      []matching.OpenPosition `json:"items"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
+}
+
+// Positions lists liquidation-monitored positions by token then symbol.
+func (h *AdminHandler) Positions(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	limit, after, err := pageParams(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	key := func(p matching.OpenPosition) string { return p.UserToken + "\x00" + p.Symbol }
+	items, next := paginate(h.Engine.Liquidation.AllPositions(), key, limit, after)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(positionsPage{Items: items, NextCursor: next})
+}
+
+// OpenInterest reports, per symbol, the total notional of open long and
+// short positions in the liquidation engine and how many there are of each.
+func (h *AdminHandler) OpenInterest(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Engine.Liquidation.OpenInterest())
+}
+
+// ── Liquidation check ───────────────────────────────────────────────────────
+
+// CheckLiquidations runs one liquidation sweep now instead of waiting for the
+// next tick, for tests and debugging, and lists the positions it liquidated
+// as "token:symbol". The sweep counts towards each breach's grace period.
+func (h *AdminHandler) CheckLiquidations(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	liquidated := h.Engine.Liquidation.CheckOnce(r.Context())
+	if liquidated == nil {
+		liquidated = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":         true,
+		"liquidated": liquidated,
+		"detectOnly": h.Engine.Liquidation.DetectOnly(),
+	})
+}
+
+// ── Settlement dead letters ──────────────────────────────────────────────────
+
+// SettleDeadLetters lists liquidations that were decided but never settled on-chain,
+// oldest first, for an operator to replay.
+func (h *AdminHandler) SettleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.SettleDLQ.List())
+}
+
+// RetrySettlement replays one dead-lettered settlement, {"nonce": "..."},
+// through the engine's settle func. On success it leaves the queue; a second
+// retry of the same nonce answers 200 with "duplicate" rather than settling
+// twice.
+func (h *AdminHandler) RetrySettlement(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req struct {
+		Nonce string `json:"nonce"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Nonce == "" {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "nonce is required")
+		return
+	}
+
+	entry, err := h.Engine.Liquidation.RetrySettlement(r.Context(), req.Nonce)
+	switch {
+	case errors.Is(err, matching.ErrAlreadySettled):
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "duplicate": true})
+		return
+	case errors.Is(err, matching.ErrSettledNotRecorded):
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	case errors.Is(err, matching.ErrDeadLetterNotFound):
+		writeJSONError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	case errors.Is(err, matching.ErrDeadLetterBusy):
+		writeJSONError(w, http.StatusConflict, "conflict", err.Error())
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusBadGateway, "bad_gateway", "settle failed again: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "settlement": entry})
+}
+
+// ── Price circuit breakers ───────────────────────────────────────────────────
+
+// PriceBreakers lists the symbols whose price circuit breaker has tripped,
+// pausing their liquidations. DELETE ?symbol= confirms the current mark price
+// and resumes that symbol.
+func (h *AdminHandler) PriceBreakers(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.Engine.Prices.Breakers())
+	case http.MethodDelete:
+		symbol, err := matching.NormalizeSymbol(r.URL.Query().Get("symbol"))
+		if err != nil {
+			writeValidationError(w, fieldErrors{"symbol": err.Error()})
+			return
+		}
+		if !h.Engine.Prices.ResumeSymbol(symbol) {
+			writeJSONError(w, http.StatusNotFound, "not_found", "no tripped breaker for "+symbol)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":        true,
+			"symbol":    symbol,
+			"markPrice": h.Engine.Prices.GetMarkPrice(symbol),
+		})
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	}
+}
+
+// ── Mock price feed ──────────────────────────────────────────────────────────
+
+// PausePrices stops the mock feed's random drift so prices only move on
+// explicit updates, making liquidation and insight scenarios reproducible.
+func (h *AdminHandler) PausePrices(w http.ResponseWriter, r *http.Request) {
+	h.setMockPaused(w, r, true)
+}
+
+// ResumePrices restarts the mock feed's drift.
+func (h *AdminHandler) ResumePrices(w http.ResponseWriter, r *http.Request) {
+	h.setMockPaused(w, r, false)
+}
+
+func (h *AdminHandler) setMockPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	changed := h.Engine.Prices.SetMockPaused(paused)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "paused": paused, "changed": changed})
+}
+
+// ── Agent disconnect ─────────────────────────────────────────────────────────
+
+type agentDisconnectRequest struct {
+	Token string `json:"token"`
+}
+
+// DisconnectAgent kicks a token's agent without revoking the token: its SSE
+// streams are closed (with a reconnect frame) and its next request counts as
+// a fresh "Agent connected". Positions, context and account watch survive.
+func (h *AdminHandler) DisconnectAgent(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+
+	var req agentDisconnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "invalid json")
+		return
+	}
+	if req.Token == "" {
+		writeValidationError(w, fieldErrors{"token": "missing"})
+		return
+	}
+
+	closed, ok := h.Store.ResetAgent(req.Token)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "not_found", "unknown token")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "token": req.Token, "streamsClosed": closed})
+}
+
+// ── Clear order book ─────────────────────────────────────────────────────────
+
+type clearBookRequest struct {
+	Symbol string `json:"symbol"`
+}
+
+// ClearBook cancels every resting order on a symbol's book, notifying each
+// owner, and reports how many were removed.
+func (h *AdminHandler) ClearBook(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+
+	var req clearBookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "invalid json")
+		return
+	}
+	fields := fieldErrors{}
+	fields.symbol("symbol", req.Symbol)
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+	symbol, _ := matching.NormalizeSymbol(req.Symbol)
+
+	removed, err := h.Engine.ClearBook(symbol)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "symbol": symbol, "cleared": len(removed)})
+}
+
+// ── Engine stats ─────────────────────────────────────────────────────────────
+
+// EngineStats reports each book's size and how many orders and fills it has
+// processed, with the time orders spend matching under the book lock.
+func (h *AdminHandler) EngineStats(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Engine.Stats())
+}
+
+// ── Insight state ────────────────────────────────────────────────────────────
+
+// InsightState shows what each order-book pair is compared against, and the
+// last insight it fired, for debugging why an insight did or didn't fire.
+// DELETE clears the baselines so the next poll starts fresh without firing.
+func (h *AdminHandler) InsightState(w http.ResponseWriter, r *http.Request) {
+	if !h.authed(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.Insights.Snapshot())
+	case http.MethodDelete:
+		q := r.URL.Query()
+		symbol := q.Get("symbol")
+		if symbol != "" {
+			var err error
+			if symbol, err = matching.NormalizeSymbol(symbol); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+				return
+			}
+		}
+		n := h.Insights.Reset(q.Get("network"), symbol)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"reset": n})
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	}
+}
+
 // ── auth helper ───────────────────────────────────────────────────────────────
 
 func (h *AdminHandler) authed(r *http.Request) bool {
-	secret := os.Getenv("ADMIN_SECRET")
+	secret := h.AdminSecret
 	if secret == "" {
 		return true // no secret set — development mode only
 	}
-	return r.Header.Get("Authorization") == "Bearer "+secret
+	return adminBearer(r, secret)
 }
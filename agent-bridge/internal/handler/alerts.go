@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"agent-bridge/internal/matching"
+	"agent-bridge/internal/middleware"
+	"agent-bridge/internal/store"
+)
+
+// AlertsHandler manages per-token price alerts.
+// POST   /api/alerts — {"token","symbol","condition":"above|below","price","repeat"}
+// GET    /api/alerts?token=... — list the token's alerts
+// DELETE /api/alerts?token=...&id=... — remove one
+type AlertsHandler struct {
+	Store *store.Store
+}
+
+type createAlertRequest struct {
+	Symbol    string  `json:"symbol"`
+	Condition string  `json:"condition"`
+	Price     float64 `json:"price"`
+	Repeat    bool    `json:"repeat"` // re-arm after the price crosses back instead of firing once
+}
+
+func (h *AlertsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	token := middleware.ConnectionFrom(r.Context()).Token
+	switch r.Method {
+	case http.MethodPost:
+		h.create(w, r, token)
+	case http.MethodGet:
+		alerts, err := h.Store.Alerts(token)
+		if err != nil {
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alerts)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeJSONError(w, http.StatusBadRequest, "bad_request", "id is required")
+			return
+		}
+		found, err := h.Store.RemoveAlert(token, id)
+		if err != nil {
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+			return
+		}
+		if !found {
+			writeJSONError(w, http.StatusNotFound, "not_found", "alert not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	}
+}
+
+func (h *AlertsHandler) create(w http.ResponseWriter, r *http.Request, token string) {
+	var req createAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "bad request body")
+		return
+	}
+	symbol, err := matching.NormalizeSymbol(req.Symbol)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	alert, err := h.Store.AddAlert(token, store.PriceAlert{
+		Symbol:    symbol,
+		Condition: req.Condition,
+		Price:     req.Price,
+		Repeat:    req.Repeat,
+	})
+	switch {
+	case errors.Is(err, store.ErrUnknownToken):
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	case errors.Is(err, store.ErrAlertLimit):
+		writeJSONError(w, http.StatusTooManyRequests, "rate_limited", err.Error())
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(alert)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker states.
+const (
+	BreakerClosed   = "closed"    // requests flow
+	BreakerOpen     = "open"      // fast-failing until the cooldown ends
+	BreakerHalfOpen = "half-open" // one probe request is deciding
+)
+
+// Breaker is a consecutive-failure circuit breaker for the frontend proxy.
+// After Threshold failures in a row it opens and refuses requests for
+// Cooldown; the first request after that is let through as a probe, and its
+// outcome closes the circuit or re-opens it for another cooldown.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	now      func() time.Time // time.Now; replaced in tests
+}
+
+// NewBreaker returns a closed breaker. threshold < 1 is treated as 1.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: max(threshold, 1), Cooldown: cooldown, state: BreakerClosed, now: time.Now}
+}
+
+// Allow reports whether a request may go upstream. Once the cooldown has
+// passed it admits exactly one probe until Success or Failure is recorded.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		return false // the probe is still in flight
+	default:
+		return true
+	}
+}
+
+// Success records a healthy upstream response and closes the circuit.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures = BreakerClosed, 0
+}
+
+// Failure records an upstream failure, opening the circuit on the
+// Threshold-th in a row or when a probe fails.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.Threshold {
+		b.state, b.openedAt = BreakerOpen, b.now()
+	}
+}
+
+// Release records an attempt with no verdict (the caller went away). A probe
+// in flight is returned so the next request probes again.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+	}
+}
+
+// BreakerStatus is the breaker as reported by /healthz.
+type BreakerStatus struct {
+	State    string    `json:"state"`
+	Failures int       `json:"consecutiveFailures"`
+	RetryAt  time.Time `json:"retryAt,omitzero"` // when an open circuit admits a probe
+}
+
+// Status returns a snapshot of the breaker.
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.state == BreakerOpen {
+		st.RetryAt = b.openedAt.Add(b.Cooldown)
+	}
+	return st
+}
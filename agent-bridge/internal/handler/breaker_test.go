@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-bridge/internal/middleware"
+	"agent-bridge/internal/store"
+)
+
+func TestBreakerOpensAndProbes(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBreaker(3, 30*time.Second)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		b.Failure()
+	}
+	if !b.Allow() {
+		t.Fatal("opened before the threshold")
+	}
+	b.Failure()
+	if b.Allow() || b.Status().State != BreakerOpen {
+		t.Fatalf("not open after 3 failures: %+v", b.Status())
+	}
+
+	now = now.Add(30 * time.Second)
+	if !b.Allow() {
+		t.Fatal("no probe after the cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("second request admitted while the probe is in flight")
+	}
+	b.Failure() // failed probe: straight back to open
+	if b.Allow() {
+		t.Fatal("failed probe did not re-open the circuit")
+	}
+
+	now = now.Add(30 * time.Second)
+	if !b.Allow() {
+		t.Fatal("no second probe")
+	}
+	b.Success()
+	if st := b.Status(); st.State != BreakerClosed || st.Failures != 0 || !b.Allow() {
+		t.Fatalf("successful probe did not close the circuit: %+v", st)
+	}
+}
+
+func TestProxyFastFailsWhileFrontendIsDown(t *testing.T) {
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	frontend.Close() // connection refused from here on
+
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := NewBreaker(2, time.Minute)
+	h := &ProxyHandler{Store: s, FrontendURL: frontend.URL, Allowed: BridgeAllowlist(), Breaker: br}
+	srv := middleware.RequireToken(s, http.HandlerFunc(h.Handle))
+
+	get := func() int {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/bridge/pairs?token="+token, nil))
+		return rec.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := get(); code != http.StatusBadGateway {
+			t.Fatalf("request %d: status %d, want 502", i, code)
+		}
+	}
+	if code := get(); code != http.StatusServiceUnavailable {
+		t.Fatalf("open circuit: status %d, want 503", code)
+	}
+
+	rec := httptest.NewRecorder()
+	(&HealthHandler{Proxy: br}).Get(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if !strings.Contains(rec.Body.String(), `"state":"open"`) {
+		t.Fatalf("healthz = %s", rec.Body.String())
+	}
+}
+
+func TestProxyProbeAlwaysReportsBack(t *testing.T) {
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	br := NewBreaker(1, time.Minute)
+	br.now = func() time.Time { return now }
+	br.Failure()
+	now = now.Add(time.Minute)
+
+	// The probe fails before it is sent: the circuit must not stay half-open.
+	h := &ProxyHandler{Store: s, FrontendURL: "http://[::1", Allowed: BridgeAllowlist(), Breaker: br}
+	srv := middleware.RequireToken(s, http.HandlerFunc(h.Handle))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/bridge/pairs?token="+token, nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rec.Code)
+	}
+	if st := br.Status(); st.State != BreakerOpen || !br.Allow() {
+		t.Fatalf("unsent probe left the breaker %+v, want another probe admitted", st)
+	}
+}
+
+func TestProxyTimesOutHungFrontend(t *testing.T) {
+	release := make(chan struct{})
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer frontend.Close()
+	defer close(release)
+
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := NewBreaker(1, time.Minute)
+	h := &ProxyHandler{
+		Store: s, FrontendURL: frontend.URL, Allowed: BridgeAllowlist(), Breaker: br,
+		Client: &http.Client{Timeout: 50 * time.Millisecond},
+	}
+	srv := middleware.RequireToken(s, http.HandlerFunc(h.Handle))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/bridge/pairs?token="+token, nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want 502", rec.Code)
+	}
+	if st := br.Status(); st.State != BreakerOpen {
+		t.Fatalf("timeout not counted against the frontend: %+v", st)
+	}
+}
@@ -3,8 +3,12 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 
+	"agent-bridge/internal/middleware"
 	"agent-bridge/internal/store"
 	"agent-bridge/internal/watcher"
 )
@@ -13,10 +17,14 @@ import (
 // and registering account watchers.
 type ContextHandler struct {
 	Store *store.Store
+	// AdminSecret guards POST /api/context/batch, which names sessions by
+	// token; empty = development mode.
+	AdminSecret string
+	// StrictContentType refuses JSON bodies that carry no Content-Type.
+	StrictContentType bool
 }
 
 type contextUpdateRequest struct {
-	Token      string `json:"token"`
 	AccountID  string `json:"account_id"`
 	Network    string `json:"network"`    // "MAINNET" | "TESTNET"
 	ActivePair string `json:"active_pair"`
@@ -26,62 +34,328 @@ func (h *ContextHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
 		h.update(w, r)
+	case http.MethodPatch:
+		h.patch(w, r)
 	case http.MethodGet:
 		h.get(w, r)
 	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 	}
 }
 
 // POST /api/context — update active pair, network, and optionally start account watcher.
 func (h *ContextHandler) update(w http.ResponseWriter, r *http.Request) {
 	var req contextUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req, "invalid request body", h.StrictContentType) {
 		return
 	}
-	if !h.Store.ValidateToken(req.Token) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	token := middleware.ConnectionFrom(r.Context()).Token
+	if fail := h.apply(r.Context(), token, req); fail != nil {
+		fail.write(w)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// maxContextBatch caps the entries in one POST /api/context/batch.
+const maxContextBatch = 100
+
+type contextBatchEntry struct {
+	Token string `json:"token"`
+	contextUpdateRequest
+}
+
+// contextBatchResult is one entry's outcome; Status and Error are what
+// POST /api/context would have answered for it.
+type contextBatchResult struct {
+	Token  string       `json:"token"`
+	OK     bool         `json:"ok"`
+	Status int          `json:"status"`
+	Error  *errorDetail `json:"error,omitempty"`
+}
+
+// Batch handles POST /api/context/batch — the POST /api/context update for
+// each of several tokens, named in the entries rather than the query, so an
+// orchestrator can pair all its agents' sessions in one call. Entries are
+// applied in order and independently: one failing doesn't stop the rest.
+// It is an admin route: callers pass ADMIN_SECRET as a Bearer token, and an
+// entry whose token is missing or unknown fails validation like any other
+// bad field, so the results can't be used to probe for live sessions.
+func (h *ContextHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	if h.AdminSecret != "" && !adminBearer(r, h.AdminSecret) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	var entries []contextBatchEntry
+	if !decodeJSON(w, r, &entries, "invalid request body: want a JSON array of updates", h.StrictContentType) {
+		return
+	}
+	if len(entries) == 0 || len(entries) > maxContextBatch {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", fmt.Sprintf("a batch takes 1 to %d updates", maxContextBatch))
+		return
+	}
+
+	results := make([]contextBatchResult, len(entries))
+	failed := 0
+	for i, e := range entries {
+		var fail *contextError
+		fields := validateUpdate(e.contextUpdateRequest)
+		if e.Token == "" || !h.Store.Touch(e.Token) {
+			fields.add("token", "missing or not a live session")
+		}
+		if len(fields) > 0 {
+			fail = &contextError{http.StatusBadRequest, fields.detail()}
+		} else {
+			fail = h.apply(r.Context(), e.Token, e.contextUpdateRequest)
+		}
+		results[i] = contextBatchResult{Token: e.Token, OK: true, Status: http.StatusOK}
+		if fail != nil {
+			failed++
+			results[i].OK, results[i].Status, results[i].Error = false, fail.status, &fail.detail
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":   results,
+		"succeeded": len(entries) - failed,
+		"failed":    failed,
+	})
+}
+
+// contextError is a context update that could not be applied: the status to
+// answer with and the error body.
+type contextError struct {
+	status int
+	detail errorDetail
+}
+
+func newContextError(status int, code, message string) *contextError {
+	return &contextError{status, errorDetail{Code: code, Message: message}}
+}
+
+// write sends e as the response.
+func (e *contextError) write(w http.ResponseWriter) {
+	if e.detail.Code == "validation_failed" {
+		writeValidationError(w, e.detail.Fields)
+		return
+	}
+	writeJSONError(w, e.status, e.detail.Code, e.detail.Message)
+}
+
+// apply validates req and applies it to token's session: the view always,
+// then the account watcher when req names an account.
+func (h *ContextHandler) apply(ctx context.Context, token string, req contextUpdateRequest) *contextError {
+	if fields := validateUpdate(req); len(fields) > 0 {
+		return &contextError{http.StatusBadRequest, fields.detail()}
+	}
+
 	// Always update the stored view (pair / network).
-	h.Store.SetActiveView(req.Token, req.ActivePair, req.Network)
+	h.Store.SetActiveView(token, req.ActivePair, req.Network)
 
 	// If an account ID is provided, (re)start the account watcher goroutine.
 	if req.AccountID != "" {
 		network := req.Network
 		if network != "MAINNET" && network != "TESTNET" {
-			network = "TESTNET"
+			network, _ = h.Store.Defaults()
 		}
-		watchCtx, cancel := context.WithCancel(context.Background())
-		h.Store.SetAccountWatch(req.Token, req.AccountID, network, cancel)
-		watcher.WatchAccount(watchCtx, h.Store, req.Token, req.AccountID, network)
+		return h.watch(ctx, token, req.AccountID, network)
+	}
+	return nil
+}
+
+// validateUpdate checks req's fields without touching any session.
+func validateUpdate(req contextUpdateRequest) fieldErrors {
+	fields := fieldErrors{}
+	if req.ActivePair != "" {
+		fields.symbol("active_pair", req.ActivePair)
+	}
+	if req.Network != "" && req.Network != "MAINNET" && req.Network != "TESTNET" {
+		fields.add("network", "must be MAINNET or TESTNET")
+	}
+	return fields
+}
+
+// PATCH /api/context — JSON merge patch of the view. Only fields present in
+// the body change:
+//
+//	active_pair  string sets it, null clears it
+//	network      "MAINNET" | "TESTNET"; not clearable
+//	account_id   string pairs (and watches) the account on the resulting
+//	             network, null unpairs it like DELETE /api/context/watch
+//
+// Unknown fields are rejected. Responds with the updated snapshot.
+func (h *ContextHandler) patch(w http.ResponseWriter, r *http.Request) {
+	var fields map[string]json.RawMessage
+	if !decodeJSON(w, r, &fields, "invalid request body", h.StrictContentType) {
+		return
+	}
+	var pair, network, accountID *string
+	problems := fieldErrors{}
+	for name, raw := range fields {
+		var dst **string
+		switch name {
+		case "active_pair":
+			dst = &pair
+		case "network":
+			dst = &network
+		case "account_id":
+			dst = &accountID
+		default:
+			problems.add(name, "unknown field")
+			continue
+		}
+		// null decodes to a nil pointer: present but cleared.
+		var v *string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			problems.add(name, "must be a string or null")
+			continue
+		}
+		if v == nil {
+			v = new(string)
+		}
+		*dst = v
+	}
+	if pair != nil && *pair != "" {
+		problems.symbol("active_pair", *pair)
+	}
+	if network != nil && *network == "" {
+		problems.add("network", "cannot be cleared")
+	} else if network != nil && *network != "MAINNET" && *network != "TESTNET" {
+		problems.add("network", "must be MAINNET or TESTNET")
+	}
+	if len(problems) > 0 {
+		writeValidationError(w, problems)
+		return
+	}
+	token := middleware.ConnectionFrom(r.Context()).Token
+	snap := h.Store.GetContextSnapshot(token)
+	if snap == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+
+	// The account goes first: it is the only step that can fail after
+	// validation, and nothing else has changed if it does.
+	if accountID != nil {
+		if *accountID == "" {
+			if err := h.Store.ClearAccountWatch(token); err != nil {
+				writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+				return
+			}
+		} else {
+			target := snap.Network
+			if network != nil {
+				target = *network
+			}
+			if fail := h.watch(r.Context(), token, *accountID, target); fail != nil {
+				fail.write(w)
+				return
+			}
+		}
+	}
+	if network != nil {
+		h.Store.SetActiveView(token, "", *network)
+	}
+	if pair != nil {
+		if *pair == "" {
+			h.Store.ClearActivePair(token)
+		} else {
+			h.Store.SetActiveView(token, *pair, "")
+		}
+	}
+
+	h.get(w, r)
+}
+
+// watch verifies accountID on network and starts watching it for token.
+func (h *ContextHandler) watch(ctx context.Context, token, accountID, network string) *contextError {
+	// Make sure the account lives on the claimed network; otherwise the
+	// watcher would follow the wrong Horizon and never see activity. A
+	// Horizon outage doesn't block pairing — the watcher retries anyway.
+	if err := watcher.VerifyAccount(ctx, accountID, network); errors.Is(err, watcher.ErrAccountNotFound) {
+		return newContextError(http.StatusBadRequest, "account_not_found", fmt.Sprintf("account %s not found on %s — check the network, or fund the account first",
+			accountID, network))
+	} else if err != nil {
+		log.Printf("[context] could not verify %s on %s: %v — watching anyway", accountID, network, err)
+	}
+
+	// Derive from the token's context so deleting the token stops the
+	// watcher at once instead of waiting for a Horizon error.
+	tokenCtx, ok := h.Store.TokenContext(token)
+	if !ok {
+		return newContextError(http.StatusUnauthorized, "unauthorized", "unauthorized")
+	}
+	watchCtx, cancel := context.WithCancel(tokenCtx)
+	if err := h.Store.SetAccountWatch(token, accountID, network, cancel); err != nil {
+		status, code := http.StatusServiceUnavailable, "unavailable"
+		if errors.Is(err, store.ErrUnknownToken) {
+			status, code = http.StatusUnauthorized, "unauthorized"
+		}
+		return newContextError(status, code, err.Error())
+	}
+	watcher.WatchAccount(watchCtx, h.Store, token, accountID, network)
+	return nil
+}
+
+// Unwatch handles DELETE /api/context/watch — stop watching the paired
+// account and unpair it, keeping the session alive.
+func (h *ContextHandler) Unwatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	token := middleware.ConnectionFrom(r.Context()).Token
+	if err := h.Store.ClearAccountWatch(token); err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(map[string]string{"status": "unwatched"})
 }
 
 // GET /api/context?token=... — return the live context snapshot for a token.
 // The agent can call this directly (no /bridge/ proxy needed) to know
-// what the user is currently looking at in the terminal.
+// what the user is currently looking at in the terminal. &history=true adds
+// the recent view changes.
 func (h *ContextHandler) get(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		token = r.Header.Get("X-Agent-Token")
-	}
-	if !h.Store.ValidateToken(token) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
+	token := middleware.ConnectionFrom(r.Context()).Token
 
 	snap := h.Store.GetContextSnapshot(token)
 	if snap == nil {
-		http.Error(w, "context not found", http.StatusNotFound)
+		writeJSONError(w, http.StatusNotFound, "not_found", "context not found")
 		return
 	}
+	if r.URL.Query().Get("history") == "true" {
+		snap.ViewHistory, _ = h.Store.GetViewHistory(token)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(snap)
 }
+
+// History handles GET /api/context/history — the token's recent active-view
+// changes, newest first, so an agent can tell what the user just switched
+// away from.
+func (h *ContextHandler) History(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	token := middleware.ConnectionFrom(r.Context()).Token
+	history, err := h.Store.GetViewHistory(token)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "context not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"history": history})
+}
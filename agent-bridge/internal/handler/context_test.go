@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agent-bridge/internal/middleware"
+	"agent-bridge/internal/store"
+)
+
+func TestContextPatchMergesFields(t *testing.T) {
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := middleware.RequireToken(s, http.HandlerFunc((&ContextHandler{Store: s}).Handle))
+
+	patch := func(body string) (int, store.ContextSnapshot) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPatch, "/api/context?token="+token, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var snap store.ContextSnapshot
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&snap); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, snap
+	}
+
+	if code, snap := patch(`{"active_pair":"XLM/EURC"}`); code != http.StatusOK || snap.ActivePair != "XLM/EURC" || snap.Network != "TESTNET" {
+		t.Fatalf("set pair: %d %+v", code, snap)
+	}
+	if code, snap := patch(`{"network":"MAINNET"}`); code != http.StatusOK || snap.ActivePair != "XLM/EURC" || snap.Network != "MAINNET" {
+		t.Fatalf("omitted pair changed: %d %+v", code, snap)
+	}
+	if code, snap := patch(`{"active_pair":null}`); code != http.StatusOK || snap.ActivePair != "" || snap.Network != "MAINNET" {
+		t.Fatalf("clear pair: %d %+v", code, snap)
+	}
+
+	for _, body := range []string{
+		`{"network":null}`,
+		`{"network":"PUBNET"}`,
+		`{"activePair":"XLM/USDC"}`,
+		`{"active_pair":5}`,
+	} {
+		if code, _ := patch(body); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, code)
+		}
+	}
+	if snap := s.GetContextSnapshot(token); snap.Network != "MAINNET" || snap.ActivePair != "" {
+		t.Fatalf("rejected patch changed the view: %+v", snap)
+	}
+}
+
+func TestContextHistory(t *testing.T) {
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxH := &ContextHandler{Store: s}
+	s.SetActiveView(token, "XLM/EURC", "")
+
+	rec := httptest.NewRecorder()
+	middleware.RequireToken(s, http.HandlerFunc(ctxH.History)).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/context/history?token="+token, nil))
+	var body struct {
+		History []store.ViewChange `json:"history"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d, decode error %v", rec.Code, err)
+	}
+	if len(body.History) != 1 || body.History[0].Pair != "XLM/EURC" {
+		t.Fatalf("history = %+v", body.History)
+	}
+
+	get := func(query string) store.ContextSnapshot {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		middleware.RequireToken(s, http.HandlerFunc(ctxH.Handle)).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/context?token="+token+query, nil))
+		var snap store.ContextSnapshot
+		if err := json.NewDecoder(rec.Body).Decode(&snap); err != nil {
+			t.Fatal(err)
+		}
+		return snap
+	}
+	if snap := get(""); snap.ViewHistory != nil {
+		t.Errorf("snapshot without ?history has %+v", snap.ViewHistory)
+	}
+	if snap := get("&history=true"); len(snap.ViewHistory) != 1 {
+		t.Errorf("snapshot with ?history=true has %+v", snap.ViewHistory)
+	}
+}
+
+func TestContextBatch(t *testing.T) {
+	s := store.NewStore(nil)
+	a, _ := s.CreateToken()
+	b, _ := s.CreateToken()
+	ctxH := &ContextHandler{Store: s}
+
+	body := `[
+		{"token":"` + a + `","active_pair":"XLM/EURC","network":"MAINNET"},
+		{"token":"nope","active_pair":"XLM/EURC"},
+		{"token":"` + b + `","network":"PUBNET"},
+		{"active_pair":"XLM/EURC"}
+	]`
+	rec := httptest.NewRecorder()
+	ctxH.Batch(rec, httptest.NewRequest(http.MethodPost, "/api/context/batch", strings.NewReader(body)))
+	var resp struct {
+		Results []struct {
+			Token  string       `json:"token"`
+			OK     bool         `json:"ok"`
+			Status int          `json:"status"`
+			Error  *errorDetail `json:"error"`
+		} `json:"results"`
+		Succeeded int `json:"succeeded"`
+		Failed    int `json:"failed"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d, decode error %v", rec.Code, err)
+	}
+	if resp.Succeeded != 1 || resp.Failed != 3 || len(resp.Results) != 4 {
+		t.Fatalf("response = %+v", resp)
+	}
+	want := []struct {
+		status int
+		code   string
+	}{{200, ""}, {400, "validation_failed"}, {400, "validation_failed"}, {400, "validation_failed"}}
+	for i, w := range want {
+		r := resp.Results[i]
+		code := ""
+		if r.Error != nil {
+			code = r.Error.Code
+		}
+		if r.Status != w.status || code != w.code || r.OK != (w.status == 200) {
+			t.Errorf("result %d = %+v (code %q), want %d %q", i, r, code, w.status, w.code)
+		}
+	}
+	if f := resp.Results[2].Error; f == nil || f.Fields["network"] == "" {
+		t.Errorf("bad network not reported per field: %+v", f)
+	}
+	if unknown, missing := resp.Results[1].Error, resp.Results[3].Error; unknown == nil || missing == nil ||
+		unknown.Fields["token"] == "" || unknown.Fields["token"] != missing.Fields["token"] {
+		t.Errorf("unknown token reported unlike a missing one: %+v vs %+v", unknown, missing)
+	}
+
+	if snap := s.GetContextSnapshot(a); snap.ActivePair != "XLM/EURC" || snap.Network != "MAINNET" {
+		t.Errorf("first entry not applied: %+v", snap)
+	}
+	if snap := s.GetContextSnapshot(b); snap.Network != "TESTNET" {
+		t.Errorf("rejected entry changed the view: %+v", snap)
+	}
+
+	for _, body := range []string{`[]`, `{"token":"` + a + `"}`} {
+		rec := httptest.NewRecorder()
+		ctxH.Batch(rec, httptest.NewRequest(http.MethodPost, "/api/context/batch", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestContextBatchRequiresAdminSecret(t *testing.T) {
+	s := store.NewStore(nil)
+	a, _ := s.CreateToken()
+	ctxH := &ContextHandler{Store: s, AdminSecret: "s3cret"}
+	body := `[{"token":"` + a + `","active_pair":"XLM/EURC"}]`
+
+	for _, auth := range []string{"", "Bearer wrong"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/context/batch", strings.NewReader(body))
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		ctxH.Batch(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("auth %q: status %d, want 401", auth, rec.Code)
+		}
+	}
+	if snap := s.GetContextSnapshot(a); snap.ActivePair == "XLM/EURC" {
+		t.Fatal("unauthenticated batch was applied")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/context/batch", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	ctxH.Batch(rec, req)
+	if rec.Code != http.StatusOK || s.GetContextSnapshot(a).ActivePair != "XLM/EURC" {
+		t.Fatalf("status %d, view %+v", rec.Code, s.GetContextSnapshot(a))
+	}
+}
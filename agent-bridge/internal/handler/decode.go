@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// decodeJSON decodes r's body into v. A body not declared as JSON is
+// answered 415 unsupported_media_type, and one that doesn't decode 400
+// invalid_body with msg; either way decodeJSON returns false and the
+// caller just returns. strict is the handler's StrictContentType: off, a
+// body with no Content-Type at all is accepted for clients that don't send
+// one; a wrong one is always refused.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any, msg string, strict bool) bool {
+	if !requireJSON(w, r, strict) {
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", msg)
+		return false
+	}
+	return true
+}
+
+// requireJSON answers 415 and returns false unless r's Content-Type is
+// application/json or a +json type (parameters such as charset are fine), or
+// is missing and strict is off.
+func requireJSON(w http.ResponseWriter, r *http.Request, strict bool) bool {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		if !strict {
+			return true
+		}
+		writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type: application/json is required")
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json")) {
+		return true
+	}
+	writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type",
+		fmt.Sprintf("Content-Type %q is not supported; send application/json", ct))
+	return false
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONContentType(t *testing.T) {
+	place := func(contentType string, strict bool) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(`{}`))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		(&OrdersHandler{StrictContentType: strict}).place(rec, req)
+		var body errorBody
+		json.NewDecoder(rec.Body).Decode(&body)
+		return rec.Code, body.Error.Code
+	}
+
+	// An empty order decodes and then fails validation: a 400
+	// validation_failed means the body got past the content-type check.
+	tests := []struct {
+		contentType string
+		strict      bool
+		status      int
+		code        string
+	}{
+		{"application/json", false, http.StatusBadRequest, "validation_failed"},
+		{"application/json; charset=utf-8", true, http.StatusBadRequest, "validation_failed"},
+		{"application/merge-patch+json", true, http.StatusBadRequest, "validation_failed"},
+		{"", false, http.StatusBadRequest, "validation_failed"},
+		{"", true, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"application/x-www-form-urlencoded", false, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"text/plain", false, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"application/json;;", false, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+	}
+	for _, tt := range tests {
+		if status, code := place(tt.contentType, tt.strict); status != tt.status || code != tt.code {
+			t.Errorf("Content-Type %q (strict=%v): %d %s, want %d %s", tt.contentType, tt.strict, status, code, tt.status, tt.code)
+		}
+	}
+}
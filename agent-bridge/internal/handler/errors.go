@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"agent-bridge/internal/matching"
+)
+
+// errorBody is the JSON shape of every handler error:
+//
+//	{"error":{"code":"bad_request","message":"symbol is required"}}
+//
+// code is a stable machine-readable string agents can branch on; message is
+// for humans and may change.
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields maps each offending request field to what is wrong with it;
+	// only set on validation_failed.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// writeJSONError is the JSON counterpart of http.Error.
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorBody{Error: errorDetail{Code: code, Message: message}})
+}
+
+// fieldErrors collects per-field validation problems so a request is
+// rejected with all of them at once rather than the first one found.
+type fieldErrors map[string]string
+
+// add records problem for field, keeping the first problem per field.
+func (f fieldErrors) add(field, problem string) {
+	if _, ok := f[field]; !ok {
+		f[field] = problem
+	}
+}
+
+// writeValidationError answers 400 validation_failed listing every field in
+// fields:
+//
+//	{"error":{"code":"validation_failed","message":"invalid fields: amount, price",
+//	          "fields":{"amount":"missing","price":"must be positive"}}}
+func writeValidationError(w http.ResponseWriter, fields fieldErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(errorBody{Error: fields.detail()})
+}
+
+// detail is the validation_failed error listing every field in f.
+func (f fieldErrors) detail() errorDetail {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return errorDetail{
+		Code:    "validation_failed",
+		Message: "invalid fields: " + strings.Join(names, ", "),
+		Fields:  f,
+	}
+}
+
+// positive checks a required positive number: 0 (absent) is "missing".
+func (f fieldErrors) positive(field string, v float64) {
+	switch {
+	case v == 0:
+		f.add(field, "missing")
+	case v < 0:
+		f.add(field, "must be positive")
+	}
+}
+
+// symbol checks a required BASE/QUOTE market symbol.
+func (f fieldErrors) symbol(field, v string) {
+	if v == "" {
+		f.add(field, "missing")
+	} else if _, err := matching.NormalizeSymbol(v); err != nil {
+		f.add(field, "malformed: expected BASE/QUOTE, e.g. XLM/USDC")
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerErrorsAreJSON(t *testing.T) {
+	h := &TradesHandler{}
+	rec := httptest.NewRecorder()
+	h.List(rec, httptest.NewRequest(http.MethodPost, "/api/trades", strings.NewReader("{}")))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want 405", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var body errorBody
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != "method_not_allowed" || body.Error.Message != "method not allowed" {
+		t.Fatalf("body = %+v", body)
+	}
+}
+
+func TestValidationErrorsListEveryField(t *testing.T) {
+	h := &OrdersHandler{}
+	rec := httptest.NewRecorder()
+	body := `{"symbol":"XLMUSDC","side":"long","price":-1,"leverage":50}`
+	h.place(rec, httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(body)))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	var got errorBody
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Error.Code != "validation_failed" {
+		t.Fatalf("code = %q, want validation_failed", got.Error.Code)
+	}
+	want := map[string]string{
+		"symbol":   "malformed: expected BASE/QUOTE, e.g. XLM/USDC",
+		"side":     `must be "buy" or "sell"`,
+		"price":    "must be positive",
+		"amount":   "missing",
+		"leverage": "must be between 0 (spot) and 20",
+	}
+	if len(got.Error.Fields) != len(want) {
+		t.Fatalf("fields = %v, want %v", got.Error.Fields, want)
+	}
+	for f, msg := range want {
+		if got.Error.Fields[f] != msg {
+			t.Errorf("fields[%s] = %q, want %q", f, got.Error.Fields[f], msg)
+		}
+	}
+	if got.Error.Message != "invalid fields: amount, leverage, price, side, symbol" {
+		t.Errorf("message = %q", got.Error.Message)
+	}
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HealthHandler serves GET /healthz: liveness plus the state of the
+// frontend proxy's circuit breaker. It is public and always 200 while the
+// bridge itself is up — a degraded frontend shows as proxy.state "open".
+type HealthHandler struct {
+	Proxy *Breaker // nil when the proxy runs without a breaker
+}
+
+func (h *HealthHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	resp := struct {
+		Status string         `json:"status"`
+		Proxy  *BreakerStatus `json:"proxy,omitempty"`
+	}{Status: "ok"}
+	if h.Proxy != nil {
+		st := h.Proxy.Status()
+		resp.Proxy = &st
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -3,42 +3,85 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"agent-bridge/internal/middleware"
 	"agent-bridge/internal/store"
 )
 
 type LogsHandler struct {
 	Store *store.Store
+	// StrictContentType refuses JSON bodies that carry no Content-Type.
+	StrictContentType bool
 }
 
 type logRequest struct {
-	Token   string `json:"token"`
 	Message string `json:"message"`
 	Source  string `json:"source"`
 }
 
-func (h *LogsHandler) Post(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
+// maxReplay caps how many entries one GET /api/logs returns.
+const maxReplay = 100
+
+// replayResponse is the polling counterpart of the SSE stream: pass latest
+// back as since to fetch only what arrived after this call.
+type replayResponse struct {
+	Entries []store.LogEntry `json:"entries"`
+	Latest  uint64           `json:"latest"`
+}
+
+func (h *LogsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.post(w, r)
+	case http.MethodGet:
+		h.replay(w, r)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 	}
+}
 
-	var req logRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+// replay returns buffered entries after ?since= (default 0: everything still
+// buffered), at most maxReplay of them. When more are pending, latest is
+// beyond the last returned Seq; clients should advance since to that Seq and
+// poll again.
+func (h *LogsHandler) replay(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad_request", "since must be a non-negative integer")
+			return
+		}
+		since = n
+	}
+
+	token := middleware.ConnectionFrom(r.Context()).Token
+	entries, latest, err := h.Store.Since(token, since, maxReplay)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "invalid_token", "invalid token")
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replayResponse{Entries: entries, Latest: latest})
+}
 
-	if !h.Store.ValidateToken(req.Token) {
-		http.Error(w, "invalid token", http.StatusUnauthorized)
+func (h *LogsHandler) post(w http.ResponseWriter, r *http.Request) {
+	var req logRequest
+	if !decodeJSON(w, r, &req, "invalid json", h.StrictContentType) {
 		return
 	}
 
+	conn := middleware.ConnectionFrom(r.Context())
+
+	// The frontend echoes X-Request-ID when a log line belongs to a proxied
+	// agent request; carry it so the terminal can correlate the two.
 	entry := store.LogEntry{
-		Message: req.Message,
-		Source:  req.Source,
+		Message:   req.Message,
+		Source:    req.Source,
+		RequestID: r.Header.Get(middleware.RequestIDHeader),
 	}
-	h.Store.Publish(req.Token, entry)
+	h.Store.Publish(conn.Token, entry)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
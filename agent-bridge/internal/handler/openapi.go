@@ -0,0 +1,24 @@
+package handler
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPIDoc is the hand-maintained OpenAPI 3 description of every route
+// registered in main.go; TestOpenAPICoversRoutes keeps the two in step.
+//
+//go:embed openapi.json
+var openAPIDoc []byte
+
+// OpenAPIHandler serves GET /api/openapi.json.
+type OpenAPIHandler struct{}
+
+func (h *OpenAPIHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDoc)
+}
@@ -3,11 +3,16 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 
 	"agent-bridge/internal/matching"
+	"agent-bridge/internal/middleware"
 	"agent-bridge/internal/soroban"
 	"agent-bridge/internal/store"
 )
@@ -15,26 +20,76 @@ import (
 // OrdersHandler exposes the matching engine's order placement over HTTP.
 // POST /api/orders — place a limit order
 // GET  /api/orders?symbol=XLM/USDC&depth=10 — view the live order book
+// GET  /api/orders?symbol=...&token=...&mine=true — the same, marking the caller's orders
+// GET  /api/orders/status?symbol=...&orderId=... — look up one of the caller's orders
+// POST /api/orders/risk-check — assess a prospective leveraged order without placing it
+// GET  /api/orders/quote?symbol=...&side=buy&amount=... — market impact of a size
 type OrdersHandler struct {
 	Engine          *matching.Engine
 	Store           *store.Store
-	Soroban         *soroban.Client // nil when ADMIN_SECRET is unset
-	SettlementToken string          // C... USDC contract address
+	Soroban         PositionChain // nil when ADMIN_SECRET is unset
+	SettlementToken string        // C... USDC contract address
+	// MaxDepth caps ?depth= on the book snapshot; 0 = matching.DefaultMaxSnapshotDepth.
+	MaxDepth int
+	// StrictContentType refuses JSON bodies that carry no Content-Type.
+	StrictContentType bool
+
+	fillOnce sync.Once
+	fills    chan []matching.MatchResult // drained in order by one worker; see queueFills
+}
+
+// PositionChain mirrors fills on-chain; *soroban.Client implements it.
+type PositionChain interface {
+	OpenPosition(ctx context.Context, user, assetSymbol string, xlmAmountScaled, entryPriceScaled int64, isLong bool, collateralToken string, collateralScaled int64) error
+	ClosePosition(ctx context.Context, user, collateralToken string, closePrice float64) error
+	SettleTrade(ctx context.Context, userAddr string, pnlScaled int64, tokenAddr string) error
 }
 
+// fillQueueSize is how many placements' fills may wait for their chain writes
+// before queueFills blocks.
+const fillQueueSize = 256
+
+// defaultSnapshotDepth is how many orders per side GET /api/orders shows
+// without ?depth=.
+const defaultSnapshotDepth = 10
+
 type placeOrderRequest struct {
-	Token    string  `json:"token"`
 	Symbol   string  `json:"symbol"`
 	Side     string  `json:"side"`     // "buy" | "sell"
 	Price    float64 `json:"price"`    // limit price
 	Amount   float64 `json:"amount"`   // base asset amount
-	Leverage int     `json:"leverage"` // 1 = spot
+	Leverage int     `json:"leverage"` // 0 or 1 = spot
+	// ReduceOnly orders only shrink the caller's open position and are
+	// trimmed to its size, when placed and again as they fill; they never
+	// open or flip a position.
+	ReduceOnly bool `json:"reduceOnly"`
+}
+
+// validate checks the fields every order needs, placed or risk-checked.
+// Leverage 0 means spot, like 1; a symbol's own lower cap is the engine's
+// to enforce.
+func (req placeOrderRequest) validate() fieldErrors {
+	fields := fieldErrors{}
+	fields.symbol("symbol", req.Symbol)
+	if req.Side != string(matching.Buy) && req.Side != string(matching.Sell) {
+		fields.add("side", `must be "buy" or "sell"`)
+	}
+	fields.positive("price", req.Price)
+	fields.positive("amount", req.Amount)
+	if req.Leverage < 0 || req.Leverage > matching.MaxLeverage {
+		fields.add("leverage", fmt.Sprintf("must be between 0 (spot) and %d", matching.MaxLeverage))
+	}
+	return fields
 }
 
 type placeOrderResponse struct {
-	OrderID string        `json:"orderId"`
-	Fills   int           `json:"fills"`
-	Results []fillSummary `json:"results,omitempty"`
+	OrderID       string        `json:"orderId"` // for /api/orders/status, even when fully filled
+	Resting       bool          `json:"resting"` // whether orderId is still in the book
+	Fills         int           `json:"fills"`
+	FilledAmount  float64       `json:"filledAmount"`  // base amount matched immediately
+	AvgPrice      float64       `json:"avgPrice"`      // weighted average fill price
+	RestingAmount float64       `json:"restingAmount"` // base amount left in the book
+	Results       []fillSummary `json:"results,omitempty"`
 }
 
 type fillSummary struct {
@@ -49,20 +104,26 @@ func (h *OrdersHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		h.place(w, r)
 	case http.MethodGet:
+		if r.URL.Query().Get("mine") == "true" {
+			// The snapshot is public; marking the caller's orders needs to
+			// know who the caller is.
+			middleware.RequireToken(h.Store, http.HandlerFunc(h.snapshot)).ServeHTTP(w, r)
+			return
+		}
 		h.snapshot(w, r)
 	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 	}
 }
 
 func (h *OrdersHandler) place(w http.ResponseWriter, r *http.Request) {
 	var req placeOrderRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req, "bad request body", h.StrictContentType) {
 		return
 	}
-	if req.Token == "" || req.Symbol == "" || req.Amount <= 0 || req.Price <= 0 {
-		http.Error(w, "token, symbol, amount, price are required", http.StatusBadRequest)
+	fields := req.validate()
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
 		return
 	}
 	if req.Leverage < 1 {
@@ -70,29 +131,50 @@ func (h *OrdersHandler) place(w http.ResponseWriter, r *http.Request) {
 	}
 
 	o := matching.Order{
-		UserToken: req.Token,
-		Symbol:    req.Symbol,
-		Side:      matching.Side(req.Side),
-		Price:     req.Price,
-		Amount:    req.Amount,
-		Leverage:  req.Leverage,
+		UserToken:  middleware.ConnectionFrom(r.Context()).Token,
+		Symbol:     req.Symbol,
+		Side:       matching.Side(req.Side),
+		Price:      req.Price,
+		Amount:     req.Amount,
+		Leverage:   req.Leverage,
+		ReduceOnly: req.ReduceOnly,
 	}
 
-	fills, err := h.Engine.PlaceOrder(o)
+	res, err := h.Engine.PlaceOrder(o)
+	if errors.Is(err, matching.ErrLeverageLimit) {
+		// The symbol caps leverage below the global maximum checked above.
+		writeValidationError(w, fieldErrors{"leverage": err.Error()})
+		return
+	}
+	if errors.Is(err, matching.ErrOrderLimit) {
+		writeJSONError(w, http.StatusTooManyRequests, "rate_limited", err.Error())
+		return
+	}
+	if errors.Is(err, matching.ErrPositionLimit) {
+		writeJSONError(w, http.StatusConflict, "position_limit", err.Error())
+		return
+	}
+	if errors.Is(err, matching.ErrBookFull) {
+		writeJSONError(w, http.StatusConflict, "book_full", err.Error())
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
 		return
 	}
 
-	// Trigger on-chain OpenPosition for every fill in a background goroutine.
-	// The HTTP response is returned immediately; the chain write is async.
-	for _, fill := range fills {
-		f := fill
-		go h.processFill(f)
-	}
+	// The HTTP response is returned immediately; the chain writes are async.
+	h.queueFills(res.Fills)
 
-	resp := placeOrderResponse{Fills: len(fills)}
-	for _, f := range fills {
+	resp := placeOrderResponse{
+		OrderID:       res.OrderID,
+		Resting:       res.Resting,
+		Fills:         len(res.Fills),
+		FilledAmount:  res.FilledAmount,
+		AvgPrice:      res.AvgPrice,
+		RestingAmount: res.RestingAmount,
+	}
+	for _, f := range res.Fills {
 		resp.Results = append(resp.Results, fillSummary{
 			BuyToken:  f.BuyOrder.UserToken,
 			SellToken: f.SellOrder.UserToken,
@@ -105,20 +187,42 @@ func (h *OrdersHandler) place(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// processFill is called in a goroutine for each matched order pair.
-// It resolves the Stellar address for each party and calls OpenPosition on-chain,
-// then registers the position with the liquidation engine.
+// queueFills hands fills to the single worker that applies them, so they
+// reach the chain and the liquidation engine one at a time in match order.
+func (h *OrdersHandler) queueFills(fills []matching.MatchResult) {
+	if len(fills) == 0 {
+		return
+	}
+	h.fillOnce.Do(func() {
+		h.fills = make(chan []matching.MatchResult, fillQueueSize)
+		go func() {
+			for batch := range h.fills {
+				for _, f := range batch {
+					h.processFill(f)
+				}
+			}
+		}()
+	})
+	h.fills <- fills
+}
+
+// processFill applies one matched order pair. For each party it resolves
+// the Stellar address, mirrors the fill on-chain (see settleFill), then
+// completes it in the liquidation engine, which folds whatever reached the
+// chain into the party's position and drops the fill from the pending
+// volume reduce-only orders are sized against. A reduce-only party is
+// trimmed to the position it reduces, so it settles that part and never
+// opens anything.
 func (h *OrdersHandler) processFill(fill matching.MatchResult) {
 	if h.Soroban == nil {
 		log.Printf("[orders] fill: soroban client not set — skipping on-chain position (no ADMIN_SECRET?)")
-		return
 	}
 
 	ctx := context.Background()
-	notional := fill.FillPrice * fill.FillAmount // total USDC value of the trade
+	symbol := fill.BuyOrder.Symbol
 
 	// Extract base asset symbol: "XLM/USDC" → "XLM"
-	assetSymbol := fill.BuyOrder.Symbol
+	assetSymbol := symbol
 	if idx := strings.Index(assetSymbol, "/"); idx >= 0 {
 		assetSymbol = assetSymbol[:idx]
 	}
@@ -133,45 +237,210 @@ func (h *OrdersHandler) processFill(fill matching.MatchResult) {
 	}
 
 	for _, p := range parties {
-		conn := h.Store.GetConnection(p.order.UserToken)
-		if conn == nil || conn.AccountID == "" {
-			log.Printf("[orders] fill: no Stellar address for token %s (side=%s) — open /api/context first",
-				p.order.UserToken, p.side)
-			continue
+		account, applied := h.mirrorFill(ctx, p.order, p.side, assetSymbol, fill)
+
+		// Fold the fill into the monitored position: averaging into one on
+		// the same side, reducing or flipping one on the other.
+		pos, err := h.Engine.Liquidation.CompleteFill(p.order.UserToken, symbol, p.side,
+			fill.FillPrice, fill.FillAmount, applied, p.order.Leverage)
+		switch {
+		case applied == 0:
+		case err != nil:
+			log.Printf("[orders] liquidation watch not registered for %s: %v", account, err)
+		case pos == nil:
+			log.Printf("[orders] position closed: user=%s symbol=%s", account, symbol)
+		default:
+			log.Printf("[orders] position updated: user=%s side=%s entry=%.7f notional=%.4f collateral=%.4f",
+				account, pos.Side, pos.EntryPrice, pos.DebtAmount, pos.CollateralAmount)
 		}
+	}
+}
 
-		// collateral_locked = notional / leverage
-		collateral := notional / float64(p.order.Leverage)
-		xlmScaled := int64(fill.FillAmount * float64(soroban.ScaleFactor))
-		entryScaled := int64(fill.FillPrice * float64(soroban.ScaleFactor))
-		collScaled := int64(collateral * float64(soroban.ScaleFactor))
-		isLong := p.side == "long"
-
-		if err := h.Soroban.OpenPosition(
-			ctx,
-			conn.AccountID, assetSymbol,
-			xlmScaled, entryScaled, isLong,
-			h.SettlementToken,
-			collScaled,
-		); err != nil {
-			log.Printf("[orders] OpenPosition failed for %s (%s): %v", conn.AccountID, p.side, err)
-			continue
+// mirrorFill settles one party's side of fill on-chain for the party's
+// Stellar account and returns how much of the fill it settled, 0 when none
+// of it reached the chain.
+func (h *OrdersHandler) mirrorFill(ctx context.Context, o matching.Order, side, assetSymbol string, fill matching.MatchResult) (account string, applied float64) {
+	if h.Soroban == nil {
+		return "", 0
+	}
+	conn := h.Store.GetConnection(o.UserToken)
+	if conn == nil || conn.AccountID == "" {
+		log.Printf("[orders] fill: no Stellar address for token %s (side=%s) — open /api/context first",
+			o.UserToken, side)
+		return "", 0
+	}
+
+	amount := fill.FillAmount
+	plan := h.Engine.Liquidation.PreviewFill(o.UserToken, o.Symbol, side, fill.FillPrice, amount)
+	if o.ReduceOnly {
+		if plan.Reduce <= 0 {
+			log.Printf("[orders] reduce-only fill for %s (%s) found no position to reduce", conn.AccountID, side)
+			return conn.AccountID, 0
 		}
+		amount, plan.Open = plan.Reduce, 0
+	}
+	if err := h.settleFill(ctx, conn.AccountID, assetSymbol, side == "long", o.Leverage,
+		fill.FillPrice, plan); err != nil {
+		log.Printf("[orders] on-chain fill failed for %s (%s): %v", conn.AccountID, side, err)
+		return conn.AccountID, 0
+	}
+	return conn.AccountID, amount
+}
 
-		// Register with the liquidation engine for ongoing monitoring.
-		h.Engine.Liquidation.AddPosition(&matching.OpenPosition{
-			UserToken:        p.order.UserToken,
-			Symbol:           fill.BuyOrder.Symbol,
-			Side:             p.side,
-			EntryPrice:       fill.FillPrice,
-			Leverage:         p.order.Leverage,
-			CollateralAmount: collateral,
-			DebtAmount:       notional,
-		})
+// settleFill mirrors plan on-chain for account. A fill against an open
+// position closes it (the contract settles its PnL at price) or, when it
+// only reduces it, settles the PnL realised on the reduced part; whatever
+// the fill opens or adds on its own side is opened with notional / leverage
+// locked as collateral.
+func (h *OrdersHandler) settleFill(ctx context.Context, account, assetSymbol string, isLong bool, leverage int, price float64, plan matching.FillPlan) error {
+	switch {
+	case plan.Close:
+		if err := h.Soroban.ClosePosition(ctx, account, h.SettlementToken, price); err != nil {
+			return fmt.Errorf("ClosePosition: %w", err)
+		}
+	case plan.Reduce > 0:
+		pnlScaled := int64(plan.Realised * float64(soroban.ScaleFactor))
+		if err := h.Soroban.SettleTrade(ctx, account, pnlScaled, h.SettlementToken); err != nil {
+			return fmt.Errorf("SettleTrade: %w", err)
+		}
+	}
+	if plan.Open <= 0 {
+		return nil
+	}
+	// collateral_locked = notional / leverage
+	collateral := price * plan.Open / float64(max(leverage, 1))
+	xlmScaled := int64(plan.Open * float64(soroban.ScaleFactor))
+	entryScaled := int64(price * float64(soroban.ScaleFactor))
+	collScaled := int64(collateral * float64(soroban.ScaleFactor))
+	if err := h.Soroban.OpenPosition(ctx, account, assetSymbol, xlmScaled, entryScaled, isLong,
+		h.SettlementToken, collScaled); err != nil {
+		return fmt.Errorf("OpenPosition: %w", err)
+	}
+	return nil
+}
 
-		log.Printf("[orders] position opened: user=%s side=%s leverage=%dx notional=%.4f collateral=%.4f",
-			conn.AccountID, p.side, p.order.Leverage, notional, collateral)
+// ── Pre-trade risk check ─────────────────────────────────────────────────────
+
+type riskCheckRequest struct {
+	placeOrderRequest
+	Collateral float64 `json:"collateral"` // optional; defaults to notional / leverage
+}
+
+// RiskCheck reports the implied entry, liquidation price and whether the
+// current mark would liquidate the position straight away. Read-only.
+func (h *OrdersHandler) RiskCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req riskCheckRequest
+	if !decodeJSON(w, r, &req, "bad request body", h.StrictContentType) {
+		return
+	}
+	fields := req.validate()
+	if req.Collateral < 0 {
+		fields.add("collateral", "must not be negative")
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	report, err := h.Engine.RiskCheck(matching.Order{
+		Symbol:   req.Symbol,
+		Side:     matching.Side(req.Side),
+		Price:    req.Price,
+		Amount:   req.Amount,
+		Leverage: req.Leverage,
+	}, req.Collateral)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// ── Market impact quote ───────────────────────────────────────────────────────
+
+// Quote reports what a market order of ?amount= on ?side= would cost against
+// the current book of ?symbol= — average and worst fill price, total cost and
+// the part beyond current depth — without placing anything.
+func (h *OrdersHandler) Quote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	fields := fieldErrors{}
+	fields.symbol("symbol", q.Get("symbol"))
+	side := matching.Side(q.Get("side"))
+	if side != matching.Buy && side != matching.Sell {
+		fields.add("side", `must be "buy" or "sell"`)
+	}
+	amount, err := strconv.ParseFloat(q.Get("amount"), 64)
+	if q.Get("amount") != "" && err != nil {
+		fields.add("amount", "must be a number")
+	}
+	fields.positive("amount", amount)
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	quote, err := h.Engine.Quote(q.Get("symbol"), side, amount)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// ── Order status ──────────────────────────────────────────────────────────────
+
+type orderStatusResponse struct {
+	OrderID   string               `json:"orderId"`
+	Symbol    string               `json:"symbol"`
+	Status    matching.OrderStatus `json:"status"` // resting | filled | cancelled | unknown
+	Remaining float64              `json:"remaining"`
+}
+
+// Status reports the lifecycle state of one of the caller's orders. Filled and
+// cancelled states are remembered for a short while after the order leaves
+// the book; after that (or for another token's order) the status is unknown.
+func (h *OrdersHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+
+	orderID := r.URL.Query().Get("orderId")
+	if orderID == "" {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "orderId is required")
+		return
+	}
+	symbol, err := matching.NormalizeSymbol(r.URL.Query().Get("symbol"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	token := middleware.ConnectionFrom(r.Context()).Token
+	status, remaining, err := h.Engine.OrderStatus(symbol, orderID, token)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orderStatusResponse{
+		OrderID:   orderID,
+		Symbol:    symbol,
+		Status:    status,
+		Remaining: remaining,
+	})
 }
 
 // ── Order book snapshot ───────────────────────────────────────────────────────
@@ -179,12 +448,24 @@ func (h *OrdersHandler) processFill(fill matching.MatchResult) {
 type bookLevel struct {
 	Price  float64 `json:"price"`
 	Amount float64 `json:"amount"`
+	// Mine is how much of Amount belongs to the caller; only set with
+	// ?mine=true. Rows are in queue order, so the rows above a marked one at
+	// the same price are ahead of it.
+	Mine float64 `json:"mine,omitempty"`
 }
 
 type bookSnapshot struct {
 	Symbol string      `json:"symbol"`
+	Depth  int         `json:"depth"` // orders per side requested, after clamping
 	Bids   []bookLevel `json:"bids"`
 	Asks   []bookLevel `json:"asks"`
+	// BidCount and AskCount are the total resting orders per side, not
+	// just the levels shown.
+	BidCount int `json:"bidCount"`
+	AskCount int `json:"askCount"`
+	// Checksum is matching.BookChecksum of the bids and asks listed, for
+	// clients reconciling a locally maintained book.
+	Checksum uint32 `json:"checksum"`
 }
 
 func (h *OrdersHandler) snapshot(w http.ResponseWriter, r *http.Request) {
@@ -192,18 +473,63 @@ func (h *OrdersHandler) snapshot(w http.ResponseWriter, r *http.Request) {
 	if symbol == "" {
 		symbol = "XLM/USDC"
 	}
-	depth := 10
+	symbol, err := matching.NormalizeSymbol(symbol)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	depth, err := h.snapshotDepth(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
 
-	bids, asks := h.Engine.BookSnapshot(symbol, depth)
+	bids, asks, err := h.Engine.BookSnapshot(symbol, depth)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	// Set only when the request went through RequireToken (?mine=true).
+	var caller string
+	if conn := middleware.ConnectionFrom(r.Context()); conn != nil {
+		caller = conn.Token
+	}
+	level := func(o matching.Order) bookLevel {
+		l := bookLevel{Price: o.Price, Amount: o.Amount}
+		if caller != "" && o.UserToken == caller {
+			l.Mine = o.Amount
+		}
+		return l
+	}
 
-	snap := bookSnapshot{Symbol: symbol}
+	snap := bookSnapshot{Symbol: symbol, Depth: depth, Checksum: matching.BookChecksum(bids, asks)}
+	snap.BidCount, snap.AskCount, _ = h.Engine.BookDepth(symbol)
 	for _, o := range bids {
-		snap.Bids = append(snap.Bids, bookLevel{Price: o.Price, Amount: o.Amount})
+		snap.Bids = append(snap.Bids, level(o))
 	}
 	for _, o := range asks {
-		snap.Asks = append(snap.Asks, bookLevel{Price: o.Price, Amount: o.Amount})
+		snap.Asks = append(snap.Asks, level(o))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(snap)
 }
+
+// snapshotDepth reads ?depth=, clamped to 1..MaxDepth. Only a value that is
+// not an integer is an error.
+func (h *OrdersHandler) snapshotDepth(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("depth")
+	if v == "" {
+		return defaultSnapshotDepth, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.New("depth must be an integer")
+	}
+	limit := h.MaxDepth
+	if limit <= 0 {
+		limit = matching.DefaultMaxSnapshotDepth
+	}
+	return max(1, min(n, limit)), nil
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agent-bridge/internal/matching"
+	"agent-bridge/internal/middleware"
+	"agent-bridge/internal/store"
+)
+
+func TestOrderQuote(t *testing.T) {
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{matching.NewSymbolConfig("XLM/USDC")}, nil)
+	eng.PlaceOrder(matching.Order{UserToken: "mm", Symbol: "XLM/USDC", Side: matching.Sell, Price: 0.10, Amount: 50})
+	h := &OrdersHandler{Engine: eng}
+
+	rec := httptest.NewRecorder()
+	h.Quote(rec, httptest.NewRequest(http.MethodGet, "/api/orders/quote?symbol=XLM/USDC&side=buy&amount=80", nil))
+	var q matching.Quote
+	if err := json.NewDecoder(rec.Body).Decode(&q); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d, decode error %v", rec.Code, err)
+	}
+	if q.Filled != 50 || q.Unfillable != 30 || q.AvgPrice != 0.10 || q.Cost != 5 {
+		t.Fatalf("quote = %+v, want 50 filled at 0.10 and 30 unfillable", q)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Quote(rec, httptest.NewRequest(http.MethodGet, "/api/orders/quote?symbol=XLM/USDC&side=hold&amount=lots", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"side"`) || !strings.Contains(rec.Body.String(), `"amount"`) {
+		t.Fatalf("status %d body %s, want 400 naming side and amount", rec.Code, rec.Body)
+	}
+}
+
+func TestOrderBookMine(t *testing.T) {
+	s := store.NewStore(nil)
+	me, _ := s.CreateToken()
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{matching.NewSymbolConfig("XLM/USDC")}, nil)
+	eng.PlaceOrder(matching.Order{UserToken: "other", Symbol: "XLM/USDC", Side: matching.Buy, Price: 0.10, Amount: 5})
+	eng.PlaceOrder(matching.Order{UserToken: me, Symbol: "XLM/USDC", Side: matching.Buy, Price: 0.10, Amount: 2})
+	h := &OrdersHandler{Engine: eng, Store: s}
+
+	get := func(query string) (int, bookSnapshot) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.Handle(rec, httptest.NewRequest(http.MethodGet, "/api/orders?symbol=XLM/USDC"+query, nil))
+		var snap bookSnapshot
+		json.NewDecoder(rec.Body).Decode(&snap)
+		return rec.Code, snap
+	}
+
+	code, snap := get("&mine=true&token=" + me)
+	if code != http.StatusOK || len(snap.Bids) != 2 {
+		t.Fatalf("status %d, bids %+v", code, snap.Bids)
+	}
+	if snap.Bids[0].Mine != 0 || snap.Bids[1].Mine != 2 {
+		t.Errorf("bids = %+v, want only the second (queued behind 5) marked 2", snap.Bids)
+	}
+	if _, anon := get("&token=" + me); anon.Bids[1].Mine != 0 {
+		t.Errorf("snapshot without mine=true marked %+v", anon.Bids[1])
+	}
+	if code, _ := get("&mine=true&token=nope"); code != http.StatusUnauthorized {
+		t.Errorf("unknown token: status %d, want 401", code)
+	}
+}
+
+func TestOrderBookDepth(t *testing.T) {
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{matching.NewSymbolConfig("XLM/USDC")}, nil)
+	for i := 0; i < 15; i++ {
+		eng.PlaceOrder(matching.Order{UserToken: "mm", Symbol: "XLM/USDC", Side: matching.Buy, Price: 0.05 + float64(i)*0.001, Amount: 1})
+	}
+	h := &OrdersHandler{Engine: eng, MaxDepth: 12}
+
+	for _, tt := range []struct {
+		query     string
+		wantDepth int
+		wantBids  int
+	}{
+		{"", 10, 10},
+		{"&depth=3", 3, 3},
+		{"&depth=0", 1, 1},
+		{"&depth=-4", 1, 1},
+		{"&depth=500", 12, 12},
+	} {
+		rec := httptest.NewRecorder()
+		h.Handle(rec, httptest.NewRequest(http.MethodGet, "/api/orders?symbol=XLM/USDC"+tt.query, nil))
+		var snap bookSnapshot
+		if err := json.NewDecoder(rec.Body).Decode(&snap); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%q: status %d, decode error %v", tt.query, rec.Code, err)
+		}
+		if snap.Depth != tt.wantDepth || len(snap.Bids) != tt.wantBids || snap.BidCount != 15 {
+			t.Errorf("%q: depth %d with %d bids of %d, want depth %d with %d", tt.query, snap.Depth, len(snap.Bids), snap.BidCount, tt.wantDepth, tt.wantBids)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.Handle(rec, httptest.NewRequest(http.MethodGet, "/api/orders?symbol=XLM/USDC&depth=deep", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("depth=deep: status %d, want 400", rec.Code)
+	}
+}
+
+func TestPlaceOrderSymbolLeverageCap(t *testing.T) {
+	s := store.NewStore(nil)
+	tok, _ := s.CreateToken()
+	btc := matching.NewSymbolConfig("BTC/USDC")
+	btc.MaxLeverage = 3
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{btc, matching.NewSymbolConfig("XLM/USDC")}, nil)
+	h := middleware.RequireToken(s, http.HandlerFunc((&OrdersHandler{Engine: eng, Store: s}).Handle))
+
+	place := func(symbol string, leverage int) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"symbol":%q,"side":"buy","price":1,"amount":1,"leverage":%d}`, symbol, leverage)
+		req := httptest.NewRequest(http.MethodPost, "/api/orders?token="+tok, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := place("BTC/USDC", 5); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "BTC/USDC allows at most 3x") {
+		t.Fatalf("BTC/USDC 5x: status %d body %s, want 400 naming the 3x cap", rec.Code, rec.Body)
+	}
+	if rec := place("XLM/USDC", 5); rec.Code != http.StatusOK {
+		t.Fatalf("XLM/USDC 5x: status %d body %s, want 200 under the global cap", rec.Code, rec.Body)
+	}
+}
+
+func TestPlaceOrderPositionLimit(t *testing.T) {
+	s := store.NewStore(nil)
+	tok, _ := s.CreateToken()
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{matching.NewSymbolConfig("BTC/USDC"), matching.NewSymbolConfig("XLM/USDC")}, nil)
+	eng.Liquidation.SetMaxPositionsPerToken(1)
+	eng.Liquidation.AddPosition(&matching.OpenPosition{UserToken: tok, Symbol: "XLM/USDC", Side: "long", EntryPrice: 1, Leverage: 1, CollateralAmount: 1, DebtAmount: 1})
+	h := middleware.RequireToken(s, http.HandlerFunc((&OrdersHandler{Engine: eng, Store: s}).Handle))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/orders?token="+tok, strings.NewReader(`{"symbol":"BTC/USDC","side":"buy","price":1,"amount":1}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "position_limit") {
+		t.Fatalf("status %d body %s, want 409 position_limit", rec.Code, rec.Body)
+	}
+}
+
+// chainCalls records the on-chain writes processFill makes.
+type chainCalls []string
+
+func (c *chainCalls) OpenPosition(_ context.Context, user, asset string, amount, entry int64, isLong bool, _ string, collateral int64) error {
+	*c = append(*c, fmt.Sprintf("open %s %s %d@%d long=%v collateral=%d", user, asset, amount, entry, isLong, collateral))
+	return nil
+}
+
+func (c *chainCalls) ClosePosition(_ context.Context, user, _ string, price float64) error {
+	*c = append(*c, fmt.Sprintf("close %s @%v", user, price))
+	return nil
+}
+
+func (c *chainCalls) SettleTrade(_ context.Context, user string, pnl int64, _ string) error {
+	*c = append(*c, fmt.Sprintf("settle %s pnl=%d", user, pnl))
+	return nil
+}
+
+func TestProcessFillMirrorsReduceOnly(t *testing.T) {
+	s := store.NewStore(nil)
+	tok, _ := s.CreateToken()
+	if err := s.SetAccountWatch(tok, "GTRADER", "TESTNET", func() {}); err != nil {
+		t.Fatal(err)
+	}
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{matching.NewSymbolConfig("XLM/USDC")}, nil)
+	// A 10-XLM long at 0.1.
+	eng.Liquidation.AddPosition(&matching.OpenPosition{UserToken: tok, Symbol: "XLM/USDC", Side: "long", EntryPrice: 0.1, Leverage: 1, CollateralAmount: 1, DebtAmount: 1})
+	var calls chainCalls
+	h := &OrdersHandler{Engine: eng, Store: s, Soroban: &calls}
+
+	// A reduce-only sell of 25 is trimmed to 10 and fills 4 at 0.12.
+	eng.PlaceOrder(matching.Order{UserToken: "mm", Symbol: "XLM/USDC", Side: matching.Buy, Price: 0.12, Amount: 4})
+	res, err := eng.PlaceOrder(matching.Order{UserToken: tok, Symbol: "XLM/USDC", Side: matching.Sell, Price: 0.12, Amount: 25, ReduceOnly: true})
+	if err != nil || len(res.Fills) != 1 {
+		t.Fatalf("reduce-only sell: %+v, %v", res, err)
+	}
+	h.processFill(res.Fills[0])
+	// PnL on 4 XLM: (0.12 - 0.1) × 4 = 0.08 USDC.
+	if want := []string{"settle GTRADER pnl=800000"}; fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("partial reduce: chain calls %q, want %q", calls, want)
+	}
+	if p := eng.Liquidation.GetPosition(tok, "XLM/USDC"); p == nil || p.Size() != 6 {
+		t.Fatalf("position after the partial reduce = %+v, want 6 XLM", p)
+	}
+
+	// The 6 left resting closes the rest of the position.
+	calls = nil
+	res, _ = eng.PlaceOrder(matching.Order{UserToken: "mm", Symbol: "XLM/USDC", Side: matching.Buy, Price: 0.12, Amount: 10})
+	if len(res.Fills) != 1 || res.Fills[0].FillAmount != 6 {
+		t.Fatalf("fills = %+v, want 6 against the resting reduce-only sell", res.Fills)
+	}
+	h.processFill(res.Fills[0])
+	if want := []string{"close GTRADER @0.12"}; fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Fatalf("full close: chain calls %q, want %q", calls, want)
+	}
+	if p := eng.Liquidation.GetPosition(tok, "XLM/USDC"); p != nil {
+		t.Fatalf("position left after the close: %+v", p)
+	}
+	if _, err := eng.PlaceOrder(matching.Order{UserToken: tok, Symbol: "XLM/USDC", Side: matching.Sell, Price: 0.1, Amount: 1, ReduceOnly: true}); !errors.Is(err, matching.ErrReduceOnly) {
+		t.Fatalf("reduce-only order once flat: err = %v, want ErrReduceOnly", err)
+	}
+}
+
+func TestRiskCheckLeverageRange(t *testing.T) {
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{matching.NewSymbolConfig("XLM/USDC")}, nil)
+	h := &OrdersHandler{Engine: eng}
+	for leverage, want := range map[int]int{-1: http.StatusBadRequest, 0: http.StatusOK, 20: http.StatusOK, 21: http.StatusBadRequest} {
+		body := fmt.Sprintf(`{"symbol":"XLM/USDC","side":"buy","price":0.1,"amount":10,"leverage":%d}`, leverage)
+		rec := httptest.NewRecorder()
+		h.RiskCheck(rec, httptest.NewRequest(http.MethodPost, "/api/orders/risk-check", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("leverage %d: status %d body %s, want %d", leverage, rec.Code, rec.Body, want)
+		}
+	}
+}
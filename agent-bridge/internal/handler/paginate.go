@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// pageParams reads ?limit=&cursor= from r. limit defaults to defaultPageSize
+// and is capped at maxPageSize; cursor is the opaque nextCursor of a previous
+// page.
+func pageParams(r *http.Request) (limit int, after string, err error) {
+	limit = defaultPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return 0, "", errors.New("limit must be a positive integer")
+		}
+		limit = min(limit, maxPageSize)
+	}
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(c)
+		if err != nil {
+			return 0, "", errors.New("malformed cursor")
+		}
+		after = string(raw)
+	}
+	return limit, after, nil
+}
+
+// paginate returns the items whose key sorts after the cursor key, up to
+// limit, plus the cursor for the following page ("" when this is the last).
+// items must already be sorted by key.
+func paginate[T any](items []T, key func(T) string, limit int, after string) ([]T, string) {
+	start := 0
+	if after != "" {
+		start = sort.Search(len(items), func(i int) bool { return key(items[i]) > after })
+	}
+	end := min(start+limit, len(items))
+	page := items[start:end]
+	if end == len(items) || len(page) == 0 {
+		return page, ""
+	}
+	return page, base64.RawURLEncoding.EncodeToString([]byte(key(page[len(page)-1])))
+}
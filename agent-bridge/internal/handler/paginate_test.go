@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"encoding/base64"
+	"slices"
+	"testing"
+)
+
+func TestPaginateWalksEveryItemOnce(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+	key := func(s string) string { return s }
+
+	var got []string
+	after := ""
+	for pages := 0; ; pages++ {
+		if pages > len(items) {
+			t.Fatal("pagination did not terminate")
+		}
+		page, next := paginate(items, key, 2, after)
+		got = append(got, page...)
+		if next == "" {
+			break
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after = string(raw)
+	}
+	if !slices.Equal(got, items) {
+		t.Fatalf("walked %v, want %v", got, items)
+	}
+
+	// A cursor whose item has since disappeared resumes at the next key.
+	if page, _ := paginate([]string{"a", "c", "d"}, key, 2, "b"); !slices.Equal(page, []string{"c", "d"}) {
+		t.Fatalf("resume after deleted key: %v", page)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 
+	"agent-bridge/internal/middleware"
 	"agent-bridge/internal/positions"
 	"agent-bridge/internal/sdex"
 	"agent-bridge/internal/store"
@@ -29,7 +30,6 @@ type PositionsHandler struct {
 // ── Open position ─────────────────────────────────────────────────────────────
 
 type sdexOpenRequest struct {
-	Token     string  `json:"token"`
 	Side      string  `json:"side"`      // "long" | "short"
 	XLMAmount float64 `json:"xlmAmount"` // XLM amount
 	Leverage  int     `json:"leverage"`  // 2–20
@@ -46,27 +46,27 @@ type openPositionResponse struct {
 
 func (h *PositionsHandler) Open(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
 
 	var req sdexOpenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request body", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "bad request body")
 		return
 	}
-	if req.Token == "" || req.XLMAmount <= 0 || req.Leverage < 2 {
-		http.Error(w, "token, xlmAmount (>0), leverage (≥2) are required", http.StatusBadRequest)
+	if req.XLMAmount <= 0 || req.Leverage < 2 {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "xlmAmount (>0), leverage (≥2) are required")
 		return
 	}
 	if req.Side != "long" && req.Side != "short" {
-		http.Error(w, "side must be 'long' or 'short'", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "side must be 'long' or 'short'")
 		return
 	}
 
-	conn := h.Store.GetConnection(req.Token)
-	if conn == nil || conn.AccountID == "" {
-		http.Error(w, "no Stellar address registered for this token — POST /api/context first", http.StatusUnauthorized)
+	conn := middleware.ConnectionFrom(r.Context())
+	if conn.AccountID == "" {
+		writeJSONError(w, http.StatusUnauthorized, "no_account", "no Stellar address registered for this token — POST /api/context first")
 		return
 	}
 
@@ -89,7 +89,7 @@ func (h *PositionsHandler) Open(w http.ResponseWriter, r *http.Request) {
 		conn.AccountID, req.Side, req.XLMAmount, midPrice, req.Leverage)
 
 	pos := &positions.Position{
-		UserToken:      req.Token,
+		UserToken:      conn.Token,
 		UserAddr:       conn.AccountID,
 		Symbol:         "XLM/USDC",
 		Side:           positions.Side(req.Side),
@@ -121,17 +121,13 @@ type closePositionResponse struct {
 
 func (h *PositionsHandler) Close(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
 
-	var req struct{ Token string `json:"token"` }
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
-		http.Error(w, "token is required", http.StatusBadRequest)
-		return
-	}
+	token := middleware.ConnectionFrom(r.Context()).Token
 
-	pos := h.Positions.Get(req.Token)
+	pos := h.Positions.Get(token)
 	if pos == nil {
 		// Not tracking this token — treat as already closed.
 		w.Header().Set("Content-Type", "application/json")
@@ -148,7 +144,7 @@ func (h *PositionsHandler) Close(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[positions] record close: user=%s side=%s entry=%.6f close=%.6f pnl=%.4f USDC",
 		pos.UserAddr, pos.Side, pos.EntryPrice, closePrice, pnl)
 
-	h.Positions.Remove(req.Token)
+	h.Positions.Remove(token)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(closePositionResponse{
@@ -161,15 +157,11 @@ func (h *PositionsHandler) Close(w http.ResponseWriter, r *http.Request) {
 
 func (h *PositionsHandler) Get(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
 
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		http.Error(w, "token query param required", http.StatusBadRequest)
-		return
-	}
+	token := middleware.ConnectionFrom(r.Context()).Token
 
 	pos := h.Positions.Get(token)
 	if pos == nil {
@@ -1,21 +1,34 @@
 package handler
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 
 	"agent-bridge/internal/matching"
 )
 
 // PricesHandler exposes the mark price feed over HTTP.
 // GET  /api/prices           — return all current mark prices
-// POST /api/price/update     — admin endpoint to push a new mark price
+// GET  /api/prices/status    — per-symbol price, source and last update time
+// GET  /api/prices/stream    — SSE "price" events, ?symbols= to narrow
+// POST /api/price/update        — TradingView alert webhook (flexible payload)
+// POST /api/price/update/strict — admin endpoint taking {"symbol","price"}
 //
-// The POST endpoint simulates the TradingView webhook: in production you would
-// point your TradingView alert webhook at this URL.
+// Point your TradingView alert webhook at /api/price/update; Alerts describes
+// the shape of the alert message.
 type PricesHandler struct {
 	Engine *matching.Engine
+	Alerts AlertMapping
+	// AdminSecret guards the update endpoints; empty = development mode.
+	AdminSecret string
+	// StrictContentType refuses JSON bodies that carry no Content-Type.
+	StrictContentType bool
 }
 
 func (h *PricesHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -24,35 +37,183 @@ func (h *PricesHandler) Get(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(prices)
 }
 
+// priceStatus is the GET /api/prices/status body.
+type priceStatus struct {
+	MockPaused bool                           `json:"mockPaused"`
+	Symbols    map[string]matching.PriceQuote `json:"symbols"`
+}
+
+// Status reports where each symbol's mark price came from and when it last
+// changed — the first thing to check when liquidations are or aren't firing —
+// and whether the mock drift is paused, in the body and the X-Mock-Paused
+// header.
+func (h *PricesHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	st := priceStatus{MockPaused: h.Engine.Prices.MockPaused(), Symbols: h.Engine.Prices.Status()}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Mock-Paused", strconv.FormatBool(st.MockPaused))
+	json.NewEncoder(w).Encode(st)
+}
+
+// Stream pushes a "price" event for every mark-price change of the symbols
+// in ?symbols=XLM/USDC,XLM/EURC (all symbols when omitted), starting with
+// their current quotes, until the client disconnects.
+func (h *PricesHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var symbols []string
+	for _, raw := range strings.Split(r.URL.Query().Get("symbols"), ",") {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		sym, err := matching.NormalizeSymbol(raw)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		symbols = append(symbols, sym)
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "streaming not supported")
+		return
+	}
+
+	// Subscribe before the snapshot so no change falls between the two.
+	updates, unsubscribe := h.Engine.Prices.Subscribe(symbols)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	writeEvent := func(u matching.PriceUpdate) {
+		data, _ := json.Marshal(u)
+		fmt.Fprintf(w, "event: price\ndata: %s\n\n", data)
+	}
+	quotes := h.Engine.Prices.Status()
+	if symbols == nil {
+		for sym := range quotes {
+			symbols = append(symbols, sym)
+		}
+	}
+	for _, sym := range symbols {
+		if q, ok := quotes[sym]; ok {
+			writeEvent(matching.PriceUpdate{Symbol: sym, PriceQuote: q})
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case u := <-updates:
+			writeEvent(u)
+			flusher.Flush()
+		}
+	}
+}
+
 type priceUpdateRequest struct {
 	Symbol string  `json:"symbol"`
 	Price  float64 `json:"price"`
 }
 
-// Update is an admin-only endpoint. Callers must pass the same secret that is
-// set in the ADMIN_SECRET environment variable as a Bearer token.
+// Webhook accepts a TradingView alert and updates the mark price from it.
+// TradingView can't set headers, so besides the ADMIN_SECRET Bearer token the
+// secret may be sent in the alert's passphrase field. For the same reason the
+// body isn't held to application/json: TradingView posts text/plain.
+func (h *PricesHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "could not read body")
+		return
+	}
+
+	symbols := h.Engine.Symbols()
+	known := make([]string, 0, len(symbols))
+	for _, cfg := range symbols {
+		known = append(known, cfg.Symbol)
+	}
+	alert, err := ParseAlert(body, h.Alerts, known)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	expected := h.AdminSecret
+	if expected != "" && !adminBearer(r, expected) && !secretEqual(alert.Passphrase, expected) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if alert.Price <= 0 {
+		writeValidationError(w, fieldErrors{"price": "alert has no positive price"})
+		return
+	}
+
+	h.setMarkPrice(w, alert.Symbol, alert.Price)
+}
+
+// Update is the strict admin-only endpoint. Callers must pass the same secret
+// configured as ADMIN_SECRET as a Bearer token.
 func (h *PricesHandler) Update(w http.ResponseWriter, r *http.Request) {
-	// Simple bearer-token guard
-	expected := os.Getenv("ADMIN_SECRET")
-	if expected != "" {
-		auth := r.Header.Get("Authorization")
-		if auth != "Bearer "+expected {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
+	if h.AdminSecret != "" && !adminBearer(r, h.AdminSecret) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
 	}
 
 	var req priceUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Symbol == "" || req.Price <= 0 {
-		http.Error(w, "symbol and price are required", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req, "bad request body", h.StrictContentType) {
 		return
 	}
+	fields := fieldErrors{}
+	fields.symbol("symbol", req.Symbol)
+	fields.positive("price", req.Price)
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+	req.Symbol, _ = matching.NormalizeSymbol(req.Symbol)
+
+	h.setMarkPrice(w, req.Symbol, req.Price)
+}
 
-	h.Engine.Prices.SetMarkPrice(req.Symbol, req.Price)
+// setMarkPrice applies a webhook price and reports the price actually set,
+// which the circuit breaker may have clamped. A price the breaker rejects is
+// a 409.
+func (h *PricesHandler) setMarkPrice(w http.ResponseWriter, symbol string, price float64) {
+	applied, err := h.Engine.Prices.SetMarkPrice(symbol, price, matching.SourceWebhook)
+	if errors.Is(err, matching.ErrPriceRejected) {
+		writeJSONError(w, http.StatusConflict, "price_rejected", err.Error())
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"ok":     true,
-		"symbol": req.Symbol,
-		"price":  req.Price,
+		"ok":      true,
+		"symbol":  symbol,
+		"price":   applied,
+		"clamped": applied != price,
 	})
 }
+
+// adminBearer reports whether r carries secret as a Bearer token.
+func adminBearer(r *http.Request, secret string) bool {
+	return secretEqual(r.Header.Get("Authorization"), "Bearer "+secret)
+}
+
+// secretEqual compares a presented credential with the expected one in
+// constant time, so response timing doesn't leak how much of it matched.
+func secretEqual(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
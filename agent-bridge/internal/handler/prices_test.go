@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agent-bridge/internal/matching"
+)
+
+func TestPricesStream(t *testing.T) {
+	eng := matching.NewEngine("", "", nil, nil)
+	eng.Prices.Seed(map[string]float64{"XLM/USDC": 0.10, "XLM/EURC": 0.09})
+	h := &PricesHandler{Engine: eng}
+	srv := httptest.NewServer(http.HandlerFunc(h.Stream))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?symbols=xlm/usdc", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+	next := func() string {
+		t.Helper()
+		var frame []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read frame: %v", err)
+			}
+			if line == "\n" {
+				return strings.Join(frame, "")
+			}
+			frame = append(frame, line)
+		}
+	}
+
+	if f := next(); !strings.HasPrefix(f, "event: price\n") || !strings.Contains(f, `"symbol":"XLM/USDC","price":0.1,`) {
+		t.Fatalf("snapshot frame = %q", f)
+	}
+	eng.Prices.SetMarkPrice("XLM/EURC", 0.095, matching.SourceWebhook) // not subscribed
+	eng.Prices.SetMarkPrice("XLM/USDC", 0.11, matching.SourceWebhook)
+	if f := next(); !strings.Contains(f, `"symbol":"XLM/USDC","price":0.11,"source":"webhook"`) {
+		t.Fatalf("update frame = %q", f)
+	}
+}
+
+func TestPricesStreamRejectsBadSymbol(t *testing.T) {
+	h := &PricesHandler{Engine: matching.NewEngine("", "", nil, nil)}
+	rec := httptest.NewRecorder()
+	h.Stream(rec, httptest.NewRequest(http.MethodGet, "/api/prices/stream?symbols=nope", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestPriceUpdateRejectedByBreaker(t *testing.T) {
+	eng := matching.NewEngine("", "", nil, nil)
+	eng.Prices.Seed(map[string]float64{"XLM/USDC": 0.10})
+	eng.Prices.SetBreaker(matching.PriceBreakerConfig{MaxMove: 0.2})
+	h := &PricesHandler{Engine: eng}
+
+	rec := httptest.NewRecorder()
+	h.Update(rec, httptest.NewRequest(http.MethodPost, "/api/price/update/strict",
+		strings.NewReader(`{"symbol":"XLM/USDC","price":1}`)))
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), `"price_rejected"`) {
+		t.Fatalf("status %d body %s, want 409 price_rejected", rec.Code, rec.Body)
+	}
+	if eng.Prices.GetMarkPrice("XLM/USDC") != 0.10 {
+		t.Fatalf("mark moved to %v", eng.Prices.GetMarkPrice("XLM/USDC"))
+	}
+}
+
+func TestPriceStatusReportsMockPaused(t *testing.T) {
+	eng := matching.NewEngine("", "", nil, nil)
+	eng.Prices.Seed(map[string]float64{"XLM/USDC": 0.10})
+	eng.Prices.SetMockPaused(true)
+	h := &PricesHandler{Engine: eng}
+
+	rec := httptest.NewRecorder()
+	h.Status(rec, httptest.NewRequest(http.MethodGet, "/api/prices/status", nil))
+	var st priceStatus
+	if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if !st.MockPaused || rec.Header().Get("X-Mock-Paused") != "true" {
+		t.Errorf("mockPaused = %v, header %q; want both true", st.MockPaused, rec.Header().Get("X-Mock-Paused"))
+	}
+	if q := st.Symbols["XLM/USDC"]; q.Price != 0.10 {
+		t.Errorf("XLM/USDC quote = %+v", q)
+	}
+}
@@ -1,22 +1,73 @@
 package handler
 
 import (
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"agent-bridge/internal/middleware"
 	"agent-bridge/internal/store"
 )
 
 type ProxyHandler struct {
 	Store       *store.Store
 	FrontendURL string // e.g. http://localhost:3000
+	// Allowed holds the sub-paths (after /api/bridge) that may be proxied;
+	// anything else is refused with 403. Build it with BridgeAllowlist.
+	Allowed map[string]bool
+	// Breaker, when set, fast-fails with 503 while the frontend is down.
+	Breaker *Breaker
+	Client  *http.Client // nil = a client with a 30 s timeout
+}
+
+var defaultProxyClient = &http.Client{Timeout: 30 * time.Second}
+
+// errNotSent marks a proxied request that never reached the frontend.
+var errNotSent = errors.New("request not sent")
+
+// BridgeAllowlist returns the /api/bridge sub-paths advertised by the skills
+// registry plus extra ones (e.g. "/portfolio" or "/api/bridge/portfolio") for
+// deployments whose frontend serves more skills.
+func BridgeAllowlist(extra ...string) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, sk := range skills {
+		if p, ok := strings.CutPrefix(sk.Path, "/api/bridge"); ok {
+			allowed[p] = true
+		}
+	}
+	for _, p := range extra {
+		p = strings.TrimPrefix(strings.TrimSpace(p), "/api/bridge")
+		if p == "" {
+			continue
+		}
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		allowed[p] = true
+	}
+	return allowed
+}
+
+// AgentActivity is the Data of agent_request and agent_response log entries,
+// so the terminal can draw an agent timeline without parsing Message.
+type AgentActivity struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Status    int    `json:"status,omitempty"`     // agent_response only
+	LatencyMs int64  `json:"latency_ms,omitempty"` // agent_response only
 }
 
 func (h *ProxyHandler) Handle(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("X-Agent-Token")
-	if token == "" || !h.Store.ValidateToken(token) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	token := middleware.ConnectionFrom(r.Context()).Token
+
+	// Strip /api/bridge prefix and proxy to /api/agent on the frontend. Only
+	// advertised skills are reachable; the mux has already cleaned the path.
+	path := strings.TrimPrefix(r.URL.Path, "/api/bridge")
+	if !h.Allowed[path] {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "bridge path "+path+" is not an advertised skill")
 		return
 	}
 
@@ -26,9 +77,6 @@ func (h *ProxyHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		h.Store.SetActiveView(token, "", network)
 	}
 
-	// Strip /api/bridge prefix and proxy to /api/agent on the frontend.
-	path := strings.TrimPrefix(r.URL.Path, "/api/bridge")
-
 	// On agent's first request, notify the frontend via SSE.
 	if h.Store.MarkAgentConnected(token) {
 		h.Store.Publish(token, store.LogEntry{
@@ -37,11 +85,41 @@ func (h *ProxyHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	// Log every agent request to the frontend terminal.
+	// Log every agent request to the frontend terminal, and its outcome once
+	// the proxied call returns (status is whatever the agent was sent).
+	requestID := middleware.RequestIDFrom(r.Context())
+	activity := AgentActivity{Method: r.Method, Path: path}
 	h.Store.Publish(token, store.LogEntry{
-		Message: r.Method + " " + path,
-		Source:  "agent",
+		Message:   r.Method + " " + path,
+		Source:    "agent",
+		EventType: "agent_request",
+		Data:      activity,
+		RequestID: requestID,
 	})
+	start := time.Now()
+	status := http.StatusBadGateway
+	defer func() {
+		activity.Status = status
+		activity.LatencyMs = time.Since(start).Milliseconds()
+		h.Store.Publish(token, store.LogEntry{
+			Message:   r.Method + " " + path + " → " + strconv.Itoa(status),
+			Source:    "agent",
+			EventType: "agent_response",
+			Data:      activity,
+			RequestID: requestID,
+		})
+	}()
+
+	if h.Breaker != nil && !h.Breaker.Allow() {
+		status = http.StatusServiceUnavailable
+		writeJSONError(w, status, "unavailable", "frontend unavailable — circuit open, retry later")
+		return
+	}
+	// The breaker hears how every admitted request ended, however it ends:
+	// a probe that never reported back would hold the circuit half-open.
+	var resp *http.Response
+	upstreamErr := errNotSent
+	defer func() { h.recordUpstream(r, resp, upstreamErr) }()
 
 	target := h.FrontendURL + "/api/agent" + path
 	if r.URL.RawQuery != "" {
@@ -50,28 +128,63 @@ func (h *ProxyHandler) Handle(w http.ResponseWriter, r *http.Request) {
 
 	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, target, r.Body)
 	if err != nil {
-		http.Error(w, "failed to create proxy request", http.StatusInternalServerError)
+		status = http.StatusInternalServerError
+		writeJSONError(w, status, "internal_error", "failed to create proxy request")
 		return
 	}
 	proxyReq.Header = r.Header.Clone()
 	proxyReq.Header.Del("X-Agent-Token")
+	if requestID != "" {
+		proxyReq.Header.Set(middleware.RequestIDHeader, requestID)
+	}
 	// Forward detected network to the frontend for informational use.
 	if snap := h.Store.GetContextSnapshot(token); snap != nil && snap.Network != "" {
 		proxyReq.Header.Set("X-Stellar-Network", snap.Network)
 	}
 
-	resp, err := http.DefaultClient.Do(proxyReq)
-	if err != nil {
-		http.Error(w, "proxy request failed: "+err.Error(), http.StatusBadGateway)
+	client := h.Client
+	if client == nil {
+		client = defaultProxyClient
+	}
+	resp, upstreamErr = client.Do(proxyReq)
+	// A bodiless GET is safe to repeat; give a dropped connection one retry.
+	if upstreamErr != nil && r.Method == http.MethodGet && (r.Body == nil || r.Body == http.NoBody) && r.Context().Err() == nil {
+		resp, upstreamErr = client.Do(proxyReq)
+	}
+	if upstreamErr != nil {
+		writeJSONError(w, http.StatusBadGateway, "bad_gateway", "proxy request failed: "+upstreamErr.Error())
 		return
 	}
 	defer resp.Body.Close()
 
 	for k, vv := range resp.Header {
+		// RequestID already set ours; don't duplicate the frontend's echo.
+		// Header keys are canonical ("X-Request-Id"); the constant isn't.
+		if k == http.CanonicalHeaderKey(middleware.RequestIDHeader) {
+			continue
+		}
 		for _, v := range vv {
 			w.Header().Add(k, v)
 		}
 	}
+	status = resp.StatusCode
 	w.WriteHeader(resp.StatusCode)
 	io.Copy(w, resp.Body)
 }
+
+// recordUpstream feeds the outcome of a proxied request to the breaker. Only
+// an unreachable, timed-out or gateway-failing frontend counts against it; a
+// request that was never sent, or an agent hanging up mid-request, says
+// nothing about the frontend.
+func (h *ProxyHandler) recordUpstream(r *http.Request, resp *http.Response, err error) {
+	switch {
+	case h.Breaker == nil:
+	case errors.Is(err, errNotSent), err != nil && r.Context().Err() != nil:
+		h.Breaker.Release()
+	case err != nil, resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable, resp.StatusCode == http.StatusGatewayTimeout:
+		h.Breaker.Failure()
+	default:
+		h.Breaker.Success()
+	}
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"agent-bridge/internal/middleware"
+	"agent-bridge/internal/store"
+)
+
+func TestProxyOnlyForwardsAllowlistedPaths(t *testing.T) {
+	var hits atomic.Int32
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte(r.URL.Path))
+	}))
+	t.Cleanup(frontend.Close)
+
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &ProxyHandler{Store: s, FrontendURL: frontend.URL, Allowed: BridgeAllowlist("/api/bridge/portfolio")}
+	mux := http.NewServeMux()
+	mux.Handle("/api/bridge/", middleware.RequireToken(s, http.HandlerFunc(h.Handle)))
+
+	tests := []struct {
+		path string
+		want int
+		body string
+	}{
+		{"/api/bridge/orderbook", http.StatusOK, "/api/agent/orderbook"},
+		{"/api/bridge/tx/submit", http.StatusOK, "/api/agent/tx/submit"},
+		{"/api/bridge/portfolio", http.StatusOK, "/api/agent/portfolio"},
+		{"/api/bridge/admin/reset", http.StatusForbidden, ""},
+		{"/api/bridge/orderbook/extra", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		hits.Store(0)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path+"?token="+token, nil)
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.path, rec.Code, tt.want)
+			continue
+		}
+		if tt.want == http.StatusOK && rec.Body.String() != tt.body {
+			t.Errorf("%s: proxied to %q, want %q", tt.path, rec.Body.String(), tt.body)
+		}
+		if tt.want == http.StatusForbidden && hits.Load() != 0 {
+			t.Errorf("%s: refused path reached the frontend", tt.path)
+		}
+	}
+}
+
+func TestProxyPublishesAgentActivity(t *testing.T) {
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(frontend.Close)
+
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := s.Subscribe(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &ProxyHandler{Store: s, FrontendURL: frontend.URL, Allowed: BridgeAllowlist()}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/bridge/tx/submit?token="+token, nil)
+	middleware.RequireToken(s, http.HandlerFunc(h.Handle)).ServeHTTP(rec, req)
+
+	var got []store.LogEntry
+	for len(ch) > 0 {
+		if e := <-ch; e.Source == "agent" {
+			got = append(got, e)
+		}
+	}
+	if len(got) != 2 || got[0].EventType != "agent_request" || got[1].EventType != "agent_response" {
+		t.Fatalf("agent entries = %+v, want agent_request then agent_response", got)
+	}
+	want := AgentActivity{Method: http.MethodPost, Path: "/tx/submit"}
+	if a := got[0].Data.(AgentActivity); a != want {
+		t.Errorf("request data = %+v, want %+v", a, want)
+	}
+	if a := got[1].Data.(AgentActivity); a.Status != http.StatusCreated || a.Method != want.Method || a.Path != want.Path {
+		t.Errorf("response data = %+v, want status %d for %s %s", a, http.StatusCreated, want.Method, want.Path)
+	}
+}
+
+func TestProxyHeaderHandling(t *testing.T) {
+	seen := make(chan *http.Request, 1)
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Clone(r.Context())
+		w.Header().Set(middleware.RequestIDHeader, r.Header.Get(middleware.RequestIDHeader))
+		w.Header().Set("X-Frontend", "yes")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, "short and stout")
+	}))
+	t.Cleanup(frontend.Close)
+
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := s.Subscribe(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &ProxyHandler{Store: s, FrontendURL: frontend.URL, Allowed: BridgeAllowlist()}
+	srv := middleware.RequestID(middleware.RequireToken(s, http.HandlerFunc(h.Handle)))
+	send := func(network string) (*httptest.ResponseRecorder, *http.Request) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/bridge/orderbook?symbol=XLM%2FUSDC&limit=5", nil)
+		req.Header.Set("X-Agent-Token", token)
+		req.Header.Set(middleware.RequestIDHeader, "rid-1")
+		req.Header.Set("Accept-Language", "en")
+		if network != "" {
+			req.Header.Set("X-Stellar-Network", network)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		select {
+		case got := <-seen:
+			return rec, got
+		default:
+			t.Fatalf("request never reached the frontend: %d %s", rec.Code, rec.Body)
+			return nil, nil
+		}
+	}
+
+	// An unrecognised network header is ignored: the stored one is sent on.
+	s.SetActiveView(token, "", "MAINNET")
+	rec, got := send("DEVNET")
+	if v := got.Header.Values("X-Agent-Token"); len(v) != 0 {
+		t.Errorf("token header forwarded: %q", v)
+	}
+	if v := got.Header.Get("X-Stellar-Network"); v != "MAINNET" {
+		t.Errorf("network header %q, want the stored MAINNET", v)
+	}
+	if got.URL.Path != "/api/agent/orderbook" || got.URL.RawQuery != "symbol=XLM%2FUSDC&limit=5" {
+		t.Errorf("frontend saw %s?%s", got.URL.Path, got.URL.RawQuery)
+	}
+	if got.Header.Get("Accept-Language") != "en" || got.Header.Get(middleware.RequestIDHeader) != "rid-1" {
+		t.Errorf("agent headers not forwarded: %v", got.Header)
+	}
+
+	if rec.Code != http.StatusTeapot || rec.Body.String() != "short and stout" {
+		t.Errorf("response %d %q, want the frontend's 418", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("X-Frontend") != "yes" || len(rec.Header().Values("Set-Cookie")) != 2 {
+		t.Errorf("response headers not passed through: %v", rec.Header())
+	}
+	if v := rec.Header().Values(middleware.RequestIDHeader); len(v) != 1 || v[0] != "rid-1" {
+		t.Errorf("request ID header %q, want it once", v)
+	}
+
+	// A valid network header switches the stored network before forwarding.
+	if _, got = send("TESTNET"); got.Header.Get("X-Stellar-Network") != "TESTNET" {
+		t.Errorf("network header %q, want TESTNET", got.Header.Get("X-Stellar-Network"))
+	}
+	if snap := s.GetContextSnapshot(token); snap.Network != "TESTNET" {
+		t.Errorf("stored network %q, want TESTNET", snap.Network)
+	}
+
+	connected := 0
+	for len(ch) > 0 {
+		if e := <-ch; e.Message == "Agent connected and ready" {
+			connected++
+		}
+	}
+	if connected != 1 {
+		t.Errorf("%d \"Agent connected\" entries over two requests, want 1", connected)
+	}
+}
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-bridge/internal/matching"
+)
+
+// signalMaxSkew bounds how far a signed signal's timestamp may be from now.
+// Within that window a repeated signature is refused; see SignalHandler.seen.
+const signalMaxSkew = 5 * time.Minute
+
+// SignalSource is one registered webhook identity allowed to trade on behalf
+// of a session token.
+type SignalSource struct {
+	Token  string `json:"token"`  // agent-bridge session token orders are placed for
+	Secret string `json:"secret"` // HMAC-SHA256 key shared with the sender
+}
+
+// ParseSignalSources reads the SIGNAL_WEBHOOKS JSON object mapping webhook
+// identity → source, e.g. {"tv-main":{"token":"…","secret":"…"}}.
+func ParseSignalSources(raw string) (map[string]SignalSource, error) {
+	sources := make(map[string]SignalSource)
+	if raw == "" {
+		return sources, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &sources); err != nil {
+		return nil, fmt.Errorf("parse signal webhooks: %w", err)
+	}
+	for id, src := range sources {
+		if src.Token == "" || src.Secret == "" {
+			return nil, fmt.Errorf("signal webhook %q needs both token and secret", id)
+		}
+	}
+	return sources, nil
+}
+
+// SignalHandler turns signed trading signals into market orders.
+// POST /api/signal — {"symbol","action":"buy"|"sell","amount"}
+//
+// Only mounted when SIGNAL_TRADING_ENABLED=true. Every request must carry:
+//
+//	X-Signal-Id:        a key of SIGNAL_WEBHOOKS
+//	X-Signal-Timestamp: unix seconds, within signalMaxSkew of now
+//	X-Signal-Signature: hex HMAC-SHA256(secret, timestamp + "." + body)
+//
+// A market order is a limit order at the mark price ± MaxSlippageBps; any
+// unfilled remainder is cancelled rather than left resting.
+type SignalHandler struct {
+	Engine         *matching.Engine
+	Orders         *OrdersHandler // reused to open on-chain positions for fills
+	Sources        map[string]SignalSource
+	Alerts         AlertMapping // ticker/action field names, shared with the price webhook
+	MaxSlippageBps int
+
+	// seen maps each accepted signature to when it stops verifying, so a
+	// captured request can't be replayed inside the timestamp window.
+	seenMu sync.Mutex
+	seen   map[string]time.Time
+}
+
+func (h *SignalHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "could not read body")
+		return
+	}
+	id := r.Header.Get("X-Signal-Id")
+	src, ok := h.Sources[id]
+	sig := r.Header.Get("X-Signal-Signature")
+	if !ok || !verifySignal(src.Secret, r.Header.Get("X-Signal-Timestamp"), sig, body) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "unauthorized")
+		return
+	}
+	if !h.firstUse(id+":"+strings.ToLower(sig), time.Now()) {
+		writeJSONError(w, http.StatusConflict, "conflict", "signal already received")
+		return
+	}
+
+	order, err := h.parseSignal(body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	order.UserToken = src.Token
+
+	res, err := h.Engine.PlaceOrder(order)
+	if errors.Is(err, matching.ErrOrderLimit) {
+		writeJSONError(w, http.StatusTooManyRequests, "rate_limited", err.Error())
+		return
+	}
+	if errors.Is(err, matching.ErrPositionLimit) {
+		writeJSONError(w, http.StatusConflict, "position_limit", err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	// Market semantics: never leave a signal order resting.
+	if res.Resting {
+		if err := h.Engine.CancelOrder(order.Symbol, res.OrderID); err != nil {
+			log.Printf("[signal] cancel remainder %s: %v", res.OrderID, err)
+		}
+	}
+	h.Orders.queueFills(res.Fills)
+	log.Printf("[signal] %s: %s %s %.4f filled=%.4f avg=%.6f",
+		id, order.Side, order.Symbol, order.Amount, res.FilledAmount, res.AvgPrice)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":           true,
+		"symbol":       order.Symbol,
+		"side":         order.Side,
+		"filledAmount": res.FilledAmount,
+		"avgPrice":     res.AvgPrice,
+		"fills":        len(res.Fills),
+	})
+}
+
+// parseSignal maps the signal body onto a marketable limit order.
+func (h *SignalHandler) parseSignal(body []byte) (matching.Order, error) {
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return matching.Order{}, fmt.Errorf("signal is not a JSON object: %w", err)
+	}
+
+	ticker, _ := lookupField(payload, h.Alerts.Symbol).(string)
+	if ticker == "" {
+		ticker, _ = payload["symbol"].(string)
+	}
+	symbols := h.Engine.Symbols()
+	known := make([]string, 0, len(symbols))
+	for _, cfg := range symbols {
+		known = append(known, cfg.Symbol)
+	}
+	symbol, err := resolveTicker(ticker, known)
+	if err != nil {
+		return matching.Order{}, err
+	}
+
+	action, _ := lookupField(payload, h.Alerts.Action).(string)
+	side := matching.Side(strings.ToLower(strings.TrimSpace(action)))
+	if side != matching.Buy && side != matching.Sell {
+		return matching.Order{}, fmt.Errorf("action must be buy or sell, got %q", action)
+	}
+
+	amountField, ok := payload["amount"]
+	if !ok {
+		return matching.Order{}, errors.New("amount is required")
+	}
+	amount, err := toFloat(amountField)
+	if err != nil || amount <= 0 {
+		return matching.Order{}, errors.New("amount must be a positive number")
+	}
+
+	mark := h.Engine.Prices.GetMarkPrice(symbol)
+	if mark <= 0 {
+		return matching.Order{}, fmt.Errorf("no mark price for %s", symbol)
+	}
+	slip := float64(h.MaxSlippageBps) / 10_000
+	price := mark * (1 + slip)
+	if side == matching.Sell {
+		price = mark * (1 - slip)
+	}
+
+	return matching.Order{
+		Symbol:   symbol,
+		Side:     side,
+		Price:    price,
+		Amount:   amount,
+		Leverage: 1,
+	}, nil
+}
+
+// firstUse records key as seen and reports whether it was new. Entries are
+// kept until their signature could no longer verify, then pruned.
+func (h *SignalHandler) firstUse(key string, now time.Time) bool {
+	h.seenMu.Lock()
+	defer h.seenMu.Unlock()
+	if h.seen == nil {
+		h.seen = make(map[string]time.Time)
+	}
+	for k, expires := range h.seen {
+		if now.After(expires) {
+			delete(h.seen, k)
+		}
+	}
+	if _, dup := h.seen[key]; dup {
+		return false
+	}
+	// A timestamp up to signalMaxSkew ahead stays valid for another
+	// signalMaxSkew after it.
+	h.seen[key] = now.Add(2 * signalMaxSkew)
+	return true
+}
+
+// verifySignal checks the timestamp window and the HMAC over
+// timestamp + "." + body in constant time.
+func verifySignal(secret, timestamp, signature string, body []byte) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := time.Since(time.Unix(ts, 0)); math.Abs(float64(skew)) > float64(signalMaxSkew) {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-bridge/internal/matching"
+)
+
+// signBody returns the X-Signal-Signature for body sent at ts.
+func signBody(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignal(t *testing.T) {
+	body := []byte(`{"symbol":"XLM/USDC","action":"buy","amount":10}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-2*signalMaxSkew).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(2*signalMaxSkew).Unix(), 10)
+
+	for _, tc := range []struct {
+		name      string
+		ts        string
+		signature string
+		body      []byte
+		want      bool
+	}{
+		{"valid", now, signBody("s3cret", now, body), body, true},
+		{"tampered body", now, signBody("s3cret", now, body), []byte(`{"symbol":"XLM/USDC","action":"buy","amount":1000}`), false},
+		{"wrong secret", now, signBody("other", now, body), body, false},
+		{"signature over another timestamp", now, signBody("s3cret", stale, body), body, false},
+		{"stale", stale, signBody("s3cret", stale, body), body, false},
+		{"from the future", future, signBody("s3cret", future, body), body, false},
+		{"timestamp not a number", "soon", signBody("s3cret", "soon", body), body, false},
+		{"signature not hex", now, "zz", body, false},
+	} {
+		if got := verifySignal("s3cret", tc.ts, tc.signature, tc.body); got != tc.want {
+			t.Errorf("%s: verifySignal = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSignalRefusesReplay(t *testing.T) {
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{matching.NewSymbolConfig("XLM/USDC")}, nil)
+	eng.Prices.Seed(map[string]float64{"XLM/USDC": 0.1})
+	h := &SignalHandler{
+		Engine:  eng,
+		Orders:  &OrdersHandler{Engine: eng},
+		Sources: map[string]SignalSource{"tv": {Token: "tok", Secret: "s3cret"}},
+		Alerts:  DefaultAlertMapping,
+	}
+	body := `{"symbol":"XLM/USDC","action":"buy","amount":10}`
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/signal", strings.NewReader(body))
+		req.Header.Set("X-Signal-Id", "tv")
+		req.Header.Set("X-Signal-Timestamp", ts)
+		req.Header.Set("X-Signal-Signature", signBody("s3cret", ts, []byte(body)))
+		rec := httptest.NewRecorder()
+		h.Handle(rec, req)
+		return rec.Code
+	}
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("first signal: status %d, want 200", code)
+	}
+	if code := send(); code != http.StatusConflict {
+		t.Fatalf("replayed signal: status %d, want 409", code)
+	}
+}
+
+func TestSeenSignaturesExpire(t *testing.T) {
+	h := &SignalHandler{}
+	now := time.Now()
+	if !h.firstUse("tv:ab", now) || h.firstUse("tv:ab", now.Add(signalMaxSkew)) {
+		t.Fatal("repeat inside the window accepted")
+	}
+	if !h.firstUse("tv:ab", now.Add(3*signalMaxSkew)) {
+		t.Fatal("signature still refused after it could no longer verify")
+	}
+	if len(h.seen) != 1 {
+		t.Errorf("seen holds %d signatures, want expired ones pruned", len(h.seen))
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{
+		matching.NewSymbolConfig("XLM/USDC"),
+		matching.NewSymbolConfig("XLM/EURC"),
+	}, nil)
+	eng.Prices.Seed(map[string]float64{"XLM/USDC": 0.1})
+	h := &SignalHandler{Engine: eng, Alerts: DefaultAlertMapping, MaxSlippageBps: 100}
+
+	for _, tc := range []struct {
+		name    string
+		body    string
+		side    matching.Side
+		price   float64
+		wantErr string
+	}{
+		{"buy crosses above mark", `{"symbol":"XLM/USDC","action":"buy","amount":10}`, matching.Buy, 0.101, ""},
+		{"sell crosses below mark", `{"ticker":"BINANCE:XLMUSDC","action":"sell","amount":"10"}`, matching.Sell, 0.099, ""},
+		{"action is case-insensitive", `{"symbol":"XLM/USDC","action":" BUY ","amount":10}`, matching.Buy, 0.101, ""},
+		{"not an object", `[1]`, "", 0, "not a JSON object"},
+		{"unknown ticker", `{"ticker":"BTCUSDC","action":"buy","amount":10}`, "", 0, "unknown symbol"},
+		{"bad action", `{"symbol":"XLM/USDC","action":"hold","amount":10}`, "", 0, "action must be buy or sell"},
+		{"missing amount", `{"symbol":"XLM/USDC","action":"buy"}`, "", 0, "amount is required"},
+		{"negative amount", `{"symbol":"XLM/USDC","action":"buy","amount":-1}`, "", 0, "positive number"},
+		{"no mark price", `{"symbol":"XLM/EURC","action":"buy","amount":10}`, "", 0, "no mark price"},
+	} {
+		o, err := h.parseSignal([]byte(tc.body))
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if o.Symbol != "XLM/USDC" || o.Side != tc.side || o.Amount != 10 || o.Price != tc.price {
+			t.Errorf("%s: order = %+v, want %s 10 XLM/USDC @ %v", tc.name, o, tc.side, tc.price)
+		}
+	}
+}
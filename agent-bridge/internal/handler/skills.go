@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"agent-bridge/internal/middleware"
 	"agent-bridge/internal/store"
 )
 
@@ -15,24 +16,100 @@ type Skill struct {
 	Params      map[string]string `json:"params,omitempty"`
 }
 
+// skills is the capability registry served by /api/skills. Its /api/bridge
+// paths also form the proxy allowlist (see BridgeAllowlist).
+var skills = []Skill{
+	// ── Read skills ──
+	{
+		Name:        "orderbook",
+		Description: "Get live SDEX order book for a trading pair",
+		Method:      "GET",
+		Path:        "/api/bridge/orderbook",
+		Params:      map[string]string{"symbol": "Trading pair symbol, e.g. XLM/USDC"},
+	},
+	{
+		Name:        "pairs",
+		Description: "List available trading pairs and assets for the current network",
+		Method:      "GET",
+		Path:        "/api/bridge/pairs",
+	},
+	{
+		Name:        "offers",
+		Description: "Get open DEX offers for an account",
+		Method:      "GET",
+		Path:        "/api/bridge/offers",
+		Params:      map[string]string{"account": "Stellar account ID (G...)"},
+	},
+	{
+		Name:        "trades",
+		Description: "Get recent trade history for an account",
+		Method:      "GET",
+		Path:        "/api/bridge/trades",
+		Params:      map[string]string{"account": "Stellar account ID (G...)", "limit": "Number of trades to return (default 20)"},
+	},
+	{
+		Name:        "trustline",
+		Description: "Check trustline status for an asset on an account",
+		Method:      "GET",
+		Path:        "/api/bridge/trustline",
+		Params:      map[string]string{"account": "Stellar account ID (G...)", "asset": "Asset code, e.g. USDC"},
+	},
+	{
+		Name:        "price",
+		Description: "Get current mid-price for a trading pair",
+		Method:      "GET",
+		Path:        "/api/bridge/price",
+		Params:      map[string]string{"symbol": "Trading pair symbol, e.g. XLM/USDC"},
+	},
+	// ── Write skills (return unsigned XDR for agent to sign) ──
+	{
+		Name:        "limit_order",
+		Description: "Build an unsigned limit order transaction (ManageSellOffer). Returns XDR for signing.",
+		Method:      "POST",
+		Path:        "/api/bridge/order/limit",
+		Params:      map[string]string{"account": "Stellar account ID (G...)", "symbol": "Trading pair, e.g. XLM/USDC", "side": "buy or sell", "amount": "Amount to trade", "price": "Limit price"},
+	},
+	{
+		Name:        "market_order",
+		Description: "Build an unsigned market order transaction (PathPaymentStrictSend). Returns XDR for signing.",
+		Method:      "POST",
+		Path:        "/api/bridge/order/market",
+		Params:      map[string]string{"account": "Stellar account ID (G...)", "symbol": "Trading pair, e.g. XLM/USDC", "side": "buy or sell", "amount": "Amount to trade", "slippage": "Slippage tolerance % (default 0.5)"},
+	},
+	{
+		Name:        "cancel_order",
+		Description: "Build an unsigned cancel-offer transaction. Returns XDR for signing.",
+		Method:      "POST",
+		Path:        "/api/bridge/order/cancel",
+		Params:      map[string]string{"account": "Stellar account ID (G...)", "offerId": "Offer ID to cancel", "symbol": "Trading pair of the offer, e.g. XLM/USDC"},
+	},
+	{
+		Name:        "build_trustline",
+		Description: "Build an unsigned ChangeTrust transaction for an asset. Returns XDR for signing.",
+		Method:      "POST",
+		Path:        "/api/bridge/trustline/build",
+		Params:      map[string]string{"account": "Stellar account ID (G...)", "asset": "Asset code, e.g. USDC"},
+	},
+	{
+		Name:        "submit_tx",
+		Description: "Submit a signed transaction XDR to the Stellar network.",
+		Method:      "POST",
+		Path:        "/api/bridge/tx/submit",
+		Params:      map[string]string{"signedXdr": "Signed transaction XDR string"},
+	},
+}
+
 type SkillsHandler struct {
 	Store *store.Store
 }
 
 func (h *SkillsHandler) List(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
 
-	token := r.Header.Get("X-Agent-Token")
-	if token == "" {
-		token = r.URL.Query().Get("token")
-	}
-	if token == "" || !h.Store.ValidateToken(token) {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
+	token := middleware.ConnectionFrom(r.Context()).Token
 
 	// Agent fetching skills = first contact
 	if h.Store.MarkAgentConnected(token) {
@@ -46,87 +123,6 @@ func (h *SkillsHandler) List(w http.ResponseWriter, r *http.Request) {
 		Source:  "agent",
 	})
 
-	skills := []Skill{
-		// ── Read skills ──
-		{
-			Name:        "orderbook",
-			Description: "Get live SDEX order book for a trading pair",
-			Method:      "GET",
-			Path:        "/api/bridge/orderbook",
-			Params:      map[string]string{"symbol": "Trading pair symbol, e.g. XLM/USDC"},
-		},
-		{
-			Name:        "pairs",
-			Description: "List available trading pairs and assets for the current network",
-			Method:      "GET",
-			Path:        "/api/bridge/pairs",
-		},
-		{
-			Name:        "offers",
-			Description: "Get open DEX offers for an account",
-			Method:      "GET",
-			Path:        "/api/bridge/offers",
-			Params:      map[string]string{"account": "Stellar account ID (G...)"},
-		},
-		{
-			Name:        "trades",
-			Description: "Get recent trade history for an account",
-			Method:      "GET",
-			Path:        "/api/bridge/trades",
-			Params:      map[string]string{"account": "Stellar account ID (G...)", "limit": "Number of trades to return (default 20)"},
-		},
-		{
-			Name:        "trustline",
-			Description: "Check trustline status for an asset on an account",
-			Method:      "GET",
-			Path:        "/api/bridge/trustline",
-			Params:      map[string]string{"account": "Stellar account ID (G...)", "asset": "Asset code, e.g. USDC"},
-		},
-		{
-			Name:        "price",
-			Description: "Get current mid-price for a trading pair",
-			Method:      "GET",
-			Path:        "/api/bridge/price",
-			Params:      map[string]string{"symbol": "Trading pair symbol, e.g. XLM/USDC"},
-		},
-		// ── Write skills (return unsigned XDR for agent to sign) ──
-		{
-			Name:        "limit_order",
-			Description: "Build an unsigned limit order transaction (ManageSellOffer). Returns XDR for signing.",
-			Method:      "POST",
-			Path:        "/api/bridge/order/limit",
-			Params:      map[string]string{"account": "Stellar account ID (G...)", "symbol": "Trading pair, e.g. XLM/USDC", "side": "buy or sell", "amount": "Amount to trade", "price": "Limit price"},
-		},
-		{
-			Name:        "market_order",
-			Description: "Build an unsigned market order transaction (PathPaymentStrictSend). Returns XDR for signing.",
-			Method:      "POST",
-			Path:        "/api/bridge/order/market",
-			Params:      map[string]string{"account": "Stellar account ID (G...)", "symbol": "Trading pair, e.g. XLM/USDC", "side": "buy or sell", "amount": "Amount to trade", "slippage": "Slippage tolerance % (default 0.5)"},
-		},
-		{
-			Name:        "cancel_order",
-			Description: "Build an unsigned cancel-offer transaction. Returns XDR for signing.",
-			Method:      "POST",
-			Path:        "/api/bridge/order/cancel",
-			Params:      map[string]string{"account": "Stellar account ID (G...)", "offerId": "Offer ID to cancel", "symbol": "Trading pair of the offer, e.g. XLM/USDC"},
-		},
-		{
-			Name:        "build_trustline",
-			Description: "Build an unsigned ChangeTrust transaction for an asset. Returns XDR for signing.",
-			Method:      "POST",
-			Path:        "/api/bridge/trustline/build",
-			Params:      map[string]string{"account": "Stellar account ID (G...)", "asset": "Asset code, e.g. USDC"},
-		},
-		{
-			Name:        "submit_tx",
-			Description: "Submit a signed transaction XDR to the Stellar network.",
-			Method:      "POST",
-			Path:        "/api/bridge/tx/submit",
-			Params:      map[string]string{"signedXdr": "Signed transaction XDR string"},
-		},
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{"skills": skills})
 }
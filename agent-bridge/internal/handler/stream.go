@@ -2,31 +2,45 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"agent-bridge/internal/middleware"
 	"agent-bridge/internal/store"
 )
 
 type StreamHandler struct {
 	Store *store.Store
+	// MaxLifetime, when positive, ends each stream after that long with an
+	// "event: reconnect" frame; the client's EventSource then reconnects.
+	MaxLifetime time.Duration
 }
 
 func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
 
-	token := r.URL.Query().Get("token")
-	if token == "" || !h.Store.ValidateToken(token) {
-		http.Error(w, "invalid token", http.StatusNotFound)
+	token := middleware.ConnectionFrom(r.Context()).Token
+
+	// ?delivery=block queues entries for this stream for a while rather than
+	// dropping them when it falls behind; see store.SubscribeWithPolicy.
+	policy := store.DeliveryDrop
+	switch d := r.URL.Query().Get("delivery"); d {
+	case "", string(store.DeliveryDrop):
+	case string(store.DeliveryBlock):
+		policy = store.DeliveryBlock
+	default:
+		writeValidationError(w, fieldErrors{"delivery": `must be "drop" or "block"`})
 		return
 	}
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "streaming not supported")
 		return
 	}
 
@@ -34,9 +48,13 @@ func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	ch := h.Store.Subscribe(token)
-	if ch == nil {
-		http.Error(w, "invalid token", http.StatusNotFound)
+	ch, err := h.Store.SubscribeWithPolicy(token, policy)
+	if errors.Is(err, store.ErrSubscriberLimit) {
+		writeJSONError(w, http.StatusTooManyRequests, "rate_limited", err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "invalid_token", "invalid token")
 		return
 	}
 	defer h.Store.Unsubscribe(token, ch)
@@ -45,13 +63,30 @@ func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "event: connected\ndata: {\"status\":\"connected\"}\n\n")
 	flusher.Flush()
 
+	var expired <-chan time.Time
+	if h.MaxLifetime > 0 {
+		timer := time.NewTimer(h.MaxLifetime)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
 	ctx := r.Context()
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-expired:
+			fmt.Fprintf(w, "event: reconnect\ndata: {\"reason\":\"max_lifetime\"}\n\n")
+			flusher.Flush()
+			return
 		case entry, ok := <-ch:
 			if !ok {
+				// Closed by Store.ResetAgent while the token lives on: ask the
+				// client to reconnect. After DeleteToken it would only get a 404.
+				if h.Store.ValidateToken(token) {
+					fmt.Fprintf(w, "event: reconnect\ndata: {\"reason\":\"disconnected\"}\n\n")
+					flusher.Flush()
+				}
 				return
 			}
 			data, err := json.Marshal(entry)
@@ -63,7 +98,8 @@ func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
 			// can add dedicated addEventListener() handlers. Regular logs use
 			// the default "message" event (caught by onmessage).
 			switch entry.EventType {
-			case "insight", "context_update":
+			case "insight", "context_update", "fill", "order_cancelled", "liquidation", "alert", "margin_warning", "stream_warning",
+				"agent_request", "agent_response":
 				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", entry.EventType, data)
 			default:
 				fmt.Fprintf(w, "data: %s\n\n", data)
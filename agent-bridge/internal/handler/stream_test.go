@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-bridge/internal/middleware"
+	"agent-bridge/internal/store"
+)
+
+// startStream serves StreamHandler behind RequireToken, opens a stream for a
+// fresh token and returns the store, token, a frame reader and a cancel func.
+// opts adjust the handler before it starts serving.
+func startStream(t *testing.T, opts ...func(*StreamHandler)) (*store.Store, string, func() []string, context.CancelFunc) {
+	t.Helper()
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &StreamHandler{Store: s}
+	for _, opt := range opts {
+		opt(h)
+	}
+	srv := httptest.NewServer(middleware.RequireToken(s, http.HandlerFunc(h.Stream)))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?token="+token, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	// next returns the lines of the next SSE frame (up to the blank line).
+	next := func() []string {
+		t.Helper()
+		var frame []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read frame: %v (got %q)", err, frame)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return frame
+			}
+			frame = append(frame, line)
+		}
+	}
+	return s, token, next, cancel
+}
+
+func TestStreamWireFormat(t *testing.T) {
+	s, token, next, _ := startStream(t)
+
+	got := next()
+	want := []string{"event: connected", `data: {"status":"connected"}`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("first frame = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		eventType string
+		wantEvent string // "" = default message event (no event: line)
+	}{
+		{"", ""},
+		{"log", ""},
+		{"insight", "insight"},
+		{"context_update", "context_update"},
+		{"fill", "fill"},
+		{"liquidation", "liquidation"},
+		{"alert", "alert"},
+	}
+	for _, tt := range tests {
+		s.Publish(token, store.LogEntry{Message: "m-" + tt.eventType, Source: "test", EventType: tt.eventType})
+		frame := next()
+
+		dataLine := frame[len(frame)-1]
+		if tt.wantEvent == "" {
+			if len(frame) != 1 {
+				t.Errorf("%q: frame = %q, want a bare data line", tt.eventType, frame)
+			}
+		} else if len(frame) != 2 || frame[0] != "event: "+tt.wantEvent {
+			t.Errorf("%q: frame = %q, want event: %s", tt.eventType, frame, tt.wantEvent)
+		}
+
+		if !strings.HasPrefix(dataLine, "data: ") {
+			t.Fatalf("%q: no data line in %q", tt.eventType, frame)
+		}
+		var entry store.LogEntry
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(dataLine, "data: ")), &entry); err != nil {
+			t.Fatalf("%q: data is not JSON: %v", tt.eventType, err)
+		}
+		if entry.Message != "m-"+tt.eventType || entry.EventType != tt.eventType || entry.Timestamp == "" {
+			t.Errorf("%q: entry = %+v", tt.eventType, entry)
+		}
+	}
+}
+
+func TestStreamUnsubscribesOnCancel(t *testing.T) {
+	s, token, next, cancel := startStream(t)
+	s.SetMaxSubscribers(1)
+	next() // connected
+
+	if _, err := s.Subscribe(token); err == nil {
+		t.Fatal("expected the open stream to hold the only subscriber slot")
+	}
+
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ch, err := s.Subscribe(token)
+		if err == nil {
+			s.Unsubscribe(token, ch)
+			return // handler returned and released its subscription
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream still subscribed after cancel: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamMaxLifetime(t *testing.T) {
+	s, token, next, _ := startStream(t, func(h *StreamHandler) { h.MaxLifetime = 50 * time.Millisecond })
+	s.SetMaxSubscribers(1)
+	next() // connected
+
+	got := next()
+	want := []string{"event: reconnect", `data: {"reason":"max_lifetime"}`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("frame = %q, want %q", got, want)
+	}
+	// The handler has returned, releasing its subscription.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ch, err := s.Subscribe(token)
+		if err == nil {
+			s.Unsubscribe(token, ch)
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream still subscribed after its lifetime: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamRejectsUnknownDelivery(t *testing.T) {
+	s := store.NewStore(nil)
+	token, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &StreamHandler{Store: s}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/logs/stream?delivery=sometimes&token="+token, nil)
+	middleware.RequireToken(s, http.HandlerFunc(h.Stream)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if conns := s.ListConnections(); len(conns) != 1 || conns[0].Subscribers != 0 {
+		t.Errorf("connections = %+v, want no subscriber registered", conns)
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agent-bridge/internal/matching"
+)
+
+// SymbolsHandler lets a generic agent discover which markets the engine
+// trades without hardcoding "XLM/USDC".
+// GET /api/symbols — list tradable symbols with assets, sizing and mark price
+type SymbolsHandler struct {
+	Engine *matching.Engine
+}
+
+type symbolInfo struct {
+	Symbol      string  `json:"symbol"`
+	Base        string  `json:"base"`
+	Counter     string  `json:"counter"`
+	TickSize    float64 `json:"tickSize,omitempty"`
+	LotSize     float64 `json:"lotSize,omitempty"`
+	MinNotional float64 `json:"minNotional,omitempty"`
+	MaxLeverage int     `json:"maxLeverage"`
+	MarkPrice   float64 `json:"markPrice"` // 0 when the feed has no price yet
+}
+
+func (h *SymbolsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+
+	cfgs := h.Engine.Symbols()
+	out := make([]symbolInfo, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		out = append(out, symbolInfo{
+			Symbol:      cfg.Symbol,
+			Base:        cfg.Base,
+			Counter:     cfg.Counter,
+			TickSize:    cfg.TickSize,
+			LotSize:     cfg.LotSize,
+			MinNotional: cfg.MinNotional,
+			MaxLeverage: cfg.LeverageCap(),
+			MarkPrice:   h.Engine.Prices.GetMarkPrice(cfg.Symbol),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"symbols": out})
+}
@@ -13,16 +13,21 @@ type TokenHandler struct {
 
 func (h *TokenHandler) Generate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 		return
 	}
 
 	token, err := h.Store.CreateToken()
 	if err != nil {
-		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "failed to generate token")
 		return
 	}
 
+	network, pair := h.Store.Defaults()
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(map[string]string{
+		"token":       token,
+		"network":     network,
+		"active_pair": pair,
+	})
 }
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"agent-bridge/internal/matching"
+)
+
+// AlertMapping describes where the fields we care about live in a TradingView
+// alert body. Each value is a field name, or a dotted path for nested objects
+// (e.g. "strategy.order_price"). Users set it with TRADINGVIEW_ALERT_MAPPING:
+//
+//	TRADINGVIEW_ALERT_MAPPING={"symbol":"ticker","price":"close","action":"strategy.order_action"}
+//
+// Empty fields fall back to the defaults below.
+type AlertMapping struct {
+	Symbol     string `json:"symbol"`
+	Price      string `json:"price"`
+	Action     string `json:"action"`
+	Passphrase string `json:"passphrase"`
+}
+
+// DefaultAlertMapping matches the payload most TradingView alert templates use:
+// {"ticker":"{{ticker}}","close":"{{close}}","action":"buy"}.
+var DefaultAlertMapping = AlertMapping{
+	Symbol:     "ticker",
+	Price:      "close",
+	Action:     "action",
+	Passphrase: "passphrase",
+}
+
+// ParseAlertMapping reads a mapping from its JSON form. An empty string yields
+// DefaultAlertMapping; unset fields inherit the default.
+func ParseAlertMapping(raw string) (AlertMapping, error) {
+	m := DefaultAlertMapping
+	if strings.TrimSpace(raw) == "" {
+		return m, nil
+	}
+	var override AlertMapping
+	if err := json.Unmarshal([]byte(raw), &override); err != nil {
+		return m, fmt.Errorf("parse alert mapping: %w", err)
+	}
+	if override.Symbol != "" {
+		m.Symbol = override.Symbol
+	}
+	if override.Price != "" {
+		m.Price = override.Price
+	}
+	if override.Action != "" {
+		m.Action = override.Action
+	}
+	if override.Passphrase != "" {
+		m.Passphrase = override.Passphrase
+	}
+	return m, nil
+}
+
+// Alert is a TradingView alert reduced to our symbol/price model.
+type Alert struct {
+	Symbol     string  // normalized, e.g. "XLM/USDC"
+	Price      float64 // 0 when the alert carries no price
+	Action     string  // lowercased "buy" / "sell", or "" if absent
+	Passphrase string
+}
+
+// ParseAlert decodes a TradingView alert body using m. Tickers without a
+// separator ("XLMUSDC", "BINANCE:XLMUSDC") are resolved against known, the
+// list of tradable symbols. Numbers may be sent as JSON numbers or strings.
+func ParseAlert(body []byte, m AlertMapping, known []string) (Alert, error) {
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return Alert{}, fmt.Errorf("alert is not a JSON object: %w", err)
+	}
+
+	var a Alert
+	ticker, _ := lookupField(payload, m.Symbol).(string)
+	if ticker == "" {
+		return Alert{}, fmt.Errorf("alert has no %q field", m.Symbol)
+	}
+	symbol, err := resolveTicker(ticker, known)
+	if err != nil {
+		return Alert{}, err
+	}
+	a.Symbol = symbol
+
+	if v := lookupField(payload, m.Price); v != nil {
+		price, err := toFloat(v)
+		if err != nil {
+			return Alert{}, fmt.Errorf("field %q: %w", m.Price, err)
+		}
+		a.Price = price
+	}
+
+	action, _ := lookupField(payload, m.Action).(string)
+	a.Action = strings.ToLower(strings.TrimSpace(action))
+	a.Passphrase, _ = lookupField(payload, m.Passphrase).(string)
+	return a, nil
+}
+
+// lookupField walks a dotted path through nested JSON objects.
+func lookupField(payload map[string]any, path string) any {
+	if path == "" {
+		return nil
+	}
+	var cur any = payload
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = obj[key]
+	}
+	return cur
+}
+
+// toFloat accepts a JSON number or a numeric string ("0.1234").
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", n)
+		}
+		return f, nil
+	default:
+		return 0, errors.New("expected a number")
+	}
+}
+
+// resolveTicker maps a TradingView ticker onto a tradable symbol. An exchange
+// prefix ("BINANCE:") is dropped; tickers with a separator go through
+// NormalizeSymbol, and bare ones ("XLMUSDC") are compared without it. Either
+// way the result must be one of known.
+func resolveTicker(ticker string, known []string) (string, error) {
+	if i := strings.LastIndex(ticker, ":"); i >= 0 {
+		ticker = ticker[i+1:]
+	}
+	if strings.ContainsAny(ticker, "/-_") {
+		sym, err := matching.NormalizeSymbol(ticker)
+		if err != nil {
+			return "", err
+		}
+		if slices.Contains(known, sym) {
+			return sym, nil
+		}
+	} else {
+		bare := strings.ToUpper(ticker)
+		for _, sym := range known {
+			if strings.ReplaceAll(sym, "/", "") == bare {
+				return sym, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", matching.ErrUnknownSymbol, ticker)
+}
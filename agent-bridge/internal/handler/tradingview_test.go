@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agent-bridge/internal/matching"
+)
+
+var tradable = []string{"XLM/USDC", "XLM/EURC"}
+
+func TestParseAlert(t *testing.T) {
+	nested := AlertMapping{Symbol: "ticker", Price: "strategy.order_price", Action: "strategy.order_action", Passphrase: "passphrase"}
+	for _, tc := range []struct {
+		name    string
+		body    string
+		m       AlertMapping
+		want    Alert
+		wantErr string
+	}{
+		{"default mapping", `{"ticker":"XLMUSDC","close":0.12,"action":"buy","passphrase":"pw"}`, DefaultAlertMapping,
+			Alert{Symbol: "XLM/USDC", Price: 0.12, Action: "buy", Passphrase: "pw"}, ""},
+		{"nested path", `{"ticker":"XLM/EURC","strategy":{"order_price":"0.095","order_action":" SELL "}}`, nested,
+			Alert{Symbol: "XLM/EURC", Price: 0.095, Action: "sell"}, ""},
+		{"no price", `{"ticker":"XLMUSDC"}`, DefaultAlertMapping, Alert{Symbol: "XLM/USDC"}, ""},
+		{"not an object", `"XLMUSDC"`, DefaultAlertMapping, Alert{}, "not a JSON object"},
+		{"missing ticker", `{"close":0.12}`, DefaultAlertMapping, Alert{}, `no "ticker" field`},
+		{"bad price", `{"ticker":"XLMUSDC","close":"soon"}`, DefaultAlertMapping, Alert{}, `field "close"`},
+		{"untradable ticker", `{"ticker":"BTC/USDC","close":1}`, DefaultAlertMapping, Alert{}, "unknown symbol"},
+	} {
+		got, err := ParseAlert([]byte(tc.body), tc.m, tradable)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: alert = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestResolveTicker(t *testing.T) {
+	for _, tc := range []struct {
+		ticker string
+		want   string // "" means ErrUnknownSymbol
+	}{
+		{"XLMUSDC", "XLM/USDC"},
+		{"BINANCE:XLMUSDC", "XLM/USDC"},
+		{"xlmeurc", "XLM/EURC"},
+		{"xlm-usdc", "XLM/USDC"},
+		{"COINBASE:XLM_EURC", "XLM/EURC"},
+		{"XLM/BTC", ""},
+		{"BTCUSDC", ""},
+	} {
+		got, err := resolveTicker(tc.ticker, tradable)
+		if tc.want == "" {
+			if !errors.Is(err, matching.ErrUnknownSymbol) {
+				t.Errorf("%s: got %q, %v, want ErrUnknownSymbol", tc.ticker, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %q, %v, want %q", tc.ticker, got, err, tc.want)
+		}
+	}
+}
+
+func TestToFloat(t *testing.T) {
+	for _, tc := range []struct {
+		in   any
+		want float64
+		ok   bool
+	}{
+		{0.25, 0.25, true},
+		{" 0.1234 ", 0.1234, true},
+		{"0.1.2", 0, false},
+		{true, 0, false},
+		{nil, 0, false},
+	} {
+		got, err := toFloat(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("toFloat(%#v) = %v, %v, want %v ok=%v", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestParseAlertMapping(t *testing.T) {
+	m, err := ParseAlertMapping("  ")
+	if err != nil || m != DefaultAlertMapping {
+		t.Fatalf("empty: %+v, %v, want the default", m, err)
+	}
+	m, err = ParseAlertMapping(`{"price":"strategy.order_price"}`)
+	want := DefaultAlertMapping
+	want.Price = "strategy.order_price"
+	if err != nil || m != want {
+		t.Fatalf("override: %+v, %v, want %+v", m, err, want)
+	}
+	if _, err := ParseAlertMapping(`{"price":`); err == nil {
+		t.Fatal("invalid JSON accepted")
+	}
+}
+
+func TestWebhookChecksPassphrase(t *testing.T) {
+	eng := matching.NewEngine("", "", []matching.SymbolConfig{matching.NewSymbolConfig("XLM/USDC")}, nil)
+	h := &PricesHandler{Engine: eng, AdminSecret: "s3cret", Alerts: DefaultAlertMapping}
+
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`{"ticker":"XLMUSDC","close":0.12,"passphrase":"wrong"}`, http.StatusUnauthorized},
+		{`{"ticker":"XLMUSDC","close":0.12}`, http.StatusUnauthorized},
+		{`{"ticker":"XLMUSDC","close":0.12,"passphrase":"s3cret"}`, http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		h.Webhook(rec, httptest.NewRequest(http.MethodPost, "/api/price/update", strings.NewReader(tc.body)))
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.body, rec.Code, tc.want)
+		}
+	}
+	if got := eng.Prices.GetMarkPrice("XLM/USDC"); got != 0.12 {
+		t.Errorf("mark = %v, want 0.12", got)
+	}
+}
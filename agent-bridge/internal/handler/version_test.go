@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	h := &VersionHandler{Build: NewBuildInfo("v1.2.3", "abc123", "2026-01-02T03:04:05Z")}
+	rec := httptest.NewRecorder()
+	h.Get(rec, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+
+	var got BuildInfo
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d, decode error %v", rec.Code, err)
+	}
+	want := BuildInfo{Version: "v1.2.3", Commit: "abc123", BuildTime: "2026-01-02T03:04:05Z", GoVersion: runtime.Version()}
+	if got != want {
+		t.Fatalf("version = %+v, want %+v", got, want)
+	}
+}
+
+func TestBuildInfoFallback(t *testing.T) {
+	// Test binaries carry no ldflags and no VCS stamp.
+	got := NewBuildInfo("", "", "")
+	if got.Version == "" || got.Commit == "" || got.BuildTime == "" || got.GoVersion != runtime.Version() {
+		t.Fatalf("fallback build info = %+v, want every field filled", got)
+	}
+}
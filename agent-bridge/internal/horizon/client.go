@@ -0,0 +1,491 @@
+// Package horizon is a small shared client for the Stellar Horizon REST API.
+// Every watcher goes through one Client so connections are pooled and each
+// request identifies the bridge, as Horizon asks integrators to do.
+package horizon
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ClientName and ClientVersion are sent as User-Agent and as Horizon's
+	// X-Client-Name / X-Client-Version headers.
+	ClientName    = "agent-bridge"
+	ClientVersion = "0.1.0"
+
+	// requestTimeout bounds one-shot requests; streams are bounded by ctx only.
+	requestTimeout = 15 * time.Second
+)
+
+// Client wraps an http.Client with a pooled transport tuned for many
+// long-lived streams and frequent polls against a handful of Horizon hosts.
+type Client struct {
+	http      *http.Client
+	userAgent string
+
+	cacheMu    sync.Mutex
+	validators map[string]validator // request URL -> last response validators
+}
+
+// validator remembers what a previous response looked like so an unchanged
+// resource can be detected: by HTTP validators when Horizon sends them, and
+// by a body hash when it doesn't.
+type validator struct {
+	etag         string
+	lastModified string
+	bodyHash     [sha256.Size]byte
+}
+
+// NewClient returns a Client with a tuned transport and descriptive User-Agent.
+func NewClient() *Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 32, // few hosts, many concurrent pollers/streams
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &Client{
+		http:       &http.Client{Transport: transport},
+		userAgent:  fmt.Sprintf("%s/%s (+https://github.com/daiwikmh/fin)", ClientName, ClientVersion),
+		validators: make(map[string]validator),
+	}
+}
+
+// newRequest builds a GET request for base+path with the identifying headers.
+func (c *Client) newRequest(ctx context.Context, base, path string, query url.Values) (*http.Request, error) {
+	u := base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("X-Client-Name", ClientName)
+	req.Header.Set("X-Client-Version", ClientVersion)
+	return req, nil
+}
+
+// getJSON fetches base+path and decodes a 200 response into out.
+func (c *Client) getJSON(ctx context.Context, base, path string, query url.Values, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := c.newRequest(ctx, base, path, query)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("horizon %s: HTTP %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ── Order book ───────────────────────────────────────────────────────────────
+
+// Asset identifies one side of an order book query.
+type Asset struct {
+	Type   string // "native" | "credit_alphanum4" | "credit_alphanum12"
+	Code   string // empty for native
+	Issuer string // empty for native
+}
+
+// PriceLevel is one aggregated order book level; values are decimal strings
+// as Horizon returns them.
+type PriceLevel struct {
+	Price  string `json:"price"`
+	Amount string `json:"amount"`
+}
+
+// Parse returns the level's price and amount. Both must be present, and the
+// price positive: a level that fails is malformed, not empty.
+func (l PriceLevel) Parse() (price, amount float64, err error) {
+	price, err = requireNumber("price", l.Price)
+	if err == nil && price == 0 {
+		err = fmt.Errorf("price: zero")
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if amount, err = requireNumber("amount", l.Amount); err != nil {
+		return 0, 0, err
+	}
+	return price, amount, nil
+}
+
+// OrderBook is a Horizon /order_book response.
+type OrderBook struct {
+	Bids []PriceLevel `json:"bids"`
+	Asks []PriceLevel `json:"asks"`
+}
+
+// validate checks every level parses, so a book handed to callers never
+// turns a bad field into a silent zero.
+func (ob *OrderBook) validate() error {
+	for _, side := range []struct {
+		name   string
+		levels []PriceLevel
+	}{{"bids", ob.Bids}, {"asks", ob.Asks}} {
+		for i, l := range side.levels {
+			if _, _, err := l.Parse(); err != nil {
+				return fmt.Errorf("%w: /order_book %s[%d] %v", ErrMalformed, side.name, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// OrderBookQuery builds the /order_book query string for a pair.
+func OrderBookQuery(selling, buying Asset, limit int) url.Values {
+	q := url.Values{}
+	addAsset(q, "selling", selling)
+	addAsset(q, "buying", buying)
+	q.Set("limit", fmt.Sprint(limit))
+	return q
+}
+
+func addAsset(q url.Values, prefix string, a Asset) {
+	q.Set(prefix+"_asset_type", a.Type)
+	if a.Type != "native" {
+		q.Set(prefix+"_asset_code", a.Code)
+		q.Set(prefix+"_asset_issuer", a.Issuer)
+	}
+}
+
+// OrderBook fetches the top limit levels of the selling/buying book.
+func (c *Client) OrderBook(ctx context.Context, base string, selling, buying Asset, limit int) (*OrderBook, error) {
+	var ob OrderBook
+	if err := c.getJSON(ctx, base, "/order_book", OrderBookQuery(selling, buying, limit), &ob); err != nil {
+		return nil, err
+	}
+	if err := ob.validate(); err != nil {
+		return nil, err
+	}
+	return &ob, nil
+}
+
+// OrderBookIfChanged is OrderBook for pollers: it sends If-None-Match /
+// If-Modified-Since from the previous response and reports changed=false
+// (with a nil book) on a 304 or when the body hashes the same as last time,
+// so callers can skip decoding and re-evaluating an unchanged book. A
+// malformed book is an ErrMalformed error and is not remembered, so the
+// next poll evaluates whatever Horizon sends rather than calling it
+// unchanged.
+func (c *Client) OrderBookIfChanged(ctx context.Context, base string, selling, buying Asset, limit int) (ob *OrderBook, changed bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := c.newRequest(ctx, base, "/order_book", OrderBookQuery(selling, buying, limit))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	key := req.URL.String()
+
+	c.cacheMu.Lock()
+	prev, seen := c.validators[key]
+	c.cacheMu.Unlock()
+	if prev.etag != "" {
+		req.Header.Set("If-None-Match", prev.etag)
+	}
+	if prev.lastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.lastModified)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("horizon /order_book: HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	next := validator{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		bodyHash:     sha256.Sum256(body),
+	}
+	if seen && next.bodyHash == prev.bodyHash {
+		return nil, false, nil
+	}
+
+	var book OrderBook
+	if err := json.Unmarshal(body, &book); err != nil {
+		c.forget(key)
+		return nil, false, fmt.Errorf("%w: /order_book: %v", ErrMalformed, err)
+	}
+	if err := book.validate(); err != nil {
+		c.forget(key)
+		return nil, false, err
+	}
+	c.cacheMu.Lock()
+	c.validators[key] = next
+	c.cacheMu.Unlock()
+	return &book, true, nil
+}
+
+// forget drops the validators for key so its next request is unconditional.
+func (c *Client) forget(key string) {
+	c.cacheMu.Lock()
+	delete(c.validators, key)
+	c.cacheMu.Unlock()
+}
+
+// ── Accounts ─────────────────────────────────────────────────────────────────
+
+// AccountExists reports whether accountID exists (is funded) on the Horizon
+// at base. A 404 is (false, nil); any other failure is an error.
+func (c *Client) AccountExists(ctx context.Context, base, accountID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := c.newRequest(ctx, base, "/accounts/"+url.PathEscape(accountID), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("horizon /accounts: HTTP %d", resp.StatusCode)
+	}
+}
+
+// Balance is one entry of an account's balances array.
+type Balance struct {
+	Balance     string `json:"balance"`
+	AssetType   string `json:"asset_type"` // "native" | "credit_alphanum4" | "credit_alphanum12" | "liquidity_pool_shares"
+	AssetCode   string `json:"asset_code"`
+	AssetIssuer string `json:"asset_issuer"`
+	Limit       string `json:"limit"`             // trustline limit; empty for native
+	PoolID      string `json:"liquidity_pool_id"` // set for pool shares only
+}
+
+// AccountBalances returns accountID's balances. An account that doesn't
+// exist (yet) has none: a 404 is (nil, nil).
+func (c *Client) AccountBalances(ctx context.Context, base, accountID string) ([]Balance, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := c.newRequest(ctx, base, "/accounts/"+url.PathEscape(accountID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("horizon /accounts: HTTP %d", resp.StatusCode)
+	}
+	var account struct {
+		Balances []Balance `json:"balances"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return nil, err
+	}
+	return account.Balances, nil
+}
+
+// ── Account offers and trades ────────────────────────────────────────────────
+
+// Offer is one open DEX offer from /accounts/{id}/offers.
+type Offer struct {
+	ID      string `json:"id"`
+	Amount  string `json:"amount"`
+	Price   string `json:"price"`
+	Selling struct {
+		AssetType string `json:"asset_type"`
+		AssetCode string `json:"asset_code"`
+	} `json:"selling"`
+	Buying struct {
+		AssetType string `json:"asset_type"`
+		AssetCode string `json:"asset_code"`
+	} `json:"buying"`
+}
+
+// AccountOffers returns up to limit open offers for accountID.
+func (c *Client) AccountOffers(ctx context.Context, base, accountID string, limit int) ([]Offer, error) {
+	var page struct {
+		Embedded struct {
+			Records []Offer `json:"records"`
+		} `json:"_embedded"`
+	}
+	q := url.Values{"limit": {fmt.Sprint(limit)}}
+	if err := c.getJSON(ctx, base, "/accounts/"+url.PathEscape(accountID)+"/offers", q, &page); err != nil {
+		return nil, err
+	}
+	return page.Embedded.Records, nil
+}
+
+// Trade is one fill from /accounts/{id}/trades.
+type Trade struct {
+	ID               string `json:"id"`
+	LedgerCloseTime  string `json:"ledger_close_time"`
+	BaseAssetType    string `json:"base_asset_type"`
+	BaseAssetCode    string `json:"base_asset_code"`
+	CounterAssetType string `json:"counter_asset_type"`
+	CounterAssetCode string `json:"counter_asset_code"`
+	BaseAmount       string `json:"base_amount"`
+	CounterAmount    string `json:"counter_amount"`
+	BaseIsSeller     bool   `json:"base_is_seller"`
+	Price            struct {
+		N json.Number `json:"n"`
+		D json.Number `json:"d"`
+	} `json:"price"`
+}
+
+// AccountTrades returns the latest limit trades for accountID, newest first.
+func (c *Client) AccountTrades(ctx context.Context, base, accountID string, limit int) ([]Trade, error) {
+	var page struct {
+		Embedded struct {
+			Records []Trade `json:"records"`
+		} `json:"_embedded"`
+	}
+	q := url.Values{"limit": {fmt.Sprint(limit)}, "order": {"desc"}}
+	if err := c.getJSON(ctx, base, "/accounts/"+url.PathEscape(accountID)+"/trades", q, &page); err != nil {
+		return nil, err
+	}
+	return page.Embedded.Records, nil
+}
+
+// ── Numbers ──────────────────────────────────────────────────────────────────
+
+// ErrMalformed marks a Horizon response that decoded but carries a field
+// that doesn't parse, such as a non-numeric amount.
+var ErrMalformed = errors.New("malformed Horizon response")
+
+// ParseNumber parses one of Horizon's stringified decimals ("12.5000000").
+// An empty string is an absent field and gives (0, false, nil), so callers
+// can tell it from a real "0"; anything else must be a finite, non-negative
+// decimal or err says why.
+func ParseNumber(raw string) (v float64, present bool, err error) {
+	if raw == "" {
+		return 0, false, nil
+	}
+	v, err = strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		return 0, true, fmt.Errorf("malformed number %q", raw)
+	}
+	return v, true, nil
+}
+
+// requireNumber is ParseNumber for a field that must be present.
+func requireNumber(field, raw string) (float64, error) {
+	v, present, err := ParseNumber(raw)
+	if err == nil && !present {
+		err = fmt.Errorf("missing")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", field, err)
+	}
+	return v, nil
+}
+
+// ── Streaming ────────────────────────────────────────────────────────────────
+
+// Event is one server-sent event from a Horizon stream. ID is Horizon's paging
+// token for the record, usable as cursor= to resume after it.
+type Event struct {
+	Name string
+	Data string
+	ID   string
+}
+
+// Stream opens the Horizon SSE endpoint at streamURL and calls onEvent for
+// each complete event. Horizon's "hello" greeting is skipped. It returns when
+// the stream ends, fails, or ctx is cancelled.
+func (c *Client) Stream(ctx context.Context, streamURL string, onEvent func(Event)) error {
+	req, err := c.newRequest(ctx, streamURL, "", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("horizon stream: HTTP %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	buf := make([]byte, 512*1024)
+	scanner.Buffer(buf, cap(buf))
+
+	var ev Event
+	var data []string
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Text()
+		if line == "" {
+			// Blank line ends an event.
+			ev.Data = strings.Join(data, "\n")
+			if len(data) > 0 && ev.Data != `"hello"` {
+				onEvent(ev)
+			}
+			ev, data = Event{}, nil
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Name = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			ev.ID = value
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,46 @@
+package horizon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	for _, tc := range []struct {
+		raw     string
+		want    float64
+		present bool
+		bad     bool
+	}{
+		{raw: "", present: false},
+		{raw: "0", want: 0, present: true},
+		{raw: "12.5000000", want: 12.5, present: true},
+		{raw: "abc", present: true, bad: true},
+		{raw: "-1", present: true, bad: true},
+		{raw: "NaN", present: true, bad: true},
+		{raw: "Inf", present: true, bad: true},
+	} {
+		v, present, err := ParseNumber(tc.raw)
+		if v != tc.want || present != tc.present || (err != nil) != tc.bad {
+			t.Errorf("ParseNumber(%q) = %v, %v, %v", tc.raw, v, present, err)
+		}
+	}
+}
+
+func TestOrderBookValidate(t *testing.T) {
+	ob := OrderBook{
+		Bids: []PriceLevel{{Price: "0.1", Amount: "5"}},
+		Asks: []PriceLevel{{Price: "0.2", Amount: "5"}, {Price: "0.3"}},
+	}
+	err := ob.validate()
+	if !errors.Is(err, ErrMalformed) {
+		t.Fatalf("validate = %v, want ErrMalformed", err)
+	}
+	if want := "malformed Horizon response: /order_book asks[1] amount: missing"; err.Error() != want {
+		t.Errorf("error %q, want %q", err, want)
+	}
+	ob.Asks = ob.Asks[:1]
+	if err := ob.validate(); err != nil {
+		t.Errorf("valid book: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package matching
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+// BreakerMode is what the price circuit breaker does with a move it trips on.
+type BreakerMode string
+
+const (
+	// BreakerReject discards the price; the last accepted one stays.
+	BreakerReject BreakerMode = "reject"
+	// BreakerClamp applies the price moved only as far as the limit allows.
+	BreakerClamp BreakerMode = "clamp"
+)
+
+// PriceBreakerConfig configures the per-symbol price circuit breaker.
+type PriceBreakerConfig struct {
+	// MaxMove is the largest accepted change, as a fraction of the last
+	// accepted price (0.2 = 20%). 0 disables the breaker.
+	MaxMove float64
+	// Window is how recent the last accepted price must be for a move to be
+	// measured against it; a price older than that is not compared. 0
+	// always compares.
+	Window time.Duration
+	Mode   BreakerMode
+	// StableFor resumes a tripped symbol on its own once every proposed
+	// price for this long has stayed within MaxMove of the one before. 0
+	// leaves it paused until ResumeSymbol.
+	StableFor time.Duration
+}
+
+// ErrPriceRejected is returned by SetMarkPrice when the breaker discards a
+// price.
+var ErrPriceRejected = errors.New("price move exceeds circuit breaker limit")
+
+// BreakerEvent reports a symbol's breaker tripping or resuming.
+type BreakerEvent struct {
+	Symbol    string  `json:"symbol"`
+	State     string  `json:"state"`            // "tripped" | "resumed"
+	Action    string  `json:"action,omitempty"` // on trip: "rejected" | "clamped"
+	Reason    string  `json:"reason,omitempty"` // on resume: "admin" | "stable"
+	LastPrice float64 `json:"lastPrice"`        // last accepted price
+	Proposed  float64 `json:"proposed"`         // price that tripped it, or the stable one
+	Move      float64 `json:"move"`             // Proposed vs LastPrice, as a fraction
+}
+
+// BreakerState is a tripped symbol as listed by Breakers.
+type BreakerState struct {
+	Symbol    string    `json:"symbol"`
+	TrippedAt time.Time `json:"trippedAt"`
+	LastPrice float64   `json:"lastPrice"` // last accepted price when it tripped
+	Proposed  float64   `json:"proposed"`  // price that tripped it
+	Move      float64   `json:"move"`
+}
+
+// breakerTrip is a tripped symbol plus the run of agreeing prices that may
+// resume it.
+type breakerTrip struct {
+	BreakerState
+	stablePrice float64   // latest proposal
+	stableSince time.Time // start of the run of proposals agreeing with it
+}
+
+// SetBreaker configures the price circuit breaker. Call before the feed
+// starts.
+func (ps *PriceSync) SetBreaker(cfg PriceBreakerConfig) error {
+	if cfg.MaxMove < 0 {
+		return fmt.Errorf("breaker max move %v must not be negative", cfg.MaxMove)
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = BreakerReject
+	}
+	if cfg.Mode != BreakerReject && cfg.Mode != BreakerClamp {
+		return fmt.Errorf("unknown breaker mode %q (want %q or %q)", cfg.Mode, BreakerReject, BreakerClamp)
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.breaker = cfg
+	return nil
+}
+
+// OnBreaker registers fn to be called, outside the lock, whenever a symbol's
+// breaker trips or resumes. Register before the feed starts.
+func (ps *PriceSync) OnBreaker(fn func(BreakerEvent)) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.breakerListeners = append(ps.breakerListeners, fn)
+}
+
+// Halted reports whether symbol's breaker has tripped. Liquidations of the
+// symbol are paused until it resumes.
+func (ps *PriceSync) Halted(symbol string) bool {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	_, ok := ps.tripped[symbol]
+	return ok
+}
+
+// Breakers returns the tripped symbols, sorted.
+func (ps *PriceSync) Breakers() []BreakerState {
+	ps.mu.RLock()
+	out := make([]BreakerState, 0, len(ps.tripped))
+	for _, t := range ps.tripped {
+		out = append(out, t.BreakerState)
+	}
+	ps.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
+
+// ResumeSymbol clears symbol's tripped breaker, as an operator confirming the
+// current mark price. It reports whether the symbol was tripped.
+func (ps *PriceSync) ResumeSymbol(symbol string) bool {
+	ps.mu.Lock()
+	t, ok := ps.tripped[symbol]
+	if !ok {
+		ps.mu.Unlock()
+		return false
+	}
+	delete(ps.tripped, symbol)
+	ev := BreakerEvent{
+		Symbol: symbol, State: "resumed", Reason: "admin",
+		LastPrice: ps.quotes[symbol].Price, Proposed: t.Proposed, Move: t.Move,
+	}
+	listeners := ps.breakerListeners
+	ps.mu.Unlock()
+	ps.emitBreaker(listeners, ev)
+	return true
+}
+
+// checkBreaker decides what becomes of price proposed for sym at now: the
+// price to apply (ok false when rejected) and any trip or resume to report.
+// The caller holds ps.mu.
+func (ps *PriceSync) checkBreaker(sym string, price float64, now time.Time) (applied float64, ok bool, ev *BreakerEvent) {
+	cfg := ps.breaker
+	if cfg.MaxMove <= 0 {
+		return price, true, nil
+	}
+	last, known := ps.quotes[sym]
+	trip := ps.tripped[sym]
+	if trip == nil && (!known || last.Price <= 0 || (cfg.Window > 0 && now.Sub(last.UpdatedAt) > cfg.Window)) {
+		return price, true, nil
+	}
+
+	if trip != nil && cfg.StableFor > 0 {
+		if math.Abs(price-trip.stablePrice) > cfg.MaxMove*trip.stablePrice {
+			trip.stableSince = now
+		}
+		trip.stablePrice = price
+		if now.Sub(trip.stableSince) >= cfg.StableFor {
+			delete(ps.tripped, sym)
+			return price, true, &BreakerEvent{
+				Symbol: sym, State: "resumed", Reason: "stable",
+				LastPrice: last.Price, Proposed: price, Move: price/last.Price - 1,
+			}
+		}
+	}
+
+	move := price/last.Price - 1
+	if math.Abs(move) <= cfg.MaxMove {
+		return price, true, nil
+	}
+	applied, ok = last.Price, false
+	if cfg.Mode == BreakerClamp {
+		applied, ok = roundStroops(last.Price*(1+math.Copysign(cfg.MaxMove, move))), true
+	}
+	if trip != nil {
+		return applied, ok, nil // already paused; reported when it tripped
+	}
+	ps.tripped[sym] = &breakerTrip{
+		BreakerState: BreakerState{Symbol: sym, TrippedAt: now, LastPrice: last.Price, Proposed: price, Move: move},
+		stablePrice:  price,
+		stableSince:  now,
+	}
+	action := "rejected"
+	if ok {
+		action = "clamped"
+	}
+	return applied, ok, &BreakerEvent{
+		Symbol: sym, State: "tripped", Action: action,
+		LastPrice: last.Price, Proposed: price, Move: move,
+	}
+}
+
+func (ps *PriceSync) emitBreaker(listeners []func(BreakerEvent), ev BreakerEvent) {
+	if ev.State == "tripped" {
+		log.Printf("[prices] circuit breaker TRIPPED for %s: %.7g -> %.7g (%+.1f%%), %s; liquidations paused",
+			ev.Symbol, ev.LastPrice, ev.Proposed, ev.Move*100, ev.Action)
+	} else {
+		log.Printf("[prices] circuit breaker resumed for %s (%s)", ev.Symbol, ev.Reason)
+	}
+	for _, fn := range listeners {
+		fn(ev)
+	}
+}
@@ -0,0 +1,110 @@
+package matching
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// breakerPrices returns a PriceSync on a fake clock with XLM/USDC at 2.0 and
+// a 20% breaker configured by cfg.
+func breakerPrices(t *testing.T, cfg PriceBreakerConfig) (*PriceSync, *fakeClock, *[]BreakerEvent) {
+	t.Helper()
+	fc := newFakeClock()
+	ps := NewPriceSync()
+	ps.clock = fc
+	ps.SetMarkPrice("XLM/USDC", 2.0, SourceWebhook)
+	cfg.MaxMove = 0.2
+	if err := ps.SetBreaker(cfg); err != nil {
+		t.Fatal(err)
+	}
+	var events []BreakerEvent
+	ps.OnBreaker(func(ev BreakerEvent) { events = append(events, ev) })
+	return ps, fc, &events
+}
+
+func TestBreakerRejectsAndPausesLiquidation(t *testing.T) {
+	ps, fc, events := breakerPrices(t, PriceBreakerConfig{Window: time.Minute})
+	var calls []settleCall
+	le := NewLiquidationEngine(ps, fakeSettle(&calls, nil))
+	le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80})
+
+	fc.Advance(time.Second)
+	if got, err := ps.SetMarkPrice("XLM/USDC", 2.3, SourceWebhook); err != nil || got != 2.3 {
+		t.Fatalf("15%% move = %v, %v; want accepted", got, err)
+	}
+	if _, err := ps.SetMarkPrice("XLM/USDC", 0.5, SourceWebhook); !errors.Is(err, ErrPriceRejected) {
+		t.Fatalf("wild move err = %v, want ErrPriceRejected", err)
+	}
+	if ps.GetMarkPrice("XLM/USDC") != 2.3 || !ps.Halted("XLM/USDC") {
+		t.Fatalf("after trip: mark %v halted %v, want 2.3 and halted", ps.GetMarkPrice("XLM/USDC"), ps.Halted("XLM/USDC"))
+	}
+	if len(*events) != 1 || (*events)[0].State != "tripped" || (*events)[0].Action != "rejected" || (*events)[0].Proposed != 0.5 {
+		t.Fatalf("events = %+v, want one rejected trip", *events)
+	}
+
+	// A real crash within the limit is applied, but liquidation waits.
+	ps.SetMarkPrice("XLM/USDC", 1.85, SourceWebhook)
+	ps.SetMarkPrice("XLM/USDC", 1.5, SourceWebhook)
+	le.checkAll(context.Background())
+	if len(calls) != 0 {
+		t.Fatalf("liquidated while halted: %+v", calls)
+	}
+	if len(*events) != 1 {
+		t.Fatalf("events = %+v, want no repeat while tripped", *events)
+	}
+
+	if !ps.ResumeSymbol("XLM/USDC") || ps.ResumeSymbol("XLM/USDC") {
+		t.Fatal("ResumeSymbol should succeed once")
+	}
+	le.checkAll(context.Background())
+	if len(calls) != 1 || calls[0].closePrice != 1.5 {
+		t.Fatalf("settle calls after resume = %+v, want one at 1.5", calls)
+	}
+	if last := (*events)[len(*events)-1]; last.State != "resumed" || last.Reason != "admin" {
+		t.Fatalf("last event = %+v, want admin resume", last)
+	}
+}
+
+func TestBreakerClamps(t *testing.T) {
+	ps, _, events := breakerPrices(t, PriceBreakerConfig{Mode: BreakerClamp})
+
+	got, err := ps.SetMarkPrice("XLM/USDC", 10, SourceWebhook)
+	if err != nil || got != 2.4 || ps.GetMarkPrice("XLM/USDC") != 2.4 {
+		t.Fatalf("clamped = %v, %v; want 2.4 applied", got, err)
+	}
+	if !ps.Halted("XLM/USDC") || len(*events) != 1 || (*events)[0].Action != "clamped" {
+		t.Fatalf("halted %v events %+v, want a clamped trip", ps.Halted("XLM/USDC"), *events)
+	}
+}
+
+func TestBreakerWindowAndStableResume(t *testing.T) {
+	ps, fc, events := breakerPrices(t, PriceBreakerConfig{Window: time.Minute, StableFor: 30 * time.Second})
+
+	// A jump from a price older than the window is not checked.
+	fc.Advance(2 * time.Minute)
+	if _, err := ps.SetMarkPrice("XLM/USDC", 3.0, SourceWebhook); err != nil {
+		t.Fatalf("move from a stale price: %v", err)
+	}
+
+	if _, err := ps.SetMarkPrice("XLM/USDC", 6.0, SourceWebhook); !errors.Is(err, ErrPriceRejected) {
+		t.Fatalf("err = %v, want ErrPriceRejected", err)
+	}
+	for i := 0; i < 3; i++ {
+		fc.Advance(10 * time.Second)
+		ps.SetMarkPrice("XLM/USDC", 6.1, SourceWebhook)
+	}
+	if ps.Halted("XLM/USDC") || ps.GetMarkPrice("XLM/USDC") != 6.1 {
+		t.Fatalf("halted %v mark %v, want resumed at 6.1 once the feed held steady", ps.Halted("XLM/USDC"), ps.GetMarkPrice("XLM/USDC"))
+	}
+	if last := (*events)[len(*events)-1]; last.State != "resumed" || last.Reason != "stable" {
+		t.Fatalf("last event = %+v, want a stable resume", last)
+	}
+}
+
+func TestSetBreakerRejectsUnknownMode(t *testing.T) {
+	if err := NewPriceSync().SetBreaker(PriceBreakerConfig{MaxMove: 0.1, Mode: "halt"}); err == nil {
+		t.Fatal("SetBreaker accepted an unknown mode")
+	}
+}
@@ -0,0 +1,36 @@
+package matching
+
+import (
+	"hash/crc32"
+	"strconv"
+)
+
+// Checksum returns the CRC32 of the top depth rows of each side, as listed by
+// Snapshot(depth). A client keeping a local copy of the book compares it with
+// the one the server sends and resyncs from a fresh snapshot on a mismatch.
+func (ob *OrderBook) Checksum(depth int) uint32 {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return BookChecksum(ob.bids.top(depth), ob.asks.top(depth))
+}
+
+// BookChecksum is the checksum of a snapshot already taken, so it can be sent
+// alongside the rows it covers. Following Kraken's convention, asks come
+// first then bids, each best-first; every row contributes "price:amount"
+// with both formatted to 7 decimals (e.g. "0.1000000:50.0000000"), and rows
+// are joined with ":". The checksum is the IEEE CRC32 of that string.
+func BookChecksum(bids, asks []Order) uint32 {
+	buf := make([]byte, 0, 24*(len(bids)+len(asks)))
+	for _, rows := range [][]Order{asks, bids} {
+		for _, o := range rows {
+			if len(buf) > 0 {
+				buf = append(buf, ':')
+			}
+			buf = strconv.AppendFloat(buf, o.Price, 'f', 7, 64)
+			buf = append(buf, ':')
+			buf = strconv.AppendFloat(buf, o.Amount, 'f', 7, 64)
+		}
+	}
+	return crc32.ChecksumIEEE(buf)
+}
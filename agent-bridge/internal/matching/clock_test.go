@@ -0,0 +1,180 @@
+package matching
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock. Its tickers deliver on unbuffered
+// channels, so Advance blocks until the loop has received each tick — and a
+// loop that received tick n+1 has necessarily finished handling tick n.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	c       chan time.Time
+	period  time.Duration
+	next    time.Time
+	stopped bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+func (t *fakeTicker) Stop()               { t.stopped = true }
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{c: make(chan time.Time), period: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// waitTickers blocks until n tickers exist, i.e. the loops under test started.
+func (c *fakeClock) waitTickers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.mu.Lock()
+		got := len(c.tickers)
+		c.mu.Unlock()
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of %d tickers started", got, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Advance moves time forward by d and delivers every tick that falls due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	var due []*fakeTicker
+	var at []time.Time
+	for _, t := range c.tickers {
+		for !t.stopped && !t.next.After(now) {
+			due = append(due, t)
+			at = append(at, t.next)
+			t.next = t.next.Add(t.period)
+		}
+	}
+	c.mu.Unlock()
+	for i, t := range due {
+		t.c <- at[i]
+	}
+}
+
+func TestLiquidationRunLiquidatesOnceOnNextTick(t *testing.T) {
+	fc := newFakeClock()
+	ps := NewPriceSync()
+	ps.clock = fc
+	calls := make(chan settleCall, 4)
+	le := NewLiquidationEngine(ps, func(_ context.Context, tok, sym string, px float64) error {
+		calls <- settleCall{tok, sym, px}
+		return nil
+	})
+	le.clock = fc
+	le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80})
+	ps.SetMarkPrice("XLM/USDC", 2, SourceWebhook) // the default seed is already past the threshold
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go le.Run(ctx)
+	fc.waitTickers(t, 1)
+
+	fc.Advance(le.interval) // healthy price: nothing happens
+	ps.SetMarkPrice("XLM/USDC", 1.5, SourceWebhook)
+	fc.Advance(le.interval) // this tick sees the move
+	fc.Advance(le.interval) // received only once the previous check finished
+
+	if len(calls) != 1 {
+		t.Fatalf("settle called %d times, want exactly 1", len(calls))
+	}
+	if got := <-calls; got != (settleCall{"tok", "XLM/USDC", 1.5}) {
+		t.Fatalf("settle call = %+v", got)
+	}
+}
+
+func TestMockUpdaterUsesClock(t *testing.T) {
+	fc := newFakeClock()
+	ps := NewPriceSync()
+	ps.clock = fc
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ps.RunMockUpdater(ctx)
+	fc.waitTickers(t, 1)
+
+	fc.Advance(time.Second)
+	fc.Advance(time.Second) // first drift is complete once this is received
+
+	// The second drift may or may not have landed yet; either way the stamp
+	// must be a fake tick time, not the wall clock.
+	q := ps.Status()["XLM/USDC"]
+	first, second := fc.Now().Add(-time.Second), fc.Now()
+	if !q.UpdatedAt.Equal(first) && !q.UpdatedAt.Equal(second) {
+		t.Fatalf("UpdatedAt = %v, want a fake tick time (%v or %v)", q.UpdatedAt, first, second)
+	}
+	if q.Source != SourceMock {
+		t.Fatalf("Source = %q, want mock", q.Source)
+	}
+}
+
+func TestMockUpdaterPause(t *testing.T) {
+	fc := newFakeClock()
+	ps := NewPriceSync()
+	ps.clock = fc
+	ps.Seed(map[string]float64{"XLM/USDC": 0.10, "XLM/EURC": 0.09})
+	if !ps.SetMockPaused(true) || ps.SetMockPaused(true) || !ps.MockPaused() {
+		t.Fatal("pausing should change the state once")
+	}
+	seeded := ps.Status()["XLM/USDC"]
+	seededEURC := ps.Status()["XLM/EURC"]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ps.RunMockUpdater(ctx)
+	fc.waitTickers(t, 1)
+
+	fc.Advance(time.Second)
+	fc.Advance(time.Second) // the first tick has been handled
+	if q := ps.Status()["XLM/USDC"]; q != seeded {
+		t.Fatalf("paused feed drifted: %+v, was %+v", q, seeded)
+	}
+	ps.SetMarkPrice("XLM/USDC", 0.12, SourceWebhook)
+	fc.Advance(time.Second)
+	fc.Advance(time.Second)
+	if q := ps.Status()["XLM/USDC"]; q.Price != 0.12 || q.Source != SourceWebhook {
+		t.Fatalf("paused feed overwrote an explicit price: %+v", q)
+	}
+
+	if !ps.SetMockPaused(false) {
+		t.Fatal("resume did not change the state")
+	}
+	fc.Advance(time.Second)
+	fc.Advance(time.Second)
+	if q := ps.Status()["XLM/EURC"]; q.Source != SourceMock || !q.UpdatedAt.After(seededEURC.UpdatedAt) {
+		t.Fatalf("resumed feed did not drift: %+v", q)
+	}
+	if q := ps.Status()["XLM/USDC"]; q.Price != 0.12 || q.Source != SourceWebhook {
+		t.Fatalf("resumed feed overwrote an explicit price: %+v", q)
+	}
+}
@@ -0,0 +1,77 @@
+package matching
+
+import "time"
+
+// Config is the engine's tunables, applied by Configure. Zero values keep
+// NewEngine's defaults.
+type Config struct {
+	MaxOrdersPerToken int             // resting orders per token; 0 = unlimited
+	MaxBookDepth      int             // resting orders per book side; 0 = unlimited
+	DepthPolicy       DepthPolicy     // empty = DepthReject
+	FillPrice         FillPricePolicy // empty = FillAtMaker
+
+	// PriceSeeds replaces the mock feed's symbols and starting prices (nil
+	// keeps DefaultPriceSeeds); PriceBands then overrides their drift bands.
+	PriceSeeds map[string]float64
+	PriceBands map[string]PriceBand
+	Breaker    PriceBreakerConfig
+
+	Liquidation LiquidationConfig
+
+	// Publisher receives every fill off the matching path (nil = none),
+	// through a queue of PublishBuffer trades; see SetTradePublisher.
+	Publisher     TradePublisher
+	PublishBuffer int
+}
+
+// LiquidationConfig is the liquidation engine's part of Config.
+type LiquidationConfig struct {
+	MaxPositionsPerToken int // 0 = unlimited
+	MaxSettleAttempts    int // 0 = DefaultMaxSettleAttempts
+	// GraceTicks and GraceFor are SetGracePeriod's arguments.
+	GraceTicks int
+	GraceFor   time.Duration
+	MarginMode MarginMode // empty = isolated
+	DetectOnly bool
+}
+
+// Configure applies cfg. Call before Start.
+func (e *Engine) Configure(cfg Config) error {
+	if cfg.DepthPolicy == "" {
+		cfg.DepthPolicy = DepthReject
+	}
+	if err := e.SetMaxBookDepth(cfg.MaxBookDepth, cfg.DepthPolicy); err != nil {
+		return err
+	}
+	if cfg.FillPrice != "" {
+		if err := e.SetFillPricePolicy(cfg.FillPrice); err != nil {
+			return err
+		}
+	}
+	if err := e.Prices.SetBreaker(cfg.Breaker); err != nil {
+		return err
+	}
+	e.SetMaxOrdersPerToken(cfg.MaxOrdersPerToken)
+	e.SetTradePublisher(cfg.Publisher, cfg.PublishBuffer)
+	if cfg.PriceSeeds != nil {
+		e.Prices.Seed(cfg.PriceSeeds)
+	}
+	if cfg.PriceBands != nil {
+		e.Prices.SetBands(cfg.PriceBands)
+	}
+
+	lc, le := cfg.Liquidation, e.Liquidation
+	if lc.MarginMode != "" {
+		if err := le.SetMarginMode(lc.MarginMode); err != nil {
+			return err
+		}
+	}
+	if lc.MaxSettleAttempts == 0 {
+		lc.MaxSettleAttempts = DefaultMaxSettleAttempts
+	}
+	le.SetMaxPositionsPerToken(lc.MaxPositionsPerToken)
+	le.SetMaxSettleAttempts(lc.MaxSettleAttempts)
+	le.SetGracePeriod(lc.GraceTicks, lc.GraceFor)
+	le.SetDetectOnly(lc.DetectOnly)
+	return nil
+}
@@ -0,0 +1,275 @@
+package matching
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// FailedSettlement is a liquidation that was decided but whose settle call
+// failed, so no funds moved on-chain. The fields are exactly what the settle
+// call was given, so an operator can replay it.
+type FailedSettlement struct {
+	// Version is the record format; see settleRecordVersion. Records
+	// written before it existed are migrated on load.
+	Version    int       `json:"version,omitempty"`
+	Nonce      string    `json:"nonce"` // unique per failed liquidation
+	UserToken  string    `json:"userToken"`
+	Symbol     string    `json:"symbol"`
+	ClosePrice float64   `json:"closePrice"` // mark price passed to SettleFunc
+	PnL        float64   `json:"pnl"`        // realised PnL, negative for a loss
+	Error      string    `json:"error"`
+	Time       time.Time `json:"timestamp"`
+	// Resolved marks the file record written when a settlement is applied;
+	// it removes the entry with the same nonce on reload and keeps the
+	// nonce as settled.
+	Resolved bool `json:"resolved,omitempty"`
+}
+
+// settleRecordVersion is the FailedSettlement format Add writes. Version 1
+// (unversioned on disk) had no closePrice and kept the close price in "pnl".
+const settleRecordVersion = 2
+
+// HasPnL reports whether e records the realised PnL. Migrated version 1
+// records only know the close price, so a settle func that sends PnL
+// refuses to replay them.
+func (e FailedSettlement) HasPnL() bool {
+	return e.Version >= settleRecordVersion
+}
+
+// migrate upgrades a record read from disk to the current format.
+func (e FailedSettlement) migrate() FailedSettlement {
+	if e.Version == 0 && !e.Resolved {
+		e.Version, e.ClosePrice, e.PnL = 1, e.PnL, 0
+	}
+	return e
+}
+
+// ErrDeadLetterNotFound is returned when no failed settlement has the given
+// nonce.
+var ErrDeadLetterNotFound = errors.New("no failed settlement with that nonce")
+
+// ErrAlreadySettled is returned for a nonce whose settlement has already been
+// applied, so repeating a replay is harmless.
+var ErrAlreadySettled = errors.New("settlement with that nonce already applied")
+
+// ErrSettledNotRecorded is returned when a settlement went through but the
+// record of it could not be persisted, so a restart would offer it again.
+var ErrSettledNotRecorded = errors.New("settled, but the resolution could not be persisted")
+
+// ErrDeadLetterBusy is returned when a replay of the same nonce is already
+// running.
+var ErrDeadLetterBusy = errors.New("settlement replay already in progress")
+
+type settleNonceKey struct{}
+
+// WithSettleNonce tags a settle call with the dead-letter nonce it replays,
+// so the settle endpoint can refuse a settlement it has already applied.
+func WithSettleNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, settleNonceKey{}, nonce)
+}
+
+// SettleNonce returns the nonce set by WithSettleNonce, or "".
+func SettleNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(settleNonceKey{}).(string)
+	return nonce
+}
+
+// SettleDLQ is the dead-letter queue of failed settlements. With a path it
+// appends one JSON line per change to that file and replays it on start, so
+// nothing is lost across restarts; without one it only keeps them in memory.
+// A later line for the same nonce supersedes an earlier one.
+type SettleDLQ struct {
+	mu       sync.Mutex
+	file     *os.File // nil when memory-only
+	entries  []FailedSettlement
+	inFlight map[string]bool // nonces being replayed
+	settled  map[string]bool // nonces whose settlement was applied
+}
+
+// OpenSettleDLQ loads the entries already in path and opens it for
+// appending, creating it if needed. An empty path gives a memory-only queue.
+func OpenSettleDLQ(path string) (*SettleDLQ, error) {
+	q := &SettleDLQ{inFlight: make(map[string]bool), settled: make(map[string]bool)}
+	if path == "" {
+		return q, nil
+	}
+	if err := q.load(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("settle dlq: %w", err)
+	}
+	q.file = f
+	return q, nil
+}
+
+func (q *SettleDLQ) load(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("settle dlq: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e FailedSettlement
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("settle dlq %s:%d: %w", path, line, err)
+		}
+		q.apply(e.migrate())
+	}
+	return sc.Err()
+}
+
+// apply folds one record into entries. The caller holds q.mu or owns q.
+func (q *SettleDLQ) apply(e FailedSettlement) {
+	if e.Resolved {
+		q.settled[e.Nonce] = true
+	}
+	for i := range q.entries {
+		if q.entries[i].Nonce != e.Nonce {
+			continue
+		}
+		if e.Resolved {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+		} else {
+			q.entries[i] = e
+		}
+		return
+	}
+	if !e.Resolved {
+		q.entries = append(q.entries, e)
+	}
+}
+
+// write appends e to the file, if any. The caller holds q.mu.
+func (q *SettleDLQ) write(e FailedSettlement) error {
+	if q.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("settle dlq: %w", err)
+	}
+	return q.file.Sync()
+}
+
+// Add records a failed settlement, filling in Nonce, Time and Version when
+// unset, and returns the stored entry. With a file, the entry is synced to
+// disk before Add returns; on a write error it is still kept in memory.
+func (q *SettleDLQ) Add(e FailedSettlement) (FailedSettlement, error) {
+	if e.Nonce == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		e.Nonce = hex.EncodeToString(b)
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Version == 0 {
+		e.Version = settleRecordVersion
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.apply(e)
+	return e, q.write(e)
+}
+
+// claim marks nonce as being replayed and returns its entry, so two
+// concurrent replays cannot both settle it.
+func (q *SettleDLQ) claim(nonce string) (FailedSettlement, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.settled[nonce] {
+		return FailedSettlement{}, ErrAlreadySettled
+	}
+	for _, e := range q.entries {
+		if e.Nonce != nonce {
+			continue
+		}
+		if q.inFlight[nonce] {
+			return FailedSettlement{}, ErrDeadLetterBusy
+		}
+		q.inFlight[nonce] = true
+		return e, nil
+	}
+	return FailedSettlement{}, ErrDeadLetterNotFound
+}
+
+// finish ends the replay of e claimed with claim: on success (settleErr nil)
+// the entry is removed, otherwise it stays with the new error.
+func (q *SettleDLQ) finish(e FailedSettlement, settleErr error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inFlight, e.Nonce)
+	if settleErr == nil {
+		e = FailedSettlement{Nonce: e.Nonce, Resolved: true}
+	} else {
+		e.Error = settleErr.Error()
+	}
+	q.apply(e)
+	return q.write(e)
+}
+
+// Settled reports whether the settlement tagged nonce has been applied.
+func (q *SettleDLQ) Settled(nonce string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.settled[nonce]
+}
+
+// BeginSettle claims nonce for a settle call made outside the queue, such as
+// the admin settle endpoint. It returns ErrAlreadySettled once a settlement
+// with nonce was applied and ErrDeadLetterBusy while one is running.
+func (q *SettleDLQ) BeginSettle(nonce string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.settled[nonce] {
+		return ErrAlreadySettled
+	}
+	if q.inFlight[nonce] {
+		return ErrDeadLetterBusy
+	}
+	q.inFlight[nonce] = true
+	return nil
+}
+
+// EndSettle releases nonce claimed with BeginSettle. On success (settleErr
+// nil) it records nonce as settled, persisting it so a repeat is recognised
+// after a restart too.
+func (q *SettleDLQ) EndSettle(nonce string, settleErr error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inFlight, nonce)
+	if settleErr != nil {
+		return nil
+	}
+	e := FailedSettlement{Nonce: nonce, Resolved: true}
+	q.apply(e)
+	return q.write(e)
+}
+
+// List returns the dead-lettered settlements, oldest first.
+func (q *SettleDLQ) List() []FailedSettlement {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]FailedSettlement{}, q.entries...)
+}
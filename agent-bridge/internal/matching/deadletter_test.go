@@ -0,0 +1,184 @@
+package matching
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSettleDLQPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.jsonl")
+	q, err := OpenSettleDLQ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := q.Add(FailedSettlement{UserToken: "tok", Symbol: "XLM/USDC", PnL: 0.1, Error: "boom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Nonce == "" || a.Time.IsZero() {
+		t.Fatalf("Add did not fill nonce and time: %+v", a)
+	}
+	if _, err := q.Add(FailedSettlement{UserToken: "tok2", Symbol: "XLM/EURC"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenSettleDLQ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reopened.List()
+	if len(got) != 2 || got[0].Nonce != a.Nonce || got[0].PnL != 0.1 || got[1].UserToken != "tok2" {
+		t.Fatalf("reloaded %+v, want the two added entries in order", got)
+	}
+}
+
+// TestSettleDLQMigratesLegacyRecords loads a record written before records
+// were versioned, whose "pnl" held the close price, and checks it is replayed
+// with that close price and no PnL.
+func TestSettleDLQMigratesLegacyRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.jsonl")
+	legacy := `{"nonce":"old","userToken":"tok","symbol":"XLM/USDC","pnl":0.1,"error":"down","timestamp":"2026-01-02T03:04:05Z"}` + "\n"
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	q, err := OpenSettleDLQ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := q.List()
+	if len(got) != 1 || got[0].Version != 1 || got[0].ClosePrice != 0.1 || got[0].PnL != 0 || got[0].HasPnL() {
+		t.Fatalf("migrated %+v, want version 1 with closePrice 0.1 and no pnl", got)
+	}
+
+	le := NewLiquidationEngine(NewPriceSync(), func(ctx context.Context, _, _ string, closePrice float64) error {
+		if _, ok := SettlePnL(ctx); ok || closePrice != 0.1 {
+			t.Errorf("legacy replay: closePrice=%v, pnl set=%v; want 0.1 and no pnl", closePrice, ok)
+		}
+		return nil
+	})
+	le.dlq = q
+	if _, err := le.RetrySettlement(context.Background(), "old"); err != nil {
+		t.Fatal(err)
+	}
+	if added, _ := q.Add(FailedSettlement{UserToken: "tok"}); added.Version != settleRecordVersion {
+		t.Errorf("new record version = %d, want %d", added.Version, settleRecordVersion)
+	}
+}
+
+func TestFailedLiquidationIsDeadLettered(t *testing.T) {
+	ps := NewPriceSync()
+	ps.SetMarkPrice("XLM/USDC", 1.0, SourceMock)
+	q, _ := OpenSettleDLQ("")
+	le := NewLiquidationEngine(ps, fakeSettle(new([]settleCall), errors.New("tx failed")))
+	le.dlq = q
+	le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80})
+
+	le.checkAll(context.Background())
+
+	got := q.List()
+	if len(got) != 1 || got[0].UserToken != "tok" || got[0].Symbol != "XLM/USDC" ||
+		got[0].ClosePrice != 1.0 || got[0].PnL != -80 || got[0].Error != "tx failed" {
+		t.Fatalf("dead letters = %+v, want the failed XLM/USDC settlement", got)
+	}
+}
+
+func TestRetrySettlement(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.jsonl")
+	q, err := OpenSettleDLQ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, _ := q.Add(FailedSettlement{UserToken: "tok", Symbol: "XLM/USDC", ClosePrice: 0.1, PnL: -80, Error: "down"})
+
+	settleErr := errors.New("still down")
+	var nonces []string
+	le := NewLiquidationEngine(NewPriceSync(), func(ctx context.Context, userToken, symbol string, closePrice float64) error {
+		if pnl, _ := SettlePnL(ctx); closePrice != 0.1 || pnl != -80 {
+			t.Errorf("replay settled closePrice=%v pnl=%v, want 0.1 and -80", closePrice, pnl)
+		}
+		nonces = append(nonces, SettleNonce(ctx))
+		return settleErr
+	})
+	le.dlq = q
+
+	if _, err := le.RetrySettlement(context.Background(), dead.Nonce); !errors.Is(err, settleErr) {
+		t.Fatalf("failing retry: err = %v, want %v", err, settleErr)
+	}
+	if got := q.List(); len(got) != 1 || got[0].Error != "still down" {
+		t.Fatalf("after failed retry: %+v, want the entry kept with the new error", got)
+	}
+
+	settleErr = nil
+	if _, err := le.RetrySettlement(context.Background(), dead.Nonce); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if _, err := le.RetrySettlement(context.Background(), dead.Nonce); !errors.Is(err, ErrAlreadySettled) {
+		t.Fatalf("repeat retry: err = %v, want ErrAlreadySettled", err)
+	}
+	if _, err := le.RetrySettlement(context.Background(), "nope"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("unknown nonce: err = %v, want ErrDeadLetterNotFound", err)
+	}
+	if len(nonces) != 2 || nonces[0] != dead.Nonce || nonces[1] != dead.Nonce {
+		t.Errorf("settle saw nonces %q, want %q twice", nonces, dead.Nonce)
+	}
+
+	reopened, err := OpenSettleDLQ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.List(); len(got) != 0 {
+		t.Fatalf("reloaded %+v, want the replayed entry gone", got)
+	}
+	if !reopened.Settled(dead.Nonce) {
+		t.Error("settled nonce forgotten across a restart")
+	}
+}
+
+func TestSettleNonceIsClaimedOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.jsonl")
+	q, err := OpenSettleDLQ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.BeginSettle("n1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.BeginSettle("n1"); !errors.Is(err, ErrDeadLetterBusy) {
+		t.Fatalf("concurrent claim: err = %v, want ErrDeadLetterBusy", err)
+	}
+	q.EndSettle("n1", errors.New("down"))
+	if err := q.BeginSettle("n1"); err != nil {
+		t.Fatalf("claim after a failed settle: %v", err)
+	}
+	if err := q.EndSettle("n1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenSettleDLQ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.BeginSettle("n1"); !errors.Is(err, ErrAlreadySettled) {
+		t.Fatalf("claim after restart: err = %v, want ErrAlreadySettled", err)
+	}
+}
+
+// TestRetrySettlementFailsWhenUnrecorded settles a replay whose resolution
+// can't be written and checks the retry reports it.
+func TestRetrySettlementFailsWhenUnrecorded(t *testing.T) {
+	q, err := OpenSettleDLQ(filepath.Join(t.TempDir(), "dlq.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, _ := q.Add(FailedSettlement{UserToken: "tok", Symbol: "XLM/USDC", ClosePrice: 0.1, PnL: -80})
+	q.file.Close() // every later write fails
+
+	le := NewLiquidationEngine(NewPriceSync(), fakeSettle(new([]settleCall), nil))
+	le.dlq = q
+	if _, err := le.RetrySettlement(context.Background(), dead.Nonce); !errors.Is(err, ErrSettledNotRecorded) {
+		t.Fatalf("err = %v, want ErrSettledNotRecorded", err)
+	}
+}
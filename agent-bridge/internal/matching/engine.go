@@ -4,19 +4,46 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"sort"
 	"sync"
+	"time"
 )
 
+// ErrUnknownSymbol is returned when an order or snapshot references a symbol
+// that is not on the engine's tradable allowlist.
+var ErrUnknownSymbol = errors.New("unknown symbol")
+
+// ErrMinNotional is returned when an order's price × amount is below its
+// symbol's minimum notional. A reduce-only order closing the whole position
+// is exempt.
+var ErrMinNotional = errors.New("order below minimum notional")
+
+// ErrReduceOnly is returned when a reduce-only order has no open position in
+// the opposite direction to reduce.
+var ErrReduceOnly = errors.New("reduce-only order would not reduce a position")
+
+// ErrOrderLimit is returned when a token already has the maximum number of
+// resting orders across all books.
+var ErrOrderLimit = errors.New("resting order limit reached")
+
+// ErrLeverageLimit is returned when an order's leverage exceeds its symbol's
+// cap (SymbolConfig.LeverageCap).
+var ErrLeverageLimit = errors.New("leverage above the symbol's maximum")
+
 // Engine ties together the order books, price feed, and liquidation engine
 // into a single entry-point used by HTTP handlers.
 type Engine struct {
 	mu          sync.Mutex
-	books       map[string]*OrderBook // symbol -> book
+	books       map[string]*OrderBook   // symbol -> book
+	symbols     map[string]SymbolConfig // tradable allowlist
 	Prices      *PriceSync
 	Liquidation *LiquidationEngine
+	Tape        *TradeTape // recent executions per symbol
 
 	// settleURL is the internal endpoint that the engine POSTs settlement
 	// requests to. In production this would be an admin-authenticated route
@@ -25,79 +52,454 @@ type Engine struct {
 
 	// adminSecret is sent as a bearer token on settlement HTTP requests.
 	adminSecret string
+	// directSettle is set once SetSettleFunc replaces the HTTP settle call.
+	directSettle bool
+
+	// notify pushes fill events to both parties; nil disables notifications.
+	notify NotifyFunc
+
+	// trades feeds fills to the TradePublisher; nil when publishing is off.
+	trades *tradeQueue
+
+	// maxDepth and depthPolicy are applied to every book; see
+	// OrderBook.SetMaxDepth.
+	maxDepth    int
+	depthPolicy DepthPolicy
+
+	// fillPrice is applied to every book; see FillPricePolicy.
+	fillPrice FillPricePolicy
+
+	// resting counts each token's resting orders across every book and
+	// caps them; see SetMaxOrdersPerToken.
+	resting *restingCounts
+}
+
+// NotifyFunc delivers a user-facing event to a session token's SSE stream.
+// eventType becomes the stream's named event; data is an optional structured
+// payload serialised alongside the human-readable message.
+type NotifyFunc func(userToken, eventType, message string, data any)
+
+// FillEvent is the structured payload sent to each party of a fill.
+type FillEvent struct {
+	Symbol  string  `json:"symbol"`
+	Side    Side    `json:"side"` // this party's side
+	Role    string  `json:"role"` // "maker" | "taker"
+	Price   float64 `json:"price"`
+	Amount  float64 `json:"amount"`
+	OrderID string  `json:"orderId"`
+}
+
+// PlaceResult summarises what happened to an incoming order.
+type PlaceResult struct {
+	OrderID       string // assigned even when fully filled, for OrderStatus
+	Resting       bool   // whether OrderID is still in the book
+	Fills         []MatchResult
+	FilledAmount  float64 // total base amount matched
+	AvgPrice      float64 // amount-weighted average fill price (0 if unfilled)
+	RestingAmount float64 // remainder left in the book under OrderID
 }
 
 // NewEngine creates a matching engine.
 // settleURL e.g. "http://localhost:3000/api/admin/settle"
 // adminSecret is passed as "Authorization: Bearer <secret>" on settle calls.
-func NewEngine(settleURL, adminSecret string) *Engine {
+// symbols is the allowlist of tradable markets; books are only ever created
+// for these, so clients cannot grow memory by inventing symbols.
+// notify, if non-nil, receives a "fill" event for the buyer and the seller of
+// every match so a resting maker learns it was hit in real time, and
+// "liquidation" events for force-closed positions.
+func NewEngine(settleURL, adminSecret string, symbols []SymbolConfig, notify NotifyFunc) *Engine {
 	ps := NewPriceSync()
 
+	allowed := make(map[string]SymbolConfig, len(symbols))
+	for _, cfg := range symbols {
+		sym, err := NormalizeSymbol(cfg.Symbol)
+		if err != nil {
+			log.Printf("[engine] skipping tradable symbol: %v", err)
+			continue
+		}
+		cfg.Symbol = sym
+		allowed[sym] = cfg
+		if cfg.TickSize > 0 {
+			ps.SetTickSize(sym, cfg.TickSize)
+		}
+	}
+
 	e := &Engine{
 		books:       make(map[string]*OrderBook),
+		symbols:     allowed,
 		Prices:      ps,
+		Tape:        NewTradeTape(DefaultTapeSize),
 		settleURL:   settleURL,
 		adminSecret: adminSecret,
+		notify:      notify,
+		resting:     newRestingCounts(),
 	}
 
-	settle := func(ctx context.Context, userToken, symbol string, pnl float64) error {
+	// The HTTP endpoint settles by PnL, which the liquidation engine passes
+	// in the context alongside the close price.
+	settle := func(ctx context.Context, userToken, symbol string, closePrice float64) error {
+		pnl, ok := SettlePnL(ctx)
+		if !ok {
+			return fmt.Errorf("settle %s %s: no pnl in context", userToken, symbol)
+		}
 		return e.submitSettle(ctx, userToken, symbol, pnl)
 	}
 
 	e.Liquidation = NewLiquidationEngine(ps, settle)
+	e.Liquidation.notify = notify
 	return e
 }
 
 // SetSettleFunc replaces the default HTTP-based settle call with a direct
-// function, typically the soroban.Client.SettleTrade call.
+// function, typically the soroban.Client.SettleTrade call, or an in-process
+// stub in tests.
 // Must be called before Start.
 func (e *Engine) SetSettleFunc(fn SettleFunc) {
 	e.Liquidation.settle = fn
+	e.directSettle = true
+}
+
+// SetSettleDLQ records every liquidation whose settle call fails in q, so it
+// can be replayed. Must be called before Start.
+func (e *Engine) SetSettleDLQ(q *SettleDLQ) {
+	e.Liquidation.dlq = q
+}
+
+// SetMaxBookDepth caps every book at n resting orders per side (0 =
+// unlimited), refusing or evicting beyond that according to policy. Must be
+// called before Start.
+func (e *Engine) SetMaxBookDepth(n int, policy DepthPolicy) error {
+	if policy != DepthReject && policy != DepthEvict {
+		return fmt.Errorf("unknown book depth policy %q (want %q or %q)", policy, DepthReject, DepthEvict)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.maxDepth, e.depthPolicy = n, policy
+	for _, book := range e.books {
+		book.SetMaxDepth(n, policy)
+	}
+	return nil
+}
+
+// SetFillPricePolicy sets the price crossing orders fill at on every book.
+// FillAtMaker, the default, fills at the resting order's price. Must be
+// called before Start.
+func (e *Engine) SetFillPricePolicy(p FillPricePolicy) error {
+	if p != FillAtMaker && p != FillAtAggressor && p != FillAtMid {
+		return fmt.Errorf("unknown fill price policy %q (want %q, %q or %q)", p, FillAtMaker, FillAtAggressor, FillAtMid)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fillPrice = p
+	for _, book := range e.books {
+		book.SetFillPricePolicy(p)
+	}
+	return nil
+}
+
+// SetMaxOrdersPerToken caps how many resting orders one token may hold across
+// all books. 0 disables the limit. Must be called before Start.
+func (e *Engine) SetMaxOrdersPerToken(n int) {
+	e.resting.setLimit(n)
 }
 
 // Start launches background goroutines (price mock, liquidation loop).
 func (e *Engine) Start(ctx context.Context) {
 	go e.Prices.RunMockUpdater(ctx)
 	go e.Liquidation.Run(ctx)
+	e.mu.Lock()
+	if e.trades != nil {
+		go e.trades.run(ctx)
+	}
+	e.mu.Unlock()
 	log.Println("[engine] matching engine started")
 }
 
-// PlaceOrder adds an order to the appropriate book and returns any fills.
-func (e *Engine) PlaceOrder(o Order) ([]MatchResult, error) {
-	if o.Symbol == "" || o.Amount <= 0 || o.Price <= 0 {
-		return nil, fmt.Errorf("invalid order: symbol, amount, and price are required")
+// PlaceOrder adds an order to the appropriate book and reports its fills and
+// any resting remainder.
+func (e *Engine) PlaceOrder(o Order) (PlaceResult, error) {
+	if o.Symbol == "" || roundStroops(o.Amount) <= 0 || roundStroops(o.Price) <= 0 {
+		return PlaceResult{}, fmt.Errorf("invalid order: symbol, amount, and price (≥ 1 stroop) are required")
+	}
+	sym, err := NormalizeSymbol(o.Symbol)
+	if err != nil {
+		return PlaceResult{}, err
+	}
+	o.Symbol = sym
+	book, err := e.getBook(o.Symbol)
+	if err != nil {
+		return PlaceResult{}, err
+	}
+	e.mu.Lock()
+	symCfg := e.symbols[o.Symbol]
+	e.mu.Unlock()
+	if limit := symCfg.LeverageCap(); o.Leverage > limit {
+		return PlaceResult{}, fmt.Errorf("%w: %s allows at most %dx, got %dx",
+			ErrLeverageLimit, o.Symbol, limit, o.Leverage)
+	}
+	minNotional := symCfg.MinNotional
+	if o.ReduceOnly {
+		var closes bool
+		if o.Amount, closes, err = e.reduceOnlyAmount(o); err != nil {
+			return PlaceResult{}, err
+		}
+		// A position worth less than the minimum must still be closable.
+		if closes {
+			minNotional = 0
+		}
+	} else if err := e.Liquidation.checkOpenLimit(o.UserToken, o.Symbol); err != nil {
+		return PlaceResult{}, err
+	}
+	if notional := roundStroops(o.Price * o.Amount); notional < minNotional {
+		return PlaceResult{}, fmt.Errorf("%w: %.7g %s is below %.7g",
+			ErrMinNotional, notional, o.Symbol, minNotional)
+	}
+	placed, fills, evicted, voided, err := book.Submit(o)
+	if err != nil {
+		return PlaceResult{}, err
+	}
+	for _, ev := range evicted {
+		log.Printf("[engine] %s order %s evicted from a full book by %s", ev.Symbol, ev.ID, placed.ID)
+		e.notifyCancelled(ev, "evicted", "pushed out of a full book by a better-priced order")
+	}
+	for _, v := range voided {
+		log.Printf("[engine] %s reduce-only order %s cancelled: no position left to reduce", v.Symbol, v.ID)
+		e.notifyCancelled(v, "reduce_only", "its position was already closed or reversed")
+	}
+
+	res := PlaceResult{
+		OrderID:       placed.ID,
+		Resting:       placed.Amount > 0,
+		Fills:         fills,
+		RestingAmount: placed.Amount,
+	}
+	var notional float64
+	now := time.Now()
+	for _, f := range fills {
+		res.FilledAmount += f.FillAmount
+		notional += f.FillPrice * f.FillAmount
+		e.Tape.Record(Trade{
+			Symbol:    o.Symbol,
+			Price:     f.FillPrice,
+			Amount:    f.FillAmount,
+			Aggressor: f.Aggressor,
+			Time:      now,
+		})
+		e.enqueueTrade(f, now)
 	}
-	book := e.getBook(o.Symbol)
-	fills := book.AddOrder(o)
+	res.FilledAmount = roundStroops(res.FilledAmount)
+	if res.FilledAmount > 0 {
+		res.AvgPrice = roundStroops(notional / res.FilledAmount)
+	}
+
 	if len(fills) > 0 {
-		log.Printf("[engine] %d fill(s) for %s %s %.4f @ %.6f",
-			len(fills), o.Symbol, o.Side, o.Amount, o.Price)
+		log.Printf("[engine] %d fill(s) for %s %s %.4f @ %.6f (filled=%.4f resting=%.4f)",
+			len(fills), o.Symbol, o.Side, o.Amount, o.Price, res.FilledAmount, res.RestingAmount)
+	}
+	for _, f := range fills {
+		e.notifyFill(f)
+	}
+	return res, nil
+}
+
+// reduceOnlyAmount caps a reduce-only order at the size of the token's open
+// position in the opposite direction: a sell may only reduce a long and a buy
+// only a short. The position counts fills that have matched but not yet
+// been applied, so an order placed straight after an opening fill sees it.
+// closes reports whether the capped order is the whole position.
+func (e *Engine) reduceOnlyAmount(o Order) (amount float64, closes bool, err error) {
+	net := e.Liquidation.netPosition(o.UserToken, o.Symbol)
+	if net == 0 {
+		return 0, false, fmt.Errorf("%w: no open %s position", ErrReduceOnly, o.Symbol)
+	}
+	side := "long"
+	if net < 0 {
+		side = "short"
+	}
+	if (o.Side == Sell) != (side == "long") {
+		return 0, false, fmt.Errorf("%w: %s order against a %s position", ErrReduceOnly, o.Side, side)
+	}
+	size := math.Abs(net)
+	return min(roundStroops(o.Amount), size), roundStroops(o.Amount) >= size, nil
+}
+
+// notifyFill sends a "fill" event to the buyer and the seller of f.
+func (e *Engine) notifyFill(f MatchResult) {
+	if e.notify == nil {
+		return
+	}
+	for _, o := range []Order{f.BuyOrder, f.SellOrder} {
+		role := "maker"
+		if o.Side == f.Aggressor {
+			role = "taker"
+		}
+		ev := FillEvent{
+			Symbol:  o.Symbol,
+			Side:    o.Side,
+			Role:    role,
+			Price:   f.FillPrice,
+			Amount:  f.FillAmount,
+			OrderID: o.ID,
+		}
+		msg := fmt.Sprintf("Filled %s %.7g %s @ %.7g (%s)", o.Side, f.FillAmount, o.Symbol, f.FillPrice, role)
+		e.notify(o.UserToken, "fill", msg, ev)
 	}
-	return fills, nil
 }
 
 // CancelOrder removes a resting order from its book. Returns error if not found.
 func (e *Engine) CancelOrder(symbol, orderID string) error {
-	book := e.getBook(symbol)
+	book, err := e.getBook(symbol)
+	if err != nil {
+		return err
+	}
 	if !book.CancelOrder(orderID) {
 		return fmt.Errorf("order %s not found in %s book", orderID, symbol)
 	}
 	return nil
 }
 
+// OrderCancelledEvent is the payload sent to the owner of an order removed
+// by someone else: cleared by the operator, evicted from a full book, or a
+// reduce-only order whose position was gone by the time it filled.
+type OrderCancelledEvent struct {
+	Symbol  string  `json:"symbol"`
+	Side    Side    `json:"side"`
+	Price   float64 `json:"price"`
+	Amount  float64 `json:"amount"` // remaining amount that was resting
+	OrderID string  `json:"orderId"`
+	Reason  string  `json:"reason"` // "book_cleared" | "evicted" | "reduce_only"
+}
+
+// ClearBook removes every resting order from symbol's book, as an operator
+// wiping it after a bad data event, and sends each owner an
+// "order_cancelled" event. It returns the orders removed.
+func (e *Engine) ClearBook(symbol string) ([]Order, error) {
+	book, err := e.getBook(symbol)
+	if err != nil {
+		return nil, err
+	}
+	removed := book.Clear()
+	log.Printf("[engine] %s book cleared: %d resting order(s) cancelled", symbol, len(removed))
+	for _, o := range removed {
+		e.notifyCancelled(o, "book_cleared", "book cleared by operator")
+	}
+	return removed, nil
+}
+
+// notifyCancelled sends o's owner an "order_cancelled" event for an order
+// removed by someone other than its owner; why is the human-readable cause.
+func (e *Engine) notifyCancelled(o Order, reason, why string) {
+	if e.notify == nil {
+		return
+	}
+	msg := fmt.Sprintf("Order %s cancelled: %s %.7g %s @ %.7g (%s)",
+		o.ID, o.Side, o.Amount, o.Symbol, o.Price, why)
+	e.notify(o.UserToken, "order_cancelled", msg, OrderCancelledEvent{
+		Symbol: o.Symbol, Side: o.Side, Price: o.Price, Amount: o.Amount,
+		OrderID: o.ID, Reason: reason,
+	})
+}
+
 // BookSnapshot returns the top-N bids and asks for a symbol.
-func (e *Engine) BookSnapshot(symbol string, depth int) (bids, asks []Order) {
-	return e.getBook(symbol).Snapshot(depth)
+func (e *Engine) BookSnapshot(symbol string, depth int) (bids, asks []Order, err error) {
+	book, err := e.getBook(symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+	bids, asks = book.Snapshot(depth)
+	return bids, asks, nil
+}
+
+// BookDepth returns how many orders rest on each side of a symbol's book.
+func (e *Engine) BookDepth(symbol string) (bids, asks int, err error) {
+	book, err := e.getBook(symbol)
+	if err != nil {
+		return 0, 0, err
+	}
+	bids, asks = book.Depth()
+	return bids, asks, nil
+}
+
+// OrderStatus reports whether userToken's order is resting, filled, cancelled
+// or unknown, plus its remaining amount while resting.
+func (e *Engine) OrderStatus(symbol, orderID, userToken string) (OrderStatus, float64, error) {
+	book, err := e.getBook(symbol)
+	if err != nil {
+		return StatusUnknown, 0, err
+	}
+	status, remaining := book.Status(orderID, userToken)
+	return status, remaining, nil
+}
+
+// RecentTrades returns up to limit executions for symbol from the trade tape,
+// newest first.
+func (e *Engine) RecentTrades(symbol string, limit int) ([]Trade, error) {
+	symbol, err := NormalizeSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	_, ok := e.symbols[symbol]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSymbol, symbol)
+	}
+	return e.Tape.Recent(symbol, limit), nil
+}
+
+// ListSymbols returns the tradable symbols in sorted order.
+func (e *Engine) ListSymbols() []string {
+	cfgs := e.Symbols()
+	out := make([]string, len(cfgs))
+	for i, cfg := range cfgs {
+		out[i] = cfg.Symbol
+	}
+	return out
+}
+
+// MaxLeverageFor returns the leverage cap of symbol, or MaxLeverage for one
+// that is not configured.
+func (e *Engine) MaxLeverageFor(symbol string) int {
+	sym, _ := NormalizeSymbol(symbol)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.symbols[sym].LeverageCap()
+}
+
+// Symbols returns the config of every tradable symbol, sorted by symbol.
+func (e *Engine) Symbols() []SymbolConfig {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]SymbolConfig, 0, len(e.symbols))
+	for _, cfg := range e.symbols {
+		out = append(out, cfg)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
 }
 
 // getBook returns (or lazily creates) the order book for a symbol.
-func (e *Engine) getBook(symbol string) *OrderBook {
+// The symbol is normalised first; symbols outside the allowlist are rejected
+// with ErrUnknownSymbol.
+func (e *Engine) getBook(symbol string) (*OrderBook, error) {
+	symbol, err := NormalizeSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	if _, ok := e.symbols[symbol]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSymbol, symbol)
+	}
 	if _, ok := e.books[symbol]; !ok {
-		e.books[symbol] = NewOrderBook()
+		book := NewOrderBook()
+		book.SetMaxDepth(e.maxDepth, e.depthPolicy)
+		book.SetFillPricePolicy(e.fillPrice)
+		book.positions = e.Liquidation
+		book.resting = e.resting
+		e.books[symbol] = book
 	}
-	return e.books[symbol]
+	return e.books[symbol], nil
 }
 
 // submitSettle POSTs a settlement request to the configured admin endpoint.
@@ -107,32 +509,100 @@ func (e *Engine) getBook(symbol string) *OrderBook {
 // Request body:
 //
 //	{ "userToken": "...", "symbol": "XLM/USDC", "pnl": -90.0 }
+//
+// A replay of a dead-lettered settlement also carries its "nonce", which the
+// endpoint should use to ignore a settlement it has already applied.
 func (e *Engine) submitSettle(ctx context.Context, userToken, symbol string, pnl float64) error {
+	req, _, err := e.newSettleRequest(ctx, userToken, symbol, pnl)
+	if err != nil {
+		return fmt.Errorf("settle request build: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("settle http: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("settle endpoint returned HTTP %d", resp.StatusCode)
+	}
+	log.Printf("[engine] settle OK userToken=%s pnl=%.4f", userToken, pnl)
+	return nil
+}
+
+// newSettleRequest builds the request submitSettle sends, returning its body
+// alongside.
+func (e *Engine) newSettleRequest(ctx context.Context, userToken, symbol string, pnl float64) (*http.Request, []byte, error) {
 	payload := map[string]interface{}{
 		"userToken": userToken,
 		"symbol":    symbol,
 		"pnl":       pnl,
 	}
+	if nonce := SettleNonce(ctx); nonce != "" {
+		payload["nonce"] = nonce
+	}
 	body, _ := json.Marshal(payload)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.settleURL, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("settle request build: %w", err)
+		return nil, nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	if e.adminSecret != "" {
 		req.Header.Set("Authorization", "Bearer "+e.adminSecret)
 	}
+	return req, body, nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// SettlePreview is the request submitSettle would send to settle a position
+// liquidated now.
+type SettlePreview struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"` // the bearer secret redacted
+	Body    json.RawMessage   `json:"body"`    // byte for byte
+	// MarkPrice is the price the preview settles at; PnL, the body's pnl, is
+	// the collateral a liquidation there would seize, as a loss.
+	MarkPrice     float64 `json:"markPrice"`
+	PnL           float64 `json:"pnl"`
+	UnrealisedPnL float64 `json:"unrealisedPnl"`
+	// InUse is false when liquidations don't settle over HTTP: a direct
+	// settle func replaced it, or the engine is detect-only.
+	InUse bool `json:"inUse"`
+}
+
+// PreviewSettle returns what submitSettle would send for userToken's
+// position in symbol at the current mark price, without sending it.
+func (e *Engine) PreviewSettle(userToken, symbol string) (SettlePreview, error) {
+	p := e.Liquidation.GetPosition(userToken, symbol)
+	if p == nil {
+		return SettlePreview{}, fmt.Errorf("%w in %s", ErrNoPosition, symbol)
+	}
+	mark := e.Prices.GetMarkPrice(symbol)
+	if mark <= 0 {
+		return SettlePreview{}, fmt.Errorf("no mark price for %s", symbol)
+	}
+	pnl := -roundStroops(min(p.unrealisedLoss(mark), p.CollateralAmount))
+	req, body, err := e.newSettleRequest(context.Background(), userToken, symbol, pnl)
 	if err != nil {
-		return fmt.Errorf("settle http: %w", err)
+		return SettlePreview{}, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		return fmt.Errorf("settle endpoint returned HTTP %d", resp.StatusCode)
+	headers := make(map[string]string, len(req.Header))
+	for k := range req.Header {
+		headers[k] = req.Header.Get(k)
 	}
-	log.Printf("[engine] settle OK userToken=%s pnl=%.4f", userToken, pnl)
-	return nil
+	if _, ok := headers["Authorization"]; ok {
+		headers["Authorization"] = "Bearer [redacted]"
+	}
+	return SettlePreview{
+		Method:        req.Method,
+		URL:           e.settleURL,
+		Headers:       headers,
+		Body:          body,
+		MarkPrice:     mark,
+		PnL:           pnl,
+		UnrealisedPnL: p.unrealisedPnL(mark),
+		InUse:         !e.directSettle && !e.Liquidation.DetectOnly(),
+	}, nil
 }
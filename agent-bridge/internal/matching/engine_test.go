@@ -0,0 +1,500 @@
+package matching
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestEngine() *Engine {
+	return NewEngine("", "", []SymbolConfig{NewSymbolConfig("XLM/USDC")}, nil)
+}
+
+func TestPlaceOrderReportsRemainder(t *testing.T) {
+	e := newTestEngine()
+	for _, o := range []Order{
+		{UserToken: "m1", Symbol: "XLM/USDC", Side: Sell, Price: 0.10, Amount: 1},
+		{UserToken: "m2", Symbol: "XLM/USDC", Side: Sell, Price: 0.12, Amount: 1},
+	} {
+		if _, err := e.PlaceOrder(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.12, Amount: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.FilledAmount != 2 || res.AvgPrice != 0.11 || res.RestingAmount != 1 || !res.Resting {
+		t.Fatalf("got filled=%v avg=%v resting=%v (%v), want 2 / 0.11 / 1 (true)",
+			res.FilledAmount, res.AvgPrice, res.RestingAmount, res.Resting)
+	}
+
+	bids, _, err := e.BookSnapshot("XLM/USDC", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bids) != 1 || bids[0].ID != res.OrderID || bids[0].Amount != 1 {
+		t.Fatalf("resting bid = %+v, want remainder 1 under %s", bids, res.OrderID)
+	}
+}
+
+func TestPlaceOrderFullyFilledLeavesNothingResting(t *testing.T) {
+	e := newTestEngine()
+	e.PlaceOrder(Order{UserToken: "m", Symbol: "XLM/USDC", Side: Buy, Price: 0.1, Amount: 5})
+
+	res, err := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.FilledAmount != 2 || res.RestingAmount != 0 || res.Resting {
+		t.Fatalf("got filled=%v resting=%v (%v), want 2 / 0 (false)", res.FilledAmount, res.RestingAmount, res.Resting)
+	}
+}
+
+func TestFillNotifiesBothParties(t *testing.T) {
+	type call struct {
+		token string
+		ev    FillEvent
+	}
+	var calls []call
+	notify := func(userToken, eventType, _ string, data any) {
+		if eventType != "fill" {
+			t.Errorf("event type = %q, want fill", eventType)
+		}
+		calls = append(calls, call{userToken, data.(FillEvent)})
+	}
+	e := NewEngine("", "", []SymbolConfig{NewSymbolConfig("XLM/USDC")}, notify)
+
+	e.PlaceOrder(Order{UserToken: "maker", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 2})
+	if len(calls) != 0 {
+		t.Fatalf("resting order produced %d notifications", len(calls))
+	}
+	e.PlaceOrder(Order{UserToken: "taker", Symbol: "XLM/USDC", Side: Buy, Price: 0.1, Amount: 2})
+
+	if len(calls) != 2 {
+		t.Fatalf("got %d notifications, want 2", len(calls))
+	}
+	byToken := map[string]FillEvent{calls[0].token: calls[0].ev, calls[1].token: calls[1].ev}
+	if ev := byToken["maker"]; ev.Side != Sell || ev.Role != "maker" || ev.Amount != 2 || ev.Price != 0.1 {
+		t.Errorf("maker event = %+v", ev)
+	}
+	if ev := byToken["taker"]; ev.Side != Buy || ev.Role != "taker" || ev.Symbol != "XLM/USDC" {
+		t.Errorf("taker event = %+v", ev)
+	}
+}
+
+func TestOrderStatusLifecycle(t *testing.T) {
+	e := newTestEngine()
+
+	resting, _ := e.PlaceOrder(Order{UserToken: "m", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 3})
+	cancelled, _ := e.PlaceOrder(Order{UserToken: "m", Symbol: "XLM/USDC", Side: Sell, Price: 0.2, Amount: 1})
+	if err := e.CancelOrder("XLM/USDC", cancelled.OrderID); err != nil {
+		t.Fatal(err)
+	}
+	taker, _ := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.1, Amount: 1})
+
+	tests := []struct {
+		name, id, token string
+		want            OrderStatus
+		remaining       float64
+	}{
+		{"partially filled maker", resting.OrderID, "m", StatusResting, 2},
+		{"cancelled", cancelled.OrderID, "m", StatusCancelled, 0},
+		{"fully filled taker", taker.OrderID, "t", StatusFilled, 0},
+		{"another token's order", resting.OrderID, "t", StatusUnknown, 0},
+		{"never existed", "nope", "m", StatusUnknown, 0},
+	}
+	for _, tt := range tests {
+		status, remaining, err := e.OrderStatus("XLM/USDC", tt.id, tt.token)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if status != tt.want || remaining != tt.remaining {
+			t.Errorf("%s: got %s/%v, want %s/%v", tt.name, status, remaining, tt.want, tt.remaining)
+		}
+	}
+}
+
+func TestClearBook(t *testing.T) {
+	cancelled := map[string]OrderCancelledEvent{}
+	notify := func(userToken, eventType, _ string, data any) {
+		if eventType == "order_cancelled" {
+			ev := data.(OrderCancelledEvent)
+			cancelled[userToken+" "+ev.OrderID] = ev
+		}
+	}
+	e := NewEngine("", "", []SymbolConfig{NewSymbolConfig("XLM/USDC")}, notify)
+	bid, _ := e.PlaceOrder(Order{UserToken: "b", Symbol: "XLM/USDC", Side: Buy, Price: 0.09, Amount: 3})
+	ask, _ := e.PlaceOrder(Order{UserToken: "s", Symbol: "XLM/USDC", Side: Sell, Price: 0.11, Amount: 2})
+	e.PlaceOrder(Order{UserToken: "s", Symbol: "XLM/USDC", Side: Sell, Price: 0.12, Amount: 1})
+
+	removed, err := e.ClearBook("xlm/usdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 3 || len(cancelled) != 3 {
+		t.Fatalf("removed %d orders with %d notifications, want 3 each", len(removed), len(cancelled))
+	}
+	if ev := cancelled["b "+bid.OrderID]; ev.Side != Buy || ev.Amount != 3 || ev.Reason != "book_cleared" {
+		t.Errorf("bid owner event = %+v", ev)
+	}
+	if bids, asks, _ := e.BookDepth("XLM/USDC"); bids != 0 || asks != 0 {
+		t.Fatalf("depth after clear = %d/%d, want empty", bids, asks)
+	}
+	if status, _, _ := e.OrderStatus("XLM/USDC", ask.OrderID, "s"); status != StatusCancelled {
+		t.Errorf("cleared ask status = %s, want cancelled", status)
+	}
+
+	// The emptied book keeps working.
+	e.PlaceOrder(Order{UserToken: "s", Symbol: "XLM/USDC", Side: Sell, Price: 0.10, Amount: 1})
+	res, _ := e.PlaceOrder(Order{UserToken: "b", Symbol: "XLM/USDC", Side: Buy, Price: 0.10, Amount: 1})
+	if res.FilledAmount != 1 {
+		t.Errorf("fill after clear = %v, want 1", res.FilledAmount)
+	}
+	if _, err := e.ClearBook("BTC/USDC"); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("unknown symbol error = %v", err)
+	}
+}
+
+func TestEvictionNotifiesOwner(t *testing.T) {
+	var events []OrderCancelledEvent
+	notify := func(userToken, eventType, _ string, data any) {
+		if eventType == "order_cancelled" && userToken == "mm" {
+			events = append(events, data.(OrderCancelledEvent))
+		}
+	}
+	e := NewEngine("", "", []SymbolConfig{NewSymbolConfig("XLM/USDC")}, notify)
+	if err := e.SetMaxBookDepth(2, DepthEvict); err != nil {
+		t.Fatal(err)
+	}
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Buy, Price: 0.10, Amount: 1})
+	worst, _ := e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Buy, Price: 0.09, Amount: 2})
+	if _, err := e.PlaceOrder(Order{UserToken: "x", Symbol: "XLM/USDC", Side: Buy, Price: 0.095, Amount: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("owner got %d order_cancelled events, want 1", len(events))
+	}
+	if ev := events[0]; ev.OrderID != worst.OrderID || ev.Reason != "evicted" || ev.Amount != 2 || ev.Price != 0.09 {
+		t.Errorf("event = %+v", ev)
+	}
+}
+
+func TestStats(t *testing.T) {
+	e := NewEngine("", "", []SymbolConfig{NewSymbolConfig("XLM/USDC"), NewSymbolConfig("BTC/USDC")}, nil)
+	if err := e.SetMaxBookDepth(2, DepthReject); err != nil {
+		t.Fatal(err)
+	}
+	e.PlaceOrder(Order{UserToken: "m", Symbol: "XLM/USDC", Side: Sell, Price: 0.10, Amount: 1})
+	e.PlaceOrder(Order{UserToken: "m", Symbol: "XLM/USDC", Side: Sell, Price: 0.11, Amount: 1})
+	if _, err := e.PlaceOrder(Order{UserToken: "m", Symbol: "XLM/USDC", Side: Sell, Price: 0.12, Amount: 1}); !errors.Is(err, ErrBookFull) {
+		t.Fatalf("third ask: %v, want ErrBookFull", err)
+	}
+	e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.11, Amount: 1.5})
+	e.PlaceOrder(Order{UserToken: "b", Symbol: "BTC/USDC", Side: Buy, Price: 60000, Amount: 0.1})
+
+	st := e.Stats()
+	if len(st.Books) != 2 || st.Books[0].Symbol != "BTC/USDC" || st.Books[1].Symbol != "XLM/USDC" {
+		t.Fatalf("books = %+v, want BTC/USDC then XLM/USDC", st.Books)
+	}
+	xlm := st.Books[1]
+	if xlm.Orders != 3 || xlm.Rejected != 1 || xlm.Fills != 2 || xlm.Bids != 0 || xlm.Asks != 1 || xlm.Levels != 1 {
+		t.Errorf("XLM/USDC stats = %+v, want 3 orders, 1 rejected, 2 fills, one ask left", xlm)
+	}
+	if st.Orders != 4 || st.Fills != 2 {
+		t.Errorf("totals = %d orders / %d fills, want 4 / 2", st.Orders, st.Fills)
+	}
+	if st.AvgMatchMicros <= 0 || st.MaxMatchMicros < st.AvgMatchMicros {
+		t.Errorf("latency avg=%v max=%v, want 0 < avg <= max", st.AvgMatchMicros, st.MaxMatchMicros)
+	}
+}
+
+func TestSetFillPricePolicy(t *testing.T) {
+	e := newTestEngine()
+	if err := e.SetFillPricePolicy("best"); err == nil {
+		t.Fatal("unknown policy accepted")
+	}
+	if err := e.SetFillPricePolicy(FillAtMid); err != nil {
+		t.Fatal(err)
+	}
+	e.PlaceOrder(Order{UserToken: "m", Symbol: "XLM/USDC", Side: Sell, Price: 0.10, Amount: 1})
+	res, _ := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.12, Amount: 1})
+	if res.AvgPrice != 0.11 {
+		t.Errorf("fill price = %v, want mid 0.11", res.AvgPrice)
+	}
+}
+
+func TestMinNotional(t *testing.T) {
+	e := newTestEngine() // DefaultMinNotional = 0.01
+
+	tests := []struct {
+		name   string
+		price  float64
+		amount float64
+		ok     bool
+	}{
+		{"below minimum", 0.1, 0.09, false},
+		{"at minimum", 0.1, 0.1, true},
+		{"above minimum", 0.1, 5, true},
+	}
+	for _, tt := range tests {
+		_, err := e.PlaceOrder(Order{UserToken: "a", Symbol: "XLM/USDC", Side: Buy, Price: tt.price, Amount: tt.amount})
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrMinNotional) {
+			t.Errorf("%s: err = %v, want ErrMinNotional", tt.name, err)
+		}
+	}
+}
+
+func TestMinNotionalSparesReduceOnlyClose(t *testing.T) {
+	e := newTestEngine()
+	// A 0.05-XLM long is worth 0.005 USDC, under the 0.01 minimum.
+	e.Liquidation.AddPosition(&OpenPosition{UserToken: "t", Symbol: "XLM/USDC", Side: "long", EntryPrice: 0.1, Leverage: 1, CollateralAmount: 0.005, DebtAmount: 0.005})
+
+	if _, err := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 0.02, ReduceOnly: true}); !errors.Is(err, ErrMinNotional) {
+		t.Fatalf("partial reduce below the minimum: err = %v, want ErrMinNotional", err)
+	}
+	res, err := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 1, ReduceOnly: true})
+	if err != nil {
+		t.Fatalf("closing the whole position: %v", err)
+	}
+	if res.RestingAmount != 0.05 {
+		t.Errorf("resting = %v, want the whole 0.05 position", res.RestingAmount)
+	}
+}
+
+func TestSymbolLeverageCaps(t *testing.T) {
+	btc := NewSymbolConfig("BTC/USDC")
+	btc.MaxLeverage = 5
+	xlm := NewSymbolConfig("XLM/USDC")
+	xlm.MaxLeverage = 10
+	e := NewEngine("", "", []SymbolConfig{btc, xlm, NewSymbolConfig("XLM/EURC")}, nil)
+
+	tests := []struct {
+		symbol   string
+		leverage int
+		ok       bool
+	}{
+		{"BTC/USDC", 5, true},
+		{"BTC/USDC", 6, false},
+		{"XLM/USDC", 6, true},
+		{"XLM/USDC", 10, true},
+		{"XLM/USDC", 11, false},
+		{"XLM/EURC", MaxLeverage, true}, // unconfigured: the global cap
+		{"XLM/EURC", MaxLeverage + 1, false},
+	}
+	for _, tt := range tests {
+		_, err := e.PlaceOrder(Order{UserToken: "a", Symbol: tt.symbol, Side: Buy, Price: 1, Amount: 1, Leverage: tt.leverage})
+		if tt.ok && err != nil {
+			t.Errorf("%s %dx: unexpected error %v", tt.symbol, tt.leverage, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrLeverageLimit) {
+			t.Errorf("%s %dx: err = %v, want ErrLeverageLimit", tt.symbol, tt.leverage, err)
+		}
+	}
+	if got := e.MaxLeverageFor("btc-usdc"); got != 5 {
+		t.Errorf("MaxLeverageFor(btc-usdc) = %d, want 5", got)
+	}
+
+	caps, err := ParseLeverageCaps("btc/usdc=5, XLM/USDC=10")
+	if err != nil || caps["BTC/USDC"] != 5 || caps["XLM/USDC"] != 10 {
+		t.Fatalf("ParseLeverageCaps = %v, %v", caps, err)
+	}
+	for _, bad := range []string{"BTC/USDC", "BTC/USDC=0", "BTC/USDC=21", "BTC/USDC=2.5"} {
+		if _, err := ParseLeverageCaps(bad); err == nil {
+			t.Errorf("ParseLeverageCaps(%q): want an error", bad)
+		}
+	}
+}
+
+func TestParseMinNotionals(t *testing.T) {
+	m, err := ParseMinNotionals("xlm-usdc=5, BTC/USDC:0.5")
+	if err != nil || m["XLM/USDC"] != 5 || m["BTC/USDC"] != 0.5 {
+		t.Fatalf("ParseMinNotionals = %v, %v", m, err)
+	}
+	for _, bad := range []string{"XLM/USDC", "XLM/USDC=-1", "XLM/USDC=cheap", "XLM/USDC=Inf", "XLMUSDC=1"} {
+		if _, err := ParseMinNotionals(bad); err == nil {
+			t.Errorf("ParseMinNotionals(%q): want an error", bad)
+		}
+	}
+}
+
+func TestReduceOnlyCappedToPosition(t *testing.T) {
+	e := newTestEngine()
+	// A 10-XLM long: 1 USDC notional at 0.1 entry.
+	e.Liquidation.AddPosition(&OpenPosition{UserToken: "trader", Symbol: "XLM/USDC", Side: "long", EntryPrice: 0.1, Leverage: 2, CollateralAmount: 0.5, DebtAmount: 1})
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Buy, Price: 0.1, Amount: 50})
+
+	res, err := e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 25, ReduceOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.FilledAmount != 10 || res.RestingAmount != 0 {
+		t.Fatalf("filled=%v resting=%v, want 10 and 0 (trimmed to the position)", res.FilledAmount, res.RestingAmount)
+	}
+	if _, err := e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 1, ReduceOnly: true}); !errors.Is(err, ErrReduceOnly) {
+		t.Fatalf("err = %v, want ErrReduceOnly once the matched fill flattens it", err)
+	}
+	// The position itself only closes when the fill worker completes it.
+	if e.Liquidation.GetPosition("trader", "XLM/USDC") == nil {
+		t.Fatal("position closed before its fill was applied")
+	}
+	if p, err := e.Liquidation.CompleteFill("trader", "XLM/USDC", "short", 0.1, 10, 10, 2); err != nil || p != nil {
+		t.Fatalf("CompleteFill = %+v, %v, want the position closed", p, err)
+	}
+	if _, err := e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 1, ReduceOnly: true}); !errors.Is(err, ErrReduceOnly) {
+		t.Fatalf("err = %v, want ErrReduceOnly once flat", err)
+	}
+}
+
+func TestReduceOnlyPartialAndWrongSide(t *testing.T) {
+	e := newTestEngine()
+	e.Liquidation.AddPosition(&OpenPosition{UserToken: "trader", Symbol: "XLM/USDC", Side: "short", EntryPrice: 0.1, Leverage: 1, CollateralAmount: 1, DebtAmount: 1})
+
+	if _, err := e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 1, ReduceOnly: true}); !errors.Is(err, ErrReduceOnly) {
+		t.Fatalf("sell against a short: err = %v, want ErrReduceOnly", err)
+	}
+
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 4})
+	if _, err := e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Buy, Price: 0.1, Amount: 4, ReduceOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Liquidation.CompleteFill("trader", "XLM/USDC", "long", 0.1, 4, 4, 1); err != nil {
+		t.Fatal(err)
+	}
+	p := e.Liquidation.GetPosition("trader", "XLM/USDC")
+	if p == nil || p.Size() != 6 || p.CollateralAmount != 0.6 {
+		t.Fatalf("position = %+v, want 6 XLM left with 0.6 collateral", p)
+	}
+}
+
+func TestRestingReduceOnlyRecheckedAtFill(t *testing.T) {
+	var events []OrderCancelledEvent
+	notify := func(userToken, eventType, _ string, data any) {
+		if eventType == "order_cancelled" && userToken == "trader" {
+			events = append(events, data.(OrderCancelledEvent))
+		}
+	}
+	e := NewEngine("", "", []SymbolConfig{NewSymbolConfig("XLM/USDC")}, notify)
+	// A 10-XLM long, with two reduce-only sells each capped to all of it.
+	e.Liquidation.AddPosition(&OpenPosition{UserToken: "trader", Symbol: "XLM/USDC", Side: "long", EntryPrice: 0.1, Leverage: 1, CollateralAmount: 1, DebtAmount: 1})
+	e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Sell, Price: 0.11, Amount: 10, ReduceOnly: true})
+	second, _ := e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Sell, Price: 0.12, Amount: 10, ReduceOnly: true})
+	// The position shrinks to 6 while both rest.
+	if _, err := e.Liquidation.ApplyFill("trader", "XLM/USDC", "short", 0.1, 4, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Buy, Price: 0.12, Amount: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.FilledAmount != 6 || res.RestingAmount != 14 {
+		t.Fatalf("filled=%v resting=%v, want 6 and 14 (only the live position trades)", res.FilledAmount, res.RestingAmount)
+	}
+	if net := e.Liquidation.netPosition("trader", "XLM/USDC"); net != 0 {
+		t.Fatalf("net position = %v after being fully reduced, want 0", net)
+	}
+	if len(events) != 1 || events[0].OrderID != second.OrderID || events[0].Reason != "reduce_only" {
+		t.Fatalf("order_cancelled events = %+v, want the second sell voided", events)
+	}
+	if st, _, _ := e.OrderStatus("XLM/USDC", second.OrderID, "trader"); st != StatusCancelled {
+		t.Errorf("voided order status = %s, want cancelled", st)
+	}
+}
+
+func TestReduceOnlySeesPendingFills(t *testing.T) {
+	e := newTestEngine()
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Sell, Price: 0.1, Amount: 10})
+	if _, err := e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Buy, Price: 0.1, Amount: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if e.Liquidation.GetPosition("trader", "XLM/USDC") != nil {
+		t.Fatal("position applied before the fill worker ran")
+	}
+
+	// The opening fill hasn't been applied, but a reduce-only sell placed
+	// straight after it is sized against it.
+	res, err := e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Sell, Price: 0.2, Amount: 25, ReduceOnly: true})
+	if err != nil {
+		t.Fatalf("reduce-only order after an unapplied opening fill: %v", err)
+	}
+	if res.RestingAmount != 10 {
+		t.Fatalf("resting = %v, want 10 (the matched fill)", res.RestingAmount)
+	}
+	if _, err := e.PlaceOrder(Order{UserToken: "trader", Symbol: "XLM/USDC", Side: Buy, Price: 0.05, Amount: 1, ReduceOnly: true}); !errors.Is(err, ErrReduceOnly) {
+		t.Fatalf("reduce-only buy against a pending long: err = %v, want ErrReduceOnly", err)
+	}
+
+	// Completing the fill moves it from pending into the position without
+	// counting it twice.
+	if _, err := e.Liquidation.CompleteFill("trader", "XLM/USDC", "long", 0.1, 10, 10, 1); err != nil {
+		t.Fatal(err)
+	}
+	if net := e.Liquidation.netPosition("trader", "XLM/USDC"); net != 10 {
+		t.Fatalf("net position = %v, want 10", net)
+	}
+	// A fill that never reached the chain leaves nothing behind.
+	if p, _ := e.Liquidation.CompleteFill("mm", "XLM/USDC", "short", 0.1, 10, 0, 1); p != nil {
+		t.Fatalf("unapplied fill opened %+v", p)
+	}
+	if net := e.Liquidation.netPosition("mm", "XLM/USDC"); net != 0 {
+		t.Errorf("mm net position = %v, want 0", net)
+	}
+}
+
+func TestOrderLimitCountsOnlyResting(t *testing.T) {
+	e := newTestEngine()
+	e.SetMaxOrdersPerToken(2)
+	first, _ := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.09, Amount: 1})
+	e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.08, Amount: 1})
+	if _, err := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.07, Amount: 1}); !errors.Is(err, ErrOrderLimit) {
+		t.Fatalf("third resting order: err = %v, want ErrOrderLimit", err)
+	}
+
+	// A marketable order never rests, so the cap doesn't apply to it.
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Sell, Price: 0.10, Amount: 1})
+	if _, err := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.10, Amount: 1}); err != nil {
+		t.Fatalf("fully marketable order at the cap: %v", err)
+	}
+	if n := e.resting.count("mm"); n != 0 {
+		t.Errorf("mm counted %d resting orders after its only one filled", n)
+	}
+
+	// A fill and a cancel each free a slot.
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Sell, Price: 0.09, Amount: 1})
+	if err := e.CancelOrder("XLM/USDC", first.OrderID); err == nil {
+		t.Fatal("first bid still resting after it was filled")
+	}
+	if n := e.resting.count("t"); n != 1 {
+		t.Fatalf("t counted %d resting orders, want 1", n)
+	}
+	if _, err := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.07, Amount: 1}); err != nil {
+		t.Fatalf("resting order after a fill freed a slot: %v", err)
+	}
+	if _, err := e.ClearBook("XLM/USDC"); err != nil {
+		t.Fatal(err)
+	}
+	if n := e.resting.count("t"); n != 0 {
+		t.Errorf("t counted %d resting orders after the book was cleared", n)
+	}
+}
+
+func TestPositionLimitCheckedAtPlacement(t *testing.T) {
+	e := NewEngine("", "", []SymbolConfig{NewSymbolConfig("XLM/USDC"), NewSymbolConfig("BTC/USDC")}, nil)
+	e.Liquidation.SetMaxPositionsPerToken(1)
+	e.Liquidation.AddPosition(&OpenPosition{UserToken: "t", Symbol: "XLM/USDC", Side: "long", EntryPrice: 0.1, Leverage: 1, CollateralAmount: 1, DebtAmount: 1})
+
+	if _, err := e.PlaceOrder(Order{UserToken: "t", Symbol: "BTC/USDC", Side: Buy, Price: 60000, Amount: 0.1}); !errors.Is(err, ErrPositionLimit) {
+		t.Fatalf("order in a new symbol: err = %v, want ErrPositionLimit", err)
+	}
+	if _, err := e.PlaceOrder(Order{UserToken: "t", Symbol: "XLM/USDC", Side: Buy, Price: 0.1, Amount: 5}); err != nil {
+		t.Fatalf("order in the symbol already held: %v", err)
+	}
+	// A fill that got past the check is still monitored.
+	if p, err := e.Liquidation.ApplyFill("t", "BTC/USDC", "long", 60000, 0.1, 1); err != nil || p == nil {
+		t.Fatalf("ApplyFill over the limit = %+v, %v, want the position monitored", p, err)
+	}
+}
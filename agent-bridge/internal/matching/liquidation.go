@@ -2,7 +2,11 @@ package matching
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"sort"
 	"sync"
 	"time"
 )
@@ -16,6 +20,78 @@ type OpenPosition struct {
 	Leverage         int
 	CollateralAmount float64 // USDC collateral deposited (7-decimal scaled: 100 USDC = 100.0)
 	DebtAmount       float64 // notional = collateral * leverage
+
+	// breachCount is how many checks in a row have found the position past
+	// the liquidation threshold, since breachSince; both reset when a check
+	// finds it back within it. See LiquidationEngine.SetGracePeriod.
+	breachCount int
+	breachSince time.Time
+}
+
+// ErrPositionLimit is returned by AddPosition, and by Engine.PlaceOrder for
+// an order that could open a position, when a token already holds the
+// maximum number of open positions.
+var ErrPositionLimit = errors.New("open position limit reached")
+
+// ErrNoPosition is returned when a token has no monitored position for the
+// requested symbol.
+var ErrNoPosition = errors.New("no open position")
+
+// ErrMaintenanceMargin is returned when removing collateral would leave the
+// position at or past its liquidation threshold.
+var ErrMaintenanceMargin = errors.New("below maintenance margin")
+
+// liquidationThreshold is the fraction of collateral that may be lost before
+// a position is force-closed.
+const liquidationThreshold = 0.90
+
+// notional is the position's exposure in quote units. DebtAmount is used when
+// known; otherwise it is derived from collateral × leverage.
+func (p OpenPosition) notional() float64 {
+	if p.DebtAmount > 0 {
+		return p.DebtAmount
+	}
+	return float64(p.Leverage) * p.CollateralAmount
+}
+
+// Size is the position's base-asset amount.
+func (p OpenPosition) Size() float64 {
+	if p.EntryPrice <= 0 {
+		return 0
+	}
+	return roundStroops(p.notional() / p.EntryPrice)
+}
+
+// unrealisedPnL is the position's profit (positive) or loss (negative) at
+// markPrice, in quote units.
+func (p OpenPosition) unrealisedPnL(markPrice float64) float64 {
+	if p.EntryPrice <= 0 {
+		return 0
+	}
+	move := (markPrice - p.EntryPrice) / p.EntryPrice
+	if p.Side == "short" {
+		move = -move
+	}
+	return move * p.notional()
+}
+
+// unrealisedLoss is the position's loss at markPrice (0 when in profit).
+func (p OpenPosition) unrealisedLoss(markPrice float64) float64 {
+	return max(0, -p.unrealisedPnL(markPrice))
+}
+
+// LiquidationPrice is the mark price at which the loss reaches the 90%
+// collateral threshold. More collateral pushes it further from entry.
+func (p OpenPosition) LiquidationPrice() float64 {
+	n := p.notional()
+	if n <= 0 || p.EntryPrice <= 0 {
+		return 0
+	}
+	move := liquidationThreshold * p.CollateralAmount / n
+	if p.Side == "short" {
+		return p.EntryPrice * (1 + move)
+	}
+	return p.EntryPrice * (1 - move)
 }
 
 // SettleFunc is called by the liquidation engine to close a position on-chain.
@@ -23,56 +99,653 @@ type OpenPosition struct {
 // entry data.  symbol is provided for logging / routing purposes.
 type SettleFunc func(ctx context.Context, userToken string, symbol string, closePrice float64) error
 
+type settlePnLKey struct{}
+
+// WithSettlePnL attaches the realised PnL of a liquidation (negative for a
+// loss) to a settle call, for settle funcs that send PnL rather than the
+// close price.
+func WithSettlePnL(ctx context.Context, pnl float64) context.Context {
+	return context.WithValue(ctx, settlePnLKey{}, pnl)
+}
+
+// SettlePnL returns the PnL set by WithSettlePnL.
+func SettlePnL(ctx context.Context) (float64, bool) {
+	pnl, ok := ctx.Value(settlePnLKey{}).(float64)
+	return pnl, ok
+}
+
+// DefaultMaxSettleAttempts is how many checks in a row may fail to settle a
+// breached position before it is dead-lettered and dropped. One keeps the
+// original behaviour of giving up on the first failure; retries are opt-in.
+const DefaultMaxSettleAttempts = 1
+
+// LiquidationEvent is the payload of the "liquidation" event sent to a
+// position's owner. It is sent twice per liquidation: with Status "attempted"
+// before settlement, then "confirmed" or "failed" once the settle call returns.
+// In detect-only mode it is sent once per breach with Status "detected".
+type LiquidationEvent struct {
+	Symbol     string  `json:"symbol"`
+	Side       string  `json:"side"` // "long" | "short"
+	EntryPrice float64 `json:"entryPrice"`
+	MarkPrice  float64 `json:"markPrice"`
+	Seized     float64 `json:"seized"` // collateral lost: the loss, capped at the collateral
+	Status     string  `json:"status"` // "attempted" | "confirmed" | "failed", or "detected" in detect-only mode
+	Error      string  `json:"error,omitempty"`
+}
+
+// MarginMode selects how the liquidation engine evaluates a token's positions.
+type MarginMode string
+
+const (
+	// MarginIsolated checks every position against its own collateral.
+	MarginIsolated MarginMode = "isolated"
+	// MarginCross nets all of a token's positions: liquidation triggers when
+	// their combined unrealised PnL eats 90% of their combined collateral,
+	// and then closes every one of them.
+	MarginCross MarginMode = "cross"
+)
+
 // LiquidationEngine monitors open positions against the live mark price and
 // triggers settlement when a position crosses the 90% collateral-loss threshold.
 type LiquidationEngine struct {
 	mu        sync.RWMutex
-	positions map[string]*OpenPosition // userToken -> position
+	positions map[string][]*OpenPosition // userToken -> positions, at most one per symbol
 	prices    *PriceSync
 	settle    SettleFunc
 	interval  time.Duration
+	clock     clock
+	mode      MarginMode
+	notify    NotifyFunc // tells the position's owner about liquidations; may be nil
+	dlq       *SettleDLQ // records settlements that failed; may be nil
+
+	// maxPerToken caps open positions per token (0 = unlimited).
+	maxPerToken int
+
+	// pending holds fills matched in a book but not yet applied by the fill
+	// worker (userToken -> symbol), so reduce-only sizing and the position
+	// limit see them; see CompleteFill.
+	pending map[string]map[string]*pendingFill
+
+	// settleFailures counts consecutive failed settle calls per position
+	// (keyed by positionKey); the position stays monitored, and is retried
+	// on the next check, until maxSettleAttempts is reached.
+	settleFailures    map[string]int
+	maxSettleAttempts int
+
+	// graceTicks and graceFor are how long a breach must last before the
+	// position is liquidated; see SetGracePeriod.
+	graceTicks int
+	graceFor   time.Duration
+
+	// detectOnly reports breaches without settling; detected holds the
+	// positions (by positionKey) already reported for the current breach.
+	detectOnly bool
+	detected   map[string]bool
+
+	// unpriced remembers symbols already warned about having no mark price,
+	// so the warning is logged once rather than every check.
+	unpriced map[string]bool
+
+	// checkMu keeps the ticker and CheckOnce from sweeping at the same time,
+	// which could settle one position twice.
+	checkMu sync.Mutex
 }
 
-// NewLiquidationEngine creates a liquidation engine.
+// NewLiquidationEngine creates a liquidation engine in isolated-margin mode.
 // settle is called whenever a position must be closed by force.
 func NewLiquidationEngine(prices *PriceSync, settle SettleFunc) *LiquidationEngine {
 	return &LiquidationEngine{
-		positions: make(map[string]*OpenPosition),
+		positions: make(map[string][]*OpenPosition),
+		pending:   make(map[string]map[string]*pendingFill),
 		prices:    prices,
 		settle:    settle,
 		interval:  5 * time.Second,
+		clock:     realClock{},
+		mode:      MarginIsolated,
+		unpriced:  make(map[string]bool),
+
+		settleFailures:    make(map[string]int),
+		maxSettleAttempts: DefaultMaxSettleAttempts,
+		graceTicks:        1,
+		detected:          make(map[string]bool),
 	}
 }
 
-// AddPosition registers a new open trade for monitoring.
-func (le *LiquidationEngine) AddPosition(p *OpenPosition) {
+func positionKey(userToken, symbol string) string {
+	return userToken + "\x00" + symbol
+}
+
+// markFor returns the mark price for a monitored symbol, warning once when
+// there is none — such positions cannot be liquidated until a price arrives.
+// A symbol whose price circuit breaker has tripped also gives 0, pausing its
+// liquidations until the breaker resumes.
+func (le *LiquidationEngine) markFor(symbol string) float64 {
+	if le.prices.Halted(symbol) {
+		return 0
+	}
+	mark := le.prices.GetMarkPrice(symbol)
 	le.mu.Lock()
 	defer le.mu.Unlock()
-	le.positions[p.UserToken] = p
+	if mark > 0 {
+		delete(le.unpriced, symbol)
+	} else if !le.unpriced[symbol] {
+		le.unpriced[symbol] = true
+		log.Printf("[liquidation] WARNING no mark price for %s — its positions are not being checked", symbol)
+	}
+	return mark
 }
 
-// RemovePosition removes a closed or liquidated trade from monitoring.
-func (le *LiquidationEngine) RemovePosition(userToken string) {
+// SetMaxPositionsPerToken caps how many open positions one token may hold.
+// 0 disables the limit. Orders are checked against it when placed; a fill
+// that opens a position is always monitored, since it has already traded.
+func (le *LiquidationEngine) SetMaxPositionsPerToken(n int) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.maxPerToken = n
+}
+
+// SetMaxSettleAttempts sets how many consecutive checks may fail to settle a
+// breached position before it is dead-lettered and dropped. Values below 1
+// mean a single attempt.
+func (le *LiquidationEngine) SetMaxSettleAttempts(n int) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.maxSettleAttempts = max(1, n)
+}
+
+// SetGracePeriod requires a position to stay past the liquidation threshold
+// for ticks consecutive checks, and for at least d since the first of them,
+// before it is liquidated, so one stale or spiky mark price cannot close it.
+// A check finding it back within the threshold starts the count over; one
+// that cannot price it (no mark, or the breaker tripped) leaves the count
+// alone. The default, 1 tick and no duration, liquidates on the first breach.
+func (le *LiquidationEngine) SetGracePeriod(ticks int, d time.Duration) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.graceTicks = max(1, ticks)
+	le.graceFor = max(0, d)
+}
+
+// SetDetectOnly switches detect-only mode, for deployments with no working
+// settle path: a breached position is logged and its owner sent a
+// "detected" liquidation event, once per breach, but nothing is settled and
+// the position stays monitored.
+func (le *LiquidationEngine) SetDetectOnly(on bool) {
 	le.mu.Lock()
 	defer le.mu.Unlock()
-	delete(le.positions, userToken)
+	le.detectOnly = on
 }
 
-// GetPosition returns a copy of the position or nil.
-func (le *LiquidationEngine) GetPosition(userToken string) *OpenPosition {
+// DetectOnly reports whether the engine is in detect-only mode.
+func (le *LiquidationEngine) DetectOnly() bool {
 	le.mu.RLock()
 	defer le.mu.RUnlock()
-	p, ok := le.positions[userToken]
-	if !ok {
+	return le.detectOnly
+}
+
+// confirmBreach records that a check found userToken's positions in symbols
+// past the threshold and reports whether the breach has lasted the grace
+// period, and whether this check is the one that started it. In cross mode
+// symbols lists every position of the token.
+func (le *LiquidationEngine) confirmBreach(userToken string, symbols ...string) (confirmed, started bool) {
+	now := le.clock.Now()
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	confirmed = true
+	for _, sym := range symbols {
+		i := le.indexOf(userToken, sym)
+		if i < 0 {
+			continue
+		}
+		p := le.positions[userToken][i]
+		if p.breachCount == 0 {
+			p.breachSince = now
+			started = true
+		}
+		p.breachCount++
+		if p.breachCount < le.graceTicks || now.Sub(p.breachSince) < le.graceFor {
+			confirmed = false
+		}
+	}
+	return confirmed, started
+}
+
+// clearBreach resets the breach count of userToken's positions in symbols
+// after a check found them within the threshold.
+func (le *LiquidationEngine) clearBreach(userToken string, symbols ...string) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	for _, sym := range symbols {
+		delete(le.detected, positionKey(userToken, sym))
+		if i := le.indexOf(userToken, sym); i >= 0 {
+			p := le.positions[userToken][i]
+			p.breachCount, p.breachSince = 0, time.Time{}
+		}
+	}
+}
+
+// settleRetrying reports whether userToken's position in symbol has already
+// failed to settle, so this check is a retry.
+func (le *LiquidationEngine) settleRetrying(userToken, symbol string) bool {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	return le.settleFailures[positionKey(userToken, symbol)] > 0
+}
+
+// settleFailed records a failed settle of userToken's position in symbol and
+// reports whether it should be given up on.
+func (le *LiquidationEngine) settleFailed(userToken, symbol string) (attempts int, giveUp bool) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	key := positionKey(userToken, symbol)
+	le.settleFailures[key]++
+	attempts = le.settleFailures[key]
+	return attempts, attempts >= le.maxSettleAttempts
+}
+
+// SetMarginMode switches between isolated and cross margin.
+func (le *LiquidationEngine) SetMarginMode(mode MarginMode) error {
+	if mode != MarginIsolated && mode != MarginCross {
+		return fmt.Errorf("unknown margin mode %q", mode)
+	}
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.mode = mode
+	return nil
+}
+
+// checkOpenLimit returns ErrPositionLimit when userToken holds no position
+// in symbol, so a fill there would open one, and already holds the maximum.
+// Symbols with fills still pending count as held.
+func (le *LiquidationEngine) checkOpenLimit(userToken, symbol string) error {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	held := func(sym string) bool {
+		return le.indexOf(userToken, sym) >= 0 || le.pending[userToken][sym] != nil
+	}
+	if le.maxPerToken <= 0 || held(symbol) {
 		return nil
 	}
+	n := len(le.positions[userToken])
+	for sym := range le.pending[userToken] {
+		if le.indexOf(userToken, sym) < 0 {
+			n++
+		}
+	}
+	if n >= le.maxPerToken {
+		return fmt.Errorf("%w: token has %d open positions (max %d)",
+			ErrPositionLimit, n, le.maxPerToken)
+	}
+	return nil
+}
+
+// AddPosition registers a new open trade for monitoring. A position in a
+// symbol the token already holds replaces it and never counts against the
+// per-token limit.
+func (le *LiquidationEngine) AddPosition(p *OpenPosition) error {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if i := le.indexOf(p.UserToken, p.Symbol); i >= 0 {
+		le.positions[p.UserToken][i] = p
+		return nil
+	}
+	if n := len(le.positions[p.UserToken]); le.maxPerToken > 0 && n >= le.maxPerToken {
+		return fmt.Errorf("%w: token has %d open positions (max %d)",
+			ErrPositionLimit, n, le.maxPerToken)
+	}
+	le.positions[p.UserToken] = append(le.positions[p.UserToken], p)
+	return nil
+}
+
+// indexOf returns the index of userToken's position in symbol, or -1. Must
+// be called with le.mu held.
+func (le *LiquidationEngine) indexOf(userToken, symbol string) int {
+	for i, p := range le.positions[userToken] {
+		if p.Symbol == symbol {
+			return i
+		}
+	}
+	return -1
+}
+
+// AdjustCollateral adds delta (negative to withdraw) to the collateral of
+// userToken's position in symbol and returns the updated copy. Withdrawals
+// that would make the position liquidatable at markPrice are refused with
+// ErrMaintenanceMargin.
+func (le *LiquidationEngine) AdjustCollateral(userToken, symbol string, delta, markPrice float64) (*OpenPosition, error) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	i := le.indexOf(userToken, symbol)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoPosition, symbol)
+	}
+	p := le.positions[userToken][i]
+
+	next := *p
+	if next.DebtAmount <= 0 {
+		// Pin the exposure before collateral changes so leverage falls as
+		// margin is added rather than the notional growing with it.
+		next.DebtAmount = next.notional()
+	}
+	next.CollateralAmount = roundStroops(p.CollateralAmount + delta)
+	if next.CollateralAmount <= 0 ||
+		(delta < 0 && next.unrealisedLoss(markPrice) >= liquidationThreshold*next.CollateralAmount) {
+		return nil, fmt.Errorf("%w: collateral %.7f cannot cover the current loss",
+			ErrMaintenanceMargin, next.CollateralAmount)
+	}
+	*p = next
+	cp := next
+	return &cp, nil
+}
+
+// pendingFill is fill volume, in base units per direction, that has matched
+// in a book but not yet been folded into a position by CompleteFill.
+type pendingFill struct {
+	long, short float64
+}
+
+// netLocked is userToken's signed position in symbol, long positive,
+// counting fills matched but not yet applied. Must be called with le.mu
+// held.
+func (le *LiquidationEngine) netLocked(userToken, symbol string) float64 {
+	var net float64
+	if i := le.indexOf(userToken, symbol); i >= 0 {
+		p := le.positions[userToken][i]
+		if net = p.Size(); p.Side == "short" {
+			net = -net
+		}
+	}
+	if f := le.pending[userToken][symbol]; f != nil {
+		net += f.long - f.short
+	}
+	return roundStroops(net)
+}
+
+// netPosition is netLocked for callers that don't hold le.mu.
+func (le *LiquidationEngine) netPosition(userToken, symbol string) float64 {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	return le.netLocked(userToken, symbol)
+}
+
+// reducible implements positionLedger: what the reduce-only order o may
+// still close of its owner's net position.
+func (le *LiquidationEngine) reducible(o Order) float64 {
+	net := le.netPosition(o.UserToken, o.Symbol)
+	if o.Side == Sell {
+		return max(net, 0)
+	}
+	return max(-net, 0)
+}
+
+// matched implements positionLedger, holding a fill of o as pending until
+// the fill worker completes it.
+func (le *LiquidationEngine) matched(o Order, amount float64) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if le.pending[o.UserToken] == nil {
+		le.pending[o.UserToken] = make(map[string]*pendingFill)
+	}
+	f := le.pending[o.UserToken][o.Symbol]
+	if f == nil {
+		f = &pendingFill{}
+		le.pending[o.UserToken][o.Symbol] = f
+	}
+	if o.Side == Buy {
+		f.long = roundStroops(f.long + amount)
+	} else {
+		f.short = roundStroops(f.short + amount)
+	}
+}
+
+// CompleteFill finishes a fill the books recorded as pending: it takes the
+// matched amount off the pending ledger and, in the same step, folds applied
+// of it into the position as ApplyFill does, so sizing never counts the fill
+// twice or misses it. applied is 0 for a fill that never reached the chain
+// and less than matched for a reduce-only fill trimmed to its position. It
+// returns the resulting position, nil when there is none.
+func (le *LiquidationEngine) CompleteFill(userToken, symbol, side string, price, matched, applied float64, leverage int) (*OpenPosition, error) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if f := le.pending[userToken][symbol]; f != nil {
+		if side == "long" {
+			f.long = max(roundStroops(f.long-matched), 0)
+		} else {
+			f.short = max(roundStroops(f.short-matched), 0)
+		}
+		if f.long == 0 && f.short == 0 {
+			delete(le.pending[userToken], symbol)
+			if len(le.pending[userToken]) == 0 {
+				delete(le.pending, userToken)
+			}
+		}
+	}
+	if applied > 0 {
+		return le.applyFillLocked(userToken, symbol, side, price, applied, leverage)
+	}
+	if i := le.indexOf(userToken, symbol); i >= 0 {
+		cp := *le.positions[userToken][i]
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+// ApplyFill folds a fill of amount base units at price into userToken's
+// position in symbol, side being the direction the fill trades ("long" for a
+// buy, "short" for a sell), and returns the resulting position (nil once it
+// is closed). With no position it opens one. A same-side fill averages in:
+// EntryPrice becomes the size-weighted average of the old entry and price,
+// notional and collateral (notional / leverage) grow by the fill's, and
+// Leverage becomes the blended notional / collateral. An opposite-side fill
+// reduces the position at its existing entry, closes it when the sizes
+// match, and past that flips it to side with the remainder entered at price.
+func (le *LiquidationEngine) ApplyFill(userToken, symbol, side string, price, amount float64, leverage int) (*OpenPosition, error) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return le.applyFillLocked(userToken, symbol, side, price, amount, leverage)
+}
+
+// applyFillLocked is ApplyFill. Must be called with le.mu held.
+func (le *LiquidationEngine) applyFillLocked(userToken, symbol, side string, price, amount float64, leverage int) (*OpenPosition, error) {
+	if price <= 0 || amount <= 0 {
+		return nil, fmt.Errorf("fill needs a positive price and amount, got %v @ %v", amount, price)
+	}
+	leverage = max(leverage, 1)
+
+	// The position limit was checked when the order was placed; the fill
+	// has traded, so it is monitored whatever the count is now.
+	open := func(amount float64) (*OpenPosition, error) {
+		notional := roundStroops(price * amount)
+		p := &OpenPosition{
+			UserToken:        userToken,
+			Symbol:           symbol,
+			Side:             side,
+			EntryPrice:       price,
+			Leverage:         leverage,
+			CollateralAmount: roundStroops(notional / float64(leverage)),
+			DebtAmount:       notional,
+		}
+		le.positions[userToken] = append(le.positions[userToken], p)
+		cp := *p
+		return &cp, nil
+	}
+
+	i := le.indexOf(userToken, symbol)
+	if i < 0 {
+		return open(amount)
+	}
+	p := le.positions[userToken][i]
+	size := p.Size()
+
+	switch {
+	case p.Side == side:
+		// The entry is left unrounded: Size is derived from notional / entry,
+		// and rounding the average would skew it off the true size.
+		added := price * amount
+		p.DebtAmount = roundStroops(p.notional() + added)
+		p.EntryPrice = p.DebtAmount / (size + amount)
+		p.CollateralAmount = roundStroops(p.CollateralAmount + added/float64(leverage))
+		// Adding at another leverage changes the blend; report the effective one.
+		p.Leverage = max(int(math.Round(p.DebtAmount/p.CollateralAmount)), 1)
+	case amount < size:
+		keep := 1 - amount/size
+		p.DebtAmount = roundStroops(p.notional() * keep)
+		p.CollateralAmount = roundStroops(p.CollateralAmount * keep)
+	default:
+		le.removeLocked(userToken, symbol)
+		if rest := roundStroops(amount - size); rest > 0 {
+			return open(rest)
+		}
+		return nil, nil
+	}
 	cp := *p
+	return &cp, nil
+}
+
+// FillPlan is how a fill would change a position; see PreviewFill.
+type FillPlan struct {
+	Reduce   float64 // base units of an opposite-side position the fill reduces
+	Close    bool    // Reduce is the whole position
+	Realised float64 // PnL on Reduce at the fill price, in quote units
+	Open     float64 // base units opened on side, or added to a same-side position
+}
+
+// PreviewFill reports what ApplyFill would do with the same fill, without
+// changing anything, so callers can mirror it on-chain first.
+func (le *LiquidationEngine) PreviewFill(userToken, symbol, side string, price, amount float64) FillPlan {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	i := le.indexOf(userToken, symbol)
+	if i < 0 {
+		return FillPlan{Open: amount}
+	}
+	p := le.positions[userToken][i]
+	if p.Side == side {
+		return FillPlan{Open: amount}
+	}
+	size := p.Size()
+	plan := FillPlan{Reduce: min(amount, size)}
+	if amount >= size {
+		plan.Close = true
+		plan.Open = roundStroops(amount - size)
+	}
+	move := price - p.EntryPrice
+	if p.Side == "short" {
+		move = -move
+	}
+	plan.Realised = roundStroops(move * plan.Reduce)
+	return plan
+}
+
+// RemovePosition removes a closed or liquidated trade from monitoring.
+func (le *LiquidationEngine) RemovePosition(userToken, symbol string) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.removeLocked(userToken, symbol)
+}
+
+// removeLocked drops userToken's position in symbol. Must be called with
+// le.mu held.
+func (le *LiquidationEngine) removeLocked(userToken, symbol string) {
+	delete(le.settleFailures, positionKey(userToken, symbol))
+	delete(le.detected, positionKey(userToken, symbol))
+	i := le.indexOf(userToken, symbol)
+	if i < 0 {
+		return
+	}
+	ps := le.positions[userToken]
+	ps = append(ps[:i], ps[i+1:]...)
+	if len(ps) == 0 {
+		delete(le.positions, userToken)
+		return
+	}
+	le.positions[userToken] = ps
+}
+
+// GetPosition returns a copy of userToken's position in symbol, or nil.
+func (le *LiquidationEngine) GetPosition(userToken, symbol string) *OpenPosition {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	i := le.indexOf(userToken, symbol)
+	if i < 0 {
+		return nil
+	}
+	cp := *le.positions[userToken][i]
 	return &cp
 }
 
+// Positions returns copies of every position userToken holds.
+func (le *LiquidationEngine) Positions(userToken string) []OpenPosition {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	out := make([]OpenPosition, 0, len(le.positions[userToken]))
+	for _, p := range le.positions[userToken] {
+		out = append(out, *p)
+	}
+	return out
+}
+
+// AllPositions returns copies of every monitored position sorted by token
+// then symbol.
+func (le *LiquidationEngine) AllPositions() []OpenPosition {
+	le.mu.RLock()
+	out := make([]OpenPosition, 0, len(le.positions))
+	for _, ps := range le.positions {
+		for _, p := range ps {
+			out = append(out, *p)
+		}
+	}
+	le.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].UserToken != out[j].UserToken {
+			return out[i].UserToken < out[j].UserToken
+		}
+		return out[i].Symbol < out[j].Symbol
+	})
+	return out
+}
+
+// OpenInterest is one symbol's open leveraged exposure in quote units.
+type OpenInterest struct {
+	Long       float64 `json:"long"`  // summed notional (DebtAmount) of longs
+	Short      float64 `json:"short"` // summed notional (DebtAmount) of shorts
+	LongCount  int     `json:"longCount"`
+	ShortCount int     `json:"shortCount"`
+}
+
+// OpenInterest sums every monitored position's notional by symbol and side.
+func (le *LiquidationEngine) OpenInterest() map[string]OpenInterest {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	out := make(map[string]OpenInterest)
+	for _, ps := range le.positions {
+		for _, p := range ps {
+			oi := out[p.Symbol]
+			if p.Side == "short" {
+				oi.Short = roundStroops(oi.Short + p.notional())
+				oi.ShortCount++
+			} else {
+				oi.Long = roundStroops(oi.Long + p.notional())
+				oi.LongCount++
+			}
+			out[p.Symbol] = oi
+		}
+	}
+	return out
+}
+
+// CheckOnce runs one liquidation check now, exactly as the ticker would —
+// it counts towards the grace period — and returns the positions it
+// liquidated as "token:symbol", sorted. For tests and debugging.
+func (le *LiquidationEngine) CheckOnce(ctx context.Context) []string {
+	liquidated := le.checkAll(ctx)
+	sort.Strings(liquidated)
+	return liquidated
+}
+
 // Run starts the background liquidation check loop until ctx is cancelled.
 func (le *LiquidationEngine) Run(ctx context.Context) {
-	ticker := time.NewTicker(le.interval)
+	ticker := le.clock.NewTicker(le.interval)
 	defer ticker.Stop()
 	log.Println("[liquidation] engine started, check interval:", le.interval)
 	for {
@@ -80,77 +753,244 @@ func (le *LiquidationEngine) Run(ctx context.Context) {
 		case <-ctx.Done():
 			log.Println("[liquidation] engine stopped")
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			le.checkAll(ctx)
 		}
 	}
 }
 
-// checkAll iterates every monitored position and liquidates if appropriate.
+// checkAll iterates every monitored token and liquidates if appropriate.
 //
 // Liquidation condition (90% collateral-loss threshold):
-//   long:  unrealisedLoss = (entryPrice - markPrice) / entryPrice × leverage × collateral
-//   short: unrealisedLoss = (markPrice - entryPrice) / entryPrice × leverage × collateral
+//   long:  unrealisedLoss = (entryPrice - markPrice) / entryPrice × notional
+//   short: unrealisedLoss = (markPrice - entryPrice) / entryPrice × notional
 //   trigger when unrealisedLoss >= 0.90 × collateral
-func (le *LiquidationEngine) checkAll(ctx context.Context) {
+// notional is DebtAmount, or leverage × collateral when that is unset, so a
+// margin top-up lowers effective leverage and pushes liquidation away.
+//
+// In isolated mode each position is checked on its own. In cross mode the
+// token's positions are netted — profits offset losses and collateral is
+// pooled — and all of them are closed together when the pool is breached.
+//
+// Either way the breach must last the grace period (SetGracePeriod) first.
+// It returns the positions settled and closed, as "token:symbol".
+func (le *LiquidationEngine) checkAll(ctx context.Context) (liquidated []string) {
+	le.checkMu.Lock()
+	defer le.checkMu.Unlock()
+
 	le.mu.RLock()
-	// copy keys so we can release the read lock before calling settle
-	tokens := make([]string, 0, len(le.positions))
-	for t := range le.positions {
-		tokens = append(tokens, t)
+	mode := le.mode
+	// copy positions so we can release the read lock before calling settle
+	books := make(map[string][]OpenPosition, len(le.positions))
+	for t, ps := range le.positions {
+		for _, p := range ps {
+			books[t] = append(books[t], *p)
+		}
 	}
 	le.mu.RUnlock()
 
-	for _, token := range tokens {
-		le.mu.RLock()
-		pos, ok := le.positions[token]
-		if !ok {
-			le.mu.RUnlock()
+	for token, ps := range books {
+		if mode == MarginCross {
+			liquidated = append(liquidated, le.checkCross(ctx, token, ps)...)
 			continue
 		}
-		p := *pos // local copy
-		le.mu.RUnlock()
+		for _, p := range ps {
+			markPrice := le.markFor(p.Symbol)
+			if markPrice <= 0 || p.EntryPrice <= 0 {
+				continue
+			}
+			unrealisedLoss := p.unrealisedLoss(markPrice)
+			if unrealisedLoss < liquidationThreshold*p.CollateralAmount {
+				if p.breachCount > 0 {
+					le.clearBreach(p.UserToken, p.Symbol)
+				}
+				continue
+			}
+			if confirmed, started := le.confirmBreach(p.UserToken, p.Symbol); !confirmed {
+				if started {
+					log.Printf("[liquidation] %s %s past threshold (mark=%.6f) — waiting out grace period",
+						p.UserToken, p.Symbol, markPrice)
+				}
+				continue
+			}
+			if !le.DetectOnly() {
+				log.Printf(
+					"[liquidation] LIQUIDATING %s | symbol=%s side=%s entry=%.6f mark=%.6f loss=%.4f collateral=%.4f",
+					p.UserToken, p.Symbol, p.Side, p.EntryPrice, markPrice, unrealisedLoss, p.CollateralAmount,
+				)
+			}
+			if le.liquidate(ctx, p, markPrice) {
+				liquidated = append(liquidated, p.UserToken+":"+p.Symbol)
+			}
+		}
+	}
+	return liquidated
+}
 
-		markPrice := le.prices.GetMarkPrice(p.Symbol)
-		if markPrice <= 0 || p.EntryPrice <= 0 {
-			continue
+// checkCross evaluates one token's positions against their pooled collateral.
+// A position without a mark price blocks the check rather than being netted
+// at an unknown value. It returns the positions liquidated, like checkAll.
+func (le *LiquidationEngine) checkCross(ctx context.Context, token string, ps []OpenPosition) (liquidated []string) {
+	var pnl, collateral float64
+	marks := make([]float64, len(ps))
+	symbols := make([]string, len(ps))
+	for i, p := range ps {
+		marks[i] = le.markFor(p.Symbol)
+		if marks[i] <= 0 || p.EntryPrice <= 0 {
+			return nil
 		}
+		pnl += p.unrealisedPnL(marks[i])
+		collateral += p.CollateralAmount
+		symbols[i] = p.Symbol
+	}
+	if -pnl < liquidationThreshold*collateral {
+		le.clearBreach(token, symbols...)
+		return nil
+	}
+	if confirmed, started := le.confirmBreach(token, symbols...); !confirmed {
+		if started {
+			log.Printf("[liquidation] %s (cross) past threshold — waiting out grace period", token)
+		}
+		return nil
+	}
 
-		var unrealisedLoss float64
-		switch p.Side {
-		case "long":
-			if markPrice < p.EntryPrice {
-				pct := (p.EntryPrice - markPrice) / p.EntryPrice
-				unrealisedLoss = pct * float64(p.Leverage) * p.CollateralAmount
-			}
-		case "short":
-			if markPrice > p.EntryPrice {
-				pct := (markPrice - p.EntryPrice) / p.EntryPrice
-				unrealisedLoss = pct * float64(p.Leverage) * p.CollateralAmount
-			}
+	if !le.DetectOnly() {
+		log.Printf("[liquidation] LIQUIDATING %s (cross) | positions=%d pnl=%.4f collateral=%.4f",
+			token, len(ps), pnl, collateral)
+	}
+	for i, p := range ps {
+		if le.liquidate(ctx, p, marks[i]) {
+			liquidated = append(liquidated, p.UserToken+":"+p.Symbol)
 		}
+	}
+	return liquidated
+}
 
-		threshold := 0.90 * p.CollateralAmount
-		if unrealisedLoss < threshold {
-			continue
+// liquidate settles p at markPrice and stops monitoring it; in detect-only
+// mode it only reports the breach. By default a failed settle dead-letters
+// and drops the position at once. With SetMaxSettleAttempts above one it
+// keeps the position so later checks retry it, giving up after that many
+// failures in a row. The owner hears over SSE of the first attempt and the
+// final outcome, never of the retries in between. It reports whether p was
+// settled and closed.
+func (le *LiquidationEngine) liquidate(ctx context.Context, p OpenPosition, markPrice float64) bool {
+	ev := LiquidationEvent{
+		Symbol:     p.Symbol,
+		Side:       p.Side,
+		EntryPrice: p.EntryPrice,
+		MarkPrice:  markPrice,
+		Seized:     roundStroops(min(p.unrealisedLoss(markPrice), p.CollateralAmount)),
+		Status:     "attempted",
+	}
+	if detectOnly, first := le.detectOnlyBreach(p); detectOnly {
+		if first {
+			ev.Status = "detected"
+			le.notifyLiquidation(p.UserToken, ev)
+			log.Printf("[liquidation] detect-only: %s %s would be liquidated at %.6f (seize %.4f) — settlement disabled",
+				p.UserToken, p.Symbol, markPrice, ev.Seized)
 		}
+		return false
+	}
+	// Retries stay quiet: the owner hears of the first attempt and the
+	// final outcome only.
+	if !le.settleRetrying(p.UserToken, p.Symbol) {
+		le.notifyLiquidation(p.UserToken, ev)
+	}
 
-		// ── Liquidation triggered ─────────────────────────────────────────────
-		log.Printf(
-			"[liquidation] LIQUIDATING %s | symbol=%s side=%s entry=%.6f mark=%.6f loss=%.4f collateral=%.4f",
-			p.UserToken, p.Symbol, p.Side, p.EntryPrice, markPrice, unrealisedLoss, p.CollateralAmount,
-		)
+	// Pass the current mark price; the contract computes PnL on-chain. Settle
+	// funcs that send PnL instead read the seized collateral, as a loss, from
+	// the context.
+	pnl := -ev.Seized
+	if err := le.settle(WithSettlePnL(ctx, pnl), p.UserToken, p.Symbol, markPrice); err != nil {
+		attempts, giveUp := le.settleFailed(p.UserToken, p.Symbol)
+		if !giveUp {
+			log.Printf("[liquidation] settle error for %s %s (attempt %d): %v — retrying next check",
+				p.UserToken, p.Symbol, attempts, err)
+			return false
+		}
+		ev.Status, ev.Error = "failed", err.Error()
+		le.notifyLiquidation(p.UserToken, ev)
+		log.Printf("[liquidation] settle error for %s %s (attempt %d): %v — giving up, removing position",
+			p.UserToken, p.Symbol, attempts, err)
+		if le.dlq != nil {
+			dead, dlqErr := le.dlq.Add(FailedSettlement{
+				UserToken:  p.UserToken,
+				Symbol:     p.Symbol,
+				ClosePrice: markPrice,
+				PnL:        pnl,
+				Error:      err.Error(),
+			})
+			if dlqErr != nil {
+				log.Printf("[liquidation] dead-letter write failed for nonce %s: %v", dead.Nonce, dlqErr)
+			}
+		}
+		le.RemovePosition(p.UserToken, p.Symbol)
+		return false
+	}
 
-		// Pass the current mark price; the contract computes PnL on-chain.
-		if err := le.settle(ctx, p.UserToken, p.Symbol, markPrice); err != nil {
-			log.Printf("[liquidation] settle error for %s: %v — removing stale position", p.UserToken, err)
-			// Remove regardless of error type: if the contract says NoOpenPosition
-			// or the tx fails, the position no longer needs tracking.
-			le.RemovePosition(p.UserToken)
-			continue
+	le.RemovePosition(p.UserToken, p.Symbol)
+	ev.Status = "confirmed"
+	le.notifyLiquidation(p.UserToken, ev)
+	log.Printf("[liquidation] position closed for %s %s (liquidated)", p.UserToken, p.Symbol)
+	return true
+}
+
+// detectOnlyBreach reports whether the engine is detect-only, so liquidate
+// must not settle p, and whether this is the first check of the current
+// breach to find p, so it should be reported.
+func (le *LiquidationEngine) detectOnlyBreach(p OpenPosition) (detectOnly, first bool) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if !le.detectOnly {
+		return false, false
+	}
+	key := positionKey(p.UserToken, p.Symbol)
+	first = !le.detected[key]
+	le.detected[key] = true
+	return true, first
+}
+
+// RetrySettlement replays the dead-lettered settlement with the given nonce
+// through the settle func, tagging the call with WithSettleNonce. It is
+// removed from the queue on success and kept, with the new error, otherwise;
+// a nonce that was already settled gives ErrAlreadySettled, so repeating a
+// retry cannot settle twice. A settlement whose resolution can't be persisted
+// gives ErrSettledNotRecorded.
+func (le *LiquidationEngine) RetrySettlement(ctx context.Context, nonce string) (FailedSettlement, error) {
+	if le.dlq == nil {
+		return FailedSettlement{}, ErrDeadLetterNotFound
+	}
+	e, err := le.dlq.claim(nonce)
+	if err != nil {
+		return FailedSettlement{}, err
+	}
+	ctx = WithSettleNonce(ctx, nonce)
+	if e.HasPnL() {
+		ctx = WithSettlePnL(ctx, e.PnL)
+	}
+	settleErr := le.settle(ctx, e.UserToken, e.Symbol, e.ClosePrice)
+	if err := le.dlq.finish(e, settleErr); err != nil {
+		if settleErr == nil {
+			return e, fmt.Errorf("%w: %v", ErrSettledNotRecorded, err)
 		}
+		log.Printf("[liquidation] dead-letter update failed for nonce %s: %v", nonce, err)
+	}
+	if settleErr != nil {
+		return e, settleErr
+	}
+	log.Printf("[liquidation] replayed settlement %s for %s %s", nonce, e.UserToken, e.Symbol)
+	return e, nil
+}
 
-		le.RemovePosition(p.UserToken)
-		log.Printf("[liquidation] position closed for %s (liquidated)", p.UserToken)
+// notifyLiquidation sends ev to userToken's stream as a "liquidation" event.
+func (le *LiquidationEngine) notifyLiquidation(userToken string, ev LiquidationEvent) {
+	if le.notify == nil {
+		return
+	}
+	msg := fmt.Sprintf("Liquidation %s: %s %s entry %.7g mark %.7g, %.7g collateral seized",
+		ev.Status, ev.Side, ev.Symbol, ev.EntryPrice, ev.MarkPrice, ev.Seized)
+	if ev.Error != "" {
+		msg += " (settle error: " + ev.Error + ")"
 	}
+	le.notify(userToken, "liquidation", msg, ev)
 }
@@ -0,0 +1,545 @@
+package matching
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// settleCall records one invocation of a fake SettleFunc.
+type settleCall struct {
+	userToken  string
+	symbol     string
+	closePrice float64
+}
+
+// fakeSettle returns a SettleFunc that records calls and returns err.
+func fakeSettle(calls *[]settleCall, err error) SettleFunc {
+	return func(_ context.Context, userToken, symbol string, closePrice float64) error {
+		*calls = append(*calls, settleCall{userToken, symbol, closePrice})
+		return err
+	}
+}
+
+func TestCheckAllLiquidationThreshold(t *testing.T) {
+	// Entry 2.0, 9x leverage, 80 collateral: the 90% threshold (72) is hit by
+	// a 10% adverse move, i.e. mark 1.8 for a long and 2.2 for a short. 0.1 has
+	// no exact float form, so the boundary rows sit a hair either side of it.
+	tests := []struct {
+		name      string
+		side      string
+		mark      float64
+		liquidate bool
+	}{
+		{"long just past threshold", "long", 1.7999, true},
+		{"long well past threshold", "long", 1.5, true},
+		{"long just short of threshold", "long", 1.8001, false},
+		{"long on a price rise", "long", 3.0, false},
+		{"short just past threshold", "short", 2.2001, true},
+		{"short on a price rise", "short", 4.0, true},
+		{"short just short of threshold", "short", 2.1999, false},
+		{"short on a price drop", "short", 1.0, false},
+		{"unchanged price", "long", 2.0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := NewPriceSync()
+			ps.SetMarkPrice("XLM/USDC", tt.mark, SourceMock)
+			var calls []settleCall
+			le := NewLiquidationEngine(ps, fakeSettle(&calls, nil))
+			if err := le.AddPosition(&OpenPosition{
+				UserToken:        "tok",
+				Symbol:           "XLM/USDC",
+				Side:             tt.side,
+				EntryPrice:       2.0,
+				Leverage:         9,
+				CollateralAmount: 80,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			le.checkAll(context.Background())
+
+			if !tt.liquidate {
+				if len(calls) != 0 {
+					t.Fatalf("settled %+v, want no liquidation", calls)
+				}
+				if le.GetPosition("tok", "XLM/USDC") == nil {
+					t.Fatal("position removed without liquidation")
+				}
+				return
+			}
+			want := settleCall{"tok", "XLM/USDC", tt.mark}
+			if len(calls) != 1 || calls[0] != want {
+				t.Fatalf("settle calls = %+v, want [%+v]", calls, want)
+			}
+			if le.GetPosition("tok", "XLM/USDC") != nil {
+				t.Fatal("liquidated position still monitored")
+			}
+		})
+	}
+}
+
+func TestCheckAllSkipsMissingMarkPrice(t *testing.T) {
+	var calls []settleCall
+	le := NewLiquidationEngine(NewPriceSync(), fakeSettle(&calls, nil))
+	le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "BTC/USDC", Side: "long", EntryPrice: 2, Leverage: 20, CollateralAmount: 10})
+
+	le.checkAll(context.Background())
+
+	if len(calls) != 0 || le.GetPosition("tok", "BTC/USDC") == nil {
+		t.Fatalf("liquidated without a mark price: %+v", calls)
+	}
+}
+
+func TestCheckAllRemovesPositionWhenSettleFails(t *testing.T) {
+	ps := NewPriceSync()
+	ps.SetMarkPrice("XLM/USDC", 1.0, SourceMock)
+	var calls []settleCall
+	le := NewLiquidationEngine(ps, fakeSettle(&calls, errors.New("NoOpenPosition")))
+	le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80})
+
+	le.checkAll(context.Background())
+
+	if len(calls) != 1 {
+		t.Fatalf("settle calls = %d, want 1", len(calls))
+	}
+	if le.GetPosition("tok", "XLM/USDC") != nil {
+		t.Fatal("position still monitored after a failed settle")
+	}
+}
+
+// TestCheckAllRetriesFailedSettle checks that with retries enabled a failed
+// settle keeps the position until the last attempt, and that the owner hears
+// only of the first attempt and the final failure.
+func TestCheckAllRetriesFailedSettle(t *testing.T) {
+	const attempts = 3
+	ps := NewPriceSync()
+	ps.SetMarkPrice("XLM/USDC", 1.0, SourceMock)
+	var calls []settleCall
+	le := NewLiquidationEngine(ps, fakeSettle(&calls, errors.New("NoOpenPosition")))
+	le.SetMaxSettleAttempts(attempts)
+	var statuses []string
+	le.notify = func(_, _, _ string, data any) {
+		statuses = append(statuses, data.(LiquidationEvent).Status)
+	}
+	le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80})
+
+	for i := 1; i < attempts; i++ {
+		le.checkAll(context.Background())
+		if len(calls) != i {
+			t.Fatalf("check %d: settle calls = %d, want %d", i, len(calls), i)
+		}
+		if le.GetPosition("tok", "XLM/USDC") == nil {
+			t.Fatalf("check %d: position dropped before the last attempt", i)
+		}
+	}
+
+	le.checkAll(context.Background())
+
+	if len(calls) != attempts {
+		t.Fatalf("settle calls = %d, want %d", len(calls), attempts)
+	}
+	if le.GetPosition("tok", "XLM/USDC") != nil {
+		t.Fatal("position still monitored after the last failed attempt")
+	}
+	if len(statuses) != 2 || statuses[0] != "attempted" || statuses[1] != "failed" {
+		t.Errorf("owner notified %q, want [attempted failed]", statuses)
+	}
+}
+
+func TestAdjustCollateral(t *testing.T) {
+	newEngine := func() *LiquidationEngine {
+		le := NewLiquidationEngine(NewPriceSync(), fakeSettle(new([]settleCall), nil))
+		le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 10, CollateralAmount: 100, DebtAmount: 1000})
+		return le
+	}
+
+	t.Run("top-up moves liquidation away", func(t *testing.T) {
+		le := newEngine()
+		before := le.GetPosition("tok", "XLM/USDC").LiquidationPrice() // 2 × (1 − 0.9×100/1000) = 1.82
+		p, err := le.AdjustCollateral("tok", "XLM/USDC", 100, 1.9)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.CollateralAmount != 200 || p.DebtAmount != 1000 {
+			t.Fatalf("position = %+v", p)
+		}
+		if after := p.LiquidationPrice(); after >= before {
+			t.Fatalf("liquidation price %v → %v, want lower", before, after)
+		}
+	})
+
+	t.Run("withdrawal past maintenance refused", func(t *testing.T) {
+		le := newEngine()
+		// At mark 1.9 the loss is 50; 90% of 50 collateral (45) can't cover it.
+		if _, err := le.AdjustCollateral("tok", "XLM/USDC", -50, 1.9); !errors.Is(err, ErrMaintenanceMargin) {
+			t.Fatalf("err = %v, want ErrMaintenanceMargin", err)
+		}
+		if got := le.GetPosition("tok", "XLM/USDC").CollateralAmount; got != 100 {
+			t.Fatalf("collateral changed to %v on a refused withdrawal", got)
+		}
+	})
+
+	t.Run("safe withdrawal allowed", func(t *testing.T) {
+		le := newEngine()
+		if _, err := le.AdjustCollateral("tok", "XLM/USDC", -20, 2.0); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("unknown symbol", func(t *testing.T) {
+		le := newEngine()
+		if _, err := le.AdjustCollateral("tok", "BTC/USDC", 10, 1); !errors.Is(err, ErrNoPosition) {
+			t.Fatalf("err = %v, want ErrNoPosition", err)
+		}
+	})
+}
+
+func TestMarginModes(t *testing.T) {
+	// A losing XLM long (loss 75 of 80 collateral) hedged by a winning BTC
+	// short (profit 50 on 80 collateral).
+	setup := func(mode MarginMode) (*LiquidationEngine, *[]settleCall) {
+		ps := NewPriceSync()
+		ps.SetMarkPrice("XLM/USDC", 1.75, SourceMock) // −12.5% on 600 notional
+		ps.SetMarkPrice("BTC/USDC", 90, SourceMock)   // −10% on 500 notional, short
+		calls := new([]settleCall)
+		le := NewLiquidationEngine(ps, fakeSettle(calls, nil))
+		if err := le.SetMarginMode(mode); err != nil {
+			t.Fatal(err)
+		}
+		le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, CollateralAmount: 80, DebtAmount: 600})
+		le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "BTC/USDC", Side: "short", EntryPrice: 100, CollateralAmount: 80, DebtAmount: 500})
+		return le, calls
+	}
+
+	t.Run("isolated liquidates the losing leg only", func(t *testing.T) {
+		le, calls := setup(MarginIsolated)
+		le.checkAll(context.Background())
+		if len(*calls) != 1 || (*calls)[0].symbol != "XLM/USDC" {
+			t.Fatalf("settle calls = %+v, want the XLM leg only", *calls)
+		}
+		if got := le.Positions("tok"); len(got) != 1 || got[0].Symbol != "BTC/USDC" {
+			t.Fatalf("remaining positions = %+v", got)
+		}
+	})
+
+	t.Run("cross nets the hedge", func(t *testing.T) {
+		le, calls := setup(MarginCross)
+		le.checkAll(context.Background()) // pnl −25 vs 0.9 × 160 pooled
+		if len(*calls) != 0 || len(le.Positions("tok")) != 2 {
+			t.Fatalf("cross margin liquidated a hedged book: %+v", *calls)
+		}
+	})
+
+	t.Run("cross closes everything when the pool is breached", func(t *testing.T) {
+		le, calls := setup(MarginCross)
+		le.prices.SetMarkPrice("BTC/USDC", 130, SourceMock) // short now loses 150
+		le.checkAll(context.Background())
+		if len(*calls) != 2 || len(le.Positions("tok")) != 0 {
+			t.Fatalf("settle calls = %+v, want both legs closed", *calls)
+		}
+	})
+
+	if err := NewLiquidationEngine(NewPriceSync(), nil).SetMarginMode("portfolio"); err == nil {
+		t.Fatal("SetMarginMode accepted an unknown mode")
+	}
+}
+
+func TestPositionsPerSymbol(t *testing.T) {
+	le := NewLiquidationEngine(NewPriceSync(), nil)
+	le.SetMaxPositionsPerToken(2)
+	add := func(sym string) error {
+		return le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: sym, Side: "long", EntryPrice: 1, Leverage: 1, CollateralAmount: 1})
+	}
+	if err := add("XLM/USDC"); err != nil {
+		t.Fatal(err)
+	}
+	if err := add("BTC/USDC"); err != nil {
+		t.Fatal(err)
+	}
+	if err := add("XLM/USDC"); err != nil {
+		t.Fatalf("replacing an existing symbol hit the limit: %v", err)
+	}
+	if err := add("ETH/USDC"); !errors.Is(err, ErrPositionLimit) {
+		t.Fatalf("err = %v, want ErrPositionLimit", err)
+	}
+	le.RemovePosition("tok", "XLM/USDC")
+	if le.GetPosition("tok", "XLM/USDC") != nil || le.GetPosition("tok", "BTC/USDC") == nil {
+		t.Fatalf("RemovePosition removed the wrong symbol: %+v", le.Positions("tok"))
+	}
+}
+
+func TestOpenInterest(t *testing.T) {
+	le := NewLiquidationEngine(NewPriceSync(), nil)
+	for _, p := range []OpenPosition{
+		{UserToken: "a", Symbol: "XLM/USDC", Side: "long", EntryPrice: 0.1, Leverage: 5, CollateralAmount: 20, DebtAmount: 100},
+		{UserToken: "b", Symbol: "XLM/USDC", Side: "long", EntryPrice: 0.1, Leverage: 2, CollateralAmount: 25, DebtAmount: 50},
+		{UserToken: "c", Symbol: "XLM/USDC", Side: "short", EntryPrice: 0.1, Leverage: 3, CollateralAmount: 10, DebtAmount: 30},
+		{UserToken: "a", Symbol: "BTC/USDC", Side: "short", EntryPrice: 60000, Leverage: 4, CollateralAmount: 10},
+	} {
+		if err := le.AddPosition(&p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := le.OpenInterest()
+	want := map[string]OpenInterest{
+		"XLM/USDC": {Long: 150, Short: 30, LongCount: 2, ShortCount: 1},
+		"BTC/USDC": {Short: 40, ShortCount: 1}, // no DebtAmount: collateral × leverage
+	}
+	if len(got) != len(want) {
+		t.Fatalf("OpenInterest = %+v, want %+v", got, want)
+	}
+	for sym, w := range want {
+		if got[sym] != w {
+			t.Errorf("%s: %+v, want %+v", sym, got[sym], w)
+		}
+	}
+
+	le.RemovePosition("a", "BTC/USDC")
+	if _, ok := le.OpenInterest()["BTC/USDC"]; ok {
+		t.Fatal("closed symbol still reported")
+	}
+}
+
+func TestGracePeriod(t *testing.T) {
+	setup := func(ticks int, d time.Duration) (*LiquidationEngine, *PriceSync, *fakeClock, *[]settleCall) {
+		ps := NewPriceSync()
+		ps.SetMarkPrice("XLM/USDC", 1.5, SourceMock) // past the 1.8 threshold
+		calls := new([]settleCall)
+		le := NewLiquidationEngine(ps, fakeSettle(calls, nil))
+		clk := newFakeClock()
+		le.clock = clk
+		le.SetGracePeriod(ticks, d)
+		le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80})
+		return le, ps, clk, calls
+	}
+	ctx := context.Background()
+
+	t.Run("default liquidates on first breach", func(t *testing.T) {
+		le, _, _, calls := setup(0, 0)
+		le.checkAll(ctx)
+		if len(*calls) != 1 {
+			t.Fatalf("settle calls = %d, want 1", len(*calls))
+		}
+	})
+
+	t.Run("waits for consecutive ticks and resets on recovery", func(t *testing.T) {
+		le, ps, _, calls := setup(3, 0)
+		le.checkAll(ctx)
+		le.checkAll(ctx)
+		ps.SetMarkPrice("XLM/USDC", 2.0, SourceMock) // spike over
+		le.checkAll(ctx)
+		ps.SetMarkPrice("XLM/USDC", 1.5, SourceMock)
+		le.checkAll(ctx)
+		le.checkAll(ctx)
+		if len(*calls) != 0 {
+			t.Fatalf("liquidated after a broken run of breaches: %+v", *calls)
+		}
+		le.checkAll(ctx)
+		if len(*calls) != 1 || le.GetPosition("tok", "XLM/USDC") != nil {
+			t.Fatalf("settle calls = %d after three breaches in a row, want 1", len(*calls))
+		}
+	})
+
+	t.Run("minimum duration", func(t *testing.T) {
+		le, _, clk, calls := setup(1, 10*time.Second)
+		le.checkAll(ctx)
+		clk.Advance(5 * time.Second)
+		le.checkAll(ctx)
+		if len(*calls) != 0 {
+			t.Fatal("liquidated 5s into a 10s grace period")
+		}
+		clk.Advance(5 * time.Second)
+		le.checkAll(ctx)
+		if len(*calls) != 1 {
+			t.Fatalf("settle calls = %d after 10s past the threshold, want 1", len(*calls))
+		}
+	})
+}
+
+func TestApplyFill(t *testing.T) {
+	newEngine := func(t *testing.T) *LiquidationEngine {
+		t.Helper()
+		le := NewLiquidationEngine(NewPriceSync(), nil)
+		// Long 100 @ 2 at 5x: notional 200, collateral 40.
+		if _, err := le.ApplyFill("tok", "XLM/USDC", "long", 2, 100, 5); err != nil {
+			t.Fatal(err)
+		}
+		return le
+	}
+	check := func(t *testing.T, p *OpenPosition, side string, size, entry, notional, collateral float64) {
+		t.Helper()
+		if p == nil {
+			t.Fatal("position closed")
+		}
+		if p.Side != side || p.Size() != size || p.EntryPrice != entry || p.DebtAmount != notional || p.CollateralAmount != collateral {
+			t.Fatalf("position = %s %v @ %v (notional %v, collateral %v), want %s %v @ %v (%v, %v)",
+				p.Side, p.Size(), p.EntryPrice, p.DebtAmount, p.CollateralAmount, side, size, entry, notional, collateral)
+		}
+	}
+
+	t.Run("add averages entry", func(t *testing.T) {
+		le := newEngine(t)
+		p, err := le.ApplyFill("tok", "XLM/USDC", "long", 3, 50, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// (100×2 + 50×3) / 150
+		check(t, p, "long", 150, 350.0/150, 350, 70)
+	})
+
+	t.Run("add at another leverage blends it", func(t *testing.T) {
+		le := newEngine(t)
+		// Adds notional 150 with collateral 15: 350 / 55 ≈ 6.4x.
+		p, err := le.ApplyFill("tok", "XLM/USDC", "long", 3, 50, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Leverage != 6 {
+			t.Errorf("leverage = %d, want 6", p.Leverage)
+		}
+	})
+
+	t.Run("reduce keeps entry", func(t *testing.T) {
+		le := newEngine(t)
+		p, _ := le.ApplyFill("tok", "XLM/USDC", "short", 2.5, 40, 5)
+		check(t, p, "long", 60, 2, 120, 24)
+	})
+
+	t.Run("exact close removes it", func(t *testing.T) {
+		le := newEngine(t)
+		if p, _ := le.ApplyFill("tok", "XLM/USDC", "short", 2.5, 100, 5); p != nil || le.GetPosition("tok", "XLM/USDC") != nil {
+			t.Fatalf("position left after closing fill: %+v", p)
+		}
+	})
+
+	t.Run("flip opens remainder at fill price", func(t *testing.T) {
+		le := newEngine(t)
+		p, _ := le.ApplyFill("tok", "XLM/USDC", "short", 1.5, 130, 3)
+		check(t, p, "short", 30, 1.5, 45, 15)
+		check(t, le.GetPosition("tok", "XLM/USDC"), "short", 30, 1.5, 45, 15)
+	})
+}
+
+func TestPreviewFill(t *testing.T) {
+	le := NewLiquidationEngine(NewPriceSync(), nil)
+	if _, err := le.ApplyFill("tok", "XLM/USDC", "long", 2, 100, 5); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		side   string
+		price  float64
+		amount float64
+		want   FillPlan
+	}{
+		{"add", "long", 3, 50, FillPlan{Open: 50}},
+		{"reduce", "short", 2.5, 40, FillPlan{Reduce: 40, Realised: 20}},
+		{"close", "short", 1.5, 100, FillPlan{Reduce: 100, Close: true, Realised: -50}},
+		{"flip", "short", 2.5, 130, FillPlan{Reduce: 100, Close: true, Realised: 50, Open: 30}},
+	} {
+		if got := le.PreviewFill("tok", "XLM/USDC", tc.side, tc.price, tc.amount); got != tc.want {
+			t.Errorf("%s: plan = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+	if got := le.PreviewFill("other", "XLM/USDC", "short", 2, 10); got != (FillPlan{Open: 10}) {
+		t.Errorf("no position: plan = %+v, want an open", got)
+	}
+	if p := le.GetPosition("tok", "XLM/USDC"); p.Size() != 100 {
+		t.Errorf("PreviewFill changed the position: size %v", p.Size())
+	}
+}
+
+func TestLiquidationNotifiesOwner(t *testing.T) {
+	for _, settleErr := range []error{nil, errors.New("tx failed")} {
+		ps := NewPriceSync()
+		ps.SetMarkPrice("XLM/USDC", 1.5, SourceMock)
+		le := NewLiquidationEngine(ps, fakeSettle(new([]settleCall), settleErr))
+		var events []LiquidationEvent
+		le.notify = func(tok, eventType, _ string, data any) {
+			if tok != "tok" || eventType != "liquidation" {
+				t.Errorf("notify(%q, %q), want tok/liquidation", tok, eventType)
+			}
+			events = append(events, data.(LiquidationEvent))
+		}
+		le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80})
+
+		le.checkAll(context.Background())
+
+		want := "confirmed"
+		if settleErr != nil {
+			want = "failed"
+		}
+		if len(events) != 2 || events[0].Status != "attempted" || events[1].Status != want {
+			t.Fatalf("settle err %v: events = %+v, want attempted then %s", settleErr, events, want)
+		}
+		// Loss is 25% × 720 = 180, capped at the 80 collateral.
+		if ev := events[1]; ev.Seized != 80 || ev.MarkPrice != 1.5 || ev.EntryPrice != 2 {
+			t.Fatalf("event = %+v", ev)
+		}
+	}
+}
+
+func TestDetectOnly(t *testing.T) {
+	ps := NewPriceSync()
+	ps.SetMarkPrice("XLM/USDC", 1.5, SourceMock)
+	var calls []settleCall
+	le := NewLiquidationEngine(ps, fakeSettle(&calls, nil))
+	le.SetDetectOnly(true)
+	var events []LiquidationEvent
+	le.notify = func(_, _, _ string, data any) { events = append(events, data.(LiquidationEvent)) }
+	le.AddPosition(&OpenPosition{UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80})
+	ctx := context.Background()
+
+	le.checkAll(ctx)
+	le.checkAll(ctx)
+	if len(calls) != 0 || le.GetPosition("tok", "XLM/USDC") == nil {
+		t.Fatalf("detect-only settled %+v or dropped the position", calls)
+	}
+	if len(events) != 1 || events[0].Status != "detected" || events[0].Seized != 80 {
+		t.Fatalf("events = %+v, want one detected event for the breach", events)
+	}
+
+	ps.SetMarkPrice("XLM/USDC", 2, SourceMock)
+	le.checkAll(ctx)
+	ps.SetMarkPrice("XLM/USDC", 1.5, SourceMock)
+	le.checkAll(ctx)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want a second one for the new breach", len(events))
+	}
+}
+
+func TestCheckOnce(t *testing.T) {
+	ps := NewPriceSync()
+	ps.SetMarkPrice("XLM/USDC", 1.5, SourceMock)
+	ps.SetMarkPrice("BTC/USDC", 60000, SourceMock)
+	var calls []settleCall
+	le := NewLiquidationEngine(ps, fakeSettle(&calls, nil))
+	le.SetGracePeriod(2, 0)
+	for _, p := range []OpenPosition{
+		{UserToken: "b", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80},
+		{UserToken: "a", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80},
+		{UserToken: "a", Symbol: "BTC/USDC", Side: "long", EntryPrice: 60000, Leverage: 2, CollateralAmount: 80},
+	} {
+		le.AddPosition(&p)
+	}
+	ctx := context.Background()
+
+	if got := le.CheckOnce(ctx); len(got) != 0 {
+		t.Fatalf("first check liquidated %v inside the grace period", got)
+	}
+	got := le.CheckOnce(ctx)
+	if want := []string{"a:XLM/USDC", "b:XLM/USDC"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("CheckOnce = %v, want %v", got, want)
+	}
+	if len(calls) != 2 || le.GetPosition("a", "BTC/USDC") == nil {
+		t.Fatalf("settled %+v; the healthy BTC position must stay", calls)
+	}
+	if got := le.CheckOnce(ctx); len(got) != 0 {
+		t.Fatalf("third check liquidated %v again", got)
+	}
+}
@@ -1,7 +1,10 @@
 package matching
 
 import (
+	"container/heap"
+	"errors"
 	"fmt"
+	"math"
 	"sort"
 	"sync"
 	"time"
@@ -15,6 +18,15 @@ const (
 	Sell Side = "sell"
 )
 
+// stroopsPerUnit is Stellar's fixed 7-decimal precision: 1 unit = 10^7 stroops.
+const stroopsPerUnit = 1e7
+
+// roundStroops rounds v to the nearest stroop so float arithmetic in the
+// matching loop never leaves sub-stroop dust on a resting order.
+func roundStroops(v float64) float64 {
+	return math.Round(v*stroopsPerUnit) / stroopsPerUnit
+}
+
 // Order is a single resting limit order in the book.
 type Order struct {
 	ID        string
@@ -25,52 +37,386 @@ type Order struct {
 	Amount    float64 // base asset amount
 	Leverage  int     // 1 = spot, 2–20 = leveraged
 	EntryAt   time.Time
+
+	// ReduceOnly orders may only shrink the token's open position in Symbol;
+	// they are trimmed to the position size, counting fills already matched
+	// but not yet applied, when placed and again each time they fill, and
+	// never open a new one.
+	ReduceOnly bool
 }
 
 // MatchResult records a single fill between a resting and an aggressing order.
 type MatchResult struct {
-	BuyOrder  Order
-	SellOrder Order
-	FillPrice  float64
+	BuyOrder   Order
+	SellOrder  Order
+	FillPrice  float64 // per the book's FillPricePolicy; the maker's price by default
 	FillAmount float64
+	Aggressor  Side // side of the incoming (taker) order
+}
+
+// priceLevel is the FIFO queue of orders resting at a single price.
+// orders[0] has time priority at this price.
+type priceLevel struct {
+	price  float64
+	orders []Order
+	index  int // position in the owning bookSide heap
+}
+
+// bookSide is one side of the book: a heap of price levels with the best
+// price at the root, plus a price → level map. Inserting into an existing
+// level is O(1), creating a level is O(log L) in the number of distinct
+// prices, and best-of-book access is O(1).
+type bookSide struct {
+	levels  []*priceLevel
+	byPrice map[float64]*priceLevel
+	better  func(a, b float64) bool // reports whether price a has priority over b
+	count   int                     // total resting orders on this side
+}
+
+func newBookSide(better func(a, b float64) bool) *bookSide {
+	return &bookSide{byPrice: make(map[float64]*priceLevel), better: better}
+}
+
+// heap.Interface — ordered so levels[0] is always the best price.
+func (s *bookSide) Len() int           { return len(s.levels) }
+func (s *bookSide) Less(i, j int) bool { return s.better(s.levels[i].price, s.levels[j].price) }
+func (s *bookSide) Swap(i, j int) {
+	s.levels[i], s.levels[j] = s.levels[j], s.levels[i]
+	s.levels[i].index = i
+	s.levels[j].index = j
+}
+func (s *bookSide) Push(x any) {
+	lvl := x.(*priceLevel)
+	lvl.index = len(s.levels)
+	s.levels = append(s.levels, lvl)
+}
+func (s *bookSide) Pop() any {
+	n := len(s.levels)
+	lvl := s.levels[n-1]
+	s.levels[n-1] = nil
+	s.levels = s.levels[:n-1]
+	return lvl
+}
+
+// add appends o to the back of its price level's queue, creating the level
+// if needed, and returns that level.
+func (s *bookSide) add(o Order) *priceLevel {
+	lvl, ok := s.byPrice[o.Price]
+	if !ok {
+		lvl = &priceLevel{price: o.Price}
+		s.byPrice[o.Price] = lvl
+		heap.Push(s, lvl)
+	}
+	lvl.orders = append(lvl.orders, o)
+	s.count++
+	return lvl
+}
+
+// worst returns the lowest-priority price level, or nil if the side is empty.
+// It scans every level, so it is only used when a side is full.
+func (s *bookSide) worst() *priceLevel {
+	var w *priceLevel
+	for _, lvl := range s.levels {
+		if w == nil || s.better(w.price, lvl.price) {
+			w = lvl
+		}
+	}
+	return w
+}
+
+// best returns the highest-priority resting order, or nil if the side is empty.
+func (s *bookSide) best() *Order {
+	if len(s.levels) == 0 {
+		return nil
+	}
+	return &s.levels[0].orders[0]
+}
+
+// remove deletes the i-th order of lvl and drops the level once it is empty.
+func (s *bookSide) remove(lvl *priceLevel, i int) {
+	lvl.orders = removeAt(lvl.orders, i)
+	s.count--
+	if len(lvl.orders) == 0 {
+		heap.Remove(s, lvl.index)
+		delete(s.byPrice, lvl.price)
+	}
+}
+
+// sorted returns the price levels best-first.
+func (s *bookSide) sorted() []*priceLevel {
+	out := make([]*priceLevel, len(s.levels))
+	copy(out, s.levels)
+	sort.Slice(out, func(i, j int) bool { return s.better(out[i].price, out[j].price) })
+	return out
 }
 
-// OrderBook is a thread-safe, per-symbol central limit order book.
+// top returns up to depth orders best-first, preserving time priority within
+// each price level.
+func (s *bookSide) top(depth int) []Order {
+	out := make([]Order, 0, min(depth, s.count))
+	for _, lvl := range s.sorted() {
+		for _, o := range lvl.orders {
+			if len(out) >= depth {
+				return out
+			}
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// ErrBookFull is returned when an order would rest on a book side that
+// already holds its maximum number of orders.
+var ErrBookFull = errors.New("order book side is full")
+
+// DepthPolicy is what a full book side does with an order that would rest.
+type DepthPolicy string
+
+const (
+	// DepthReject refuses the order with ErrBookFull.
+	DepthReject DepthPolicy = "reject"
+	// DepthEvict accepts it if it is better priced than the side's worst
+	// order, which is removed (latest first within that price) to make room.
+	DepthEvict DepthPolicy = "evict"
+)
+
+// FillPricePolicy is the price a crossing order fills at.
+type FillPricePolicy string
+
+const (
+	// FillAtMaker fills at the resting order's price, so the aggressor gets
+	// any price improvement. The default.
+	FillAtMaker FillPricePolicy = "maker"
+	// FillAtAggressor fills at the incoming order's limit, so the maker gets
+	// the improvement.
+	FillAtAggressor FillPricePolicy = "aggressor"
+	// FillAtMid splits the improvement: the midpoint of the two limits,
+	// rounded to the stroop.
+	FillAtMid FillPricePolicy = "mid"
+)
+
+// price returns what an aggressor with limit fills at against a resting
+// order at maker. A limit of 0 (a market walk, see quote) has nothing to
+// improve on and always fills at maker.
+func (p FillPricePolicy) price(limit, maker float64) float64 {
+	if limit == 0 {
+		return maker
+	}
+	switch p {
+	case FillAtAggressor:
+		return limit
+	case FillAtMid:
+		return roundStroops((limit + maker) / 2)
+	}
+	return maker
+}
+
+// OrderBook is a thread-safe, per-symbol central limit order book with
+// price-time priority.
 type OrderBook struct {
 	mu     sync.Mutex
-	bids   []Order // sorted descending (highest bid first)
-	asks   []Order // sorted ascending  (lowest ask first)
+	bids   *bookSide              // highest bid first
+	asks   *bookSide              // lowest ask first
+	index  map[string]*priceLevel // order ID -> level it rests in
+	fates  *fateCache             // recently filled/cancelled order IDs
 	nextID uint64
+
+	// maxDepth caps resting orders per side (0 = unlimited); depthPolicy
+	// says what happens beyond it.
+	maxDepth    int
+	depthPolicy DepthPolicy
+
+	fillPrice FillPricePolicy // "" behaves as FillAtMaker
+
+	// positions backs reduce-only orders and hears of every fill; without
+	// it reduce-only orders trade like any other.
+	positions positionLedger
+
+	// resting counts each token's resting orders across every book that
+	// shares it and enforces the per-token limit; nil counts nothing.
+	resting *restingCounts
+
+	stats bookStats
+}
+
+// restingCounts is the per-token resting order count shared by an engine's
+// books. Books add to it as orders come to rest and take away as they leave,
+// so the limit is checked without walking every book.
+type restingCounts struct {
+	mu    sync.Mutex
+	limit int // 0 = unlimited
+	n     map[string]int
+}
+
+func newRestingCounts() *restingCounts {
+	return &restingCounts{n: make(map[string]int)}
+}
+
+// setLimit caps each token at n resting orders; 0 disables the limit.
+func (c *restingCounts) setLimit(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = n
+}
+
+// reserve counts one more order for userToken as it enters a book. A token
+// already at the limit gets ErrOrderLimit instead, unless wouldRest reports
+// that the order fills completely and so never really rests.
+func (c *restingCounts) reserve(userToken string, wouldRest func() bool) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := c.n[userToken]; c.limit > 0 && n >= c.limit && wouldRest() {
+		return fmt.Errorf("%w: token has %d resting orders (max %d)", ErrOrderLimit, n, c.limit)
+	}
+	c.n[userToken]++
+	return nil
+}
+
+// add adjusts userToken's count by delta, forgetting tokens that reach zero.
+func (c *restingCounts) add(userToken string, delta int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n[userToken] += delta
+	if c.n[userToken] <= 0 {
+		delete(c.n, userToken)
+	}
+}
+
+// count returns userToken's resting orders.
+func (c *restingCounts) count(userToken string) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n[userToken]
+}
+
+// positionLedger is the book's view of its traders' positions, including
+// fills that have matched but not yet been applied. The book calls it with
+// its lock held, at match time, so an order that rested while the position
+// shrank can't trade past it.
+type positionLedger interface {
+	// reducible is how much of o's owner's position o may still close: the
+	// net size when o trades against it, otherwise 0.
+	reducible(o Order) float64
+	// matched records a fill of amount for o's owner.
+	matched(o Order, amount float64)
 }
 
 // NewOrderBook creates an empty order book.
 func NewOrderBook() *OrderBook {
-	return &OrderBook{}
+	return &OrderBook{
+		bids:  newBookSide(func(a, b float64) bool { return a > b }),
+		asks:  newBookSide(func(a, b float64) bool { return a < b }),
+		index: make(map[string]*priceLevel),
+		fates: newFateCache(),
+	}
+}
+
+// SetMaxDepth caps each side at n resting orders (0 = unlimited), handling
+// orders beyond it according to policy.
+func (ob *OrderBook) SetMaxDepth(n int, policy DepthPolicy) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.maxDepth, ob.depthPolicy = n, policy
+}
+
+// SetFillPricePolicy sets the price crossing orders fill at.
+func (ob *OrderBook) SetFillPricePolicy(p FillPricePolicy) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.fillPrice = p
+}
+
+// Depth returns how many orders rest on each side.
+func (ob *OrderBook) Depth() (bids, asks int) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.bids.count, ob.asks.count
+}
+
+// side returns the book side that holds orders of the given direction.
+func (ob *OrderBook) side(s Side) *bookSide {
+	if s == Buy {
+		return ob.bids
+	}
+	return ob.asks
 }
 
 // AddOrder inserts an order and immediately attempts matching.
-// Returns any fills produced; unmatched remainder stays in the book.
+// Returns any fills produced; unmatched remainder stays in the book. An order
+// refused by a full book produces no fills.
 func (ob *OrderBook) AddOrder(o Order) []MatchResult {
+	_, fills, _, _, _ := ob.Submit(o)
+	return fills
+}
+
+// Submit is AddOrder that also returns the order as the book recorded it:
+// ID and EntryAt are assigned, and Amount is the unmatched remainder left
+// resting (0 when the order was fully filled). Orders pushed out of a full
+// side under DepthEvict are returned in evicted, and reduce-only orders
+// cancelled because their position was already closed or reversed in
+// voided. It fails with ErrOrderLimit when part of the order would rest and
+// its token already has the most resting orders allowed, and with
+// ErrBookFull,
+// leaving the book untouched, when the order would rest on a full side that
+// it cannot evict from.
+func (ob *OrderBook) Submit(o Order) (placed Order, fills []MatchResult, evicted, voided []Order, err error) {
 	ob.mu.Lock()
 	defer ob.mu.Unlock()
+	start := time.Now()
+	defer func() { ob.stats.observe(time.Since(start), err == nil, len(fills)) }()
+
+	o.Price = roundStroops(o.Price)
+	o.Amount = roundStroops(o.Amount)
+	own := ob.side(o.Side)
+	// Only an order that would leave something resting is held to the depth
+	// and per-token limits; the walk is done only when a limit is reached.
+	wouldRest := func() bool {
+		filled, _ := ob.simulateFill(o.Side, o.Price, o.Amount)
+		return filled < o.Amount
+	}
+	if ob.maxDepth > 0 && own.count >= ob.maxDepth && wouldRest() &&
+		(ob.depthPolicy != DepthEvict || !own.better(o.Price, own.worst().price)) {
+		return Order{}, nil, nil, nil, fmt.Errorf("%w: %d %s orders resting (max %d)",
+			ErrBookFull, own.count, o.Side, ob.maxDepth)
+	}
+	// The order is counted from the moment it enters the book; removeOrder
+	// takes it off again as it fills.
+	if err := ob.resting.reserve(o.UserToken, wouldRest); err != nil {
+		return Order{}, nil, nil, nil, err
+	}
 
 	ob.nextID++
 	o.ID = fmt.Sprintf("%d-%d", time.Now().UnixNano(), ob.nextID)
 	o.EntryAt = time.Now()
 
-	if o.Side == Buy {
-		ob.bids = append(ob.bids, o)
-		sort.Slice(ob.bids, func(i, j int) bool {
-			return ob.bids[i].Price > ob.bids[j].Price
-		})
-	} else {
-		ob.asks = append(ob.asks, o)
-		sort.Slice(ob.asks, func(i, j int) bool {
-			return ob.asks[i].Price < ob.asks[j].Price
-		})
+	ob.index[o.ID] = own.add(o)
+	fills, voided = ob.match(o.Side)
+	for ob.maxDepth > 0 && own.count > ob.maxDepth {
+		lvl := own.worst()
+		evicted = append(evicted, lvl.orders[len(lvl.orders)-1])
+		ob.removeOrder(lvl, len(lvl.orders)-1, StatusEvicted)
 	}
 
-	return ob.match()
+	placed = o
+	placed.Amount = 0
+	if lvl, ok := ob.index[o.ID]; ok {
+		for _, r := range lvl.orders {
+			if r.ID == o.ID {
+				placed.Amount = r.Amount
+				break
+			}
+		}
+	}
+	return placed, fills, evicted, voided, nil
 }
 
 // CancelOrder removes a resting order by ID. Returns true if found.
@@ -78,56 +424,197 @@ func (ob *OrderBook) CancelOrder(orderID string) bool {
 	ob.mu.Lock()
 	defer ob.mu.Unlock()
 
-	for i, o := range ob.bids {
-		if o.ID == orderID {
-			ob.bids = append(ob.bids[:i], ob.bids[i+1:]...)
-			return true
-		}
+	lvl, ok := ob.index[orderID]
+	if !ok {
+		return false
 	}
-	for i, o := range ob.asks {
+	for i, o := range lvl.orders {
 		if o.ID == orderID {
-			ob.asks = append(ob.asks[:i], ob.asks[i+1:]...)
+			ob.removeOrder(lvl, i, StatusCancelled)
 			return true
 		}
 	}
 	return false
 }
 
+// Clear removes every resting order, recording each as cancelled, and returns
+// them best-first per side, bids before asks.
+func (ob *OrderBook) Clear() []Order {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	removed := make([]Order, 0, ob.bids.count+ob.asks.count)
+	for _, side := range []*bookSide{ob.bids, ob.asks} {
+		for _, lvl := range side.sorted() {
+			for _, o := range lvl.orders {
+				ob.fates.record(o.ID, o.UserToken, StatusCancelled)
+				ob.resting.add(o.UserToken, -1)
+				removed = append(removed, o)
+			}
+		}
+	}
+	ob.bids = newBookSide(ob.bids.better)
+	ob.asks = newBookSide(ob.asks.better)
+	ob.index = make(map[string]*priceLevel)
+	return removed
+}
+
+// removeOrder drops lvl.orders[i] from its side and the ID index, recording
+// why it left so Status can still report it. Must be called with ob.mu held.
+func (ob *OrderBook) removeOrder(lvl *priceLevel, i int, why OrderStatus) {
+	o := lvl.orders[i]
+	delete(ob.index, o.ID)
+	ob.fates.record(o.ID, o.UserToken, why)
+	ob.resting.add(o.UserToken, -1)
+	ob.side(o.Side).remove(lvl, i)
+}
+
+// Status reports the state of an order owned by userToken and, while it is
+// resting, its remaining amount. Orders belonging to other tokens report
+// StatusUnknown.
+func (ob *OrderBook) Status(orderID, userToken string) (OrderStatus, float64) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if lvl, ok := ob.index[orderID]; ok {
+		for _, o := range lvl.orders {
+			if o.ID == orderID && o.UserToken == userToken {
+				return StatusResting, o.Amount
+			}
+		}
+		return StatusUnknown, 0
+	}
+	if f, ok := ob.fates.lookup(orderID); ok && f.userToken == userToken {
+		return f.status, 0
+	}
+	return StatusUnknown, 0
+}
+
+// removeAt deletes orders[i] in place, shifting the tail down and zeroing the
+// vacated last slot. Unlike reslicing with orders[1:], the slice keeps its
+// original backing array start, so capacity is reused instead of creeping
+// forward and forcing fresh allocations while the old head stays reachable.
+func removeAt(orders []Order, i int) []Order {
+	copy(orders[i:], orders[i+1:])
+	orders[len(orders)-1] = Order{}
+	return orders[:len(orders)-1]
+}
+
+// DefaultMaxSnapshotDepth is the deepest snapshot the API serves per side
+// unless BOOK_SNAPSHOT_MAX_DEPTH says otherwise.
+const DefaultMaxSnapshotDepth = 200
+
 // Snapshot returns a read-only copy of the top-N bids and asks.
 func (ob *OrderBook) Snapshot(depth int) (bids, asks []Order) {
 	ob.mu.Lock()
 	defer ob.mu.Unlock()
 
-	n := depth
-	if n > len(ob.bids) {
-		n = len(ob.bids)
+	return ob.bids.top(depth), ob.asks.top(depth)
+}
+
+// SimulateFill reports how much of an order on side at limit price would fill
+// immediately against the opposite side, and at what average price, without
+// changing the book.
+func (ob *OrderBook) SimulateFill(side Side, price, amount float64) (filled, avgPrice float64) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.simulateFill(side, price, amount)
+}
+
+// simulateFill is SimulateFill with ob.mu already held.
+func (ob *OrderBook) simulateFill(side Side, price, amount float64) (filled, avgPrice float64) {
+	fw := ob.walk(side, price, amount)
+	return fw.filled, fw.avgPrice()
+}
+
+// fillWalk is what an order would take from the book: the amount, its cost
+// in quote units, and the first and last price levels reached.
+type fillWalk struct {
+	filled, notional float64
+	best, worst      float64 // 0 when nothing fills
+}
+
+func (fw fillWalk) avgPrice() float64 {
+	if fw.filled <= 0 {
+		return 0
 	}
-	bids = make([]Order, n)
-	copy(bids, ob.bids[:n])
+	return roundStroops(fw.notional / fw.filled)
+}
 
-	n = depth
-	if n > len(ob.asks) {
-		n = len(ob.asks)
+// walk is the read-only form of match: it takes liquidity opposite side, best
+// level first and in time priority, until amount is filled or the next level
+// is beyond limit (no limit when limit is 0), pricing each take by the fill
+// price policy. Must be called with ob.mu held.
+func (ob *OrderBook) walk(side Side, limit, amount float64) fillWalk {
+	opp := ob.asks
+	crosses := func(p float64) bool { return limit == 0 || p <= limit }
+	if side == Sell {
+		opp = ob.bids
+		crosses = func(p float64) bool { return p >= limit }
 	}
-	asks = make([]Order, n)
-	copy(asks, ob.asks[:n])
-	return
+	var fw fillWalk
+	for _, lvl := range opp.sorted() {
+		if fw.filled >= amount || !crosses(lvl.price) {
+			break
+		}
+		if fw.best == 0 {
+			fw.best = lvl.price
+		}
+		fw.worst = lvl.price
+		for _, o := range lvl.orders {
+			take := min(o.Amount, amount-fw.filled)
+			fw.filled += take
+			fw.notional += take * ob.fillPrice.price(limit, lvl.price)
+			if fw.filled >= amount {
+				break
+			}
+		}
+	}
+	fw.filled = roundStroops(fw.filled)
+	fw.notional = roundStroops(fw.notional)
+	return fw
 }
 
-// match runs price-time priority matching. Must be called with ob.mu held.
-func (ob *OrderBook) match() []MatchResult {
-	var fills []MatchResult
+// quote walks the book for a market order of amount on side.
+func (ob *OrderBook) quote(side Side, amount float64) fillWalk {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.walk(side, 0, amount)
+}
 
-	for len(ob.bids) > 0 && len(ob.asks) > 0 {
-		best_bid := &ob.bids[0]
-		best_ask := &ob.asks[0]
+// match runs price-time priority matching after an order from the aggressor
+// side was added, returning the fills and the reduce-only orders it voided.
+// Must be called with ob.mu held.
+func (ob *OrderBook) match(aggressor Side) (fills []MatchResult, voided []Order) {
+	for {
+		best_bid := ob.bids.best()
+		best_ask := ob.asks.best()
+		if best_bid == nil || best_ask == nil {
+			break
+		}
 
 		if best_bid.Price < best_ask.Price {
 			break // no cross
 		}
 
-		// Fill at the resting order's price (maker price)
-		fillPrice := best_ask.Price
+		// A reduce-only order may have rested while its position shrank;
+		// trim it to what is left, or void it and look again.
+		if o, ok := ob.clampReduceOnly(ob.bids); ok {
+			voided = append(voided, o)
+			continue
+		}
+		if o, ok := ob.clampReduceOnly(ob.asks); ok {
+			voided = append(voided, o)
+			continue
+		}
+
+		// The incoming order is the best on its own side, since the book
+		// was not crossed before it arrived: an incoming buy lifts the ask,
+		// an incoming sell hits the bid.
+		fillPrice := ob.fillPrice.price(best_bid.Price, best_ask.Price)
+		if aggressor == Sell {
+			fillPrice = ob.fillPrice.price(best_ask.Price, best_bid.Price)
+		}
 		fillAmount := best_bid.Amount
 		if best_ask.Amount < fillAmount {
 			fillAmount = best_ask.Amount
@@ -138,18 +625,43 @@ func (ob *OrderBook) match() []MatchResult {
 			SellOrder:  *best_ask,
 			FillPrice:  fillPrice,
 			FillAmount: fillAmount,
+			Aggressor:  aggressor,
 		})
+		if ob.positions != nil {
+			ob.positions.matched(*best_bid, fillAmount)
+			ob.positions.matched(*best_ask, fillAmount)
+		}
 
-		best_bid.Amount -= fillAmount
-		best_ask.Amount -= fillAmount
+		// Round after every subtraction: a remainder below one stroop
+		// rounds to zero and the order is treated as fully filled.
+		best_bid.Amount = roundStroops(best_bid.Amount - fillAmount)
+		best_ask.Amount = roundStroops(best_ask.Amount - fillAmount)
 
 		if best_bid.Amount <= 0 {
-			ob.bids = ob.bids[1:]
+			ob.removeOrder(ob.bids.levels[0], 0, StatusFilled)
 		}
 		if best_ask.Amount <= 0 {
-			ob.asks = ob.asks[1:]
+			ob.removeOrder(ob.asks.levels[0], 0, StatusFilled)
 		}
 	}
 
-	return fills
+	return fills, voided
+}
+
+// clampReduceOnly trims the best order on side, if it is reduce-only, to
+// what its owner's position still allows. When that is nothing it removes
+// the order as cancelled and returns it with true. Must be called with
+// ob.mu held.
+func (ob *OrderBook) clampReduceOnly(side *bookSide) (Order, bool) {
+	o := side.best()
+	if ob.positions == nil || !o.ReduceOnly {
+		return Order{}, false
+	}
+	if allowed := roundStroops(ob.positions.reducible(*o)); allowed > 0 {
+		o.Amount = min(o.Amount, allowed)
+		return Order{}, false
+	}
+	voided := *o
+	ob.removeOrder(side.levels[0], 0, StatusCancelled)
+	return voided, true
 }
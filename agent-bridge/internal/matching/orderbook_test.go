@@ -0,0 +1,358 @@
+package matching
+
+import (
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+func TestPartialFillsLeaveNoDust(t *testing.T) {
+	ob := NewOrderBook()
+	ob.AddOrder(Order{UserToken: "maker", Side: Sell, Price: 0.1, Amount: 0.3})
+
+	// 0.3 - 0.1 - 0.1 - 0.1 is 2.7e-17 in float64, which used to leave a
+	// phantom ask resting in the book forever.
+	for i := 0; i < 3; i++ {
+		fills := ob.AddOrder(Order{UserToken: "taker", Side: Buy, Price: 0.1, Amount: 0.1})
+		if len(fills) != 1 || fills[0].FillAmount != 0.1 {
+			t.Fatalf("fill %d: got %+v, want one fill of 0.1", i, fills)
+		}
+	}
+
+	bids, asks := ob.Snapshot(10)
+	if len(bids) != 0 || len(asks) != 0 {
+		t.Fatalf("book not empty after exact fills: bids=%+v asks=%+v", bids, asks)
+	}
+}
+
+func TestAmountsRoundedToStroops(t *testing.T) {
+	ob := NewOrderBook()
+	ob.AddOrder(Order{UserToken: "maker", Side: Sell, Price: 0.123456789, Amount: 1.00000004})
+
+	_, asks := ob.Snapshot(1)
+	if len(asks) != 1 {
+		t.Fatalf("got %d asks, want 1", len(asks))
+	}
+	if asks[0].Price != 0.1234568 || asks[0].Amount != 1 {
+		t.Fatalf("got price=%v amount=%v, want 0.1234568 and 1", asks[0].Price, asks[0].Amount)
+	}
+}
+
+func TestSubStroopOrderRejected(t *testing.T) {
+	e := NewEngine("", "", []SymbolConfig{NewSymbolConfig("XLM/USDC")}, nil)
+	if _, err := e.PlaceOrder(Order{UserToken: "a", Symbol: "XLM/USDC", Side: Buy, Price: 0.1, Amount: 1e-9}); err == nil {
+		t.Fatal("expected sub-stroop amount to be rejected")
+	}
+}
+
+// churn keeps depth resting asks in the book and repeatedly adds one more ask
+// and a buy that consumes the best one, so the book size stays constant.
+func churn(ob *OrderBook, depth, n int) {
+	for i := 0; i < depth; i++ {
+		ob.AddOrder(Order{UserToken: "mm", Side: Sell, Price: 1 + float64(i)*0.001, Amount: 1})
+	}
+	for i := 0; i < n; i++ {
+		ob.AddOrder(Order{UserToken: "mm", Side: Sell, Price: 1 + float64(i%depth)*0.001, Amount: 1})
+		ob.AddOrder(Order{UserToken: "taker", Side: Buy, Price: 2, Amount: 1})
+	}
+}
+
+// queueCapacity sums the backing-array capacity of every price level on a side.
+func queueCapacity(s *bookSide) int {
+	n := cap(s.levels)
+	for _, lvl := range s.byPrice {
+		n += cap(lvl.orders)
+	}
+	return n
+}
+
+func TestChurnKeepsCapacityBounded(t *testing.T) {
+	const depth = 64
+	ob := NewOrderBook()
+	churn(ob, depth, 100_000)
+
+	if ob.asks.count != depth || ob.bids.count != 0 {
+		t.Fatalf("got %d asks / %d bids, want %d / 0", ob.asks.count, ob.bids.count, depth)
+	}
+	if c := queueCapacity(ob.asks); c > 4*depth {
+		t.Fatalf("ask capacity grew to %d for a %d-order book", c, depth)
+	}
+}
+
+func BenchmarkOrderBookChurn(b *testing.B) {
+	const depth = 64
+	ob := NewOrderBook()
+	b.ReportAllocs()
+	b.ResetTimer()
+	churn(ob, depth, b.N)
+	b.StopTimer()
+
+	if c := queueCapacity(ob.asks); c > 4*depth {
+		b.Fatalf("ask capacity grew to %d for a %d-order book", c, depth)
+	}
+}
+
+// BenchmarkAddOrderDeepBook measures inserting and then cancelling a
+// non-crossing order in a book that holds 10k resting orders per side; the
+// cancel keeps the book at that depth however large b.N gets.
+func BenchmarkAddOrderDeepBook(b *testing.B) {
+	const depth = 10_000
+	ob := NewOrderBook()
+	for i := 0; i < depth; i++ {
+		ob.AddOrder(Order{UserToken: "mm", Side: Buy, Price: 1 + float64(i)*0.0001, Amount: 1})
+		ob.AddOrder(Order{UserToken: "mm", Side: Sell, Price: 3 + float64(i)*0.0001, Amount: 1})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		placed, _, _, _, err := ob.Submit(Order{UserToken: "t", Side: Buy, Price: 1 + float64(i%depth)*0.0001, Amount: 1})
+		if err != nil || !ob.CancelOrder(placed.ID) {
+			b.Fatalf("order %d: submit err %v, or cancel missed %s", i, err, placed.ID)
+		}
+	}
+	b.StopTimer()
+	if bids, asks := ob.Depth(); bids != depth || asks != depth {
+		b.Fatalf("depth = %d/%d, want %d each", bids, asks, depth)
+	}
+}
+
+func TestSnapshotAndCancelAcrossLevels(t *testing.T) {
+	ob := NewOrderBook()
+	for _, p := range []float64{0.10, 0.12, 0.11, 0.12} {
+		ob.AddOrder(Order{UserToken: "b", Side: Buy, Price: p, Amount: 1})
+	}
+	for _, p := range []float64{0.15, 0.13, 0.14} {
+		ob.AddOrder(Order{UserToken: "s", Side: Sell, Price: p, Amount: 1})
+	}
+
+	bids, asks := ob.Snapshot(3)
+	wantBids := []float64{0.12, 0.12, 0.11}
+	wantAsks := []float64{0.13, 0.14, 0.15}
+	for i := range wantBids {
+		if bids[i].Price != wantBids[i] || asks[i].Price != wantAsks[i] {
+			t.Fatalf("snapshot level %d: bid=%v ask=%v, want %v / %v",
+				i, bids[i].Price, asks[i].Price, wantBids[i], wantAsks[i])
+		}
+	}
+
+	if !ob.CancelOrder(asks[0].ID) {
+		t.Fatal("cancel of best ask failed")
+	}
+	if ob.CancelOrder(asks[0].ID) {
+		t.Fatal("second cancel of the same order succeeded")
+	}
+	_, asks = ob.Snapshot(1)
+	if asks[0].Price != 0.14 {
+		t.Fatalf("best ask after cancel = %v, want 0.14", asks[0].Price)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	build := func(bids, asks []float64) *OrderBook {
+		ob := NewOrderBook()
+		for _, p := range bids {
+			ob.AddOrder(Order{UserToken: "b", Side: Buy, Price: p, Amount: 10})
+		}
+		for _, p := range asks {
+			ob.AddOrder(Order{UserToken: "s", Side: Sell, Price: p, Amount: 5})
+		}
+		return ob
+	}
+	ob := build([]float64{0.10, 0.11}, []float64{0.13, 0.12})
+
+	want := crc32.ChecksumIEEE([]byte("0.1200000:5.0000000:0.1300000:5.0000000:0.1100000:10.0000000:0.1000000:10.0000000"))
+	if got := ob.Checksum(2); got != want {
+		t.Fatalf("Checksum = %08x, want %08x", got, want)
+	}
+	bids, asks := ob.Snapshot(2)
+	if got := BookChecksum(bids, asks); got != want {
+		t.Errorf("BookChecksum of the snapshot = %08x, want %08x", got, want)
+	}
+	if got := build([]float64{0.11, 0.10}, []float64{0.12, 0.13}).Checksum(2); got != want {
+		t.Errorf("same book built in another order: %08x, want %08x", got, want)
+	}
+
+	// Anything within the depth changes it; anything beyond does not.
+	ob.AddOrder(Order{UserToken: "b", Side: Buy, Price: 0.05, Amount: 1})
+	if got := ob.Checksum(2); got != want {
+		t.Errorf("order below depth changed checksum to %08x", got)
+	}
+	ob.AddOrder(Order{UserToken: "b", Side: Buy, Price: 0.115, Amount: 1})
+	if got := ob.Checksum(2); got == want {
+		t.Error("new best bid left the checksum unchanged")
+	}
+	ob = build([]float64{0.10, 0.11}, []float64{0.12, 0.13})
+	ob.AddOrder(Order{UserToken: "t", Side: Buy, Price: 0.12, Amount: 1})
+	if got := ob.Checksum(2); got == want {
+		t.Error("partial fill of the best ask left the checksum unchanged")
+	}
+}
+
+func TestPriceTimePriorityAtEqualPrice(t *testing.T) {
+	makers := []string{"alice", "bob", "carol", "dave", "erin"}
+
+	tests := []struct {
+		name      string
+		makerSide Side
+		takerSide Side
+		takerPx   float64
+	}{
+		{"asks filled by buy", Sell, Buy, 0.2},
+		{"bids filled by sell", Buy, Sell, 0.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := NewOrderBook()
+			for _, m := range makers {
+				ob.AddOrder(Order{UserToken: m, Side: tt.makerSide, Price: 0.1, Amount: 1})
+			}
+
+			// Partially fill the head first, then sweep: the head must keep
+			// its priority after a partial fill.
+			fills := ob.AddOrder(Order{UserToken: "taker", Side: tt.takerSide, Price: tt.takerPx, Amount: 0.5})
+			fills = append(fills, ob.AddOrder(Order{UserToken: "taker", Side: tt.takerSide, Price: tt.takerPx, Amount: 4.5})...)
+
+			want := []string{"alice", "alice", "bob", "carol", "dave", "erin"}
+			if len(fills) != len(want) {
+				t.Fatalf("got %d fills, want %d", len(fills), len(want))
+			}
+			for i, f := range fills {
+				maker := f.SellOrder.UserToken
+				if tt.makerSide == Buy {
+					maker = f.BuyOrder.UserToken
+				}
+				if maker != want[i] {
+					t.Errorf("fill %d went to %s, want %s", i, maker, want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFillsAtMakerPriceForEitherAggressor(t *testing.T) {
+	t.Run("buy aggressor lifts asks", func(t *testing.T) {
+		ob := NewOrderBook()
+		ob.AddOrder(Order{UserToken: "m1", Side: Sell, Price: 0.10, Amount: 1})
+		ob.AddOrder(Order{UserToken: "m2", Side: Sell, Price: 0.11, Amount: 1})
+
+		fills := ob.AddOrder(Order{UserToken: "t", Side: Buy, Price: 0.12, Amount: 2})
+		assertFills(t, fills, Buy, []float64{0.10, 0.11})
+	})
+
+	t.Run("sell aggressor hits bids", func(t *testing.T) {
+		ob := NewOrderBook()
+		ob.AddOrder(Order{UserToken: "m1", Side: Buy, Price: 0.12, Amount: 1})
+		ob.AddOrder(Order{UserToken: "m2", Side: Buy, Price: 0.11, Amount: 1})
+
+		// The seller asked for 0.10 but gets price improvement at each bid.
+		fills := ob.AddOrder(Order{UserToken: "t", Side: Sell, Price: 0.10, Amount: 2})
+		assertFills(t, fills, Sell, []float64{0.12, 0.11})
+	})
+}
+
+func assertFills(t *testing.T, fills []MatchResult, aggressor Side, prices []float64) {
+	t.Helper()
+	if len(fills) != len(prices) {
+		t.Fatalf("got %d fills, want %d", len(fills), len(prices))
+	}
+	for i, f := range fills {
+		if f.FillPrice != prices[i] {
+			t.Errorf("fill %d price = %v, want %v", i, f.FillPrice, prices[i])
+		}
+		if f.Aggressor != aggressor {
+			t.Errorf("fill %d aggressor = %s, want %s", i, f.Aggressor, aggressor)
+		}
+	}
+}
+
+func TestFillPricePolicy(t *testing.T) {
+	tests := []struct {
+		policy   FillPricePolicy
+		buyFills []float64 // buy at 0.12 lifting asks at 0.10 and 0.11
+		sellFill []float64 // sell at 0.10 hitting bids at 0.12 and 0.11
+	}{
+		{FillAtMaker, []float64{0.10, 0.11}, []float64{0.12, 0.11}},
+		{FillAtAggressor, []float64{0.12, 0.12}, []float64{0.10, 0.10}},
+		{FillAtMid, []float64{0.11, 0.115}, []float64{0.11, 0.105}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetFillPricePolicy(tt.policy)
+			ob.AddOrder(Order{UserToken: "m1", Side: Sell, Price: 0.10, Amount: 1})
+			ob.AddOrder(Order{UserToken: "m2", Side: Sell, Price: 0.11, Amount: 1})
+			if _, avg := ob.SimulateFill(Buy, 0.12, 2); avg != roundStroops((tt.buyFills[0]+tt.buyFills[1])/2) {
+				t.Errorf("simulated buy avg = %v, want the average of %v", avg, tt.buyFills)
+			}
+			assertFills(t, ob.AddOrder(Order{UserToken: "t", Side: Buy, Price: 0.12, Amount: 2}), Buy, tt.buyFills)
+
+			ob = NewOrderBook()
+			ob.SetFillPricePolicy(tt.policy)
+			ob.AddOrder(Order{UserToken: "m1", Side: Buy, Price: 0.12, Amount: 1})
+			ob.AddOrder(Order{UserToken: "m2", Side: Buy, Price: 0.11, Amount: 1})
+			assertFills(t, ob.AddOrder(Order{UserToken: "t", Side: Sell, Price: 0.10, Amount: 2}), Sell, tt.sellFill)
+		})
+	}
+
+	// A market walk has no limit to improve on, so quotes stay at the maker.
+	ob := NewOrderBook()
+	ob.SetFillPricePolicy(FillAtAggressor)
+	ob.AddOrder(Order{UserToken: "m", Side: Sell, Price: 0.10, Amount: 1})
+	if fw := ob.quote(Buy, 1); fw.avgPrice() != 0.10 {
+		t.Errorf("market quote avg = %v, want 0.10", fw.avgPrice())
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	fill := func(policy DepthPolicy) (*OrderBook, []Order) {
+		ob := NewOrderBook()
+		ob.SetMaxDepth(3, policy)
+		var bids []Order
+		for _, p := range []float64{0.10, 0.09, 0.08} {
+			o, _, _, _, err := ob.Submit(Order{UserToken: "mm", Side: Buy, Price: p, Amount: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			bids = append(bids, o)
+		}
+		ob.AddOrder(Order{UserToken: "mm", Side: Sell, Price: 0.20, Amount: 1})
+		return ob, bids
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		ob, _ := fill(DepthReject)
+		if _, _, _, _, err := ob.Submit(Order{UserToken: "x", Side: Buy, Price: 0.11, Amount: 1}); !errors.Is(err, ErrBookFull) {
+			t.Fatalf("resting order on full side: err = %v, want ErrBookFull", err)
+		}
+		// An order that fills completely never rests, so it is accepted.
+		if _, fills, _, _, err := ob.Submit(Order{UserToken: "x", Side: Buy, Price: 0.20, Amount: 1}); err != nil || len(fills) != 1 {
+			t.Fatalf("crossing order: fills %d, err %v", len(fills), err)
+		}
+		if bids, asks := ob.Depth(); bids != 3 || asks != 0 {
+			t.Fatalf("depth = %d/%d, want 3/0", bids, asks)
+		}
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		ob, bids := fill(DepthEvict)
+		if _, _, _, _, err := ob.Submit(Order{UserToken: "x", Side: Buy, Price: 0.08, Amount: 1}); !errors.Is(err, ErrBookFull) {
+			t.Fatalf("order no better than the worst: err = %v, want ErrBookFull", err)
+		}
+		placed, _, evicted, _, err := ob.Submit(Order{UserToken: "x", Side: Buy, Price: 0.095, Amount: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(evicted) != 1 || evicted[0].ID != bids[2].ID {
+			t.Fatalf("evicted = %+v, want the worst bid", evicted)
+		}
+		if n, _ := ob.Depth(); n != 3 {
+			t.Fatalf("bid depth = %d, want 3", n)
+		}
+		if st, _ := ob.Status(bids[2].ID, "mm"); st != StatusEvicted {
+			t.Errorf("worst bid status = %s, want evicted", st)
+		}
+		if st, _ := ob.Status(placed.ID, "x"); st != StatusResting {
+			t.Errorf("new bid status = %s, want resting", st)
+		}
+	})
+}
@@ -4,71 +4,379 @@ package matching
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"math/rand"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// PriceSource identifies where a mark price came from.
+type PriceSource string
+
+const (
+	SourceMock      PriceSource = "mock"      // RunMockUpdater drift or startup seed
+	SourceWebhook   PriceSource = "webhook"   // POST /api/price/update
+	SourceOrderbook PriceSource = "orderbook" // derived from a Horizon order book
+)
+
+// PriceQuote is the current mark price for a symbol plus its provenance.
+type PriceQuote struct {
+	Price     float64     `json:"price"`
+	Source    PriceSource `json:"source"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+// PriceUpdate is one mark-price change delivered to a Subscribe channel.
+type PriceUpdate struct {
+	Symbol string `json:"symbol"`
+	PriceQuote
+}
+
+// priceSubscriberBuffer is how many updates a slow subscriber may lag before
+// further ones are dropped; a later update supersedes a dropped one anyway.
+const priceSubscriberBuffer = 16
+
 // PriceSync holds the current mark price for each trading symbol and simulates
 // a TradingView webhook by randomly drifting prices every second.
 type PriceSync struct {
 	mu     sync.RWMutex
-	prices map[string]float64 // symbol -> mark price
+	quotes map[string]PriceQuote // symbol -> latest quote
+	clock  clock
+
+	listeners []func(symbol string, price float64) // see OnUpdate
+
+	// bands keeps each symbol's mock drift inside [Min, Max]; ticks holds
+	// the engine's tick sizes the drifted price is rounded to.
+	bands map[string]PriceBand
+	ticks map[string]float64
+
+	// subscribers maps each Subscribe channel to its symbols (nil = all).
+	// Channels are only sent to under mu.RLock and closed under mu.Lock.
+	subscribers map[chan PriceUpdate]map[string]bool
+
+	// breaker guards SetMarkPrice against wild moves; tripped holds the
+	// symbols it has paused. See breaker.go.
+	breaker          PriceBreakerConfig
+	tripped          map[string]*breakerTrip
+	breakerListeners []func(BreakerEvent)
+
+	// mockPaused stops RunMockUpdater's drift; see SetMockPaused.
+	mockPaused atomic.Bool
+}
+
+// OnUpdate registers fn to be called, outside the lock, after every mark
+// price change from any source. Register before the feed starts.
+func (ps *PriceSync) OnUpdate(fn func(symbol string, price float64)) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.listeners = append(ps.listeners, fn)
+}
+
+// Subscribe returns a channel of mark-price changes for symbols (all symbols
+// when empty) and a func that unsubscribes and closes the channel. Unlike
+// OnUpdate it can be called at any time. Updates are dropped, not queued,
+// while the channel is full.
+func (ps *PriceSync) Subscribe(symbols []string) (<-chan PriceUpdate, func()) {
+	var want map[string]bool
+	if len(symbols) > 0 {
+		want = make(map[string]bool, len(symbols))
+		for _, s := range symbols {
+			want[s] = true
+		}
+	}
+	ch := make(chan PriceUpdate, priceSubscriberBuffer)
+	ps.mu.Lock()
+	if ps.subscribers == nil {
+		ps.subscribers = make(map[chan PriceUpdate]map[string]bool)
+	}
+	ps.subscribers[ch] = want
+	ps.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			ps.mu.Lock()
+			delete(ps.subscribers, ch)
+			close(ch)
+			ps.mu.Unlock()
+		})
+	}
+}
+
+// notify sends each changed symbol to its subscribers and calls the OnUpdate
+// listeners.
+func (ps *PriceSync) notify(changed map[string]float64) {
+	ps.mu.RLock()
+	listeners := ps.listeners
+	for sym := range changed {
+		u := PriceUpdate{Symbol: sym, PriceQuote: ps.quotes[sym]}
+		for ch, want := range ps.subscribers {
+			if want != nil && !want[sym] {
+				continue
+			}
+			select {
+			case ch <- u:
+			default:
+			}
+		}
+	}
+	ps.mu.RUnlock()
+	for sym, price := range changed {
+		for _, fn := range listeners {
+			fn(sym, price)
+		}
+	}
+}
+
+// PriceBand bounds where the mock feed may drift a symbol's price.
+type PriceBand struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
 }
 
-// NewPriceSync creates a PriceSync seeded with sane defaults.
+// DefaultBandFactor sets a seeded symbol's band when none is configured:
+// from seed/DefaultBandFactor to seed×DefaultBandFactor.
+const DefaultBandFactor = 2.0
+
+// DefaultPriceSeeds is the mock feed's starting point when no seeds are
+// configured: 0.10 USDC per XLM.
+var DefaultPriceSeeds = map[string]float64{"XLM/USDC": 0.10}
+
+// NewPriceSync creates a PriceSync seeded with DefaultPriceSeeds.
 func NewPriceSync() *PriceSync {
-	return &PriceSync{
-		prices: map[string]float64{
-			"XLM/USDC": 0.10, // seed: 0.10 USDC per XLM
-		},
+	ps := &PriceSync{
+		quotes:  make(map[string]PriceQuote),
+		clock:   realClock{},
+		tripped: make(map[string]*breakerTrip),
+	}
+	ps.Seed(DefaultPriceSeeds)
+	return ps
+}
+
+// Seed replaces the mock feed's symbols and starting prices. RunMockUpdater
+// drifts every seeded symbol until another source prices it. Call before the
+// feed starts.
+func (ps *PriceSync) Seed(seeds map[string]float64) {
+	now := ps.clock.Now()
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.quotes = make(map[string]PriceQuote, len(seeds))
+	ps.bands = make(map[string]PriceBand, len(seeds))
+	for sym, price := range seeds {
+		ps.quotes[sym] = PriceQuote{Price: price, Source: SourceMock, UpdatedAt: now}
+		ps.bands[sym] = PriceBand{Min: price / DefaultBandFactor, Max: price * DefaultBandFactor}
+	}
+}
+
+// SetBands overrides the drift band of the given symbols. Call after Seed,
+// which resets every band to the default, and before the feed starts.
+func (ps *PriceSync) SetBands(bands map[string]PriceBand) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for sym, b := range bands {
+		ps.bands[sym] = b
 	}
 }
 
+// SetTickSize makes the mock feed round symbol's drifted price to tick
+// rather than to the stroop. Call before the feed starts.
+func (ps *PriceSync) SetTickSize(symbol string, tick float64) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.ticks == nil {
+		ps.ticks = make(map[string]float64)
+	}
+	ps.ticks[symbol] = tick
+}
+
+// ParsePriceBands parses "XLM/USDC=0.05:0.20,XLM/EURC=0.04:0.18" into drift
+// bands. Symbols are normalised; bounds must satisfy 0 < min < max.
+func ParsePriceBands(raw string) (map[string]PriceBand, error) {
+	bands := make(map[string]PriceBand)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		symRaw, rangeRaw, ok := strings.Cut(item, "=")
+		minRaw, maxRaw, ok2 := strings.Cut(rangeRaw, ":")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("%q: want SYMBOL=MIN:MAX", item)
+		}
+		sym, err := NormalizeSymbol(symRaw)
+		if err != nil {
+			return nil, err
+		}
+		lo, err1 := strconv.ParseFloat(strings.TrimSpace(minRaw), 64)
+		hi, err2 := strconv.ParseFloat(strings.TrimSpace(maxRaw), 64)
+		if err1 != nil || err2 != nil || lo <= 0 || hi <= lo {
+			return nil, fmt.Errorf("%q: want 0 < MIN < MAX", item)
+		}
+		bands[sym] = PriceBand{Min: lo, Max: hi}
+	}
+	if len(bands) == 0 {
+		return nil, fmt.Errorf("no price bands in %q", raw)
+	}
+	return bands, nil
+}
+
+// ParsePriceSeeds parses "XLM/USDC=0.10,XLM/EURC=0.092" into a seed map.
+// Symbols are normalised; prices must be positive.
+func ParsePriceSeeds(raw string) (map[string]float64, error) {
+	seeds := make(map[string]float64)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		symRaw, priceRaw, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: want SYMBOL=PRICE", item)
+		}
+		sym, err := NormalizeSymbol(symRaw)
+		if err != nil {
+			return nil, err
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(priceRaw), 64)
+		if err != nil || price <= 0 {
+			return nil, fmt.Errorf("%q: price must be a positive number", item)
+		}
+		seeds[sym] = price
+	}
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("no price seeds in %q", raw)
+	}
+	return seeds, nil
+}
+
 // GetMarkPrice returns the current mark price for a symbol (0 if unknown).
 func (ps *PriceSync) GetMarkPrice(symbol string) float64 {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
-	return ps.prices[symbol]
+	return ps.quotes[symbol].Price
 }
 
 // SetMarkPrice is called by an external price feed (e.g. a TradingView webhook
 // forwarded to POST /api/price/update) to push a new authoritative mark price.
-func (ps *PriceSync) SetMarkPrice(symbol string, price float64) {
+// source is recorded so operators can see which feed last moved the price.
+// It returns the price applied, which the circuit breaker may have clamped,
+// or ErrPriceRejected when the breaker discarded it.
+func (ps *PriceSync) SetMarkPrice(symbol string, price float64, source PriceSource) (float64, error) {
+	now := ps.clock.Now()
 	ps.mu.Lock()
-	defer ps.mu.Unlock()
-	ps.prices[symbol] = price
+	applied, ok, ev := ps.checkBreaker(symbol, price, now)
+	if ok {
+		ps.quotes[symbol] = PriceQuote{Price: applied, Source: source, UpdatedAt: now}
+	}
+	listeners := ps.breakerListeners
+	ps.mu.Unlock()
+	if ev != nil {
+		ps.emitBreaker(listeners, *ev)
+	}
+	if !ok {
+		return applied, fmt.Errorf("%w: %s %.7g vs last %.7g", ErrPriceRejected, symbol, price, applied)
+	}
+	ps.notify(map[string]float64{symbol: applied})
+	return applied, nil
 }
 
 // AllPrices returns a snapshot copy of all mark prices.
 func (ps *PriceSync) AllPrices() map[string]float64 {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
-	out := make(map[string]float64, len(ps.prices))
-	for k, v := range ps.prices {
-		out[k] = v
+	out := make(map[string]float64, len(ps.quotes))
+	for k, q := range ps.quotes {
+		out[k] = q.Price
+	}
+	return out
+}
+
+// Status returns a snapshot copy of every symbol's quote, including the
+// source and time of the last update.
+func (ps *PriceSync) Status() map[string]PriceQuote {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	out := make(map[string]PriceQuote, len(ps.quotes))
+	for k, q := range ps.quotes {
+		out[k] = q
 	}
 	return out
 }
 
 // RunMockUpdater simulates a live TradingView price feed by randomly drifting
-// each symbol's price ±0.5% every second until ctx is cancelled.
+// each mock-fed symbol's price ±0.5% every second until ctx is cancelled.
 // Replace or supplement this with a real webhook in production.
 func (ps *PriceSync) RunMockUpdater(ctx context.Context) {
-	ticker := time.NewTicker(time.Second)
+	ticker := ps.clock.NewTicker(time.Second)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			ps.mu.Lock()
-			for sym, price := range ps.prices {
-				// drift: uniform random in [-0.5%, +0.5%]
-				drift := (rand.Float64()*1.0 - 0.5) / 100.0
-				ps.prices[sym] = price * (1 + drift)
+		case now := <-ticker.C():
+			if ps.mockPaused.Load() {
+				continue
 			}
-			ps.mu.Unlock()
+			ps.notify(ps.drift(now))
+		}
+	}
+}
+
+// SetMockPaused stops (true) or restarts (false) RunMockUpdater's drift
+// without stopping its goroutine, so that while paused prices only move when
+// SetMarkPrice is called. It reports whether the state changed.
+func (ps *PriceSync) SetMockPaused(paused bool) bool {
+	return ps.mockPaused.Swap(paused) != paused
+}
+
+// MockPaused reports whether RunMockUpdater's drift is paused.
+func (ps *PriceSync) MockPaused() bool {
+	return ps.mockPaused.Load()
+}
+
+// drift moves every mock-fed symbol's price by a uniform random ±0.5%, kept
+// inside its band and on its tick, and returns the new prices. A symbol that
+// has been priced by a webhook, the admin API or an order book is left alone:
+// the drift would overwrite a real price and relabel it as mock.
+func (ps *PriceSync) drift(now time.Time) map[string]float64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	changed := make(map[string]float64, len(ps.quotes))
+	for sym, q := range ps.quotes {
+		if q.Source != SourceMock {
+			continue
 		}
+		d := (rand.Float64()*1.0 - 0.5) / 100.0
+		price := ps.constrain(sym, q.Price*(1+d))
+		ps.quotes[sym] = PriceQuote{Price: price, Source: SourceMock, UpdatedAt: now}
+		changed[sym] = price
+	}
+	return changed
+}
+
+// constrain clamps price to sym's band and rounds it to the symbol's tick
+// (the stroop by default), staying within the band after rounding. A symbol
+// with no band is only kept above zero. The caller holds ps.mu.
+func (ps *PriceSync) constrain(sym string, price float64) float64 {
+	tick := ps.ticks[sym]
+	if tick <= 0 {
+		tick = 1 / stroopsPerUnit
+	}
+	b, ok := ps.bands[sym]
+	if !ok {
+		b = PriceBand{Min: tick, Max: math.Inf(1)}
+	}
+	price = math.Min(math.Max(price, b.Min), b.Max)
+	steps := math.Round(price / tick)
+	if steps*tick < b.Min {
+		steps = math.Ceil(b.Min / tick)
+	}
+	if steps*tick > b.Max {
+		steps = math.Floor(b.Max / tick)
 	}
+	return roundStroops(max(steps, 1) * tick)
 }
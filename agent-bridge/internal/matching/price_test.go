@@ -0,0 +1,156 @@
+package matching
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParsePriceSeeds(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{"XLM/USDC=0.10", map[string]float64{"XLM/USDC": 0.10}, false},
+		{" xlm/usdc = 0.1 , XLM/EURC=0.092 ,", map[string]float64{"XLM/USDC": 0.1, "XLM/EURC": 0.092}, false},
+		{"XLM/USDC", nil, true},
+		{"XLM/USDC=0", nil, true},
+		{"XLM/USDC=abc", nil, true},
+		{"XLMUSDC=0.1", nil, true},
+		{",", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePriceSeeds(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.raw, got, tt.want)
+			continue
+		}
+		for sym, p := range tt.want {
+			if got[sym] != p {
+				t.Errorf("%q: %s = %g, want %g", tt.raw, sym, got[sym], p)
+			}
+		}
+	}
+}
+
+func TestSeedReplacesMockSymbols(t *testing.T) {
+	ps := NewPriceSync()
+	ps.Seed(map[string]float64{"XLM/EURC": 0.09, "BTC/USDC": 60000})
+	prices := ps.AllPrices()
+	if len(prices) != 2 || prices["XLM/EURC"] != 0.09 || prices["BTC/USDC"] != 60000 {
+		t.Errorf("AllPrices after Seed = %v", prices)
+	}
+}
+
+func TestSubscribeFiltersAndUnsubscribes(t *testing.T) {
+	ps := NewPriceSync()
+	xlm, stopXLM := ps.Subscribe([]string{"XLM/USDC"})
+	all, stopAll := ps.Subscribe(nil)
+	defer stopAll()
+
+	ps.SetMarkPrice("XLM/EURC", 0.09, SourceWebhook)
+	ps.SetMarkPrice("XLM/USDC", 0.11, SourceWebhook)
+
+	if u := <-xlm; u.Symbol != "XLM/USDC" || u.Price != 0.11 || u.Source != SourceWebhook {
+		t.Errorf("filtered subscriber got %+v, want XLM/USDC 0.11", u)
+	}
+	if len(xlm) != 0 {
+		t.Errorf("filtered subscriber has %d more updates, want none", len(xlm))
+	}
+	if len(all) != 2 {
+		t.Errorf("unfiltered subscriber has %d updates, want 2", len(all))
+	}
+
+	stopXLM()
+	stopXLM() // idempotent
+	if _, ok := <-xlm; ok {
+		t.Fatal("channel still open after unsubscribe")
+	}
+	ps.SetMarkPrice("XLM/USDC", 0.12, SourceWebhook) // must not send on the closed channel
+}
+
+func TestParsePriceBands(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    map[string]PriceBand
+		wantErr bool
+	}{
+		{"XLM/USDC=0.05:0.20", map[string]PriceBand{"XLM/USDC": {0.05, 0.20}}, false},
+		{" xlm-eurc = 0.04 : 0.18 ,", map[string]PriceBand{"XLM/EURC": {0.04, 0.18}}, false},
+		{"XLM/USDC=0.05", nil, true},
+		{"XLM/USDC=0.2:0.1", nil, true},
+		{"XLM/USDC=0:0.1", nil, true},
+		{",", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePriceBands(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.raw, got, tt.want)
+			continue
+		}
+		for sym, b := range tt.want {
+			if got[sym] != b {
+				t.Errorf("%q: %s = %+v, want %+v", tt.raw, sym, got[sym], b)
+			}
+		}
+	}
+}
+
+func TestLongDriftStaysInBandOnTick(t *testing.T) {
+	ps := NewPriceSync()
+	ps.Seed(map[string]float64{"XLM/USDC": 0.10, "BTC/USDC": 60000})
+	ps.SetBands(map[string]PriceBand{"XLM/USDC": {Min: 0.098, Max: 0.102}})
+	ps.SetTickSize("BTC/USDC", 0.5)
+
+	for i := 0; i < 100000; i++ {
+		prices := ps.drift(time.Time{})
+		if p := prices["XLM/USDC"]; p < 0.098 || p > 0.102 {
+			t.Fatalf("step %d: XLM/USDC = %g, outside [0.098, 0.102]", i, p)
+		}
+		btc := prices["BTC/USDC"]
+		if btc < 30000 || btc > 120000 {
+			t.Fatalf("step %d: BTC/USDC = %g, outside the default band", i, btc)
+		}
+		if math.Mod(btc, 0.5) != 0 {
+			t.Fatalf("step %d: BTC/USDC = %g, not on its 0.5 tick", i, btc)
+		}
+	}
+}
+
+func TestDriftLeavesFedPricesAlone(t *testing.T) {
+	ps := NewPriceSync()
+	ps.Seed(map[string]float64{"XLM/USDC": 0.10, "XLM/EURC": 0.09})
+	if _, err := ps.SetMarkPrice("XLM/EURC", 0.095, SourceWebhook); err != nil {
+		t.Fatal(err)
+	}
+	fed := ps.Status()["XLM/EURC"]
+
+	prices := ps.drift(time.Now())
+	if _, ok := prices["XLM/EURC"]; ok || len(prices) != 1 {
+		t.Fatalf("drift moved %v, want only XLM/USDC", prices)
+	}
+	if q := ps.Status()["XLM/EURC"]; q != fed {
+		t.Errorf("webhook quote = %+v, want it kept as %+v", q, fed)
+	}
+	if q := ps.Status()["XLM/USDC"]; q.Source != SourceMock {
+		t.Errorf("seeded quote source = %s, want mock", q.Source)
+	}
+}
+
+func TestConstrainKeepsPricePositive(t *testing.T) {
+	ps := NewPriceSync()
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if got := ps.constrain("UNBANDED/USDC", -1); got <= 0 {
+		t.Fatalf("constrain(-1) = %g, want a positive price", got)
+	}
+}
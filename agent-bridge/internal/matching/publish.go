@@ -0,0 +1,150 @@
+package matching
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// TradePublisher receives every fill the engine matches, for fan-out to an
+// external bus (analytics, trade history). The engine calls it from one
+// background goroutine in match order, never from the matching path; see
+// Engine.SetTradePublisher. Delivery is at most once: an error is logged and
+// the trade is not retried.
+type TradePublisher interface {
+	PublishTrade(ctx context.Context, m MatchResult, at time.Time) error
+}
+
+// NopPublisher discards every trade. It is the engine's default.
+type NopPublisher struct{}
+
+func (NopPublisher) PublishTrade(context.Context, MatchResult, time.Time) error { return nil }
+
+// TradeMessage is the public shape of a fill sent to an external bus. It
+// carries order IDs but not session tokens, which are bearer credentials.
+type TradeMessage struct {
+	Symbol      string    `json:"symbol"`
+	Price       float64   `json:"price"`
+	Amount      float64   `json:"amount"`
+	Aggressor   Side      `json:"aggressor"`
+	BuyOrderID  string    `json:"buyOrderId"`
+	SellOrderID string    `json:"sellOrderId"`
+	Time        time.Time `json:"timestamp"`
+}
+
+// NewTradeMessage converts a match made at at.
+func NewTradeMessage(m MatchResult, at time.Time) TradeMessage {
+	return TradeMessage{
+		Symbol:      m.BuyOrder.Symbol,
+		Price:       m.FillPrice,
+		Amount:      m.FillAmount,
+		Aggressor:   m.Aggressor,
+		BuyOrderID:  m.BuyOrder.ID,
+		SellOrderID: m.SellOrder.ID,
+		Time:        at,
+	}
+}
+
+// HTTPPublisher POSTs each trade to URL as a TradeMessage JSON body. Any
+// non-2xx response is an error.
+type HTTPPublisher struct {
+	URL    string
+	Client *http.Client // nil = a client with a 5 s timeout
+}
+
+var defaultPublishClient = &http.Client{Timeout: 5 * time.Second}
+
+func (p *HTTPPublisher) PublishTrade(ctx context.Context, m MatchResult, at time.Time) error {
+	body, err := json.Marshal(NewTradeMessage(m, at))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := p.Client
+	if client == nil {
+		client = defaultPublishClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("trade publish: %s returned %d", p.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// DefaultPublishBuffer is how many trades may wait for the publisher before
+// new ones are dropped.
+const DefaultPublishBuffer = 1024
+
+type queuedTrade struct {
+	match MatchResult
+	at    time.Time
+}
+
+// tradeQueue decouples the publisher from matching: PlaceOrder only ever
+// does a non-blocking send, and a full queue drops the trade.
+type tradeQueue struct {
+	pub     TradePublisher
+	ch      chan queuedTrade
+	dropped atomic.Uint64
+}
+
+// SetTradePublisher sends every fill to p, through a queue of buffer trades
+// (<= 0 = DefaultPublishBuffer) drained by Start. A nil or NopPublisher turns
+// publishing off. Call before Start.
+func (e *Engine) SetTradePublisher(p TradePublisher, buffer int) {
+	if buffer <= 0 {
+		buffer = DefaultPublishBuffer
+	}
+	var q *tradeQueue
+	if _, nop := p.(NopPublisher); p != nil && !nop {
+		q = &tradeQueue{pub: p, ch: make(chan queuedTrade, buffer)}
+	}
+	e.mu.Lock()
+	e.trades = q
+	e.mu.Unlock()
+}
+
+// enqueueTrade hands f to the publisher without waiting.
+func (e *Engine) enqueueTrade(f MatchResult, at time.Time) {
+	e.mu.Lock()
+	q := e.trades
+	e.mu.Unlock()
+	if q == nil {
+		return
+	}
+	select {
+	case q.ch <- queuedTrade{f, at}:
+	default:
+		if n := q.dropped.Add(1); n == 1 || n%1000 == 0 {
+			log.Printf("[engine] trade publisher queue full — %d trade(s) dropped so far", n)
+		}
+	}
+}
+
+// run publishes queued trades in order until ctx is cancelled.
+func (q *tradeQueue) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-q.ch:
+			if err := q.pub.PublishTrade(ctx, t.match, t.at); err != nil && ctx.Err() == nil {
+				log.Printf("[engine] publish %s trade %s/%s: %v",
+					t.match.BuyOrder.Symbol, t.match.BuyOrder.ID, t.match.SellOrder.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package matching
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type chanPublisher chan MatchResult
+
+func (c chanPublisher) PublishTrade(ctx context.Context, m MatchResult, _ time.Time) error {
+	select {
+	case c <- m:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func TestTradePublisher(t *testing.T) {
+	eng := NewEngine("", "", []SymbolConfig{NewSymbolConfig("XLM/USDC")}, nil)
+	got := make(chanPublisher)
+	eng.SetTradePublisher(got, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eng.Start(ctx)
+
+	eng.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Sell, Price: 0.10, Amount: 50})
+	res, err := eng.PlaceOrder(Order{UserToken: "taker", Symbol: "XLM/USDC", Side: Buy, Price: 0.10, Amount: 5})
+	if err != nil || len(res.Fills) != 1 {
+		t.Fatalf("PlaceOrder = %+v, %v; want one fill", res, err)
+	}
+	select {
+	case m := <-got:
+		if m.FillAmount != 5 || m.BuyOrder.ID != res.OrderID {
+			t.Fatalf("published %+v, want the 5 XLM fill", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fill never reached the publisher")
+	}
+
+	// Nobody reads got now: the publisher is stuck on the next trade, the
+	// queue holds two more, and the rest are dropped without blocking.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 6; i++ {
+			eng.PlaceOrder(Order{UserToken: "taker", Symbol: "XLM/USDC", Side: Buy, Price: 0.10, Amount: 1})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("PlaceOrder blocked on a stuck publisher")
+	}
+	if n := eng.Stats().TradesDropped; n < 3 {
+		t.Fatalf("TradesDropped = %d, want at least 3", n)
+	}
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	bodies := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		bodies <- string(raw)
+		if strings.Contains(string(raw), "nope") {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	p := &HTTPPublisher{URL: srv.URL}
+	m := MatchResult{
+		BuyOrder:   Order{ID: "b1", UserToken: "secret-buyer", Symbol: "XLM/USDC"},
+		SellOrder:  Order{ID: "s1", UserToken: "secret-seller", Symbol: "XLM/USDC"},
+		FillPrice:  0.1,
+		FillAmount: 5,
+		Aggressor:  Buy,
+	}
+	if err := p.PublishTrade(context.Background(), m, time.Unix(0, 0)); err != nil {
+		t.Fatalf("PublishTrade: %v", err)
+	}
+	if body := <-bodies; !strings.Contains(body, `"buyOrderId":"b1"`) || strings.Contains(body, "secret") {
+		t.Fatalf("body %s: want order IDs and no session tokens", body)
+	}
+
+	m.BuyOrder.ID = "nope"
+	if err := p.PublishTrade(context.Background(), m, time.Unix(0, 0)); err == nil {
+		t.Fatal("want an error for a 502")
+	}
+}
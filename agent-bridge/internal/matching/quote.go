@@ -0,0 +1,55 @@
+package matching
+
+import (
+	"fmt"
+	"math"
+)
+
+// Quote is what a market order of Amount would cost against the current book.
+// Nothing is placed.
+type Quote struct {
+	Symbol     string  `json:"symbol"`
+	Side       Side    `json:"side"`
+	Amount     float64 `json:"amount"`
+	Filled     float64 `json:"filled"`     // amount the book can absorb now
+	Unfillable float64 `json:"unfillable"` // amount − filled: beyond current depth
+	AvgPrice   float64 `json:"avgPrice"`   // weighted average over Filled (0 = none)
+	BestPrice  float64 `json:"bestPrice"`  // top of the opposite side
+	WorstPrice float64 `json:"worstPrice"` // deepest level reached
+	Cost       float64 `json:"cost"`       // quote units paid (buy) or received (sell) for Filled
+	Slippage   float64 `json:"slippage"`   // |avg − best| / best
+}
+
+// Quote walks symbol's book as a market order of amount on side would, best
+// level first, and reports the average and worst fill prices, the total cost
+// and what would be left unfilled.
+func (e *Engine) Quote(symbol string, side Side, amount float64) (Quote, error) {
+	if side != Buy && side != Sell {
+		return Quote{}, fmt.Errorf("invalid side %q", side)
+	}
+	if roundStroops(amount) <= 0 {
+		return Quote{}, fmt.Errorf("invalid amount: must be positive")
+	}
+	book, err := e.getBook(symbol)
+	if err != nil {
+		return Quote{}, err
+	}
+	sym, _ := NormalizeSymbol(symbol)
+
+	fw := book.quote(side, amount)
+	q := Quote{
+		Symbol:     sym,
+		Side:       side,
+		Amount:     roundStroops(amount),
+		Filled:     fw.filled,
+		Unfillable: roundStroops(amount - fw.filled),
+		AvgPrice:   fw.avgPrice(),
+		BestPrice:  fw.best,
+		WorstPrice: fw.worst,
+		Cost:       fw.notional,
+	}
+	if q.BestPrice > 0 {
+		q.Slippage = roundStroops(math.Abs(q.AvgPrice-q.BestPrice) / q.BestPrice)
+	}
+	return q, nil
+}
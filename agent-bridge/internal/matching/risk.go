@@ -0,0 +1,93 @@
+package matching
+
+import "fmt"
+
+// MaxLeverage is the highest leverage the engine will assess or accept, and
+// the cap of any symbol without its own (SymbolConfig.MaxLeverage).
+const MaxLeverage = 20
+
+// RiskReport is the outcome of a pre-trade risk check. Nothing is placed.
+type RiskReport struct {
+	Allowed bool     `json:"allowed"`
+	Reasons []string `json:"reasons,omitempty"` // why it was denied
+
+	Side              string  `json:"side"`              // "long" | "short"
+	EntryPrice        float64 `json:"entryPrice"`        // implied average entry
+	ImmediateFill     float64 `json:"immediateFill"`     // amount that would fill now
+	Notional          float64 `json:"notional"`          // entry × amount
+	Collateral        float64 `json:"collateral"`        // collateral assessed
+	MarkPrice         float64 `json:"markPrice"`         // current mark (0 = none)
+	LiquidationPrice  float64 `json:"liquidationPrice"`  // mark at which 90% of collateral is lost
+	MoveToLiquidation float64 `json:"moveToLiquidation"` // (liq − mark) / mark; signed
+}
+
+// RiskCheck assesses o as a leveraged position without placing it. The
+// implied entry is what o would pay against the current book, with any
+// unfilled remainder assumed to fill at its limit price. collateral defaults
+// to notional / leverage when 0. The report is denied when the leverage is
+// out of range or the current mark already breaches the liquidation
+// threshold, i.e. the position would be liquidated on the next check.
+func (e *Engine) RiskCheck(o Order, collateral float64) (RiskReport, error) {
+	if roundStroops(o.Amount) <= 0 || roundStroops(o.Price) <= 0 {
+		return RiskReport{}, fmt.Errorf("invalid order: amount and price are required")
+	}
+	if o.Side != Buy && o.Side != Sell {
+		return RiskReport{}, fmt.Errorf("invalid side %q", o.Side)
+	}
+	book, err := e.getBook(o.Symbol)
+	if err != nil {
+		return RiskReport{}, err
+	}
+	sym, _ := NormalizeSymbol(o.Symbol)
+	if o.Leverage < 1 {
+		o.Leverage = 1
+	}
+
+	filled, avg := book.SimulateFill(o.Side, o.Price, o.Amount)
+	entry := o.Price
+	if filled > 0 {
+		entry = roundStroops((avg*filled + o.Price*(o.Amount-filled)) / o.Amount)
+	}
+
+	pos := OpenPosition{
+		Symbol:     sym,
+		Side:       "long",
+		EntryPrice: entry,
+		Leverage:   o.Leverage,
+		DebtAmount: roundStroops(entry * o.Amount),
+	}
+	if o.Side == Sell {
+		pos.Side = "short"
+	}
+	pos.CollateralAmount = collateral
+	if collateral <= 0 {
+		pos.CollateralAmount = roundStroops(pos.DebtAmount / float64(o.Leverage))
+	}
+
+	r := RiskReport{
+		Side:             pos.Side,
+		EntryPrice:       entry,
+		ImmediateFill:    filled,
+		Notional:         pos.DebtAmount,
+		Collateral:       pos.CollateralAmount,
+		MarkPrice:        e.Prices.GetMarkPrice(sym),
+		LiquidationPrice: roundStroops(pos.LiquidationPrice()),
+	}
+
+	if limit := e.MaxLeverageFor(sym); o.Leverage > limit {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("leverage %dx exceeds the %dx maximum for %s", o.Leverage, limit, sym))
+	}
+	if r.MarkPrice <= 0 {
+		r.Reasons = append(r.Reasons, "no mark price for "+sym)
+	} else {
+		r.MoveToLiquidation = (r.LiquidationPrice - r.MarkPrice) / r.MarkPrice
+		loss := pos.unrealisedLoss(r.MarkPrice)
+		if loss >= liquidationThreshold*pos.CollateralAmount {
+			r.Reasons = append(r.Reasons, fmt.Sprintf(
+				"mark %.7g already past liquidation price %.7g: loss %.7g vs %.7g collateral",
+				r.MarkPrice, r.LiquidationPrice, loss, pos.CollateralAmount))
+		}
+	}
+	r.Allowed = len(r.Reasons) == 0
+	return r, nil
+}
@@ -0,0 +1,76 @@
+package matching
+
+import "testing"
+
+func TestRiskCheck(t *testing.T) {
+	e := newTestEngine() // mark 0.10
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Sell, Price: 0.10, Amount: 50})
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Sell, Price: 0.12, Amount: 50})
+
+	tests := []struct {
+		name    string
+		order   Order
+		entry   float64
+		liq     float64
+		allowed bool
+	}{
+		// Sweeps 50 @ 0.10 and 50 @ 0.12 for an entry of 0.11. At 5x the long
+		// liquidates at 0.11 × (1 − 0.9/5) = 0.0902, safely under the 0.10 mark.
+		{"5x long through the book", Order{Side: Buy, Price: 0.12, Amount: 100, Leverage: 5}, 0.11, 0.0902, true},
+		// At 10x it liquidates at 0.11 × 0.91 = 0.1001 — above the mark already.
+		{"10x long already breached", Order{Side: Buy, Price: 0.12, Amount: 100, Leverage: 10}, 0.11, 0.1001, false},
+		{"short resting at limit", Order{Side: Sell, Price: 0.2, Amount: 10, Leverage: 2}, 0.2, 0.29, true},
+		{"leverage over maximum", Order{Side: Sell, Price: 0.2, Amount: 10, Leverage: 25}, 0.2, 0.2072, false},
+	}
+	for _, tt := range tests {
+		tt.order.Symbol = "XLM/USDC"
+		r, err := e.RiskCheck(tt.order, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if r.EntryPrice != tt.entry || r.LiquidationPrice != tt.liq || r.Allowed != tt.allowed {
+			t.Errorf("%s: entry=%v liq=%v allowed=%v (%v), want %v %v %v",
+				tt.name, r.EntryPrice, r.LiquidationPrice, r.Allowed, r.Reasons, tt.entry, tt.liq, tt.allowed)
+		}
+	}
+
+	// Nothing was placed: the two asks are still there.
+	if _, asks, _ := e.BookSnapshot("XLM/USDC", 10); len(asks) != 2 {
+		t.Fatalf("risk check changed the book: %d asks", len(asks))
+	}
+}
+
+func TestQuote(t *testing.T) {
+	e := newTestEngine()
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Sell, Price: 0.10, Amount: 50})
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Sell, Price: 0.12, Amount: 50})
+	e.PlaceOrder(Order{UserToken: "mm", Symbol: "XLM/USDC", Side: Buy, Price: 0.09, Amount: 20})
+
+	tests := []struct {
+		name string
+		side Side
+		amt  float64
+		want Quote
+	}{
+		{"top level only", Buy, 40, Quote{Filled: 40, AvgPrice: 0.10, BestPrice: 0.10, WorstPrice: 0.10, Cost: 4}},
+		{"sweeps two levels", Buy, 100, Quote{Filled: 100, AvgPrice: 0.11, BestPrice: 0.10, WorstPrice: 0.12, Cost: 11, Slippage: 0.1}},
+		{"beyond depth", Sell, 30, Quote{Filled: 20, Unfillable: 10, AvgPrice: 0.09, BestPrice: 0.09, WorstPrice: 0.09, Cost: 1.8}},
+	}
+	for _, tt := range tests {
+		q, err := e.Quote("xlm/usdc", tt.side, tt.amt)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		tt.want.Symbol, tt.want.Side, tt.want.Amount = "XLM/USDC", tt.side, tt.amt
+		if q != tt.want {
+			t.Errorf("%s: quote = %+v, want %+v", tt.name, q, tt.want)
+		}
+	}
+
+	if _, asks, _ := e.BookSnapshot("XLM/USDC", 10); len(asks) != 2 {
+		t.Fatalf("quote changed the book: %d asks", len(asks))
+	}
+	if _, err := e.Quote("XLM/USDC", "hold", 1); err == nil {
+		t.Fatal("quote accepted an invalid side")
+	}
+}
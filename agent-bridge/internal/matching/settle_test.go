@@ -0,0 +1,152 @@
+package matching
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// settleServer is an in-process stand-in for the frontend settle endpoint.
+type settleServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	status int
+	posts  []settlePost
+}
+
+// settlePost is one request received by settleServer.
+type settlePost struct {
+	Auth      string
+	UserToken string  `json:"userToken"`
+	Symbol    string  `json:"symbol"`
+	PnL       float64 `json:"pnl"`
+}
+
+// newSettleServer starts a settle endpoint answering every POST with status.
+func newSettleServer(t *testing.T, status int) *settleServer {
+	t.Helper()
+	s := &settleServer{status: status}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p settlePost
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" ||
+			json.NewDecoder(r.Body).Decode(&p) != nil {
+			t.Errorf("malformed settle request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		p.Auth = r.Header.Get("Authorization")
+		s.mu.Lock()
+		s.posts = append(s.posts, p)
+		status := s.status
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *settleServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *settleServer) received() []settlePost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]settlePost{}, s.posts...)
+}
+
+// breachedEngine returns an engine settling to url with a 9x long XLM/USDC
+// position whose mark has fallen far enough to liquidate it.
+func breachedEngine(t *testing.T, url string) *Engine {
+	t.Helper()
+	e := NewEngine(url, "secret", []SymbolConfig{NewSymbolConfig("XLM/USDC")}, nil)
+	if err := e.Liquidation.AddPosition(&OpenPosition{
+		UserToken: "tok", Symbol: "XLM/USDC", Side: "long", EntryPrice: 2, Leverage: 9, CollateralAmount: 80,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	e.Prices.SetMarkPrice("XLM/USDC", 1.5, SourceMock)
+	return e
+}
+
+func TestLiquidationPostsSettlement(t *testing.T) {
+	srv := newSettleServer(t, http.StatusOK)
+	e := breachedEngine(t, srv.URL)
+
+	e.Liquidation.checkAll(context.Background())
+
+	posts := srv.received()
+	want := settlePost{Auth: "Bearer secret", UserToken: "tok", Symbol: "XLM/USDC", PnL: -80}
+	if len(posts) != 1 || posts[0] != want {
+		t.Fatalf("settle posts = %+v, want exactly [%+v]", posts, want)
+	}
+	if e.Liquidation.GetPosition("tok", "XLM/USDC") != nil {
+		t.Fatal("settled position still monitored")
+	}
+
+	e.Liquidation.checkAll(context.Background())
+	if n := len(srv.received()); n != 1 {
+		t.Fatalf("settle posts after a second check = %d, want 1", n)
+	}
+}
+
+func TestLiquidationKeepsPositionOnSettleError(t *testing.T) {
+	srv := newSettleServer(t, http.StatusInternalServerError)
+	e := breachedEngine(t, srv.URL)
+	e.Liquidation.SetMaxSettleAttempts(3)
+
+	err := e.submitSettle(context.Background(), "tok", "XLM/USDC", -80)
+	if err == nil {
+		t.Fatal("submitSettle succeeded against an HTTP 500")
+	}
+
+	e.Liquidation.checkAll(context.Background())
+
+	if n := len(srv.received()); n != 2 {
+		t.Fatalf("settle posts = %d, want 2", n)
+	}
+	if e.Liquidation.GetPosition("tok", "XLM/USDC") == nil {
+		t.Fatal("position dropped after a failed settle; want it kept for retry")
+	}
+
+	srv.setStatus(http.StatusOK)
+	e.Liquidation.checkAll(context.Background())
+	if e.Liquidation.GetPosition("tok", "XLM/USDC") != nil {
+		t.Fatal("position still monitored after the retry settled")
+	}
+}
+
+func TestPreviewSettle(t *testing.T) {
+	srv := newSettleServer(t, http.StatusOK)
+	e := breachedEngine(t, srv.URL)
+
+	p, err := e.PreviewSettle("tok", "XLM/USDC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p.Body) != `{"pnl":-80,"symbol":"XLM/USDC","userToken":"tok"}` || p.PnL != -80 || p.MarkPrice != 1.5 {
+		t.Fatalf("preview = %+v, body %s", p, p.Body)
+	}
+	if p.Method != http.MethodPost || p.URL != srv.URL || !p.InUse {
+		t.Fatalf("preview = %+v", p)
+	}
+	if p.Headers["Authorization"] != "Bearer [redacted]" || p.Headers["Content-Type"] != "application/json" {
+		t.Fatalf("headers = %v", p.Headers)
+	}
+	if n := len(srv.received()); n != 0 {
+		t.Fatalf("preview sent %d settle requests", n)
+	}
+
+	if _, err := e.PreviewSettle("other", "XLM/USDC"); !errors.Is(err, ErrNoPosition) {
+		t.Fatalf("unknown position err = %v", err)
+	}
+	e.SetSettleFunc(func(context.Context, string, string, float64) error { return nil })
+	if p, _ := e.PreviewSettle("tok", "XLM/USDC"); p.InUse {
+		t.Fatal("preview claims the HTTP path is in use after SetSettleFunc")
+	}
+}
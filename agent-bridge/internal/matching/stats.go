@@ -0,0 +1,115 @@
+package matching
+
+import (
+	"sort"
+	"time"
+)
+
+// bookStats counts what a book has processed. Guarded by OrderBook.mu.
+type bookStats struct {
+	orders   uint64        // Submit calls that entered the book
+	rejected uint64        // Submit calls refused with ErrBookFull
+	fills    uint64        // matches produced
+	lockTime time.Duration // total time Submit held the lock
+	maxLock  time.Duration // longest single Submit
+}
+
+// observe records one Submit that held the lock for d and produced fills
+// matches; accepted is false when the book refused the order.
+func (s *bookStats) observe(d time.Duration, accepted bool, fills int) {
+	s.lockTime += d
+	s.maxLock = max(s.maxLock, d)
+	if !accepted {
+		s.rejected++
+		return
+	}
+	s.orders++
+	s.fills += uint64(fills)
+}
+
+// BookStats is one symbol's line in EngineStats.
+type BookStats struct {
+	Symbol   string `json:"symbol"`
+	Bids     int    `json:"bids"` // resting orders
+	Asks     int    `json:"asks"`
+	Levels   int    `json:"levels"` // distinct resting prices, both sides
+	Orders   uint64 `json:"orders"` // accepted since start
+	Rejected uint64 `json:"rejected"`
+	Fills    uint64 `json:"fills"`
+	// AvgMatchMicros and MaxMatchMicros are the time each order spent
+	// under the book lock, matching included.
+	AvgMatchMicros float64 `json:"avgMatchMicros"`
+	MaxMatchMicros float64 `json:"maxMatchMicros"`
+}
+
+// EngineStats summarises every book that has seen an order.
+type EngineStats struct {
+	Books          []BookStats `json:"books"` // sorted by symbol
+	Orders         uint64      `json:"orders"`
+	Fills          uint64      `json:"fills"`
+	AvgMatchMicros float64     `json:"avgMatchMicros"`
+	MaxMatchMicros float64     `json:"maxMatchMicros"`
+	// TradesDropped counts fills the trade publisher's full queue refused.
+	TradesDropped uint64 `json:"tradesDropped"`
+}
+
+// Stats returns the book's size and what it has processed so far.
+func (ob *OrderBook) Stats() BookStats {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	st := ob.stats
+	out := BookStats{
+		Bids:           ob.bids.count,
+		Asks:           ob.asks.count,
+		Levels:         len(ob.bids.levels) + len(ob.asks.levels),
+		Orders:         st.orders,
+		Rejected:       st.rejected,
+		Fills:          st.fills,
+		MaxMatchMicros: micros(st.maxLock),
+	}
+	if n := st.orders + st.rejected; n > 0 {
+		out.AvgMatchMicros = micros(st.lockTime / time.Duration(n))
+	}
+	return out
+}
+
+// Stats reports per-symbol book sizes and matching throughput and latency,
+// for books created so far (a symbol appears once it has seen an order).
+func (e *Engine) Stats() EngineStats {
+	e.mu.Lock()
+	books := make(map[string]*OrderBook, len(e.books))
+	for sym, b := range e.books {
+		books[sym] = b
+	}
+	e.mu.Unlock()
+
+	out := EngineStats{Books: make([]BookStats, 0, len(books))}
+	var totalMicros float64
+	var calls uint64
+	for sym, b := range books {
+		st := b.Stats()
+		st.Symbol = sym
+		out.Books = append(out.Books, st)
+		out.Orders += st.Orders
+		out.Fills += st.Fills
+		out.MaxMatchMicros = max(out.MaxMatchMicros, st.MaxMatchMicros)
+		n := st.Orders + st.Rejected
+		totalMicros += st.AvgMatchMicros * float64(n)
+		calls += n
+	}
+	if calls > 0 {
+		out.AvgMatchMicros = totalMicros / float64(calls)
+	}
+	sort.Slice(out.Books, func(i, j int) bool { return out.Books[i].Symbol < out.Books[j].Symbol })
+	e.mu.Lock()
+	if e.trades != nil {
+		out.TradesDropped = e.trades.dropped.Load()
+	}
+	e.mu.Unlock()
+	return out
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
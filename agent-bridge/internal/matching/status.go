@@ -0,0 +1,67 @@
+package matching
+
+import "time"
+
+// OrderStatus is the lifecycle state reported for an order ID.
+type OrderStatus string
+
+const (
+	StatusResting   OrderStatus = "resting"   // in the book (possibly partially filled)
+	StatusFilled    OrderStatus = "filled"    // fully matched
+	StatusCancelled OrderStatus = "cancelled" // removed before filling
+	StatusEvicted   OrderStatus = "evicted"   // pushed out of a full book by a better-priced order
+	StatusUnknown   OrderStatus = "unknown"   // never seen, expired, or not the caller's
+)
+
+const (
+	// fateCacheSize caps how many terminal order states each book remembers.
+	fateCacheSize = 10_000
+	// fateTTL is how long a filled/cancelled state stays queryable.
+	fateTTL = 10 * time.Minute
+)
+
+// orderFate records how an order left the book.
+type orderFate struct {
+	userToken string
+	status    OrderStatus
+	at        time.Time
+}
+
+// fateCache is a bounded, expiring map of order ID → terminal state, so a
+// filled order can be told apart from one that never existed. It is not
+// thread-safe; the owning OrderBook's lock guards it.
+type fateCache struct {
+	entries map[string]orderFate
+	ring    []string // insertion order; the oldest ID is evicted when full
+	next    int
+}
+
+func newFateCache() *fateCache {
+	return &fateCache{
+		entries: make(map[string]orderFate),
+		ring:    make([]string, fateCacheSize),
+	}
+}
+
+// record stores the terminal state for id, evicting the oldest entry if full.
+func (c *fateCache) record(id, userToken string, status OrderStatus) {
+	if old := c.ring[c.next]; old != "" {
+		delete(c.entries, old)
+	}
+	c.ring[c.next] = id
+	c.next = (c.next + 1) % len(c.ring)
+	c.entries[id] = orderFate{userToken: userToken, status: status, at: time.Now()}
+}
+
+// lookup returns the recorded state for id, dropping it once expired.
+func (c *fateCache) lookup(id string) (orderFate, bool) {
+	f, ok := c.entries[id]
+	if !ok {
+		return orderFate{}, false
+	}
+	if time.Since(f.at) > fateTTL {
+		delete(c.entries, id)
+		return orderFate{}, false
+	}
+	return f, true
+}
@@ -0,0 +1,132 @@
+package matching
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SymbolConfig describes one tradable market on the engine.
+type SymbolConfig struct {
+	Symbol   string  // e.g. "XLM/USDC"
+	Base     string  // e.g. "XLM"
+	Counter  string  // e.g. "USDC"
+	TickSize float64 // minimum price increment; 0 = unrestricted
+	LotSize  float64 // minimum amount increment; 0 = unrestricted
+
+	// MinNotional is the smallest price × amount, in counter units, an order
+	// may have; 0 = unrestricted.
+	MinNotional float64
+
+	// MaxLeverage caps the leverage of orders on this symbol, e.g. lower for
+	// a volatile pair; 0 = the engine-wide MaxLeverage, which it never
+	// exceeds.
+	MaxLeverage int
+}
+
+// LeverageCap is the highest leverage an order on cfg's symbol may use.
+func (cfg SymbolConfig) LeverageCap() int {
+	if cfg.MaxLeverage > 0 && cfg.MaxLeverage < MaxLeverage {
+		return cfg.MaxLeverage
+	}
+	return MaxLeverage
+}
+
+// DefaultMinNotional is the minimum order value NewSymbolConfig applies:
+// one cent of the counter asset keeps dust out of the book and tape.
+const DefaultMinNotional = 0.01
+
+// NormalizeSymbol canonicalises a market symbol to upper-case "BASE/QUOTE" so
+// that "xlm/usdc", "XLM-USDC" and "XLM_USDC" all map to the same book.
+// Each side must be a 1–12 character alphanumeric Stellar asset code.
+func NormalizeSymbol(s string) (string, error) {
+	sym := strings.ToUpper(strings.TrimSpace(s))
+	sym = strings.NewReplacer("-", "/", "_", "/").Replace(sym)
+
+	base, quote, ok := strings.Cut(sym, "/")
+	if !ok || !validAssetCode(base) || !validAssetCode(quote) {
+		return "", fmt.Errorf("malformed symbol %q: expected BASE/QUOTE, e.g. XLM/USDC", s)
+	}
+	return base + "/" + quote, nil
+}
+
+// validAssetCode reports whether code looks like a Stellar asset code.
+func validAssetCode(code string) bool {
+	if len(code) == 0 || len(code) > 12 {
+		return false
+	}
+	for _, c := range code {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewSymbolConfig builds a config for a "BASE/COUNTER" symbol with no tick or
+// lot restrictions and DefaultMinNotional. The symbol is normalised when it is
+// well-formed.
+func NewSymbolConfig(symbol string) SymbolConfig {
+	if sym, err := NormalizeSymbol(symbol); err == nil {
+		symbol = sym
+	}
+	cfg := SymbolConfig{Symbol: symbol, MinNotional: DefaultMinNotional}
+	if base, counter, ok := strings.Cut(symbol, "/"); ok {
+		cfg.Base = base
+		cfg.Counter = counter
+	}
+	return cfg
+}
+
+// ParseLeverageCaps parses "BTC/USDC=10,XLM/USDC=5" into per-symbol leverage
+// caps. Symbols are normalised; each cap must be between 1 and MaxLeverage.
+func ParseLeverageCaps(raw string) (map[string]int, error) {
+	return parseSymbolValues(raw, "SYMBOL=LEVERAGE", func(v string) (int, error) {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLeverage {
+			return 0, fmt.Errorf("leverage must be a whole number from 1 to %d", MaxLeverage)
+		}
+		return n, nil
+	})
+}
+
+// ParseMinNotionals parses "XLM/USDC=5,BTC/USDC=10" into per-symbol minimum
+// order notionals, in counter units. Symbols are normalised; each minimum
+// must be a finite number ≥ 0, 0 lifting the minimum for that symbol.
+func ParseMinNotionals(raw string) (map[string]float64, error) {
+	return parseSymbolValues(raw, "SYMBOL=NOTIONAL", func(v string) (float64, error) {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, fmt.Errorf("minimum notional must be a number ≥ 0")
+		}
+		return f, nil
+	})
+}
+
+// parseSymbolValues parses comma-separated "SYMBOL=VALUE" items (":" works
+// as well as "=") into a map keyed by normalised symbol. parse converts and
+// checks each value; want names the item format in errors.
+func parseSymbolValues[V any](raw, want string, parse func(string) (V, error)) (map[string]V, error) {
+	out := make(map[string]V)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.IndexAny(item, "=:")
+		if i < 0 {
+			return nil, fmt.Errorf("%q: want %s", item, want)
+		}
+		sym, err := NormalizeSymbol(item[:i])
+		if err != nil {
+			return nil, err
+		}
+		v, err := parse(strings.TrimSpace(item[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", item, err)
+		}
+		out[sym] = v
+	}
+	return out, nil
+}
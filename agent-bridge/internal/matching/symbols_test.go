@@ -0,0 +1,59 @@
+package matching
+
+import "testing"
+
+func TestNormalizeSymbol(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "XLM/USDC", want: "XLM/USDC"},
+		{in: "xlm/usdc", want: "XLM/USDC"},
+		{in: "Xlm/Usdc", want: "XLM/USDC"},
+		{in: "XLM-USDC", want: "XLM/USDC"},
+		{in: "xlm_usdc", want: "XLM/USDC"},
+		{in: "  XLM/EURC ", want: "XLM/EURC"},
+		{in: "", wantErr: true},
+		{in: "XLMUSDC", wantErr: true},
+		{in: "XLM/", wantErr: true},
+		{in: "/USDC", wantErr: true},
+		{in: "XLM/USDC/EURC", wantErr: true},
+		{in: "XLM/US DC", wantErr: true},
+		{in: "XLM/ABCDEFGHIJKLM", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeSymbol(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NormalizeSymbol(%q) = %q, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NormalizeSymbol(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeSymbol(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSymbolVariantsShareOneBook(t *testing.T) {
+	e := NewEngine("", "", []SymbolConfig{NewSymbolConfig("xlm-usdc")}, nil)
+
+	if _, err := e.PlaceOrder(Order{UserToken: "a", Symbol: "xlm/usdc", Side: Sell, Price: 0.1, Amount: 10}); err != nil {
+		t.Fatalf("place sell: %v", err)
+	}
+	res, err := e.PlaceOrder(Order{UserToken: "b", Symbol: "XLM_USDC", Side: Buy, Price: 0.1, Amount: 10})
+	if err != nil {
+		t.Fatalf("place buy: %v", err)
+	}
+	if len(res.Fills) != 1 {
+		t.Fatalf("got %d fills, want 1 — variants landed in different books", len(res.Fills))
+	}
+	if got := e.ListSymbols(); len(got) != 1 || got[0] != "XLM/USDC" {
+		t.Fatalf("ListSymbols() = %v, want [XLM/USDC]", got)
+	}
+}
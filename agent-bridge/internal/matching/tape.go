@@ -0,0 +1,79 @@
+package matching
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTapeSize is the number of recent trades kept per symbol.
+const DefaultTapeSize = 500
+
+// Trade is one execution on the public trade tape.
+type Trade struct {
+	Symbol    string    `json:"symbol"`
+	Price     float64   `json:"price"`
+	Amount    float64   `json:"amount"`
+	Aggressor Side      `json:"aggressor"` // side of the taker order
+	Time      time.Time `json:"time"`
+}
+
+// TradeTape is a thread-safe, bounded per-symbol ring buffer of recent fills.
+// Memory per symbol is capped at the configured size.
+type TradeTape struct {
+	mu    sync.RWMutex
+	size  int
+	rings map[string]*tradeRing
+}
+
+// tradeRing is a fixed-size circular buffer; next is the slot to overwrite.
+type tradeRing struct {
+	buf  []Trade
+	next int
+	full bool
+}
+
+// NewTradeTape creates a tape keeping at most size trades per symbol.
+func NewTradeTape(size int) *TradeTape {
+	if size <= 0 {
+		size = DefaultTapeSize
+	}
+	return &TradeTape{size: size, rings: make(map[string]*tradeRing)}
+}
+
+// Record appends a trade, overwriting the oldest once the symbol's ring is full.
+func (t *TradeTape) Record(tr Trade) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.rings[tr.Symbol]
+	if !ok {
+		r = &tradeRing{buf: make([]Trade, t.size)}
+		t.rings[tr.Symbol] = r
+	}
+	r.buf[r.next] = tr
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Recent returns up to limit trades for symbol, newest first.
+func (t *TradeTape) Recent(symbol string, limit int) []Trade {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	r, ok := t.rings[symbol]
+	if !ok {
+		return []Trade{}
+	}
+	n := r.next
+	if r.full {
+		n = len(r.buf)
+	}
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	out := make([]Trade, 0, limit)
+	for i := 1; i <= limit; i++ {
+		out = append(out, r.buf[(r.next-i+len(r.buf))%len(r.buf)])
+	}
+	return out
+}
@@ -0,0 +1,28 @@
+package matching
+
+import "testing"
+
+func TestTradeTapeRingBuffer(t *testing.T) {
+	tape := NewTradeTape(3)
+	for i := 1; i <= 5; i++ {
+		tape.Record(Trade{Symbol: "XLM/USDC", Price: float64(i)})
+	}
+
+	got := tape.Recent("XLM/USDC", 10)
+	want := []float64{5, 4, 3}
+	if len(got) != len(want) {
+		t.Fatalf("got %d trades, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Price != want[i] {
+			t.Errorf("trade %d price = %v, want %v", i, got[i].Price, want[i])
+		}
+	}
+
+	if got := tape.Recent("XLM/USDC", 1); len(got) != 1 || got[0].Price != 5 {
+		t.Fatalf("Recent(limit=1) = %+v, want newest trade only", got)
+	}
+	if got := tape.Recent("XLM/EURC", 10); len(got) != 0 {
+		t.Fatalf("unknown symbol returned %d trades", len(got))
+	}
+}
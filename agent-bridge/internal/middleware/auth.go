@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"agent-bridge/internal/store"
+)
+
+type connKey struct{}
+
+// RequireToken rejects requests that do not carry a valid session token and
+// stashes the token's *store.Connection in the request context for handlers
+// to read via ConnectionFrom.
+//
+// The token is taken from the X-Agent-Token header, then the "token" query
+// param, then (for POST) the "token" field of a JSON body; the body is
+// restored afterwards so handlers can decode it as usual.
+//
+// If methods is non-empty, only requests with one of those methods are
+// checked and all others pass through untouched — used for routes such as
+// /api/orders whose GET is public but whose POST is not.
+func RequireToken(s *store.Store, next http.Handler, methods ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(methods) > 0 && !contains(methods, r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := extractToken(r)
+		conn := s.GetConnection(token)
+		if token == "" || conn == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			// Same shape as the handlers' JSON errors.
+			w.Write([]byte(`{"error":{"code":"unauthorized","message":"unauthorized"}}` + "\n"))
+			return
+		}
+		conn.Touch()
+
+		ctx := context.WithValue(r.Context(), connKey{}, conn)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ConnectionFrom returns the connection stored by RequireToken, or nil.
+func ConnectionFrom(ctx context.Context) *store.Connection {
+	conn, _ := ctx.Value(connKey{}).(*store.Connection)
+	return conn
+}
+
+// maxTokenPeek caps how much of a POST body extractToken buffers looking
+// for the token; it runs before authentication, on any client's request.
+const maxTokenPeek = 64 << 10
+
+// extractToken finds the session token in the header, query, or JSON body.
+// Only the first maxTokenPeek bytes of the body are searched; the handler
+// still reads all of it.
+func extractToken(r *http.Request) string {
+	if t := r.Header.Get("X-Agent-Token"); t != "" {
+		return t
+	}
+	if t := r.URL.Query().Get("token"); t != "" {
+		return t
+	}
+	if r.Method != http.MethodPost || r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxTokenPeek))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+	var req struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(body, &req)
+	return req.Token
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// countingReader records how many bytes have been read from it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestExtractTokenBoundsBodyPeek(t *testing.T) {
+	body := `{"token":"tok","pad":"` + strings.Repeat("x", 4*maxTokenPeek) + `"}`
+	src := &countingReader{r: strings.NewReader(body)}
+	r := httptest.NewRequest(http.MethodPost, "/api/orders", src)
+
+	if got := extractToken(r); got != "" {
+		t.Errorf("token = %q from a body past the peek limit, want none", got)
+	}
+	if src.n > maxTokenPeek {
+		t.Errorf("read %d bytes before authentication, want at most %d", src.n, maxTokenPeek)
+	}
+	rest, err := io.ReadAll(r.Body)
+	if err != nil || string(rest) != body {
+		t.Fatalf("handler saw %d of %d body bytes (%v)", len(rest), len(body), err)
+	}
+}
+
+func TestExtractTokenFromBody(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(`{"token":"tok","amount":1}`))
+	if got := extractToken(r); got != "tok" {
+		t.Errorf("token = %q, want tok", got)
+	}
+}
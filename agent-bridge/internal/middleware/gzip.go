@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// Gzip compresses responses for clients that send Accept-Encoding: gzip once
+// the body reaches minSize bytes; smaller bodies go out as-is. Event streams,
+// responses that already carry a Content-Encoding (e.g. proxied ones) and
+// responses the handler flushes before minSize is reached are never
+// compressed, so SSE stays flushable frame by frame.
+func Gzip(next http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, status: http.StatusOK}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding value allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether
+// to compress: at minSize bytes it switches to gzip, while an early Flush,
+// an event stream or an existing Content-Encoding sends it through plain.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status      int
+	wroteHeader bool // handler called WriteHeader
+	decided     bool // headers sent downstream, gz chosen or not
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader, g.status = true, code
+	// Bodiless statuses and streams are decided on the spot.
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified || !g.compressible() {
+		g.passThrough()
+	}
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.decided {
+		if !g.compressible() {
+			g.passThrough()
+		} else {
+			g.buf = append(g.buf, b...)
+			if len(g.buf) >= g.minSize {
+				g.startGzip()
+			}
+			return len(b), nil
+		}
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// Flush sends what is buffered. Flushing before a decision means the handler
+// is streaming, so the response stays uncompressed.
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		g.passThrough()
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// compressible reports whether the headers set so far allow compression.
+func (g *gzipResponseWriter) compressible() bool {
+	h := g.Header()
+	return h.Get("Content-Encoding") == "" &&
+		!strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
+func (g *gzipResponseWriter) startGzip() {
+	g.decided = true
+	h := g.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(g.buf))
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+	g.ResponseWriter.WriteHeader(g.status)
+	g.gz = gzipWriters.Get().(*gzip.Writer)
+	g.gz.Reset(g.ResponseWriter)
+	g.gz.Write(g.buf)
+	g.buf = nil
+}
+
+func (g *gzipResponseWriter) passThrough() {
+	g.decided = true
+	g.ResponseWriter.WriteHeader(g.status)
+	if len(g.buf) > 0 {
+		g.ResponseWriter.Write(g.buf)
+		g.buf = nil
+	}
+}
+
+// finish writes out a response that never reached minSize and closes the
+// gzip stream.
+func (g *gzipResponseWriter) finish() {
+	if !g.decided {
+		if !g.wroteHeader && len(g.buf) == 0 {
+			return // handler wrote nothing; let net/http send its default 200
+		}
+		g.passThrough()
+	}
+	if g.gz != nil {
+		g.gz.Close()
+		gzipWriters.Put(g.gz)
+		g.gz = nil
+	}
+}
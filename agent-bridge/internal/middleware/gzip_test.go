@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGzipCompressesLargeJSON(t *testing.T) {
+	big := `{"bids":[` + strings.Repeat(`{"price":0.1,"amount":100},`, 200) + `{}]}`
+	h := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("small") != "" {
+			w.Write([]byte(`{"ok":true}`))
+			return
+		}
+		w.Write([]byte(big))
+	}), 1024)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	get := func(path, accept string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Accept-Encoding", accept) // set explicitly: no transparent decoding
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get("/", "gzip, deflate")
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("large JSON not compressed: %v", resp.Header)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != big {
+		t.Fatal("decompressed body differs")
+	}
+
+	for _, tt := range []struct{ path, accept string }{
+		{"/?small=1", "gzip"}, // under the threshold
+		{"/", "identity"},     // client did not ask
+		{"/", "gzip;q=0, br"}, // client refused gzip
+	} {
+		resp := get(tt.path, tt.accept)
+		if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+			t.Errorf("%s with %q: Content-Encoding %q, want none", tt.path, tt.accept, ce)
+		}
+	}
+}
+
+func TestGzipLeavesEventStreamAlone(t *testing.T) {
+	frames := make(chan string)
+	h := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for f := range frames {
+			fmt.Fprintf(w, "data: %s\n\n", f)
+			w.(http.Flusher).Flush()
+		}
+	}), 16)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(frames) })
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	respCh := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			close(respCh)
+			return
+		}
+		respCh <- resp
+	}()
+
+	// Each frame, even one past the threshold, must arrive on its own.
+	frames <- strings.Repeat("x", 64)
+	resp := <-respCh
+	if resp == nil {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+		t.Fatalf("event stream compressed: Content-Encoding %q", ce)
+	}
+	r := bufio.NewReader(resp.Body)
+	read := make(chan string, 1)
+	go func() {
+		line, _ := r.ReadString('\n')
+		read <- line
+	}()
+	select {
+	case line := <-read:
+		if !strings.HasPrefix(line, "data: xxx") {
+			t.Fatalf("first frame = %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("frame was not flushed through")
+	}
+}
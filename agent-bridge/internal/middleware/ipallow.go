@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseCIDRs parses a comma-separated list of CIDRs ("10.0.0.0/8,::1/128");
+// a bare address is taken as a single host.
+func ParseCIDRs(raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("%q: not a CIDR or IP address", item)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q: not a CIDR or IP address", item)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// RequireIP refuses with 403 any request whose client address (see ClientIP)
+// is outside allowed. It runs before the handler, so a leaked admin secret is
+// useless from elsewhere. An empty allowed list lets everything through.
+func RequireIP(allowed []netip.Prefix, trustForwarded bool, next http.Handler) http.Handler {
+	if len(allowed) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr, ok := ClientIP(r, trustForwarded); ok {
+			for _, p := range allowed {
+				if p.Contains(addr) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":{"code":"forbidden","message":"source address not allowed"}}` + "\n"))
+	})
+}
+
+// ClientIP returns the address the request came from: the connection's peer,
+// or — when trustForwarded is set because the bridge sits behind a reverse
+// proxy — the last X-Forwarded-For hop, the one that proxy itself appended.
+// Earlier hops are client-supplied and never trusted.
+func ClientIP(r *http.Request, trustForwarded bool) (netip.Addr, bool) {
+	if trustForwarded {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			hops := strings.Split(xff[len(xff)-1], ",")
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[len(hops)-1]))
+			return addr.Unmap(), err == nil
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr.Unmap(), err == nil
+}
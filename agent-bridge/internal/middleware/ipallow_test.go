@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireIP(t *testing.T) {
+	allowed, err := ParseCIDRs("10.0.0.0/8, 192.168.1.7, ::1/128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name           string
+		remote         string
+		xff            string
+		trustForwarded bool
+		want           int
+	}{
+		{"in range", "10.1.2.3:5000", "", false, http.StatusOK},
+		{"single host", "192.168.1.7:5000", "", false, http.StatusOK},
+		{"ipv6 loopback", "[::1]:5000", "", false, http.StatusOK},
+		{"mapped ipv4", "[::ffff:10.0.0.1]:5000", "", false, http.StatusOK},
+		{"outside", "192.168.1.8:5000", "", false, http.StatusForbidden},
+		{"forwarded ignored when untrusted", "203.0.113.1:5000", "10.0.0.1", false, http.StatusForbidden},
+		{"last forwarded hop when trusted", "127.0.0.1:5000", "203.0.113.9, 10.0.0.1", true, http.StatusOK},
+		{"spoofed first hop when trusted", "127.0.0.1:5000", "10.0.0.1, 203.0.113.9", true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/positions", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rec := httptest.NewRecorder()
+			RequireIP(allowed, tt.trustForwarded, ok).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	// No allowlist: no restriction.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "198.51.100.1:1"
+	rec := httptest.NewRecorder()
+	RequireIP(nil, false, ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("empty allowlist: status %d, want 200", rec.Code)
+	}
+
+	if _, err := ParseCIDRs("10.0.0.0/33"); err == nil {
+		t.Error("ParseCIDRs accepted an invalid prefix")
+	}
+}
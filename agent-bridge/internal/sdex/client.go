@@ -19,6 +19,8 @@ import (
 	"strings"
 	"time"
 
+	"agent-bridge/internal/horizon"
+
 	"github.com/stellar/go-stellar-sdk/keypair"
 	"github.com/stellar/go-stellar-sdk/txnbuild"
 )
@@ -77,18 +79,21 @@ func (c *Client) GetMidPrice(ctx context.Context) (float64, error) {
 	}
 	defer resp.Body.Close()
 
-	var ob struct {
-		Asks []struct{ Price string `json:"price"` } `json:"asks"`
-		Bids []struct{ Price string `json:"price"` } `json:"bids"`
-	}
+	var ob horizon.OrderBook
 	if err = json.NewDecoder(resp.Body).Decode(&ob); err != nil {
 		return 0, fmt.Errorf("sdex: orderbook decode: %w", err)
 	}
 	if len(ob.Asks) == 0 || len(ob.Bids) == 0 {
 		return 0, fmt.Errorf("sdex: XLM/USDC book has no liquidity on testnet")
 	}
-	ask, _ := strconv.ParseFloat(ob.Asks[0].Price, 64)
-	bid, _ := strconv.ParseFloat(ob.Bids[0].Price, 64)
+	ask, _, err := ob.Asks[0].Parse()
+	if err != nil {
+		return 0, fmt.Errorf("sdex: best ask: %w", err)
+	}
+	bid, _, err := ob.Bids[0].Parse()
+	if err != nil {
+		return 0, fmt.Errorf("sdex: best bid: %w", err)
+	}
 	return (ask + bid) / 2.0, nil
 }
 
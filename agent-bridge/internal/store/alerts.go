@@ -0,0 +1,155 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAlertLimit is returned by AddAlert when a token already has
+// MaxAlertsPerToken alerts.
+var ErrAlertLimit = errors.New("price alert limit reached")
+
+// MaxAlertsPerToken caps how many price alerts one token may hold.
+const MaxAlertsPerToken = 50
+
+// PriceAlert fires an "alert" event to its token when a symbol's mark price
+// goes above or below Price. One-shot alerts are removed once they fire;
+// Repeat alerts re-arm when the price crosses back.
+type PriceAlert struct {
+	ID          string    `json:"id"`
+	Symbol      string    `json:"symbol"`
+	Condition   string    `json:"condition"` // "above" | "below"
+	Price       float64   `json:"price"`
+	Repeat      bool      `json:"repeat"`
+	Armed       bool      `json:"armed"`
+	CreatedAt   time.Time `json:"createdAt"`
+	TriggeredAt time.Time `json:"triggeredAt,omitzero"`
+}
+
+// met reports whether price satisfies the alert's condition.
+func (a *PriceAlert) met(price float64) bool {
+	if a.Condition == "above" {
+		return price >= a.Price
+	}
+	return price <= a.Price
+}
+
+// AddAlert stores a new armed alert for token and returns it with its ID.
+func (s *Store) AddAlert(token string, a PriceAlert) (PriceAlert, error) {
+	if a.Condition != "above" && a.Condition != "below" {
+		return PriceAlert{}, fmt.Errorf("condition must be \"above\" or \"below\", got %q", a.Condition)
+	}
+	if a.Price <= 0 {
+		return PriceAlert{}, errors.New("price must be positive")
+	}
+	s.mu.RLock()
+	conn, ok := s.connections[token]
+	s.mu.RUnlock()
+	if !ok {
+		return PriceAlert{}, ErrUnknownToken
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return PriceAlert{}, err
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.closed {
+		return PriceAlert{}, ErrUnknownToken
+	}
+	if len(conn.alerts) >= MaxAlertsPerToken {
+		return PriceAlert{}, ErrAlertLimit
+	}
+	a.ID = hex.EncodeToString(b)
+	a.Armed = true
+	a.CreatedAt = time.Now()
+	a.TriggeredAt = time.Time{}
+	conn.alerts = append(conn.alerts, &a)
+	return a, nil
+}
+
+// Alerts returns a copy of token's alerts, oldest first.
+func (s *Store) Alerts(token string) ([]PriceAlert, error) {
+	s.mu.RLock()
+	conn, ok := s.connections[token]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownToken
+	}
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	out := make([]PriceAlert, len(conn.alerts))
+	for i, a := range conn.alerts {
+		out[i] = *a
+	}
+	return out, nil
+}
+
+// RemoveAlert deletes one of token's alerts. It reports whether the alert
+// existed.
+func (s *Store) RemoveAlert(token, id string) (bool, error) {
+	s.mu.RLock()
+	conn, ok := s.connections[token]
+	s.mu.RUnlock()
+	if !ok {
+		return false, ErrUnknownToken
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	for i, a := range conn.alerts {
+		if a.ID == id {
+			conn.alerts = append(conn.alerts[:i], conn.alerts[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CheckAlerts evaluates every token's alerts on symbol against a new price
+// and publishes an "alert" event for each one that fires.
+func (s *Store) CheckAlerts(symbol string, price float64) {
+	s.mu.RLock()
+	conns := make([]*Connection, 0, len(s.connections))
+	for _, c := range s.connections {
+		conns = append(conns, c)
+	}
+	s.mu.RUnlock()
+
+	now := time.Now()
+	for _, conn := range conns {
+		var fired []PriceAlert
+		conn.mu.Lock()
+		kept := conn.alerts[:0]
+		for _, a := range conn.alerts {
+			switch {
+			case a.Symbol != symbol:
+			case a.Armed && a.met(price):
+				a.TriggeredAt = now
+				a.Armed = false
+				fired = append(fired, *a)
+				if !a.Repeat {
+					continue // one-shot: drop it
+				}
+			case !a.Armed && !a.met(price):
+				a.Armed = true // crossed back; repeat alerts re-arm
+			}
+			kept = append(kept, a)
+		}
+		clear(conn.alerts[len(kept):])
+		conn.alerts = kept
+		conn.mu.Unlock()
+
+		for _, a := range fired {
+			s.Publish(conn.Token, LogEntry{
+				Message:   fmt.Sprintf("%s is %s %g (mark %g)", a.Symbol, a.Condition, a.Price, price),
+				Source:    "alert",
+				EventType: "alert",
+				Data:      a,
+			})
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package store
+
+import "testing"
+
+func TestCheckAlerts(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+	ch, err := s.Subscribe(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	once, err := s.AddAlert(tok, PriceAlert{Symbol: "XLM/USDC", Condition: "above", Price: 0.12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddAlert(tok, PriceAlert{Symbol: "XLM/USDC", Condition: "below", Price: 0.09, Repeat: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddAlert(tok, PriceAlert{Symbol: "XLM/USDC", Condition: "sideways", Price: 1}); err == nil {
+		t.Error("AddAlert accepted a bad condition")
+	}
+
+	fired := func() (n int) {
+		for {
+			select {
+			case e := <-ch:
+				if e.EventType != "alert" {
+					t.Errorf("EventType = %q, want alert", e.EventType)
+				}
+				n++
+			default:
+				return n
+			}
+		}
+	}
+
+	steps := []struct {
+		symbol string
+		price  float64
+		want   int
+	}{
+		{"XLM/USDC", 0.10, 0},
+		{"XLM/EURC", 0.13, 0}, // other symbol
+		{"XLM/USDC", 0.13, 1}, // above fires and is removed
+		{"XLM/USDC", 0.14, 0},
+		{"XLM/USDC", 0.08, 1}, // below fires
+		{"XLM/USDC", 0.07, 0}, // still below: no repeat until it crosses back
+		{"XLM/USDC", 0.10, 0}, // re-arms
+		{"XLM/USDC", 0.08, 1},
+	}
+	for i, st := range steps {
+		s.CheckAlerts(st.symbol, st.price)
+		if got := fired(); got != st.want {
+			t.Errorf("step %d (%s @ %g): %d alerts, want %d", i, st.symbol, st.price, got, st.want)
+		}
+	}
+
+	alerts, _ := s.Alerts(tok)
+	if len(alerts) != 1 || alerts[0].ID == once.ID {
+		t.Errorf("one-shot alert not removed: %+v", alerts)
+	}
+	if ok, _ := s.RemoveAlert(tok, alerts[0].ID); !ok {
+		t.Error("RemoveAlert: want true")
+	}
+}
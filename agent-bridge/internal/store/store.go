@@ -1,23 +1,92 @@
 package store
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"agent-bridge/internal/db"
 )
 
-// LogEntry is what gets streamed to SSE subscribers.
-// EventType: "log" (default), "insight" (market signal), "context_update" (account activity).
+// ErrUnknownToken is returned when an operation references a token the store
+// does not know about.
+var ErrUnknownToken = errors.New("unknown token")
+
+// ErrSubscriberLimit is returned by Subscribe when a token already has the
+// maximum number of concurrent SSE subscribers.
+var ErrSubscriberLimit = errors.New("subscriber limit reached")
+
+// ErrWatcherLimit is returned by SetAccountWatch when the bridge already runs
+// the maximum number of account watchers.
+var ErrWatcherLimit = errors.New("account watcher limit reached — try again later")
+
+// LogEntry is what gets streamed to SSE subscribers. EventType is one of
+// "log" (the default), "insight" (a market signal), "context_update"
+// (account activity), "fill" (an engine match involving the token),
+// "order_cancelled" (an operator cleared the book under a resting order, a
+// better-priced one evicted it from a full book, or a reduce-only order
+// found its position gone), "liquidation" (a position force-closed),
+// "margin_warning" (a position nearing liquidation), "alert" (a price alert
+// set via /api/alerts fired), "stream_warning" (a price feed paused or
+// resumed by the circuit breaker, sent to every stream), "agent_request" or
+// "agent_response" (a proxied agent call and its status and latency). The
+// types in criticalEvents are never dropped for a slow subscriber;
+// everything else is best-effort.
 type LogEntry struct {
+	Seq       uint64 `json:"seq"` // per-token, increasing; see Since
 	Token     string `json:"token,omitempty"`
 	Message   string `json:"message"`
 	Source    string `json:"source"`
 	Timestamp string `json:"timestamp"`
 	EventType string `json:"event_type,omitempty"`
+	Data      any    `json:"data,omitempty"` // structured payload for typed events
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// logHistorySize is how many recent entries each token keeps for replay.
+const logHistorySize = 256
+
+// criticalEvents are the EventTypes a trader must see: Publish never drops
+// them for a slow subscriber; they queue until the reader catches up.
+var criticalEvents = map[string]bool{
+	"liquidation":    true,
+	"alert":          true,
+	"margin_warning": true,
+	"stream_warning": true,
+}
+
+// DeliveryPolicy is what Publish does when a subscriber's buffer is full.
+type DeliveryPolicy string
+
+const (
+	// DeliveryDrop skips routine entries for a full subscriber; fine for a
+	// UI that only cares about recent logs.
+	DeliveryDrop DeliveryPolicy = "drop"
+	// DeliveryBlock queues routine entries for a full subscriber for up to
+	// the store's block timeout, for consumers such as audit loggers that
+	// need every entry.
+	DeliveryBlock DeliveryPolicy = "block"
+)
+
+// DefaultInsightOverride is how many times larger than the last one sent an
+// insight must be to break through the insight cool-down.
+const DefaultInsightOverride = 2.0
+
+// DefaultBlockTimeout is how long an entry stays queued for a full
+// DeliveryBlock subscriber before it is dropped for it.
+const DefaultBlockTimeout = time.Second
+
+// Critical reports whether e is a high-priority event that is delivered even
+// to a slow subscriber.
+func (e LogEntry) Critical() bool {
+	return criticalEvents[e.EventType]
 }
 
 type TradeRecord struct {
@@ -38,49 +107,160 @@ type OfferRecord struct {
 	Price   string `json:"price"`
 }
 
+// BalanceRecord is one balance line of the paired account. Asset is "XLM"
+// for lumens and CODE:ISSUER otherwise; Balance is Horizon's decimal string.
+type BalanceRecord struct {
+	Asset   string `json:"asset"`
+	Balance string `json:"balance"`
+}
+
+// TrustlineRecord is one credit-asset trustline the paired account holds.
+type TrustlineRecord struct {
+	Code   string `json:"code"`
+	Issuer string `json:"issuer"`
+	Limit  string `json:"limit"`
+}
+
+// ViewChange is one entry of a token's view history: the pair and network
+// the user switched to, and when.
+type ViewChange struct {
+	Pair      string    `json:"pair"` // "" once the pair was cleared
+	Network   string    `json:"network"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// viewHistorySize caps UserContext.ViewHistory.
+const viewHistorySize = 20
+
+// MaxRecentTrades caps UserContext.RecentTrades; a live account summary
+// fetches the same number, so both sources answer alike.
+const MaxRecentTrades = 5
+
+// AccountPolls records when each part of an account snapshot was last filled
+// by a full Horizon read. Zero means never, so a part that is empty because
+// the account has nothing there can be told from one not fetched yet. Recent
+// trades are only ever added one event at a time, so they have no entry.
+type AccountPolls struct {
+	Holdings time.Time // balances and trustlines
+	Offers   time.Time
+}
+
 // UserContext tracks the live state for a connected user.
 // Protected by the parent Connection's mu — no separate mutex.
 type UserContext struct {
-	LastActiveNetwork string        `json:"last_active_network"`
-	RecentTrades      []TradeRecord `json:"recent_trades"`
-	OpenOffers        []OfferRecord `json:"open_offers"`
-	ActivePair        string        `json:"active_pair"`
+	LastActiveNetwork string            `json:"last_active_network"`
+	RecentTrades      []TradeRecord     `json:"recent_trades"`
+	OpenOffers        []OfferRecord     `json:"open_offers"`
+	ActivePair        string            `json:"active_pair"`
+	Balances          []BalanceRecord   `json:"balances"`
+	Trustlines        []TrustlineRecord `json:"trustlines"`
+	// ViewHistory lists active-view changes newest first, capped at
+	// viewHistorySize. In memory only; it starts empty after a restart.
+	ViewHistory []ViewChange `json:"view_history"`
+	Polled      AccountPolls `json:"-"`
 }
 
 // ContextSnapshot is a thread-safe copy returned to callers outside the store.
 type ContextSnapshot struct {
-	Network           string        `json:"network"`
-	AccountID         string        `json:"account_id"`
-	ActivePair        string        `json:"active_pair"`
-	LastActiveNetwork string        `json:"last_active_network"`
-	RecentTrades      []TradeRecord `json:"recent_trades"`
-	OpenOffers        []OfferRecord `json:"open_offers"`
+	Network           string            `json:"network"`
+	AccountID         string            `json:"account_id"`
+	ActivePair        string            `json:"active_pair"`
+	LastActiveNetwork string            `json:"last_active_network"`
+	RecentTrades      []TradeRecord     `json:"recent_trades"`
+	OpenOffers        []OfferRecord     `json:"open_offers"`
+	Balances          []BalanceRecord   `json:"balances"`   // empty until fetched, or when the account is unfunded
+	Trustlines        []TrustlineRecord `json:"trustlines"` // refreshed with balances
+	// ViewHistory is only filled in on request; see GetViewHistory.
+	ViewHistory []ViewChange `json:"view_history,omitempty"`
+	// Polled says which account parts above hold a completed fetch.
+	Polled AccountPolls `json:"-"`
 }
 
 type Connection struct {
 	Token          string
 	CreatedAt      time.Time
 	AgentConnected bool
-	subscribers    map[chan LogEntry]bool
-	mu             sync.RWMutex
+	// lastSeen is the time, in unix nanoseconds, of the token's latest
+	// authenticated request or stream subscribe; see Touch. Atomic so that
+	// per-request touches never wait on mu.
+	lastSeen atomic.Int64
+	// subscribers is only mutated while holding mu: a subscriber is removed
+	// from the map and closed in the same critical section, so a broadcast
+	// never offers to a closed one.
+	subscribers map[chan LogEntry]*subscriber
+	mu          sync.RWMutex
+
+	// closed is set under mu by DeleteToken. Once set, subscriber channels
+	// have been closed and nothing may be sent to or registered on them.
+	closed bool
+
+	// ctx lives as long as the token; DeleteToken cancels it so background
+	// work started for the token (account watchers) unwinds immediately.
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	// Real-time observer fields — set when the user pairs their Stellar account.
 	AccountID   string
 	Network     string       // "MAINNET" | "TESTNET"
 	Context     *UserContext
 	WatchCancel func()       // cancel func for the account-watching goroutine
+
+	alerts []*PriceAlert // guarded by mu; dropped with the connection
+
+	// history is a ring of the last logHistorySize published entries, with
+	// seq the last sequence number handed out. Both are guarded by histMu,
+	// which Publish also holds across the fan-out so every subscriber sees
+	// entries in Seq order; the fan-out never blocks, so that is cheap.
+	histMu  sync.Mutex
+	seq     uint64
+	history []LogEntry
+
+	// insights holds, per insight key, the last insight PublishInsight sent
+	// this token. Guarded by insightMu.
+	insightMu sync.Mutex
+	insights  map[string]insightMark
+}
+
+// insightMark is when an insight was last sent and how large it was.
+type insightMark struct {
+	at        time.Time
+	magnitude float64
 }
 
 type Store struct {
 	mu          sync.RWMutex
 	connections map[string]*Connection
 	db          *db.DB // nil when running without persistence
+
+	// maxSubscribers caps concurrent SSE subscribers per token (0 = unlimited).
+	maxSubscribers int
+	// blockTimeout bounds how long Publish waits on a DeliveryBlock subscriber.
+	blockTimeout time.Duration
+	// insightCooldown and insightOverride throttle PublishInsight per token
+	// and key; a zero cool-down sends every insight.
+	insightCooldown time.Duration
+	insightOverride float64
+
+	// defaultNetwork and defaultPair seed every new session's view.
+	defaultNetwork string
+	defaultPair    string
+
+	// watchMu guards the global account-watcher count and cap. A watcher is
+	// counted from SetAccountWatch until its cancel func runs.
+	watchMu      sync.Mutex
+	liveWatchers int
+	maxWatchers  int // 0 = unlimited
 }
 
 func NewStore(database *db.DB) *Store {
 	s := &Store{
-		connections: make(map[string]*Connection),
-		db:          database,
+		connections:    make(map[string]*Connection),
+		db:             database,
+		defaultNetwork: "TESTNET",
+		defaultPair:    "XLM/USDC",
+		blockTimeout:   DefaultBlockTimeout,
+
+		insightOverride: DefaultInsightOverride,
 	}
 	if database != nil {
 		s.loadFromDB()
@@ -96,17 +276,23 @@ func (s *Store) loadFromDB() {
 		return
 	}
 	for _, sess := range sessions {
+		ctx, cancel := context.WithCancel(context.Background())
 		conn := &Connection{
+			ctx:         ctx,
+			cancel:      cancel,
 			Token:       sess.Token,
 			CreatedAt:   sess.CreatedAt,
 			AccountID:   sess.AccountID,
 			Network:     sess.Network,
-			subscribers: make(map[chan LogEntry]bool),
+			subscribers: make(map[chan LogEntry]*subscriber),
 			Context: &UserContext{
 				LastActiveNetwork: sess.Network,
 				ActivePair:        sess.ActivePair,
 			},
 		}
+		// LastSeen isn't persisted; count the restart as activity so
+		// restored sessions don't all look idle since creation.
+		conn.Touch()
 		s.connections[sess.Token] = conn
 	}
 	log.Printf("[store] restored %d session(s) from db", len(sessions))
@@ -122,18 +308,24 @@ func (s *Store) CreateToken() (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.connections[token] = &Connection{
+	now := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := &Connection{
+		ctx:         ctx,
+		cancel:      cancel,
 		Token:       token,
-		CreatedAt:   time.Now(),
-		Network:     "TESTNET",
-		subscribers: make(map[chan LogEntry]bool),
+		CreatedAt:   now,
+		Network:     s.defaultNetwork,
+		subscribers: make(map[chan LogEntry]*subscriber),
 		Context: &UserContext{
-			LastActiveNetwork: "TESTNET",
-			ActivePair:        "XLM/USDC",
+			LastActiveNetwork: s.defaultNetwork,
+			ActivePair:        s.defaultPair,
 		},
 	}
+	conn.lastSeen.Store(now.UnixNano())
+	s.connections[token] = conn
 	if s.db != nil {
-		if err := s.db.InsertSession(token); err != nil {
+		if err := s.db.InsertSession(token, s.defaultNetwork, s.defaultPair); err != nil {
 			log.Printf("[store] persist session %s: %v", token, err)
 		}
 	}
@@ -153,20 +345,207 @@ func (s *Store) GetConnection(token string) *Connection {
 	return s.connections[token]
 }
 
-func (s *Store) Subscribe(token string) chan LogEntry {
+// Touch records activity on c now.
+func (c *Connection) Touch() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// LastSeen returns the time of c's latest recorded activity.
+func (c *Connection) LastSeen() time.Time {
+	return time.Unix(0, c.lastSeen.Load())
+}
+
+// Touch records activity on token, reporting whether the token exists. It
+// is ValidateToken for callers that act on the token's behalf.
+func (s *Store) Touch(token string) bool {
+	conn := s.GetConnection(token)
+	if conn == nil {
+		return false
+	}
+	conn.Touch()
+	return true
+}
+
+// ConnectionInfo is an admin-facing summary of one session.
+type ConnectionInfo struct {
+	Token          string    `json:"token"`
+	CreatedAt      time.Time `json:"createdAt"`
+	LastSeen       time.Time `json:"lastSeen"`
+	AgentConnected bool      `json:"agentConnected"`
+	AccountID      string    `json:"accountId,omitempty"`
+	Network        string    `json:"network"`
+	Subscribers    int       `json:"subscribers"` // open SSE streams
+}
+
+// ListConnections returns a summary of every session, oldest first (ties
+// broken by token) so the order is stable for pagination.
+func (s *Store) ListConnections() []ConnectionInfo {
+	s.mu.RLock()
+	conns := make([]*Connection, 0, len(s.connections))
+	for _, c := range s.connections {
+		conns = append(conns, c)
+	}
+	s.mu.RUnlock()
+
+	out := make([]ConnectionInfo, 0, len(conns))
+	for _, c := range conns {
+		c.mu.RLock()
+		out = append(out, ConnectionInfo{
+			Token:          c.Token,
+			CreatedAt:      c.CreatedAt,
+			LastSeen:       c.LastSeen(),
+			AgentConnected: c.AgentConnected,
+			AccountID:      c.AccountID,
+			Network:        c.Network,
+			Subscribers:    len(c.subscribers),
+		})
+		c.mu.RUnlock()
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].Token < out[j].Token
+	})
+	return out
+}
+
+// TokenContext returns a context that is cancelled when token is deleted.
+// Goroutines working on behalf of a token should derive from it.
+func (s *Store) TokenContext(token string) (context.Context, bool) {
 	s.mu.RLock()
+	defer s.mu.RUnlock()
 	conn, ok := s.connections[token]
+	if !ok {
+		return nil, false
+	}
+	return conn.ctx, true
+}
+
+// Config is the store's settings, applied by Configure. Zero values keep
+// NewStore's defaults.
+type Config struct {
+	MaxSubscribers  int           // SSE subscribers per token; 0 = unlimited
+	BlockTimeout    time.Duration // see SetBlockTimeout
+	InsightCooldown time.Duration // see SetInsightCooldown; 0 = off
+	InsightOverride float64
+	MaxWatchers     int    // account watchers across all tokens; 0 = unlimited
+	DefaultNetwork  string // view new sessions start on
+	DefaultPair     string
+}
+
+// Configure applies cfg. Call before serving.
+func (s *Store) Configure(cfg Config) error {
+	network, pair := s.Defaults()
+	if cfg.DefaultNetwork != "" {
+		network = cfg.DefaultNetwork
+	}
+	if cfg.DefaultPair != "" {
+		pair = cfg.DefaultPair
+	}
+	if err := s.SetDefaults(network, pair); err != nil {
+		return err
+	}
+	s.SetMaxSubscribers(cfg.MaxSubscribers)
+	s.SetBlockTimeout(cfg.BlockTimeout)
+	s.SetInsightCooldown(cfg.InsightCooldown, cfg.InsightOverride)
+	s.SetMaxWatchers(cfg.MaxWatchers)
+	return nil
+}
+
+// SetBlockTimeout sets how long an entry stays queued for a full
+// DeliveryBlock subscriber before it is dropped for it. Values <= 0 restore
+// DefaultBlockTimeout.
+func (s *Store) SetBlockTimeout(d time.Duration) {
+	if d <= 0 {
+		d = DefaultBlockTimeout
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blockTimeout = d
+}
+
+// SetInsightCooldown makes PublishInsight send each token at most one insight
+// per key every d. An insight whose magnitude is at least override times the
+// last one sent for the key is new information and goes out regardless.
+// d <= 0 disables the cool-down; override <= 1 restores
+// DefaultInsightOverride.
+func (s *Store) SetInsightCooldown(d time.Duration, override float64) {
+	if override <= 1 {
+		override = DefaultInsightOverride
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insightCooldown = max(d, 0)
+	s.insightOverride = override
+}
+
+// SetMaxSubscribers caps concurrent SSE subscribers per token. 0 disables
+// the limit.
+func (s *Store) SetMaxSubscribers(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxSubscribers = n
+}
+
+// SetDefaults sets the network and pair new sessions start on. network must
+// be MAINNET or TESTNET; existing sessions keep their view.
+func (s *Store) SetDefaults(network, pair string) error {
+	if network != "MAINNET" && network != "TESTNET" {
+		return fmt.Errorf("network %q must be MAINNET or TESTNET", network)
+	}
+	if pair == "" {
+		return errors.New("pair is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultNetwork, s.defaultPair = network, pair
+	return nil
+}
+
+// Defaults returns the network and pair new sessions start on.
+func (s *Store) Defaults() (network, pair string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.defaultNetwork, s.defaultPair
+}
+
+// Subscribe registers a DeliveryDrop subscriber on token's log stream.
+func (s *Store) Subscribe(token string) (chan LogEntry, error) {
+	return s.SubscribeWithPolicy(token, DeliveryDrop)
+}
+
+// SubscribeWithPolicy registers a subscriber that Publish serves according
+// to policy when its buffer is full. Critical entries are delivered under
+// either policy. Publish itself never waits: entries a full subscriber
+// can't take yet are queued for it (see subscriber.offer).
+func (s *Store) SubscribeWithPolicy(token string, policy DeliveryPolicy) (chan LogEntry, error) {
+	if policy != DeliveryDrop && policy != DeliveryBlock {
+		return nil, fmt.Errorf("unknown delivery policy %q", policy)
+	}
+	s.mu.RLock()
+	conn, ok := s.connections[token]
+	limit := s.maxSubscribers
 	s.mu.RUnlock()
 	if !ok {
-		return nil
+		return nil, ErrUnknownToken
 	}
-	ch := make(chan LogEntry, 64)
 	conn.mu.Lock()
-	conn.subscribers[ch] = true
-	conn.mu.Unlock()
-	return ch
+	defer conn.mu.Unlock()
+	if conn.closed {
+		return nil, ErrUnknownToken
+	}
+	if limit > 0 && len(conn.subscribers) >= limit {
+		return nil, ErrSubscriberLimit
+	}
+	sub := newSubscriber(policy)
+	conn.subscribers[sub.ch] = sub
+	conn.Touch()
+	return sub.ch, nil
 }
 
+// Unsubscribe removes and closes ch. It is safe to call more than once and
+// after DeleteToken: only the call that actually removes ch closes it.
 func (s *Store) Unsubscribe(token string, ch chan LogEntry) {
 	s.mu.RLock()
 	conn, ok := s.connections[token]
@@ -175,9 +554,69 @@ func (s *Store) Unsubscribe(token string, ch chan LogEntry) {
 		return
 	}
 	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	sub, registered := conn.subscribers[ch]
+	if !registered {
+		return
+	}
 	delete(conn.subscribers, ch)
+	sub.close()
+}
+
+// DeleteToken removes a session: it stops its account watcher, closes every
+// SSE subscriber channel (ending those streams) and drops the persisted row.
+// Returns false if the token was unknown.
+func (s *Store) DeleteToken(token string) bool {
+	s.mu.Lock()
+	conn, ok := s.connections[token]
+	delete(s.connections, token)
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	conn.cancel()
+	conn.mu.Lock()
+	conn.closed = true
+	for _, sub := range conn.subscribers {
+		sub.close()
+	}
+	conn.subscribers = nil
+	if conn.WatchCancel != nil {
+		conn.WatchCancel()
+		conn.WatchCancel = nil
+	}
 	conn.mu.Unlock()
-	close(ch)
+
+	if s.db != nil {
+		if err := s.db.DeleteSession(token); err != nil {
+			log.Printf("[store] delete session %s: %v", token, err)
+		}
+	}
+	return true
+}
+
+// ResetAgent kicks token's agent without revoking the session: it clears
+// AgentConnected, so the agent's next request announces it again, and closes
+// every SSE subscriber, ending those streams so clients reconnect. Context,
+// positions and the account watcher are kept; DeleteToken is the revocation.
+// Returns how many streams were closed, and false if the token was unknown.
+func (s *Store) ResetAgent(token string) (closed int, ok bool) {
+	s.mu.RLock()
+	conn, ok := s.connections[token]
+	s.mu.RUnlock()
+	if !ok {
+		return 0, false
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.AgentConnected = false
+	for ch, sub := range conn.subscribers {
+		delete(conn.subscribers, ch)
+		sub.close()
+		closed++
+	}
+	return closed, true
 }
 
 // MarkAgentConnected returns true on the first call per token (agent's first request).
@@ -212,6 +651,7 @@ func (s *Store) IsAgentConnected(token string) bool {
 func (s *Store) Publish(token string, entry LogEntry) bool {
 	s.mu.RLock()
 	conn, ok := s.connections[token]
+	blockTimeout := s.blockTimeout
 	s.mu.RUnlock()
 	if !ok {
 		return false
@@ -219,16 +659,51 @@ func (s *Store) Publish(token string, entry LogEntry) bool {
 	entry.Timestamp = time.Now().UTC().Format(time.RFC3339)
 	conn.mu.RLock()
 	defer conn.mu.RUnlock()
-	for ch := range conn.subscribers {
-		select {
-		case ch <- entry:
-		default:
-			// drop if subscriber is slow
-		}
+	if conn.closed {
+		return false
+	}
+	conn.histMu.Lock()
+	conn.seq++
+	entry.Seq = conn.seq
+	if len(conn.history) < logHistorySize {
+		conn.history = append(conn.history, entry)
+	} else {
+		conn.history[(entry.Seq-1)%logHistorySize] = entry
 	}
+	for _, sub := range conn.subscribers {
+		sub.offer(entry, blockTimeout)
+	}
+	conn.histMu.Unlock()
 	return true
 }
 
+// Since returns up to limit buffered entries with Seq > since, oldest first,
+// and the latest sequence number published for the token. Entries older than
+// the last logHistorySize are gone; a caller that fell that far behind sees
+// the first returned Seq jump past since+1.
+func (s *Store) Since(token string, since uint64, limit int) ([]LogEntry, uint64, error) {
+	s.mu.RLock()
+	conn, ok := s.connections[token]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, 0, ErrUnknownToken
+	}
+	conn.histMu.Lock()
+	defer conn.histMu.Unlock()
+	entries := []LogEntry{}
+	first := uint64(1)
+	if conn.seq > logHistorySize {
+		first = conn.seq - logHistorySize + 1
+	}
+	if since+1 > first {
+		first = since + 1
+	}
+	for seq := first; seq <= conn.seq && len(entries) < limit; seq++ {
+		entries = append(entries, conn.history[(seq-1)%logHistorySize])
+	}
+	return entries, conn.seq, nil
+}
+
 // PublishAll broadcasts a log entry to every connected token.
 // Used for global market insights from the order book heartbeat.
 func (s *Store) PublishAll(entry LogEntry) {
@@ -244,22 +719,130 @@ func (s *Store) PublishAll(entry LogEntry) {
 	}
 }
 
+// PublishInsight broadcasts entry like PublishAll, skipping each token that
+// was sent an insight with the same key within the cool-down unless
+// magnitude (e.g. the percent a price moved) is at least the override factor
+// times the last one it was sent; 0 never overrides. It returns how many
+// tokens it was sent to.
+func (s *Store) PublishInsight(entry LogEntry, key string, magnitude float64) int {
+	s.mu.RLock()
+	conns := make([]*Connection, 0, len(s.connections))
+	for _, c := range s.connections {
+		conns = append(conns, c)
+	}
+	cooldown, override := s.insightCooldown, s.insightOverride
+	s.mu.RUnlock()
+
+	now := time.Now()
+	sent := 0
+	for _, conn := range conns {
+		if cooldown > 0 && !conn.allowInsight(key, magnitude, now, cooldown, override) {
+			continue
+		}
+		s.Publish(conn.Token, entry)
+		sent++
+	}
+	return sent
+}
+
+// allowInsight reports whether an insight for key may go to the connection
+// now, and if so records it as the last one sent.
+func (conn *Connection) allowInsight(key string, magnitude float64, now time.Time, cooldown time.Duration, override float64) bool {
+	conn.insightMu.Lock()
+	defer conn.insightMu.Unlock()
+	last, ok := conn.insights[key]
+	if ok && now.Sub(last.at) < cooldown && (magnitude <= 0 || magnitude < override*last.magnitude) {
+		return false
+	}
+	if conn.insights == nil {
+		conn.insights = make(map[string]insightMark)
+	}
+	conn.insights[key] = insightMark{at: now, magnitude: magnitude}
+	return true
+}
+
+// SetMaxWatchers caps concurrent account watchers across all tokens. 0
+// disables the limit.
+func (s *Store) SetMaxWatchers(n int) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	s.maxWatchers = n
+}
+
+// WatcherCount returns how many account watchers are live.
+func (s *Store) WatcherCount() int {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	return s.liveWatchers
+}
+
+// reserveWatcher takes a watcher slot. A token replacing its own watcher is
+// always let through since its old slot is about to be released.
+func (s *Store) reserveWatcher(replacing bool) bool {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if !replacing && s.maxWatchers > 0 && s.liveWatchers >= s.maxWatchers {
+		return false
+	}
+	s.liveWatchers++
+	return true
+}
+
+// releaseOnCancel wraps cancel so the first call also frees the watcher slot.
+func (s *Store) releaseOnCancel(cancel func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if cancel != nil {
+				cancel()
+			}
+			s.watchMu.Lock()
+			s.liveWatchers--
+			s.watchMu.Unlock()
+		})
+	}
+}
+
 // SetAccountWatch registers an account ID and network for a token,
 // cancels any previous account-watcher goroutine, and stores the new cancel func.
-func (s *Store) SetAccountWatch(token, accountID, network string, cancel func()) {
+// If the global watcher cap is reached (ErrWatcherLimit) or the token is
+// gone (ErrUnknownToken), cancel is called and nothing is registered.
+func (s *Store) SetAccountWatch(token, accountID, network string, cancel func()) error {
 	s.mu.RLock()
 	conn, ok := s.connections[token]
 	s.mu.RUnlock()
 	if !ok {
-		return
+		if cancel != nil {
+			cancel()
+		}
+		return ErrUnknownToken
 	}
 	conn.mu.Lock()
+	if conn.closed {
+		// Token was deleted between the lookup and the lock; don't leak the
+		// watcher goroutine on a connection nobody can reach.
+		conn.mu.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+		return ErrUnknownToken
+	}
+	if !s.reserveWatcher(conn.WatchCancel != nil) {
+		conn.mu.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+		return ErrWatcherLimit
+	}
 	if conn.WatchCancel != nil {
 		conn.WatchCancel()
 	}
+	if conn.AccountID != accountID || conn.Network != network {
+		conn.clearHoldings()
+	}
 	conn.AccountID = accountID
 	conn.Network = network
-	conn.WatchCancel = cancel
+	conn.WatchCancel = s.releaseOnCancel(cancel)
 	if conn.Context != nil {
 		conn.Context.LastActiveNetwork = network
 	}
@@ -269,18 +852,44 @@ func (s *Store) SetAccountWatch(token, accountID, network string, cancel func())
 			log.Printf("[store] persist account for %s: %v", token, err)
 		}
 	}
+	return nil
 }
 
-// SetActiveView updates the active pair and/or network for a token.
-func (s *Store) SetActiveView(token, pair, network string) {
+// ClearAccountWatch stops the token's account watcher, if any, and unpairs
+// its account while keeping the session alive. A later SetAccountWatch starts
+// afresh. Returns ErrUnknownToken if the token is gone.
+func (s *Store) ClearAccountWatch(token string) error {
 	s.mu.RLock()
 	conn, ok := s.connections[token]
 	s.mu.RUnlock()
 	if !ok {
-		return
+		return ErrUnknownToken
 	}
 	conn.mu.Lock()
-	if conn.Context != nil {
+	if conn.closed {
+		conn.mu.Unlock()
+		return ErrUnknownToken
+	}
+	if conn.WatchCancel != nil {
+		conn.WatchCancel()
+		conn.WatchCancel = nil
+	}
+	conn.AccountID = ""
+	conn.clearHoldings()
+	network := conn.Network
+	conn.mu.Unlock()
+	if s.db != nil {
+		if err := s.db.UpdateSessionAccount(token, "", network); err != nil {
+			log.Printf("[store] persist unpair for %s: %v", token, err)
+		}
+	}
+	return nil
+}
+
+// SetActiveView updates the active pair and/or network for a token. An empty
+// pair or network leaves that field unchanged; see ClearActivePair.
+func (s *Store) SetActiveView(token, pair, network string) {
+	s.updateView(token, func(conn *Connection) {
 		if pair != "" {
 			conn.Context.ActivePair = pair
 		}
@@ -288,6 +897,37 @@ func (s *Store) SetActiveView(token, pair, network string) {
 			conn.Context.LastActiveNetwork = network
 			conn.Network = network
 		}
+	})
+}
+
+// ClearActivePair unsets the token's active pair.
+func (s *Store) ClearActivePair(token string) error {
+	if !s.updateView(token, func(conn *Connection) { conn.Context.ActivePair = "" }) {
+		return ErrUnknownToken
+	}
+	return nil
+}
+
+// updateView applies fn to the token's view under its lock, records the
+// change in the view history and persists the resulting pair and network. It
+// reports whether the token exists.
+func (s *Store) updateView(token string, fn func(*Connection)) bool {
+	s.mu.RLock()
+	conn, ok := s.connections[token]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	conn.mu.Lock()
+	if conn.Context == nil {
+		conn.Context = &UserContext{}
+	}
+	prevPair, prevNetwork := conn.Context.ActivePair, conn.Network
+	fn(conn)
+	pair, network := conn.Context.ActivePair, conn.Network
+	if pair != prevPair || network != prevNetwork {
+		h := append([]ViewChange{{Pair: pair, Network: network, Timestamp: time.Now().UTC()}}, conn.Context.ViewHistory...)
+		conn.Context.ViewHistory = h[:min(len(h), viewHistorySize)]
 	}
 	conn.mu.Unlock()
 	if s.db != nil {
@@ -295,9 +935,27 @@ func (s *Store) SetActiveView(token, pair, network string) {
 			log.Printf("[store] persist pair for %s: %v", token, err)
 		}
 	}
+	return true
+}
+
+// GetViewHistory returns the token's active-view changes, newest first.
+func (s *Store) GetViewHistory(token string) ([]ViewChange, error) {
+	s.mu.RLock()
+	conn, ok := s.connections[token]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownToken
+	}
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	if conn.Context == nil {
+		return []ViewChange{}, nil
+	}
+	return append([]ViewChange{}, conn.Context.ViewHistory...), nil
 }
 
-// AddRecentTrade prepends a trade to the context (capped at 5).
+// AddRecentTrade prepends a trade to the context (capped at MaxRecentTrades).
+// It is a single event, not a full read, so it doesn't mark trades polled.
 func (s *Store) AddRecentTrade(token string, trade TradeRecord) {
 	s.mu.RLock()
 	conn, ok := s.connections[token]
@@ -307,8 +965,8 @@ func (s *Store) AddRecentTrade(token string, trade TradeRecord) {
 	}
 	conn.mu.Lock()
 	conn.Context.RecentTrades = append([]TradeRecord{trade}, conn.Context.RecentTrades...)
-	if len(conn.Context.RecentTrades) > 5 {
-		conn.Context.RecentTrades = conn.Context.RecentTrades[:5]
+	if len(conn.Context.RecentTrades) > MaxRecentTrades {
+		conn.Context.RecentTrades = conn.Context.RecentTrades[:MaxRecentTrades]
 	}
 	conn.mu.Unlock()
 }
@@ -323,9 +981,40 @@ func (s *Store) SetOpenOffers(token string, offers []OfferRecord) {
 	}
 	conn.mu.Lock()
 	conn.Context.OpenOffers = offers
+	conn.Context.Polled.Offers = time.Now()
 	conn.mu.Unlock()
 }
 
+// SetHoldings replaces the balances and trustlines snapshot, provided
+// accountID is still the token's paired account — a poller for a previous
+// account can't clobber it.
+func (s *Store) SetHoldings(token, accountID string, balances []BalanceRecord, trustlines []TrustlineRecord) {
+	s.mu.RLock()
+	conn, ok := s.connections[token]
+	s.mu.RUnlock()
+	if !ok || conn.Context == nil {
+		return
+	}
+	conn.mu.Lock()
+	if conn.AccountID == accountID {
+		conn.Context.Balances = balances
+		conn.Context.Trustlines = trustlines
+		conn.Context.Polled.Holdings = time.Now()
+	}
+	conn.mu.Unlock()
+}
+
+// clearHoldings drops the balances and trustlines of a previous account and
+// forgets every part's poll, so nothing cached for it passes as current.
+// Caller holds c.mu.
+func (c *Connection) clearHoldings() {
+	if c.Context != nil {
+		c.Context.Balances = nil
+		c.Context.Trustlines = nil
+		c.Context.Polled = AccountPolls{}
+	}
+}
+
 // GetContextSnapshot returns a thread-safe copy of the full context for a token.
 func (s *Store) GetContextSnapshot(token string) *ContextSnapshot {
 	s.mu.RLock()
@@ -346,6 +1035,9 @@ func (s *Store) GetContextSnapshot(token string) *ContextSnapshot {
 		snap.LastActiveNetwork = conn.Context.LastActiveNetwork
 		snap.RecentTrades = append([]TradeRecord{}, conn.Context.RecentTrades...)
 		snap.OpenOffers = append([]OfferRecord{}, conn.Context.OpenOffers...)
+		snap.Balances = append([]BalanceRecord{}, conn.Context.Balances...)
+		snap.Trustlines = append([]TrustlineRecord{}, conn.Context.Trustlines...)
+		snap.Polled = conn.Context.Polled
 	}
 	return snap
 }
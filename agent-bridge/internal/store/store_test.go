@@ -0,0 +1,639 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"agent-bridge/internal/db"
+)
+
+// newTestStore returns an in-memory store with n fresh tokens.
+func newTestStore(t *testing.T, n int) (*Store, []string) {
+	t.Helper()
+	s := NewStore(nil)
+	tokens := make([]string, n)
+	for i := range tokens {
+		tok, err := s.CreateToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[i] = tok
+	}
+	return s, tokens
+}
+
+// TestStoreConcurrentLifecycle hammers the connection lifecycle from many
+// goroutines. It is meant to run under -race; without it the test still
+// catches send-on-closed-channel and double-close panics.
+func TestStoreConcurrentLifecycle(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		delete  bool // delete tokens while others are using them
+	}{
+		{"subscribe/publish", 16, false},
+		{"with deletes", 16, true},
+		{"many workers with deletes", 64, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, tokens := newTestStore(t, 4)
+			var wg sync.WaitGroup
+			for w := 0; w < tt.workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < 200; i++ {
+						tok := tokens[(w+i)%len(tokens)]
+						switch (w + i) % 5 {
+						case 0:
+							if ch, err := s.Subscribe(tok); err == nil {
+								s.Publish(tok, LogEntry{Message: "x"})
+								s.Unsubscribe(tok, ch)
+							}
+						case 1:
+							s.Publish(tok, LogEntry{Message: fmt.Sprint(i)})
+						case 2:
+							s.PublishAll(LogEntry{Message: "all"})
+						case 3:
+							s.SetAccountWatch(tok, "GABC", "TESTNET", func() {})
+						case 4:
+							if tt.delete && i%50 == 0 {
+								s.DeleteToken(tok)
+							}
+							s.GetContextSnapshot(tok)
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestDeleteTokenClosesSubscribers(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+
+	ch, err := s.Subscribe(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled := false
+	s.SetAccountWatch(tok, "GABC", "TESTNET", func() { cancelled = true })
+	ctx, ok := s.TokenContext(tok)
+	if !ok {
+		t.Fatal("TokenContext: want ok for a live token")
+	}
+
+	if !s.DeleteToken(tok) {
+		t.Fatal("DeleteToken: want true for a live token")
+	}
+	if _, ok := <-ch; ok {
+		t.Error("subscriber channel still open after DeleteToken")
+	}
+	if !cancelled {
+		t.Error("account watcher not cancelled")
+	}
+	if ctx.Err() == nil {
+		t.Error("token context not cancelled")
+	}
+	if s.Publish(tok, LogEntry{Message: "late"}) {
+		t.Error("Publish succeeded on a deleted token")
+	}
+	if _, err := s.Subscribe(tok); err == nil {
+		t.Error("Subscribe succeeded on a deleted token")
+	}
+	s.Unsubscribe(tok, ch) // must not double-close
+}
+
+func TestResetAgentKeepsSession(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+
+	a, _ := s.Subscribe(tok)
+	b, _ := s.Subscribe(tok)
+	cancelled := false
+	s.SetAccountWatch(tok, "GABC", "TESTNET", func() { cancelled = true })
+	if !s.MarkAgentConnected(tok) {
+		t.Fatal("MarkAgentConnected: want true on first call")
+	}
+
+	closed, ok := s.ResetAgent(tok)
+	if !ok || closed != 2 {
+		t.Fatalf("ResetAgent = %d, %v; want 2 streams closed", closed, ok)
+	}
+	for _, ch := range []chan LogEntry{a, b} {
+		if _, open := <-ch; open {
+			t.Error("subscriber channel still open after ResetAgent")
+		}
+	}
+	s.Unsubscribe(tok, a) // must not double-close
+
+	if !s.ValidateToken(tok) || cancelled {
+		t.Fatal("ResetAgent revoked the session or stopped its account watch")
+	}
+	if !s.MarkAgentConnected(tok) {
+		t.Error("next request not treated as a fresh agent connection")
+	}
+	ch, err := s.Subscribe(tok)
+	if err != nil {
+		t.Fatalf("Subscribe after reset: %v", err)
+	}
+	if !s.Publish(tok, LogEntry{Message: "back"}) || (<-ch).Message != "back" {
+		t.Error("new stream does not receive entries")
+	}
+	if _, ok := s.ResetAgent("nope"); ok {
+		t.Error("ResetAgent: want false for an unknown token")
+	}
+}
+
+// TestRestoredSessionLastSeen checks that a session loaded from the
+// database counts the restart as activity rather than reporting CreatedAt.
+func TestRestoredSessionLastSeen(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "bridge.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	tok, err := NewStore(database).CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	before := time.Now()
+	c := NewStore(database).GetConnection(tok)
+	if c == nil {
+		t.Fatal("session not restored")
+	}
+	if !c.LastSeen().After(c.CreatedAt) || c.LastSeen().Before(before) {
+		t.Errorf("restored LastSeen %v, want the load time (after %v)", c.LastSeen(), before)
+	}
+}
+
+func TestTouchUpdatesLastSeen(t *testing.T) {
+	s, tokens := newTestStore(t, 2)
+	idle, busy := tokens[0], tokens[1]
+
+	created := s.GetConnection(busy).CreatedAt
+	time.Sleep(2 * time.Millisecond)
+	if !s.Touch(busy) {
+		t.Fatal("Touch: want true for a live token")
+	}
+	if s.Touch("nope") {
+		t.Error("Touch: want false for an unknown token")
+	}
+
+	seen := map[string]ConnectionInfo{}
+	for _, c := range s.ListConnections() {
+		seen[c.Token] = c
+	}
+	if !seen[idle].LastSeen.Equal(seen[idle].CreatedAt) {
+		t.Errorf("untouched LastSeen %v, want CreatedAt %v", seen[idle].LastSeen, seen[idle].CreatedAt)
+	}
+	touched := seen[busy].LastSeen
+	if !touched.After(created) {
+		t.Fatalf("touched LastSeen %v not after CreatedAt %v", touched, created)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if _, err := s.Subscribe(busy); err != nil {
+		t.Fatal(err)
+	}
+	if c := s.GetConnection(busy); !c.LastSeen().After(touched) {
+		t.Error("Subscribe did not update LastSeen")
+	}
+}
+
+// TestUnsubscribeDuringPublish interleaves broadcasts with subscribers coming
+// and going (including double unsubscribes) to prove no send on, or second
+// close of, a closed channel.
+func TestUnsubscribeDuringPublish(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				s.Publish(tok, LogEntry{Message: "tick"})
+			}
+		}()
+	}
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				ch, err := s.Subscribe(tok)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				go s.Unsubscribe(tok, ch)
+				s.Unsubscribe(tok, ch)
+				for range ch {
+					// drain until closed
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAccountWatcherLimit(t *testing.T) {
+	s, tokens := newTestStore(t, 3)
+	s.SetMaxWatchers(2)
+
+	for _, tok := range tokens[:2] {
+		if err := s.SetAccountWatch(tok, "GABC", "TESTNET", func() {}); err != nil {
+			t.Fatalf("SetAccountWatch(%s): %v", tok, err)
+		}
+	}
+	rejected := false
+	if err := s.SetAccountWatch(tokens[2], "GABC", "TESTNET", func() { rejected = true }); !errors.Is(err, ErrWatcherLimit) {
+		t.Fatalf("third watcher: got %v, want ErrWatcherLimit", err)
+	}
+	if !rejected {
+		t.Error("rejected watcher's cancel not called")
+	}
+
+	// Re-pairing an already-watched token swaps its slot rather than taking a new one.
+	if err := s.SetAccountWatch(tokens[0], "GDEF", "MAINNET", func() {}); err != nil {
+		t.Fatalf("replace watcher: %v", err)
+	}
+	if got := s.WatcherCount(); got != 2 {
+		t.Fatalf("WatcherCount after replace = %d, want 2", got)
+	}
+
+	// Deleting a token frees its slot.
+	s.DeleteToken(tokens[1])
+	if got := s.WatcherCount(); got != 1 {
+		t.Fatalf("WatcherCount after delete = %d, want 1", got)
+	}
+	if err := s.SetAccountWatch(tokens[2], "GABC", "TESTNET", func() {}); err != nil {
+		t.Fatalf("watcher after slot freed: %v", err)
+	}
+}
+
+func TestClearAccountWatch(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+
+	cancelled := 0
+	s.SetAccountWatch(tok, "GABC", "TESTNET", func() { cancelled++ })
+	if err := s.ClearAccountWatch(tok); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ClearAccountWatch(tok); err != nil { // nothing to stop is fine
+		t.Fatal(err)
+	}
+	if cancelled != 1 {
+		t.Errorf("watcher cancelled %d times, want 1", cancelled)
+	}
+	if conn := s.GetConnection(tok); conn.AccountID != "" {
+		t.Errorf("AccountID = %q after unwatch, want empty", conn.AccountID)
+	}
+	if got := s.WatcherCount(); got != 0 {
+		t.Errorf("WatcherCount = %d, want 0", got)
+	}
+	if err := s.SetAccountWatch(tok, "GDEF", "TESTNET", func() {}); err != nil {
+		t.Fatalf("re-watch: %v", err)
+	}
+	if err := s.ClearAccountWatch("nope"); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("unknown token: got %v, want ErrUnknownToken", err)
+	}
+}
+
+func TestSetDefaultsSeedsNewSessions(t *testing.T) {
+	s, before := newTestStore(t, 1)
+	if err := s.SetDefaults("MAINNET", "XLM/EURC"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDefaults("PUBNET", "XLM/USDC"); err == nil {
+		t.Fatal("SetDefaults accepted an unknown network")
+	}
+
+	tok, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := s.GetContextSnapshot(tok)
+	if snap.Network != "MAINNET" || snap.ActivePair != "XLM/EURC" {
+		t.Fatalf("new session view = %s %s, want MAINNET XLM/EURC", snap.Network, snap.ActivePair)
+	}
+	if old := s.GetContextSnapshot(before[0]); old.Network != "TESTNET" {
+		t.Fatalf("existing session moved to %s", old.Network)
+	}
+}
+
+// recvN reads n entries from ch, failing the test if they don't all arrive
+// within a second.
+func recvN(t *testing.T, ch chan LogEntry, n int) []LogEntry {
+	t.Helper()
+	timeout := time.After(time.Second)
+	got := make([]LogEntry, 0, n)
+	for len(got) < n {
+		select {
+		case e := <-ch:
+			got = append(got, e)
+		case <-timeout:
+			t.Fatalf("received %d entries, want %d", len(got), n)
+		}
+	}
+	return got
+}
+
+// TestPublishKeepsCriticalEvents fills a subscriber that isn't reading:
+// routine entries are dropped once the buffer is full, critical ones queue
+// behind it and arrive once the reader catches up, in order.
+func TestPublishKeepsCriticalEvents(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+	ch, err := s.Subscribe(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < cap(ch); i++ {
+		s.Publish(tok, LogEntry{EventType: "log", Message: fmt.Sprint(i)})
+	}
+	s.Publish(tok, LogEntry{EventType: "log", Message: "dropped"})
+	for _, typ := range []string{"liquidation", "alert", "margin_warning"} {
+		s.Publish(tok, LogEntry{EventType: typ})
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("publishing to a full subscriber took %v", d)
+	}
+
+	got := recvN(t, ch, cap(ch)+3)
+	for i := 0; i < cap(ch); i++ {
+		if got[i].Message != fmt.Sprint(i) {
+			t.Fatalf("entry %d = %q, want %q", i, got[i].Message, fmt.Sprint(i))
+		}
+	}
+	for i, typ := range []string{"liquidation", "alert", "margin_warning"} {
+		if e := got[cap(ch)+i]; e.EventType != typ {
+			t.Errorf("entry %d = %q, want %q", cap(ch)+i, e.EventType, typ)
+		}
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("unexpected entry %q %q", e.EventType, e.Message)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// TestBacklogEvictsOnlyRoutine overfills a stalled block subscriber's
+// backlog: routine entries are evicted to make room, critical ones never are.
+func TestBacklogEvictsOnlyRoutine(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+	s.SetBlockTimeout(5 * time.Second)
+	ch, err := s.SubscribeWithPolicy(tok, DeliveryBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < cap(ch); i++ {
+		s.Publish(tok, LogEntry{EventType: "log"})
+	}
+	s.Publish(tok, LogEntry{EventType: "liquidation", Message: "first"})
+	for i := 0; i < maxBacklog+10; i++ {
+		s.Publish(tok, LogEntry{EventType: "log"})
+	}
+	s.Publish(tok, LogEntry{EventType: "alert", Message: "last"})
+
+	// The pump may already hold "first" outside the backlog, so the count
+	// is one of two; either way "last" is the final entry.
+	var critical []string
+	n := 0
+	for len(critical) < 2 || critical[len(critical)-1] != "last" {
+		e := recvN(t, ch, 1)[0]
+		n++
+		if e.Critical() {
+			critical = append(critical, e.Message)
+		}
+	}
+	if len(critical) != 2 || critical[0] != "first" {
+		t.Errorf("critical entries delivered = %q, want [first last]", critical)
+	}
+	if n < cap(ch)+maxBacklog || n > cap(ch)+maxBacklog+1 {
+		t.Errorf("received %d entries, want the buffer plus a full backlog", n)
+	}
+}
+
+// TestConcurrentPublishKeepsSeqOrder publishes from several goroutines and
+// checks the subscriber receives strictly increasing sequence numbers.
+func TestConcurrentPublishKeepsSeqOrder(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+	s.SetBlockTimeout(5 * time.Second)
+	ch, err := s.SubscribeWithPolicy(tok, DeliveryBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const publishers, each = 8, 25
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				s.Publish(tok, LogEntry{EventType: "log"})
+			}
+		}()
+	}
+	got := recvN(t, ch, publishers*each)
+	wg.Wait()
+	for i, e := range got {
+		if e.Seq != uint64(i+1) {
+			t.Fatalf("entry %d has seq %d, want %d", i, e.Seq, i+1)
+		}
+	}
+}
+
+// TestPublishHonorsDeliveryPolicy checks that a block subscriber gets every
+// entry from a slow reader while a drop subscriber on the same token sheds
+// the overflow, and that a stalled block subscriber never delays Publish:
+// its queued entries expire after the block timeout instead.
+func TestPublishHonorsDeliveryPolicy(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+	s.SetBlockTimeout(5 * time.Second)
+	dropCh, err := s.Subscribe(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockCh, err := s.SubscribeWithPolicy(tok, DeliveryBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SubscribeWithPolicy(tok, "sometimes"); err == nil {
+		t.Error("unknown policy accepted")
+	}
+
+	const total = 100
+	received := make(chan int)
+	go func() {
+		n := 0
+		for range blockCh {
+			n++
+			if n == total {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		received <- n
+	}()
+	for i := 0; i < total; i++ {
+		s.Publish(tok, LogEntry{EventType: "log", Message: fmt.Sprint(i)})
+	}
+	if n := <-received; n != total {
+		t.Errorf("block subscriber got %d entries, want %d", n, total)
+	}
+	if len(dropCh) != cap(dropCh) {
+		t.Errorf("drop subscriber buffered %d entries, want %d", len(dropCh), cap(dropCh))
+	}
+
+	s.SetBlockTimeout(20 * time.Millisecond)
+	for len(blockCh) < cap(blockCh) {
+		s.Publish(tok, LogEntry{EventType: "log"})
+	}
+	start := time.Now()
+	s.Publish(tok, LogEntry{EventType: "log", Message: "late"})
+	if d := time.Since(start); d >= 20*time.Millisecond {
+		t.Errorf("Publish to a stalled block subscriber took %v, want no wait", d)
+	}
+	time.Sleep(60 * time.Millisecond)
+	for _, e := range recvN(t, blockCh, cap(blockCh)) {
+		if e.Message == "late" {
+			t.Fatal("entry delivered after its block timeout expired")
+		}
+	}
+}
+
+func TestPublishInsightCooldown(t *testing.T) {
+	s, tokens := newTestStore(t, 2)
+	entry := LogEntry{EventType: "insight"}
+	if n := s.PublishInsight(entry, "price_move:TESTNET:XLM/USDC", 0.6); n != 2 {
+		t.Fatalf("without a cool-down sent to %d tokens, want 2", n)
+	}
+
+	s.SetInsightCooldown(time.Hour, 0)
+	steps := []struct {
+		key       string
+		magnitude float64
+		want      int
+	}{
+		{"price_move:TESTNET:XLM/USDC", 0.6, 2},
+		{"price_move:TESTNET:XLM/USDC", 0.6, 0},
+		{"price_move:TESTNET:XLM/USDC", 1.1, 0}, // under 2× the last sent
+		{"price_move:TESTNET:XLM/USDC", 1.2, 2}, // 2× breaks through
+		{"price_move:TESTNET:XLM/USDC", 2.0, 0}, // measured against 1.2 now
+		{"price_move:MAINNET:XLM/USDC", 0.5, 2}, // another pair
+		{"book_empty:TESTNET:XLM/USDC", 0, 2},
+		{"book_empty:TESTNET:XLM/USDC", 0, 0}, // no magnitude never overrides
+	}
+	for i, st := range steps {
+		if n := s.PublishInsight(entry, st.key, st.magnitude); n != st.want {
+			t.Errorf("step %d (%s %v): sent to %d tokens, want %d", i, st.key, st.magnitude, n, st.want)
+		}
+	}
+	if got, _, err := s.Since(tokens[0], 0, 100); err != nil || len(got) != 5 {
+		t.Errorf("token history holds %d insights (err %v), want 5", len(got), err)
+	}
+
+	s.SetInsightCooldown(10*time.Millisecond, 0)
+	time.Sleep(20 * time.Millisecond)
+	if n := s.PublishInsight(entry, "book_empty:TESTNET:XLM/USDC", 0); n != 2 {
+		t.Errorf("after the cool-down sent to %d tokens, want 2", n)
+	}
+}
+
+func TestViewHistory(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+	s.SetActiveView(tok, "XLM/USDC", "TESTNET")
+	s.SetActiveView(tok, "XLM/EURC", "")
+	s.SetActiveView(tok, "XLM/EURC", "") // no change, not recorded
+	if err := s.ClearActivePair(tok); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := s.GetViewHistory(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pairs []string
+	for _, v := range h {
+		pairs = append(pairs, v.Pair)
+	}
+	// newTestStore sessions start on XLM/USDC, TESTNET: the first call
+	// changes nothing.
+	if len(h) != 2 || pairs[0] != "" || pairs[1] != "XLM/EURC" || h[1].Network != "TESTNET" || h[1].Timestamp.IsZero() {
+		t.Fatalf("history = %+v, want the clear then XLM/EURC", h)
+	}
+
+	for i := 0; i < viewHistorySize+5; i++ {
+		s.SetActiveView(tok, fmt.Sprintf("P%d/USDC", i), "")
+	}
+	h, _ = s.GetViewHistory(tok)
+	if len(h) != viewHistorySize || h[0].Pair != fmt.Sprintf("P%d/USDC", viewHistorySize+4) {
+		t.Fatalf("history has %d entries starting %q, want %d starting with the latest", len(h), h[0].Pair, viewHistorySize)
+	}
+	if _, err := s.GetViewHistory("nope"); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("unknown token err = %v", err)
+	}
+}
+
+func TestSinceReplaysRing(t *testing.T) {
+	s, tokens := newTestStore(t, 1)
+	tok := tokens[0]
+	total := logHistorySize + 10
+	for i := 1; i <= total; i++ {
+		s.Publish(tok, LogEntry{Message: fmt.Sprint(i)})
+	}
+
+	tests := []struct {
+		name      string
+		since     uint64
+		limit     int
+		wantFirst uint64
+		wantN     int
+	}{
+		{"from zero starts at oldest buffered", 0, 1000, 11, logHistorySize},
+		{"limit caps the page", 0, 5, 11, 5},
+		{"after since", uint64(total - 3), 1000, uint64(total - 2), 3},
+		{"caught up", uint64(total), 1000, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, latest, err := s.Since(tok, tt.since, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if latest != uint64(total) {
+				t.Errorf("latest = %d, want %d", latest, total)
+			}
+			if len(got) != tt.wantN {
+				t.Fatalf("got %d entries, want %d", len(got), tt.wantN)
+			}
+			for i, e := range got {
+				if want := tt.wantFirst + uint64(i); e.Seq != want || e.Message != fmt.Sprint(want) {
+					t.Fatalf("entry %d = seq %d %q, want seq %d", i, e.Seq, e.Message, want)
+				}
+			}
+		})
+	}
+
+	if _, _, err := s.Since("nope", 0, 10); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("unknown token: err = %v, want ErrUnknownToken", err)
+	}
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is the capacity of each subscriber channel.
+const subscriberBuffer = 64
+
+// maxBacklog caps the entries queued for a subscriber whose channel is full.
+const maxBacklog = 256
+
+// queued is a backlogged entry. A zero deadline never expires.
+type queued struct {
+	entry    LogEntry
+	deadline time.Time
+}
+
+// subscriber is one SSE stream. Publish never waits on it: an entry goes
+// straight into ch while there is room and nothing is queued ahead of it;
+// otherwise it is backlogged (or dropped, per policy) and a pump goroutine
+// feeds the backlog into ch as the reader drains it. ch is closed exactly
+// once, by close or, if a pump is running, by the pump on its way out.
+type subscriber struct {
+	ch     chan LogEntry
+	policy DeliveryPolicy
+	done   chan struct{} // closed by close; wakes a pump blocked on ch
+
+	mu      sync.Mutex
+	backlog []queued
+	pumping bool
+	closed  bool
+}
+
+func newSubscriber(policy DeliveryPolicy) *subscriber {
+	return &subscriber{
+		ch:     make(chan LogEntry, subscriberBuffer),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+}
+
+// offer hands entry to the subscriber without blocking. A routine entry for
+// a DeliveryBlock subscriber may wait in the backlog up to blockTimeout;
+// critical entries wait until delivered.
+func (sub *subscriber) offer(entry LogEntry, blockTimeout time.Duration) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	// The backlog is only non-empty while a pump runs; sending past it
+	// would reorder the stream.
+	if !sub.pumping {
+		select {
+		case sub.ch <- entry:
+			return
+		default:
+		}
+	}
+	q := queued{entry: entry}
+	switch {
+	case entry.Critical():
+	case sub.policy == DeliveryBlock:
+		q.deadline = time.Now().Add(blockTimeout)
+	default:
+		return // routine logs are best-effort
+	}
+	if len(sub.backlog) >= maxBacklog && !sub.evictRoutine() {
+		log.Printf("[store] subscriber backlog full of critical events; dropping %s", entry.EventType)
+		return
+	}
+	sub.backlog = append(sub.backlog, q)
+	if !sub.pumping {
+		sub.pumping = true
+		go sub.pump()
+	}
+}
+
+// evictRoutine removes the oldest non-critical backlog entry, reporting
+// false if every queued entry is critical. Critical entries are never
+// evicted. The caller holds sub.mu.
+func (sub *subscriber) evictRoutine() bool {
+	for i, q := range sub.backlog {
+		if !q.entry.Critical() {
+			sub.backlog = append(sub.backlog[:i], sub.backlog[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// pump moves the backlog into ch, oldest first, until it is empty or the
+// subscriber is closed.
+func (sub *subscriber) pump() {
+	for {
+		sub.mu.Lock()
+		if sub.closed {
+			close(sub.ch)
+			sub.mu.Unlock()
+			return
+		}
+		if len(sub.backlog) == 0 {
+			sub.pumping = false
+			sub.mu.Unlock()
+			return
+		}
+		q := sub.backlog[0]
+		sub.backlog = sub.backlog[1:]
+		sub.mu.Unlock()
+		sub.deliver(q)
+	}
+}
+
+// deliver waits for room in ch for q, giving up at its deadline or when the
+// subscriber is closed.
+func (sub *subscriber) deliver(q queued) {
+	if q.deadline.IsZero() {
+		select {
+		case sub.ch <- q.entry:
+		case <-sub.done:
+		}
+		return
+	}
+	timer := time.NewTimer(time.Until(q.deadline))
+	defer timer.Stop()
+	select {
+	case sub.ch <- q.entry:
+	case <-timer.C: // dropped for this subscriber
+	case <-sub.done:
+	}
+}
+
+// close ends the stream and discards its backlog. It is safe to call more
+// than once.
+func (sub *subscriber) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	sub.backlog = nil
+	close(sub.done)
+	if !sub.pumping {
+		close(sub.ch)
+	}
+}
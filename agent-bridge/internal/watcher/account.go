@@ -1,22 +1,51 @@
 package watcher
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
+	"agent-bridge/internal/horizon"
 	"agent-bridge/internal/store"
 )
 
-const (
+// hz is the shared Horizon client every watcher goes through.
+var hz = horizon.NewClient()
+
+// Horizon base URLs per network. The public endpoints are the defaults;
+// ConfigureHorizon replaces them at startup.
+var (
 	mainnetHorizon = "https://horizon.stellar.org"
 	testnetHorizon = "https://horizon-testnet.stellar.org"
 )
 
+// ConfigureHorizon overrides the MAINNET and TESTNET Horizon base URLs (e.g.
+// a self-hosted Horizon or caching proxy). Empty arguments keep the public
+// default. Must be called before any watcher starts.
+func ConfigureHorizon(mainnet, testnet string) error {
+	for _, o := range []struct {
+		name string
+		raw  string
+		dst  *string
+	}{
+		{"mainnet", mainnet, &mainnetHorizon},
+		{"testnet", testnet, &testnetHorizon},
+	} {
+		if o.raw == "" {
+			continue
+		}
+		u, err := url.Parse(o.raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s Horizon URL %q: want an absolute http(s) URL", o.name, o.raw)
+		}
+		*o.dst = strings.TrimRight(o.raw, "/")
+	}
+	return nil
+}
+
 // HorizonURL returns the Horizon base URL for the given network.
 func HorizonURL(network string) string {
 	if network == "MAINNET" {
@@ -27,26 +56,50 @@ func HorizonURL(network string) string {
 
 // WatchAccount launches a background goroutine that streams new transactions
 // for the given Stellar account via Horizon SSE and publishes context_update
-// events to the SSE log stream. The goroutine stops when ctx is cancelled.
+// events to the SSE log stream, plus a companion poller keeping the account's
+// balances in the context snapshot. The goroutine stops when ctx is cancelled
+// (pass a context derived from Store.TokenContext so token deletion stops it)
+// or when it notices the token no longer exists.
 func WatchAccount(ctx context.Context, s *store.Store, token, accountID, network string) {
+	watchAccount(ctx, hz, HorizonURL(network), s, token, accountID, network)
+}
+
+// watchAccount is WatchAccount against an explicit client and Horizon base.
+func watchAccount(ctx context.Context, c *horizon.Client, base string, s *store.Store, token, accountID, network string) {
+	ctx, cancel := context.WithCancel(ctx)
+	refresh := make(chan struct{}, 1)
+	go pollBalances(ctx, c, base, s, token, accountID, refresh)
 	go func() {
-		base := HorizonURL(network)
-		url := fmt.Sprintf("%s/accounts/%s/transactions?cursor=now&limit=5", base, accountID)
+		defer cancel()
 
 		shortID := accountID
 		if len(shortID) > 8 {
 			shortID = shortID[:8]
 		}
 
+		// cursor starts at "now" and then follows the last event seen, so a
+		// reconnect picks up transactions that landed while disconnected.
+		cursor := "now"
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			default:
 			}
+			if !s.ValidateToken(token) {
+				log.Printf("[account-watcher] %s token gone — stopping", shortID)
+				return
+			}
 
-			err := streamSSE(ctx, url, func(data string) {
-				if data == "" || data == `"hello"` {
+			streamURL := base + "/accounts/" + url.PathEscape(accountID) +
+				"/transactions?" + url.Values{"cursor": {cursor}, "limit": {"5"}}.Encode()
+			lastID, err := horizonSSE(ctx, c, streamURL, func(_, data string) {
+				if data == "" {
+					return
+				}
+				if !s.ValidateToken(token) {
+					cancel() // token deleted mid-stream; unwind the stream
 					return
 				}
 				txID := extractJSONString(data, "id")
@@ -70,8 +123,15 @@ func WatchAccount(ctx context.Context, s *store.Store, token, accountID, network
 					Source:    "system",
 					EventType: "context_update",
 				})
+				select {
+				case refresh <- struct{}{}:
+				default: // a refresh is already pending
+				}
 			})
 
+			if lastID != "" {
+				cursor = lastID
+			}
 			if err != nil && ctx.Err() == nil {
 				log.Printf("[account-watcher] %s SSE error: %v — retry in 5s", shortID, err)
 				select {
@@ -84,37 +144,6 @@ func WatchAccount(ctx context.Context, s *store.Store, token, accountID, network
 	}()
 }
 
-// streamSSE opens a Horizon SSE endpoint and calls onData for each data line.
-// Returns when the stream ends or ctx is cancelled.
-func streamSSE(ctx context.Context, url string, onData func(string)) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Accept", "text/event-stream")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	scanner := bufio.NewScanner(resp.Body)
-	buf := make([]byte, 512*1024)
-	scanner.Buffer(buf, cap(buf))
-
-	for scanner.Scan() {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		line := scanner.Text()
-		if strings.HasPrefix(line, "data: ") {
-			onData(strings.TrimPrefix(line, "data: "))
-		}
-	}
-	return scanner.Err()
-}
-
 // extractJSONString pulls the string value for a given key from raw JSON,
 // avoiding the need to fully unmarshal large transaction payloads.
 func extractJSONString(js, key string) string {
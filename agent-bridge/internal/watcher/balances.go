@@ -0,0 +1,71 @@
+package watcher
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"agent-bridge/internal/horizon"
+	"agent-bridge/internal/store"
+)
+
+// balanceInterval is how often a watched account's balances are refreshed
+// when no transaction prompts it sooner.
+var balanceInterval = 30 * time.Second
+
+// pollBalances keeps the token's balances and trustlines snapshot current: once at start,
+// on every tick of balanceInterval and whenever refresh fires (the account
+// watcher signals it on each context_update). Returns when ctx is done.
+func pollBalances(ctx context.Context, c *horizon.Client, base string, s *store.Store, token, accountID string, refresh <-chan struct{}) {
+	ticker := time.NewTicker(balanceInterval)
+	defer ticker.Stop()
+	for {
+		balances, err := c.AccountBalances(ctx, base, accountID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[account-watcher] balances for %s: %v", accountID, err)
+		} else {
+			s.SetHoldings(token, accountID, balanceRecords(balances), trustlineRecords(balances))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-refresh:
+		}
+	}
+}
+
+// balanceRecords flattens Horizon balances into the store's shape. An
+// unfunded account yields an empty (non-nil) slice.
+func balanceRecords(balances []horizon.Balance) []store.BalanceRecord {
+	out := make([]store.BalanceRecord, 0, len(balances))
+	for _, b := range balances {
+		asset := "XLM"
+		switch b.AssetType {
+		case "native":
+		case "liquidity_pool_shares":
+			asset = "pool:" + b.PoolID
+		default:
+			asset = b.AssetCode + ":" + b.AssetIssuer
+		}
+		out = append(out, store.BalanceRecord{Asset: asset, Balance: b.Balance})
+	}
+	return out
+}
+
+// trustlineRecords picks the credit-asset trustlines out of Horizon balances.
+// Pool-share trustlines are left out: they can't receive a payment.
+func trustlineRecords(balances []horizon.Balance) []store.TrustlineRecord {
+	out := make([]store.TrustlineRecord, 0, len(balances))
+	for _, b := range balances {
+		if b.AssetType != "credit_alphanum4" && b.AssetType != "credit_alphanum12" {
+			continue
+		}
+		out = append(out, store.TrustlineRecord{Code: b.AssetCode, Issuer: b.AssetIssuer, Limit: b.Limit})
+	}
+	return out
+}
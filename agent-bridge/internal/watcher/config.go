@@ -0,0 +1,42 @@
+package watcher
+
+import "time"
+
+// Config is the watchers' settings, applied by Configure. Zero values keep
+// the defaults.
+type Config struct {
+	// HorizonMainnet and HorizonTestnet override the public Horizon base
+	// URLs; see ConfigureHorizon.
+	HorizonMainnet string
+	HorizonTestnet string
+	// PollIntervals is the order-book poll interval per network; a network
+	// left out polls every DefaultPollInterval.
+	PollIntervals     map[string]time.Duration
+	AdaptivePolling   bool
+	PriceMode         PriceMode // empty = PriceMid
+	WallConfirmations int       // 0 = DefaultWallConfirmations
+}
+
+// Configure applies cfg. Call before any watcher starts.
+func Configure(cfg Config) error {
+	if err := ConfigureHorizon(cfg.HorizonMainnet, cfg.HorizonTestnet); err != nil {
+		return err
+	}
+	for network, d := range cfg.PollIntervals {
+		if err := SetPollInterval(network, d); err != nil {
+			return err
+		}
+	}
+	if cfg.PriceMode == "" {
+		cfg.PriceMode = PriceMid
+	}
+	if err := SetPriceMode(cfg.PriceMode); err != nil {
+		return err
+	}
+	if cfg.WallConfirmations == 0 {
+		cfg.WallConfirmations = DefaultWallConfirmations
+	}
+	SetAdaptivePolling(cfg.AdaptivePolling)
+	Insights.SetWallConfirmations(cfg.WallConfirmations)
+	return nil
+}
@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeHorizon is an httptest server serving canned Horizon responses:
+// /order_book (one body per poll, the last repeating), an SSE stream for
+// /accounts/{id}/transactions, /accounts/{id}/offers, /accounts/{id}/trades
+// and /accounts/{id} (404 until account is set, like an unfunded account).
+type fakeHorizon struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	books   []string   // successive /order_book bodies
+	txs     []sseEvent // events sent on each transactions stream
+	offers  string
+	trades  string
+	account string // /accounts/{id} body; "" serves 404
+}
+
+type sseEvent struct {
+	id   string
+	data string
+}
+
+func newFakeHorizon(t *testing.T) *fakeHorizon {
+	t.Helper()
+	f := &fakeHorizon{offers: `{"_embedded":{"records":[]}}`, trades: `{"_embedded":{"records":[]}}`}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeHorizon) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/order_book":
+		f.mu.Lock()
+		body := `{"bids":[],"asks":[]}`
+		if len(f.books) > 0 {
+			body = f.books[0]
+			if len(f.books) > 1 {
+				f.books = f.books[1:]
+			}
+		}
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+
+	case strings.HasPrefix(r.URL.Path, "/accounts/") && strings.HasSuffix(r.URL.Path, "/transactions"):
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "retry: 1000\nevent: open\ndata: \"hello\"\n\n")
+		f.mu.Lock()
+		for _, ev := range f.txs {
+			fmt.Fprintf(w, "id: %s\ndata: %s\n\n", ev.id, ev.data)
+		}
+		f.mu.Unlock()
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // hold the stream open like Horizon does
+
+	case strings.HasPrefix(r.URL.Path, "/accounts/") && strings.HasSuffix(r.URL.Path, "/offers"):
+		w.Header().Set("Content-Type", "application/json")
+		f.mu.Lock()
+		fmt.Fprint(w, f.offers)
+		f.mu.Unlock()
+
+	case strings.HasPrefix(r.URL.Path, "/accounts/") && strings.HasSuffix(r.URL.Path, "/trades"):
+		w.Header().Set("Content-Type", "application/json")
+		f.mu.Lock()
+		fmt.Fprint(w, f.trades)
+		f.mu.Unlock()
+
+	case strings.HasPrefix(r.URL.Path, "/accounts/") && strings.Count(r.URL.Path, "/") == 2:
+		f.mu.Lock()
+		body := f.account
+		f.mu.Unlock()
+		if body == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// book renders an /order_book body with a single level per side.
+func book(bid, bidAmt, ask, askAmt float64) string {
+	return fmt.Sprintf(`{"bids":[{"price":"%g","amount":"%g"}],"asks":[{"price":"%g","amount":"%g"}]}`,
+		bid, bidAmt, ask, askAmt)
+}
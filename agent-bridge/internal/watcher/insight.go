@@ -0,0 +1,216 @@
+package watcher
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// pairState holds the last-known reference price (mid or microprice, see
+// SetPriceMode) and top-of-book sizes for one pair.
+type pairState struct {
+	mid    float64 // last two-sided reading; kept while the book is one-sided
+	topBid float64
+	topAsk float64
+	// missing is the side absent from the last book: "bid", "ask", "both"
+	// or "" when two-sided.
+	missing string
+
+	updatedAt     time.Time
+	lastInsight   string
+	lastInsightAt time.Time
+
+	bidWall wallTrack
+	askWall wallTrack
+}
+
+const (
+	// wallRemovedRatio: a side whose size falls below this share of its
+	// reference size counts as a removed wall.
+	wallRemovedRatio = 0.5
+	// wallRebuiltRatio: after an alert, the side must recover to this share
+	// of its reference size before the same wall can alert again.
+	wallRebuiltRatio = 0.8
+	// DefaultWallConfirmations is how many consecutive polls a wall must
+	// stay removed before the insight fires.
+	DefaultWallConfirmations = 2
+)
+
+// wallTrack debounces wall-removal insights for one side of a book.
+type wallTrack struct {
+	ref     float64 // size the wall is measured against
+	pending int     // consecutive polls the wall has been below wallRemovedRatio
+	alerted bool    // alert sent; suppressed until the wall is rebuilt
+}
+
+// WallState is a wallTrack as reported to admins.
+type WallState struct {
+	Reference float64 `json:"reference"`
+	Pending   int     `json:"pending"`
+	Alerted   bool    `json:"alerted"`
+}
+
+// InsightState is the order-book watcher's memory of each pair, keyed by
+// network and pair label. It outlives the polling goroutines so a restarted or
+// reconfigured poller compares against the same baseline, and so admins can
+// see why an insight did or didn't fire.
+type InsightState struct {
+	mu      sync.Mutex
+	pairs   map[insightKey]*pairState
+	confirm int // polls a wall must stay removed before alerting
+}
+
+type insightKey struct {
+	network string
+	symbol  string
+}
+
+// Insights is the state shared by every WatchOrderBooks poller.
+var Insights = NewInsightState()
+
+// NewInsightState returns an empty InsightState.
+func NewInsightState() *InsightState {
+	return &InsightState{
+		pairs:   make(map[insightKey]*pairState),
+		confirm: DefaultWallConfirmations,
+	}
+}
+
+// SetWallConfirmations sets how many consecutive polls a wall must stay
+// removed before its insight fires. Values below 1 are treated as 1 (fire
+// on the first poll, the old behaviour).
+func (is *InsightState) SetWallConfirmations(n int) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	is.confirm = max(n, 1)
+}
+
+// wallStep advances the debounce for one side of a pair given its current
+// top-of-book size. fire reports that an alert should go out now, with from
+// the size the wall had before it was pulled; a side smaller than minWall
+// was never a wall and doesn't alert when it shrinks.
+func (is *InsightState) wallStep(network, symbol, side string, size, minWall float64) (fire bool, from float64) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	st, ok := is.pairs[insightKey{network, symbol}]
+	if !ok {
+		return false, 0
+	}
+	w := &st.bidWall
+	if side == "ask" {
+		w = &st.askWall
+	}
+
+	switch {
+	case w.ref <= 0:
+		w.ref = size
+	case w.alerted:
+		if size >= w.ref*wallRebuiltRatio {
+			*w = wallTrack{ref: size}
+		}
+	case size < w.ref*wallRemovedRatio && w.ref >= minWall:
+		w.pending++
+		if w.pending >= is.confirm {
+			w.alerted, w.pending = true, 0
+			return true, w.ref
+		}
+	default:
+		// Wall present (or back before confirmation): follow its size.
+		w.ref, w.pending = size, 0
+	}
+	return false, 0
+}
+
+// InsightEntry is one pair's state as reported to admins.
+type InsightEntry struct {
+	Network       string    `json:"network"`
+	Symbol        string    `json:"symbol"`
+	Mid           float64   `json:"mid"` // reference price: mid or microprice
+	TopBid        float64   `json:"topBid"`
+	TopAsk        float64   `json:"topAsk"`
+	MissingSide   string    `json:"missingSide,omitempty"` // "bid" | "ask" | "both" while one-sided
+	UpdatedAt     time.Time `json:"updatedAt"`
+	LastInsight   string    `json:"lastInsight,omitempty"`
+	LastInsightAt time.Time `json:"lastInsightAt,omitzero"`
+	BidWall       WallState `json:"bidWall"`
+	AskWall       WallState `json:"askWall"`
+}
+
+// get returns a copy of the pair's state.
+func (is *InsightState) get(network, symbol string) (pairState, bool) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	st, ok := is.pairs[insightKey{network, symbol}]
+	if !ok {
+		return pairState{}, false
+	}
+	return *st, true
+}
+
+// update records a fresh observation, keeping the pair's last insight.
+func (is *InsightState) update(network, symbol string, mid, topBid, topAsk float64, missing string, at time.Time) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	k := insightKey{network, symbol}
+	st, ok := is.pairs[k]
+	if !ok {
+		st = &pairState{}
+		is.pairs[k] = st
+	}
+	st.mid, st.topBid, st.topAsk, st.missing, st.updatedAt = mid, topBid, topAsk, missing, at
+}
+
+// noteInsight records the most recent insight sent to at least one token
+// for a pair.
+func (is *InsightState) noteInsight(network, symbol, msg string, at time.Time) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	if st, ok := is.pairs[insightKey{network, symbol}]; ok {
+		st.lastInsight, st.lastInsightAt = msg, at
+	}
+}
+
+// Snapshot returns every tracked pair, sorted by network then symbol.
+func (is *InsightState) Snapshot() []InsightEntry {
+	is.mu.Lock()
+	out := make([]InsightEntry, 0, len(is.pairs))
+	for k, st := range is.pairs {
+		out = append(out, InsightEntry{
+			Network:       k.network,
+			Symbol:        k.symbol,
+			Mid:           st.mid,
+			TopBid:        st.topBid,
+			TopAsk:        st.topAsk,
+			MissingSide:   st.missing,
+			UpdatedAt:     st.updatedAt,
+			LastInsight:   st.lastInsight,
+			LastInsightAt: st.lastInsightAt,
+			BidWall:       WallState{st.bidWall.ref, st.bidWall.pending, st.bidWall.alerted},
+			AskWall:       WallState{st.askWall.ref, st.askWall.pending, st.askWall.alerted},
+		})
+	}
+	is.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Network != out[j].Network {
+			return out[i].Network < out[j].Network
+		}
+		return out[i].Symbol < out[j].Symbol
+	})
+	return out
+}
+
+// Reset forgets matching pairs so the next poll re-establishes a baseline
+// without firing. Empty network or symbol match everything. It returns how
+// many pairs were cleared.
+func (is *InsightState) Reset(network, symbol string) int {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	n := 0
+	for k := range is.pairs {
+		if (network == "" || k.network == network) && (symbol == "" || k.symbol == symbol) {
+			delete(is.pairs, k)
+			n++
+		}
+	}
+	return n
+}
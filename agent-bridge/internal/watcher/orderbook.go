@@ -2,14 +2,16 @@ package watcher
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
-	"net/http"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
+	"agent-bridge/internal/horizon"
 	"agent-bridge/internal/store"
 )
 
@@ -20,8 +22,27 @@ type assetPair struct {
 	buyingCode   string
 	buyingIssuer string
 	label        string
+	base         assetMeta // the selling asset, which book amounts are in
 }
 
+// assetMeta is how amounts of an asset are shown and judged in insights.
+type assetMeta struct {
+	code     string // shown after amounts, e.g. "XLM"
+	decimals int    // decimals amounts are shown with
+	// minWall is the smallest top-of-book size, in this asset, that counts
+	// as a wall: a thinner side is noise, and its removal isn't reported.
+	// For a high-value asset it is correspondingly small.
+	minWall float64
+}
+
+// format renders amount in the asset's units, e.g. "5000 XLM".
+func (m assetMeta) format(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', m.decimals, 64) + " " + m.code
+}
+
+// xlm is the native asset: whole lumens are precise enough for book sizes.
+var xlm = assetMeta{code: "XLM", decimals: 0, minWall: 1000}
+
 // monitoredPairs defines which order books to watch per network.
 var monitoredPairs = map[string][]assetPair{
 	"TESTNET": {
@@ -31,6 +52,7 @@ var monitoredPairs = map[string][]assetPair{
 			buyingCode:   "USDC",
 			buyingIssuer: "GBBD47IF6LWK7P7MDEVSCWR7DPUWV3NY3DTQEVFL4NAT4AQH3ZLLFLA5",
 			label:        "XLM/USDC",
+			base:         xlm,
 		},
 	},
 	"MAINNET": {
@@ -40,6 +62,7 @@ var monitoredPairs = map[string][]assetPair{
 			buyingCode:   "USDC",
 			buyingIssuer: "GA5ZSEJYB37JRC5AVCIA5MOP4RHTM335X2KGX3IHOJAPP5RE34K4KZVN",
 			label:        "XLM/USDC",
+			base:         xlm,
 		},
 		{
 			sellingType:  "native",
@@ -47,31 +70,156 @@ var monitoredPairs = map[string][]assetPair{
 			buyingCode:   "EURC",
 			buyingIssuer: "GDHU6WRG4IEQXM5NZ4BMPKOXHW76MZM4Y2IEMFDVXBSDP6SJY4ITNPP",
 			label:        "XLM/EURC",
+			base:         xlm,
 		},
 	},
 }
 
-type obLevel struct {
-	Price  string `json:"price"`
-	Amount string `json:"amount"`
+// MonitoredSymbols returns the unique pair labels watched across all networks,
+// sorted. The matching engine uses this as its default tradable allowlist so
+// the two stay consistent.
+func MonitoredSymbols() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, pairs := range monitoredPairs {
+		for _, p := range pairs {
+			if !seen[p.label] {
+				seen[p.label] = true
+				out = append(out, p.label)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
 }
 
-type horizonOrderBook struct {
-	Bids []obLevel `json:"bids"`
-	Asks []obLevel `json:"asks"`
+// ── Poll interval ────────────────────────────────────────────────────────────
+
+// DefaultPollInterval is how often a network's order books are polled unless
+// SetPollInterval says otherwise.
+const DefaultPollInterval = 10 * time.Second
+
+const (
+	idleRoundsBeforeBackoff = 3 // unchanged rounds before the adaptive poller slows down
+	maxBackoffFactor        = 4 // adaptive interval never exceeds 4× the configured one
+)
+
+var (
+	pollMu        sync.Mutex
+	pollIntervals = map[string]time.Duration{}
+	adaptivePoll  bool
+)
+
+// SetPollInterval sets the order-book poll interval for a network. It may be
+// called while the watcher runs; the poller picks the new value up on its
+// next tick.
+func SetPollInterval(network string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s poll interval must be positive, got %s", network, d)
+	}
+	pollMu.Lock()
+	pollIntervals[network] = d
+	pollMu.Unlock()
+	return nil
+}
+
+// PollInterval returns the configured poll interval for a network.
+func PollInterval(network string) time.Duration {
+	pollMu.Lock()
+	defer pollMu.Unlock()
+	if d, ok := pollIntervals[network]; ok {
+		return d
+	}
+	return DefaultPollInterval
 }
 
-// pairState holds the last-known mid-price and top-of-book sizes for one pair.
-type pairState struct {
-	mid    float64
-	topBid float64
-	topAsk float64
+// SetAdaptivePolling turns on backoff: after a few rounds in which no book
+// changed the interval doubles (up to 4× the configured one), and it drops
+// back to the configured interval as soon as a book changes.
+func SetAdaptivePolling(on bool) {
+	pollMu.Lock()
+	adaptivePoll = on
+	pollMu.Unlock()
+}
+
+// nextInterval returns the interval for the next round given how many rounds
+// in a row saw no change.
+func nextInterval(network string, idleRounds int) time.Duration {
+	base := PollInterval(network)
+	pollMu.Lock()
+	adaptive := adaptivePoll
+	pollMu.Unlock()
+	if !adaptive || idleRounds < idleRoundsBeforeBackoff {
+		return base
+	}
+	factor := 1 << min(idleRounds-idleRoundsBeforeBackoff+1, 2) // 2×, then 4×
+	return base * time.Duration(min(factor, maxBackoffFactor))
 }
 
-// WatchOrderBooks polls both order books for the given network every 10 seconds
-// and publishes insight events to all connected tokens when:
-//   - the mid-price moves more than 0.5%
-//   - a top-of-book wall shrinks by more than 50%
+// ── Reference price ──────────────────────────────────────────────────────────
+
+// PriceMode selects how a book's top of book is reduced to one price for the
+// price-move insight and the OnReferencePrice feed.
+type PriceMode string
+
+const (
+	// PriceMid is the plain mid, (bid + ask) / 2.
+	PriceMid PriceMode = "mid"
+	// PriceMicro is the size-weighted mid,
+	// (bid × askSize + ask × bidSize) / (bidSize + askSize): the deeper the
+	// bid queue relative to the ask, the closer it sits to the ask.
+	PriceMicro PriceMode = "microprice"
+)
+
+var (
+	priceMode     = PriceMid
+	priceListener func(network, symbol string, price float64)
+)
+
+// SetPriceMode selects the reference price. It may be called while the
+// watcher runs.
+func SetPriceMode(mode PriceMode) error {
+	if mode != PriceMid && mode != PriceMicro {
+		return fmt.Errorf("unknown price mode %q (want %q or %q)", mode, PriceMid, PriceMicro)
+	}
+	pollMu.Lock()
+	priceMode = mode
+	pollMu.Unlock()
+	return nil
+}
+
+// OnReferencePrice registers fn to receive each changed book's reference
+// price, e.g. to feed the matching engine's mark price. nil unregisters.
+func OnReferencePrice(fn func(network, symbol string, price float64)) {
+	pollMu.Lock()
+	priceListener = fn
+	pollMu.Unlock()
+}
+
+// referencePrice reduces a top of book to one price under the current mode.
+// The microprice falls back to the mid when either size is unknown.
+func referencePrice(bid, ask, bidSize, askSize float64) float64 {
+	pollMu.Lock()
+	mode := priceMode
+	pollMu.Unlock()
+	if mode == PriceMicro && bidSize > 0 && askSize > 0 {
+		return microprice(bid, ask, bidSize, askSize)
+	}
+	return (ask + bid) / 2.0
+}
+
+// microprice is the size-weighted mid of a top of book.
+func microprice(bid, ask, bidSize, askSize float64) float64 {
+	return (bid*askSize + ask*bidSize) / (bidSize + askSize)
+}
+
+// WatchOrderBooks polls both order books for the given network (every
+// PollInterval, 10 seconds by default) and publishes insight events to all
+// connected tokens when:
+//   - the reference price (mid or microprice, see SetPriceMode) moves more
+//     than 0.5%
+//   - a top-of-book wall shrinks by more than 50% and stays down for the
+//     configured number of polls (see InsightState.SetWallConfirmations)
 //
 // The goroutine stops when ctx is cancelled.
 func WatchOrderBooks(ctx context.Context, s *store.Store, network string) {
@@ -81,108 +229,212 @@ func WatchOrderBooks(ctx context.Context, s *store.Store, network string) {
 	}
 
 	go func() {
-		states := make(map[string]*pairState, len(pairs))
-		ticker := time.NewTicker(10 * time.Second)
+		interval := nextInterval(network, 0)
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
+		// Unchanged-book counters, logged every cacheLogEvery polls.
+		var polls, unchanged, idleRounds int
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
+				roundChanged := false
 				for _, pair := range pairs {
-					pollPair(ctx, s, network, pair, states)
+					ok, changed := pollPair(ctx, hz, HorizonURL(network), s, network, pair, Insights)
+					if !ok {
+						continue
+					}
+					polls++
+					if changed {
+						roundChanged = true
+					} else {
+						unchanged++
+					}
+				}
+				if roundChanged {
+					idleRounds = 0
+				} else {
+					idleRounds++
+				}
+				// Reset rather than replace the ticker so a pending tick from
+				// the old interval can't fire on a stale channel.
+				if next := nextInterval(network, idleRounds); next != interval {
+					log.Printf("[orderbook-watcher] %s poll interval %s → %s", network, interval, next)
+					interval = next
+					ticker.Reset(interval)
+				}
+				if polls >= cacheLogEvery {
+					log.Printf("[orderbook-watcher] %s cache hit rate %.0f%% (%d/%d polls unchanged)",
+						network, 100*float64(unchanged)/float64(polls), unchanged, polls)
+					polls, unchanged = 0, 0
 				}
 			}
 		}
 	}()
 }
 
-func pollPair(ctx context.Context, s *store.Store, network string, pair assetPair, states map[string]*pairState) {
-	base := HorizonURL(network)
-	url := fmt.Sprintf(
-		"%s/order_book?selling_asset_type=%s&buying_asset_type=%s&buying_asset_code=%s&buying_asset_issuer=%s&limit=10",
-		base, pair.sellingType, pair.buyingType, pair.buyingCode, pair.buyingIssuer,
-	)
+// cacheLogEvery is how many successful polls pass between hit-rate log lines.
+const cacheLogEvery = 60
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return
+// pollPair fetches one pair's book and fires insights against its previous
+// state. ok is false when the poll failed; changed is false when Horizon
+// reported (or the body hash showed) the book is unchanged, in which case
+// nothing is decoded or evaluated. A malformed book also fails the poll,
+// leaving the pair's state as it was.
+func pollPair(ctx context.Context, c *horizon.Client, base string, s *store.Store, network string, pair assetPair, states *InsightState) (ok, changed bool) {
+	ob, changed, err := c.OrderBookIfChanged(ctx, base,
+		horizon.Asset{Type: pair.sellingType},
+		horizon.Asset{Type: pair.buyingType, Code: pair.buyingCode, Issuer: pair.buyingIssuer},
+		10)
+	if errors.Is(err, horizon.ErrMalformed) {
+		// Skip the tick and keep the pair's state: a bad field must not
+		// read as an emptied side or a pulled wall.
+		log.Printf("[orderbook-watcher] %s %s: skipping poll: %v", network, pair.label, err)
+		return false, false
 	}
-
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	var ob horizonOrderBook
-	if err := json.NewDecoder(resp.Body).Decode(&ob); err != nil {
-		return
+		return false, false
 	}
-	if len(ob.Asks) == 0 || len(ob.Bids) == 0 {
-		return
+	if !changed {
+		// The walls may still be pending confirmation: an unchanged book is
+		// another poll on which they stayed removed.
+		recheckWalls(s, network, pair, states)
+		return true, false
 	}
+	evaluateBook(s, network, pair, ob, states)
+	return true, true
+}
 
-	askF, err1 := strconv.ParseFloat(ob.Asks[0].Price, 64)
-	bidF, err2 := strconv.ParseFloat(ob.Bids[0].Price, 64)
-	if err1 != nil || err2 != nil {
-		return
+// publishFunc publishes one insight about a pair. kind names the signal
+// ("price_move", "bid_wall", ...) and, with the pair, keys the per-token
+// cool-down; magnitude is its size, so a much larger one can break through.
+type publishFunc func(kind string, magnitude float64, msg string)
+
+// insightPublisher returns a publishFunc that logs msg, broadcasts it to
+// every token not cooling down on that kind of insight for the pair and, if
+// any token was sent it, records it as the pair's last insight.
+func insightPublisher(s *store.Store, states *InsightState, network, symbol string, at time.Time) publishFunc {
+	return func(kind string, magnitude float64, msg string) {
+		log.Println(msg)
+		sent := s.PublishInsight(store.LogEntry{
+			Message:   msg,
+			Source:    "insight",
+			EventType: "insight",
+		}, kind+":"+network+":"+symbol, magnitude)
+		if sent > 0 {
+			states.noteInsight(network, symbol, msg, at)
+		}
 	}
-	mid := (askF + bidF) / 2.0
+}
 
-	topBidAmt, _ := strconv.ParseFloat(ob.Bids[0].Amount, 64)
-	topAskAmt, _ := strconv.ParseFloat(ob.Asks[0].Amount, 64)
+// evaluateBook compares a fresh book with the pair's previous state and
+// publishes any insights. A one-sided book still records the side it has and
+// keeps the last two-sided price, so a move across the gap is caught when
+// the missing side returns; the change to and from one-sided is itself an
+// insight.
+func evaluateBook(s *store.Store, network string, pair assetPair, ob *horizon.OrderBook, states *InsightState) {
+	bidF, topBidAmt, hasBid := topLevel(ob.Bids)
+	askF, topAskAmt, hasAsk := topLevel(ob.Asks)
+	missing := missingSide(hasBid, hasAsk)
 
-	key := pair.label
-	prev, seen := states[key]
+	now := time.Now()
+	prev, seen := states.get(network, pair.label)
+	mid := prev.mid
+	if missing == "" {
+		mid = referencePrice(bidF, askF, topBidAmt, topAskAmt)
+		pollMu.Lock()
+		listener := priceListener
+		pollMu.Unlock()
+		if listener != nil {
+			listener(network, pair.label, mid)
+		}
+	}
+	states.update(network, pair.label, mid, topBidAmt, topAskAmt, missing, now)
+	publish := insightPublisher(s, states, network, pair.label, now)
 	if !seen {
-		states[key] = &pairState{mid: mid, topBid: topBidAmt, topAsk: topAskAmt}
+		checkWalls(states, network, pair, topBidAmt, topAskAmt, missing, publish) // seeds the wall references
 		return
 	}
 
-	// Price-move insight: fire if mid moves ≥ 0.5%.
-	if prev.mid > 0 {
+	switch {
+	case missing == prev.missing:
+	case missing == "both":
+		publish("book_empty", 0, fmt.Sprintf("[Insight] %s %s order book is empty", network, pair.label))
+	case missing != "":
+		publish("book_no_"+missing, 0, fmt.Sprintf("[Insight] %s %s order book became one-sided: no %ss", network, pair.label, missing))
+	default:
+		publish("book_recovered", 0, fmt.Sprintf("[Insight] %s %s order book recovered: both sides quoted at %.6f", network, pair.label, mid))
+	}
+
+	// Price-move insight: fire if the reference price moves ≥ 0.5%.
+	if missing == "" && prev.mid > 0 {
 		pct := math.Abs((mid-prev.mid)/prev.mid) * 100
 		if pct >= 0.5 {
-			msg := fmt.Sprintf(
+			publish("price_move", pct, fmt.Sprintf(
 				"[Insight] %s %s price moved %.2f%% → %.6f (was %.6f)",
 				network, pair.label, pct, mid, prev.mid,
-			)
-			log.Println(msg)
-			s.PublishAll(store.LogEntry{
-				Message:   msg,
-				Source:    "insight",
-				EventType: "insight",
-			})
+			))
 		}
 	}
 
-	// Wall-removal insight: fire if top-of-book size drops ≥ 50%.
-	if prev.topBid > 0 && topBidAmt < prev.topBid*0.5 {
-		msg := fmt.Sprintf(
-			"[Insight] %s %s large bid wall removed (%.0f → %.0f XLM)",
-			network, pair.label, prev.topBid, topBidAmt,
-		)
-		log.Println(msg)
-		s.PublishAll(store.LogEntry{
-			Message:   msg,
-			Source:    "insight",
-			EventType: "insight",
-		})
+	checkWalls(states, network, pair, topBidAmt, topAskAmt, missing, publish)
+}
+
+// topLevel parses the best level of one side of a book; ok is false when the
+// side is empty. The client has already rejected books with a malformed
+// level, so a parse error here can't pass for an empty side or a 0-size wall.
+func topLevel(levels []horizon.PriceLevel) (price, amount float64, ok bool) {
+	if len(levels) == 0 {
+		return 0, 0, false
 	}
-	if prev.topAsk > 0 && topAskAmt < prev.topAsk*0.5 {
-		msg := fmt.Sprintf(
-			"[Insight] %s %s large ask wall removed (%.0f → %.0f XLM)",
-			network, pair.label, prev.topAsk, topAskAmt,
-		)
-		log.Println(msg)
-		s.PublishAll(store.LogEntry{
-			Message:   msg,
-			Source:    "insight",
-			EventType: "insight",
-		})
+	price, amount, err := levels[0].Parse()
+	return price, amount, err == nil
+}
+
+// missingSide names the absent side of a book: "bid", "ask", "both" or "".
+func missingSide(hasBid, hasAsk bool) string {
+	switch {
+	case !hasBid && !hasAsk:
+		return "both"
+	case !hasBid:
+		return "bid"
+	case !hasAsk:
+		return "ask"
+	}
+	return ""
+}
+
+// recheckWalls re-runs wall confirmation against the pair's last known sizes.
+func recheckWalls(s *store.Store, network string, pair assetPair, states *InsightState) {
+	st, ok := states.get(network, pair.label)
+	if !ok {
+		return
 	}
+	checkWalls(states, network, pair, st.topBid, st.topAsk, st.missing,
+		insightPublisher(s, states, network, pair.label, time.Now()))
+}
 
-	states[key] = &pairState{mid: mid, topBid: topBidAmt, topAsk: topAskAmt}
+// checkWalls fires a wall-removal insight once a top-of-book side has stayed
+// below half its former size for the configured number of polls. A missing
+// side is skipped: its absence is reported as the book going one-sided.
+// Sizes are in the pair's base asset, and only a side of at least its
+// minWall is treated as a wall.
+func checkWalls(states *InsightState, network string, pair assetPair, topBid, topAsk float64, missing string, publish publishFunc) {
+	for _, side := range []struct {
+		name string
+		size float64
+	}{{"bid", topBid}, {"ask", topAsk}} {
+		if missing == side.name || missing == "both" {
+			continue
+		}
+		if fire, from := states.wallStep(network, pair.label, side.name, side.size, pair.base.minWall); fire {
+			publish(side.name+"_wall", from-side.size, fmt.Sprintf(
+				"[Insight] %s %s large %s wall removed (%s → %s)",
+				network, pair.label, side.name,
+				strconv.FormatFloat(from, 'f', pair.base.decimals, 64), pair.base.format(side.size),
+			))
+		}
+	}
 }
@@ -0,0 +1,26 @@
+package watcher
+
+import (
+	"context"
+
+	"agent-bridge/internal/horizon"
+)
+
+// HorizonSSE consumes one Horizon SSE connection at streamURL, calling onEvent
+// with each event's name and data. The "hello" heartbeat is filtered out. It
+// returns the id (paging token) of the last event seen, or "" if none, so the
+// caller can reconnect with cursor=<id>, together with the error that ended
+// the stream.
+func HorizonSSE(ctx context.Context, streamURL string, onEvent func(eventName, data string)) (lastID string, err error) {
+	return horizonSSE(ctx, hz, streamURL, onEvent)
+}
+
+func horizonSSE(ctx context.Context, c *horizon.Client, streamURL string, onEvent func(eventName, data string)) (lastID string, err error) {
+	err = c.Stream(ctx, streamURL, func(ev horizon.Event) {
+		if ev.ID != "" {
+			lastID = ev.ID
+		}
+		onEvent(ev.Name, ev.Data)
+	})
+	return lastID, err
+}
@@ -0,0 +1,119 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"agent-bridge/internal/horizon"
+	"agent-bridge/internal/store"
+)
+
+// summaryLimit caps the offers a live account fetch returns; trades are
+// capped at store.MaxRecentTrades, like the cached ones.
+const summaryLimit = 20
+
+// AccountParts selects what FetchAccount reads from Horizon.
+type AccountParts struct {
+	Holdings bool // balances and trustlines
+	Offers   bool
+	Trades   bool
+}
+
+// AccountState is a live read of an account, in the store's record shapes.
+// A part that was not requested, or whose fetch failed, is nil.
+type AccountState struct {
+	Balances     []store.BalanceRecord
+	Trustlines   []store.TrustlineRecord
+	OpenOffers   []store.OfferRecord
+	RecentTrades []store.TradeRecord
+}
+
+// FetchAccount reads the requested parts of accountID straight from
+// network's Horizon, for callers that can't wait for the watcher to cache
+// them. Parts are fetched independently: on error the state still holds
+// every part that succeeded.
+func FetchAccount(ctx context.Context, accountID, network string, parts AccountParts) (AccountState, error) {
+	return fetchAccount(ctx, hz, HorizonURL(network), accountID, parts)
+}
+
+// fetchAccount is FetchAccount against an explicit client and Horizon base.
+func fetchAccount(ctx context.Context, c *horizon.Client, base, accountID string, parts AccountParts) (AccountState, error) {
+	var st AccountState
+	var errs []error
+	if parts.Holdings {
+		balances, err := c.AccountBalances(ctx, base, accountID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("balances: %w", err))
+		} else {
+			st.Balances, st.Trustlines = balanceRecords(balances), trustlineRecords(balances)
+		}
+	}
+	if parts.Offers {
+		offers, err := c.AccountOffers(ctx, base, accountID, summaryLimit)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("offers: %w", err))
+		} else {
+			st.OpenOffers = offerRecords(offers)
+		}
+	}
+	if parts.Trades {
+		trades, err := c.AccountTrades(ctx, base, accountID, store.MaxRecentTrades)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("trades: %w", err))
+		} else {
+			st.RecentTrades = tradeRecords(trades)
+		}
+	}
+	return st, errors.Join(errs...)
+}
+
+// assetName is "XLM" for lumens and the asset code otherwise; Horizon's
+// offer and trade records don't carry the issuer in this client's shape.
+func assetName(assetType, code string) string {
+	if assetType == "native" {
+		return "XLM"
+	}
+	return code
+}
+
+// offerRecords converts Horizon offers; never nil.
+func offerRecords(offers []horizon.Offer) []store.OfferRecord {
+	out := make([]store.OfferRecord, 0, len(offers))
+	for _, o := range offers {
+		out = append(out, store.OfferRecord{
+			ID:      o.ID,
+			Selling: assetName(o.Selling.AssetType, o.Selling.AssetCode),
+			Buying:  assetName(o.Buying.AssetType, o.Buying.AssetCode),
+			Amount:  o.Amount,
+			Price:   o.Price,
+		})
+	}
+	return out
+}
+
+// tradeRecords converts Horizon trades, newest first; never nil. Price is
+// counter per base, from Horizon's rational n/d, and left empty when that
+// is missing or malformed.
+func tradeRecords(trades []horizon.Trade) []store.TradeRecord {
+	out := make([]store.TradeRecord, 0, len(trades))
+	for _, t := range trades {
+		var price string
+		n, _, errN := horizon.ParseNumber(t.Price.N.String())
+		d, _, errD := horizon.ParseNumber(t.Price.D.String())
+		if errN == nil && errD == nil && d != 0 {
+			price = strconv.FormatFloat(n/d, 'f', 7, 64)
+		}
+		out = append(out, store.TradeRecord{
+			ID:           t.ID,
+			Type:         "trade",
+			BaseAsset:    assetName(t.BaseAssetType, t.BaseAssetCode),
+			CounterAsset: assetName(t.CounterAssetType, t.CounterAssetCode),
+			Price:        price,
+			Amount:       t.BaseAmount,
+			CreatedAt:    t.LedgerCloseTime,
+		})
+	}
+	return out
+}
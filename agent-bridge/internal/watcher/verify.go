@@ -0,0 +1,60 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrAccountNotFound is returned by VerifyAccount when Horizon has no such
+// account on the claimed network.
+var ErrAccountNotFound = errors.New("account not found")
+
+// verifiedTTL is how long a successful existence check is trusted.
+const verifiedTTL = 10 * time.Minute
+
+var (
+	verifiedMu sync.Mutex
+	verified   = map[string]time.Time{} // network + "/" + accountID -> checked at
+)
+
+// VerifyAccount checks that accountID exists on network's Horizon so a
+// watcher isn't started against the wrong network, where it would silently
+// never see activity. Positive results are cached for verifiedTTL; negative
+// ones are not, so a freshly funded account passes on the next try.
+func VerifyAccount(ctx context.Context, accountID, network string) error {
+	key := network + "/" + accountID
+	verifiedMu.Lock()
+	at, ok := verified[key]
+	verifiedMu.Unlock()
+	if ok && time.Since(at) < verifiedTTL {
+		return nil
+	}
+
+	exists, err := hz.AccountExists(ctx, HorizonURL(network), accountID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w on %s", ErrAccountNotFound, network)
+	}
+
+	rememberVerified(key, time.Now())
+	return nil
+}
+
+// rememberVerified caches a successful check of key at now, sweeping out
+// the ones that have expired so the cache holds only accounts verified in
+// the last verifiedTTL.
+func rememberVerified(key string, now time.Time) {
+	verifiedMu.Lock()
+	defer verifiedMu.Unlock()
+	for k, at := range verified {
+		if now.Sub(at) >= verifiedTTL {
+			delete(verified, k)
+		}
+	}
+	verified[key] = now
+}
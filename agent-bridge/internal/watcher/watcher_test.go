@@ -0,0 +1,452 @@
+package watcher
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-bridge/internal/horizon"
+	"agent-bridge/internal/store"
+)
+
+// subscribedStore returns a store with one token and a subscriber on it.
+func subscribedStore(t *testing.T) (*store.Store, string, chan store.LogEntry) {
+	t.Helper()
+	s := store.NewStore(nil)
+	tok, err := s.CreateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := s.Subscribe(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, tok, ch
+}
+
+// drain returns everything already queued on ch.
+func drain(ch chan store.LogEntry) []store.LogEntry {
+	var out []store.LogEntry
+	for {
+		select {
+		case e := <-ch:
+			out = append(out, e)
+		default:
+			return out
+		}
+	}
+}
+
+func TestPollPairPriceMoveFiresOneInsight(t *testing.T) {
+	fh := newFakeHorizon(t)
+	fh.books = []string{
+		book(0.0999, 5000, 0.1001, 5000), // baseline mid 0.1000
+		book(0.1009, 5000, 0.1011, 5000), // mid 0.1010: +1.00%, walls intact
+	}
+	s, _, ch := subscribedStore(t)
+	pair := monitoredPairs["TESTNET"][0]
+	states := NewInsightState()
+	c := horizon.NewClient()
+
+	for i := 0; i < 2; i++ {
+		if ok, changed := pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states); !ok || !changed {
+			t.Fatalf("poll %d: ok=%v changed=%v, want both true", i, ok, changed)
+		}
+	}
+
+	got := drain(ch)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want exactly 1: %+v", len(got), got)
+	}
+	e := got[0]
+	if e.EventType != "insight" || !strings.Contains(e.Message, "XLM/USDC price moved 1.00%") {
+		t.Errorf("unexpected insight: %+v", e)
+	}
+
+	// The same book again is unchanged: no decode, no insight.
+	if ok, changed := pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states); !ok || changed {
+		t.Fatalf("repeat poll: ok=%v changed=%v, want ok and unchanged", ok, changed)
+	}
+	if extra := drain(ch); len(extra) != 0 {
+		t.Errorf("unchanged book produced events: %+v", extra)
+	}
+}
+
+func TestInsightStateKeepsOnlySentInsights(t *testing.T) {
+	fh := newFakeHorizon(t)
+	fh.books = []string{
+		book(0.0999, 5000, 0.1001, 5000),
+		book(0.1009, 5000, 0.1011, 5000), // +1.00%
+		book(0.1019, 5000, 0.1021, 5000), // +0.99%, inside the cool-down
+	}
+	s, _, ch := subscribedStore(t)
+	s.SetInsightCooldown(time.Hour, 0)
+	pair := monitoredPairs["TESTNET"][0]
+	states := NewInsightState()
+	c := horizon.NewClient()
+
+	lastInsight := func() string {
+		for _, e := range states.Snapshot() {
+			if e.Network == "TESTNET" && e.Symbol == pair.label {
+				return e.LastInsight
+			}
+		}
+		return ""
+	}
+	for i := 0; i < 2; i++ {
+		pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states)
+	}
+	sent := lastInsight()
+	if !strings.Contains(sent, "moved 1.00%") {
+		t.Fatalf("last insight = %q, want the 1.00%% move", sent)
+	}
+	pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states)
+	if got := drain(ch); len(got) != 1 {
+		t.Fatalf("got %d events, want the cooled-down move withheld", len(got))
+	}
+	if got := lastInsight(); got != sent {
+		t.Errorf("last insight = %q, want the withheld one not recorded over %q", got, sent)
+	}
+}
+
+func TestWatchAccountPublishesContextUpdate(t *testing.T) {
+	fh := newFakeHorizon(t)
+	fh.txs = []sseEvent{{
+		id:   "123456789",
+		data: `{"id":"abcdef0123456789","created_at":"2026-01-02T03:04:05Z"}`,
+	}}
+	s, tok, ch := subscribedStore(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchAccount(ctx, horizon.NewClient(), fh.URL, s, tok, "GABCDEFGHIJK", "TESTNET")
+
+	select {
+	case e := <-ch:
+		if e.EventType != "context_update" || !strings.Contains(e.Message, "abcdef012345") {
+			t.Errorf("unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no context_update within 5s")
+	}
+	snap := s.GetContextSnapshot(tok)
+	if snap == nil || len(snap.RecentTrades) != 1 || snap.RecentTrades[0].ID != "abcdef0123456789" {
+		t.Errorf("recent trades not recorded: %+v", snap)
+	}
+}
+
+func TestWallRemovalDebounce(t *testing.T) {
+	wall := book(0.0999, 5000, 0.1001, 5000)
+	pulled := book(0.0999, 1000, 0.1001, 5000)
+	tests := []struct {
+		name    string
+		confirm int
+		books   []string
+		want    int // wall-removal insights
+	}{
+		{"flicker is ignored", 2, []string{wall, pulled, wall, pulled, wall}, 0},
+		{"confirmed on an unchanged poll", 2, []string{wall, pulled, pulled}, 1},
+		{"no repeat until rebuilt", 2, []string{wall, pulled, pulled, pulled, pulled}, 1},
+		{"rebuilt wall can alert again", 2, []string{wall, pulled, pulled, wall, pulled, pulled}, 2},
+		{"single confirmation fires at once", 1, []string{wall, pulled}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fh := newFakeHorizon(t)
+			fh.books = append([]string(nil), tt.books...)
+			s, _, ch := subscribedStore(t)
+			states := NewInsightState()
+			states.SetWallConfirmations(tt.confirm)
+			c := horizon.NewClient()
+			pair := monitoredPairs["TESTNET"][0]
+
+			for range tt.books {
+				if ok, _ := pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states); !ok {
+					t.Fatal("poll failed")
+				}
+			}
+			got := 0
+			for _, e := range drain(ch) {
+				if strings.Contains(e.Message, "bid wall removed (5000 → 1000 XLM)") {
+					got++
+				} else {
+					t.Errorf("unexpected event: %s", e.Message)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("wall insights = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWallMinimumSize(t *testing.T) {
+	states := NewInsightState()
+	states.SetWallConfirmations(1)
+	states.update("TESTNET", "BTC/USDC", 60000, 0, 0, "", time.Now())
+	btc := assetMeta{code: "BTC", decimals: 4, minWall: 0.5}
+	pair := assetPair{label: "BTC/USDC", base: btc}
+
+	var msgs []string
+	publish := func(_ string, _ float64, msg string) { msgs = append(msgs, msg) }
+	for _, sizes := range [][2]float64{{0.2, 0.8}, {0.05, 0.3}} {
+		checkWalls(states, "TESTNET", pair, sizes[0], sizes[1], "", publish)
+	}
+	// The 0.2 BTC bid was below the minimum; the 0.8 BTC ask was a wall.
+	if len(msgs) != 1 || msgs[0] != "[Insight] TESTNET BTC/USDC large ask wall removed (0.8000 → 0.3000 BTC)" {
+		t.Fatalf("insights = %q", msgs)
+	}
+}
+
+func TestWatchAccountTracksHoldings(t *testing.T) {
+	fh := newFakeHorizon(t)
+	s, tok, _ := subscribedStore(t)
+	const id = "GABCDEFGHIJK"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.SetAccountWatch(tok, id, "TESTNET", cancel); err != nil {
+		t.Fatal(err)
+	}
+
+	// waitBalances polls the snapshot until want reports true.
+	waitBalances := func(want func([]store.BalanceRecord) bool) []store.BalanceRecord {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			b := s.GetContextSnapshot(tok).Balances
+			if want(b) {
+				return b
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("balances never settled: %+v", b)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Unfunded: Horizon 404s and the snapshot stays empty, not an error.
+	prev := balanceInterval
+	balanceInterval = 20 * time.Millisecond
+	t.Cleanup(func() { balanceInterval = prev })
+	watchAccount(ctx, horizon.NewClient(), fh.URL, s, tok, id, "TESTNET")
+	time.Sleep(50 * time.Millisecond)
+	if b := s.GetContextSnapshot(tok).Balances; len(b) != 0 {
+		t.Fatalf("unfunded account has balances: %+v", b)
+	}
+
+	fh.mu.Lock()
+	fh.account = `{"balances":[
+		{"balance":"12.5000000","limit":"1000.0000000","asset_type":"credit_alphanum4","asset_code":"USDC","asset_issuer":"GISSUER"},
+		{"balance":"100.0000000","asset_type":"native"}]}`
+	fh.mu.Unlock()
+	got := waitBalances(func(b []store.BalanceRecord) bool { return len(b) == 2 })
+	want := []store.BalanceRecord{{Asset: "USDC:GISSUER", Balance: "12.5000000"}, {Asset: "XLM", Balance: "100.0000000"}}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("balance %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	lines := s.GetContextSnapshot(tok).Trustlines
+	if len(lines) != 1 || lines[0] != (store.TrustlineRecord{Code: "USDC", Issuer: "GISSUER", Limit: "1000.0000000"}) {
+		t.Errorf("trustlines = %+v, want the USDC line only", lines)
+	}
+
+	// Unpairing drops them.
+	if err := s.ClearAccountWatch(tok); err != nil {
+		t.Fatal(err)
+	}
+	if snap := s.GetContextSnapshot(tok); len(snap.Balances) != 0 || len(snap.Trustlines) != 0 {
+		t.Fatalf("holdings survived unpairing: %+v", snap)
+	}
+}
+
+func TestMicropriceWeightsBySize(t *testing.T) {
+	// 9000 bid against 1000 ask: buyers dominate, so the fair price sits
+	// nine tenths of the way from the bid to the ask.
+	mid := (0.0999 + 0.1001) / 2
+	micro := microprice(0.0999, 0.1001, 9000, 1000)
+	if math.Abs(micro-0.10008) > 1e-9 || micro <= mid {
+		t.Fatalf("microprice = %v, want 0.10008 (above the %v mid)", micro, mid)
+	}
+	if got := microprice(0.0999, 0.1001, 5000, 5000); math.Abs(got-mid) > 1e-12 {
+		t.Fatalf("balanced microprice = %v, want the mid %v", got, mid)
+	}
+}
+
+func TestPollPairUsesMicroprice(t *testing.T) {
+	if err := SetPriceMode(PriceMicro); err != nil {
+		t.Fatal(err)
+	}
+	var prices []float64
+	OnReferencePrice(func(network, symbol string, price float64) { prices = append(prices, price) })
+	t.Cleanup(func() {
+		SetPriceMode(PriceMid)
+		OnReferencePrice(nil)
+	})
+
+	// The quotes don't move, so the mid stays put, but the bid queue grows
+	// nine-fold: the microprice climbs 1.6% toward the ask.
+	fh := newFakeHorizon(t)
+	fh.books = []string{
+		book(0.0990, 1000, 0.1010, 9000), // microprice 0.0992
+		book(0.0990, 9000, 0.1010, 1000), // microprice 0.1008
+	}
+	s, _, ch := subscribedStore(t)
+	pair := monitoredPairs["TESTNET"][0]
+	states := NewInsightState()
+	c := horizon.NewClient()
+	for i := 0; i < 2; i++ {
+		pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states)
+	}
+
+	if len(prices) != 2 || math.Abs(prices[0]-0.0992) > 1e-9 || math.Abs(prices[1]-0.1008) > 1e-9 {
+		t.Fatalf("reference prices = %v, want [0.0992 0.1008]", prices)
+	}
+	var moved bool
+	for _, e := range drain(ch) {
+		moved = moved || strings.Contains(e.Message, "price moved 1.61%")
+	}
+	if !moved {
+		t.Error("no price-move insight for the microprice shift")
+	}
+	if err := SetPriceMode("vwap"); err == nil {
+		t.Error("SetPriceMode accepted an unknown mode")
+	}
+}
+
+func TestOneSidedBook(t *testing.T) {
+	fh := newFakeHorizon(t)
+	oneSided := `{"bids":[],"asks":[{"price":"0.1001","amount":"4000"}]}`
+	fh.books = []string{
+		book(0.0999, 5000, 0.1001, 5000), // baseline mid 0.1000
+		oneSided,
+		oneSided, // unchanged: rechecks walls from the stored sizes
+		oneSided,
+		book(0.1009, 5000, 0.1011, 5000), // mid 0.1010: +1.00% across the gap
+	}
+	s, _, ch := subscribedStore(t)
+	pair := monitoredPairs["TESTNET"][0]
+	states := NewInsightState()
+	c := horizon.NewClient()
+
+	pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states)
+	pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states)
+	snap := states.Snapshot()
+	if len(snap) != 1 || snap[0].MissingSide != "bid" || snap[0].TopAsk != 4000 || snap[0].Mid != 0.1 {
+		t.Fatalf("one-sided state = %+v, want missing bid, ask size 4000, last mid kept", snap)
+	}
+	// Unchanged one-sided polls must not read the missing side as a pulled wall.
+	for i := 0; i < 3; i++ {
+		pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states)
+	}
+
+	var msgs []string
+	for _, e := range drain(ch) {
+		msgs = append(msgs, e.Message)
+	}
+	want := []string{
+		"[Insight] TESTNET XLM/USDC order book became one-sided: no bids",
+		"[Insight] TESTNET XLM/USDC order book recovered: both sides quoted at 0.101000",
+		"[Insight] TESTNET XLM/USDC price moved 1.00% → 0.101000 (was 0.100000)",
+	}
+	if strings.Join(msgs, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("insights =\n%s\nwant\n%s", strings.Join(msgs, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMalformedBookSkipsPoll(t *testing.T) {
+	fh := newFakeHorizon(t)
+	good := book(0.0999, 5000, 0.1001, 5000)
+	fh.books = []string{
+		good,
+		`{"bids":[{"price":"0.0999","amount":"lots"}],"asks":[{"price":"0.1001","amount":"5000"}]}`,
+		`{"bids":[{"price":"0.0999"}],"asks":[{"price":"0.1001","amount":"5000"}]}`, // amount absent
+		`{"bids":[{"price":"0.0999","amount":"5000"}],"asks":[{"price":"NaN","amount":"5000"}]}`,
+		`{"bids":[{"price":"0.0999","amount":"5000"}],"asks":[{"price":"0","amount":"5000"}]}`,
+		`{"bids":[{"price":"0.0999","amount":"5000"}],"asks":[{"price":"0.1001","amount":"5000"}]`,
+		`{"bids":[{"price":"0.0999","amount":"5000"}],"asks":[{"price":"0.1001","amount":"5000"}]`, // same bad body again
+		good,
+	}
+	s, _, ch := subscribedStore(t)
+	pair := monitoredPairs["TESTNET"][0]
+	states := NewInsightState()
+	c := horizon.NewClient()
+
+	if ok, _ := pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states); !ok {
+		t.Fatal("baseline poll failed")
+	}
+	before := states.Snapshot()
+	for i := 0; i < 6; i++ {
+		if ok, changed := pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states); ok || changed {
+			t.Fatalf("malformed book %d: ok=%v changed=%v, want the poll skipped", i, ok, changed)
+		}
+	}
+	if after := states.Snapshot(); len(after) != 1 || after[0].TopBid != before[0].TopBid || after[0].MissingSide != "" {
+		t.Fatalf("state after malformed books = %+v, want %+v", after, before)
+	}
+	// The good book comes back: the client forgot the bad body, so it is
+	// evaluated afresh and reads as no change at all.
+	if ok, changed := pollPair(context.Background(), c, fh.URL, s, "TESTNET", pair, states); !ok || !changed {
+		t.Fatalf("recovery poll: ok=%v changed=%v", ok, changed)
+	}
+	if got := drain(ch); len(got) != 0 {
+		t.Fatalf("insights from malformed books: %+v", got)
+	}
+}
+
+func TestFetchAccount(t *testing.T) {
+	fh := newFakeHorizon(t)
+	fh.account = `{"balances":[{"balance":"100.0000000","asset_type":"native"}]}`
+	fh.offers = `{"_embedded":{"records":[{"id":"7","amount":"50.0000000","price":"0.1000000",
+		"selling":{"asset_type":"native"},"buying":{"asset_type":"credit_alphanum4","asset_code":"USDC"}}]}}`
+	fh.trades = `{"_embedded":{"records":[{"id":"t1","ledger_close_time":"2026-01-02T03:04:05Z",
+		"base_asset_type":"native","counter_asset_type":"credit_alphanum4","counter_asset_code":"USDC",
+		"base_amount":"10.0000000","counter_amount":"1.0000000","price":{"n":1,"d":10}}]}}`
+	c := horizon.NewClient()
+
+	st, err := fetchAccount(context.Background(), c, fh.URL, "GABC", AccountParts{Offers: true, Trades: true})
+	if err != nil {
+		t.Fatalf("fetchAccount: %v", err)
+	}
+	if st.Balances != nil {
+		t.Errorf("unrequested balances fetched: %+v", st.Balances)
+	}
+	if want := (store.OfferRecord{ID: "7", Selling: "XLM", Buying: "USDC", Amount: "50.0000000", Price: "0.1000000"}); len(st.OpenOffers) != 1 || st.OpenOffers[0] != want {
+		t.Errorf("offers = %+v, want [%+v]", st.OpenOffers, want)
+	}
+	if len(st.RecentTrades) != 1 || st.RecentTrades[0].Price != "0.1000000" || st.RecentTrades[0].CounterAsset != "USDC" {
+		t.Errorf("trades = %+v", st.RecentTrades)
+	}
+
+	// A failing part doesn't lose the others.
+	fh.mu.Lock()
+	fh.offers = `not json`
+	fh.mu.Unlock()
+	st, err = fetchAccount(context.Background(), c, fh.URL, "GABC", AccountParts{Holdings: true, Offers: true})
+	if err == nil || !strings.Contains(err.Error(), "offers") {
+		t.Fatalf("err = %v, want an offers error", err)
+	}
+	if len(st.Balances) != 1 || st.OpenOffers != nil {
+		t.Fatalf("state = %+v, want balances and no offers", st)
+	}
+}
+
+func TestVerifiedCacheExpires(t *testing.T) {
+	verifiedMu.Lock()
+	verified = map[string]time.Time{}
+	verifiedMu.Unlock()
+	now := time.Now()
+	rememberVerified("testnet/GA", now)
+	rememberVerified("testnet/GB", now.Add(verifiedTTL/2))
+	rememberVerified("testnet/GC", now.Add(verifiedTTL))
+
+	verifiedMu.Lock()
+	defer verifiedMu.Unlock()
+	if _, ok := verified["testnet/GA"]; ok || len(verified) != 2 {
+		t.Fatalf("verified = %v, want the expired GA swept", verified)
+	}
+}
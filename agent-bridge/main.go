@@ -3,13 +3,16 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
+	"agent-bridge/internal/config"
 	"agent-bridge/internal/db"
 	"agent-bridge/internal/handler"
 	"agent-bridge/internal/matching"
@@ -19,6 +22,20 @@ import (
 	"agent-bridge/internal/soroban"
 	"agent-bridge/internal/store"
 	"agent-bridge/internal/watcher"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Build identity, stamped in at build time:
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Left empty they fall back to what the Go toolchain embeds (see
+// handler.NewBuildInfo).
+var (
+	version   string
+	commit    string
+	buildTime string
 )
 
 // resolveSecret resolves a 1Password secret reference (op:// URI) via the
@@ -81,11 +98,19 @@ func loadDotEnv(path string) {
 func main() {
 	loadDotEnv(".env")
 
-	// ── Persistent SQLite store ───────────────────────────────────────────────
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "bridge.db"
+	build := handler.NewBuildInfo(version, commit, buildTime)
+	log.Printf("agent-bridge %s (commit %s, built %s, %s)", build.Version, build.Commit, build.BuildTime, build.GoVersion)
+
+	// ── Configuration: defaults < CONFIG_PATH file < environment ─────────────
+	cfg, err := config.Load(os.Getenv("CONFIG_PATH"), os.Getenv)
+	if err != nil {
+		log.Fatalf("[config] %v", err)
 	}
+	storeCfg, _ := cfg.StoreConfig()   // checked by Load
+	engineCfg, _ := cfg.EngineConfig() // checked by Load
+
+	// ── Persistent SQLite store ───────────────────────────────────────────────
+	dbPath := cfg.Server.DBPath
 	database, err := db.Open(dbPath)
 	if err != nil {
 		fmt.Printf("[db] WARNING: could not open %s: %v — running without persistence\n", dbPath, err)
@@ -95,50 +120,33 @@ func main() {
 	}
 
 	s := store.NewStore(database)
-
-	frontendURL := os.Getenv("FRONTEND_URL")
-	if frontendURL == "" {
-		frontendURL = "http://localhost:3000"
+	if err := s.Configure(storeCfg); err != nil {
+		log.Fatalf("[config] store: %v", err)
 	}
 
-	adminSecret := resolveSecret(os.Getenv("ADMIN_SECRET"))
+	frontendURL := cfg.Server.FrontendURL
+	adminSecret := resolveSecret(cfg.Server.AdminSecret)
 
 	// ── Background context for all long-running goroutines ───────────────────
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// ── Horizon order-book heartbeats (market insight SSE events) ────────────
+	if err := watcher.Configure(cfg.WatcherConfig()); err != nil {
+		log.Fatalf("[config] watcher: %v", err)
+	}
 	watcher.WatchOrderBooks(ctx, s, "MAINNET")
 	watcher.WatchOrderBooks(ctx, s, "TESTNET")
 
 	// ── Soroban Contract Controller ───────────────────────────────────────────
 	// Holds ADMIN_SECRET and is the only entity authorised to call settle_pnl
 	// and open_synthetic_position on-chain.
-	rpcURL := os.Getenv("SOROBAN_RPC_URL")
-	if rpcURL == "" {
-		rpcURL = "https://soroban-testnet.stellar.org"
-	}
-	horizonURL := os.Getenv("HORIZON_URL")
-	if horizonURL == "" {
-		horizonURL = "https://horizon-testnet.stellar.org"
-	}
-	networkPassphrase := os.Getenv("NETWORK_PASSPHRASE")
-	if networkPassphrase == "" {
-		networkPassphrase = "Test SDF Network ; September 2015"
-	}
-	vaultContractID := os.Getenv("AGENT_VAULT_ID")
-	if vaultContractID == "" {
-		vaultContractID = "CCNK5O3FFCOC5KEBRK6ORUUPPHYDUITTH2XCLLG7P2IBQRX2L6HXJFWG"
-	}
-	poolContractID := os.Getenv("LEVERAGE_POOL_ID")
-	if poolContractID == "" {
-		poolContractID = "CCNF3JMO7MO5PSR7AS4GT3DKZU7MLDN5WS2ML7RWOGMGPLXTT7HXRY7L"
-	}
-	// Default settlement token: USDC on testnet (C... contract address)
-	settlementToken := os.Getenv("SETTLEMENT_TOKEN")
-	if settlementToken == "" {
-		settlementToken = "CBIELTK6YBZJU5UP2WWQEUCYKLPU6AUNZ2BQ4WWFEIE3USCIHMXQDAMA"
-	}
+	rpcURL := cfg.Soroban.RPCURL
+	horizonURL := cfg.Soroban.HorizonURL
+	networkPassphrase := cfg.Soroban.NetworkPassphrase
+	vaultContractID := cfg.Soroban.AgentVaultID
+	poolContractID := cfg.Soroban.LeveragePoolID
+	settlementToken := cfg.Soroban.SettlementToken
 
 	var sorobanClient *soroban.Client
 	if adminSecret != "" {
@@ -152,12 +160,30 @@ func main() {
 	}
 
 	// ── Matching engine ───────────────────────────────────────────────────────
-	settleURL := os.Getenv("SETTLE_URL")
-	if settleURL == "" {
-		settleURL = frontendURL + "/api/admin/settle"
+	settleURL := cfg.SettleURL()
+	symbolCfgs, _ := cfg.SymbolConfigs() // checked by Load
+
+	notify := func(userToken, eventType, message string, data any) {
+		s.Publish(userToken, store.LogEntry{
+			Message:   message,
+			Source:    "engine",
+			EventType: eventType,
+			Data:      data,
+		})
 	}
 
-	eng := matching.NewEngine(settleURL, adminSecret)
+	eng := matching.NewEngine(settleURL, adminSecret, symbolCfgs, notify)
+	// Seeds, bands, book limits, the price circuit breaker (a feed price that
+	// jumps more than PRICE_BREAKER_MAX_MOVE_PCT is rejected or clamped and the
+	// symbol's liquidations pause) and the liquidation settings.
+	if err := eng.Configure(engineCfg); err != nil {
+		log.Fatalf("[config] engine: %v", err)
+	}
+	if engineCfg.Liquidation.DetectOnly {
+		log.Printf("[engine] WARNING: no settle path configured (set ADMIN_SECRET or SETTLE_URL) — " +
+			"liquidations are DETECT-ONLY: breaches are logged and reported, nothing is settled. " +
+			"SETTLE_FORCE_ENABLE=true settles via %s anyway", settleURL)
+	}
 
 	// Wire the soroban client into the liquidation engine so settlements go
 	// directly on-chain without an extra HTTP round-trip.
@@ -174,10 +200,46 @@ func main() {
 		})
 	}
 
+	// Liquidations whose settle call fails are kept for replay; without a
+	// path they only survive until restart.
+	settleDLQ, err := matching.OpenSettleDLQ(cfg.Engine.SettleDLQPath)
+	if err != nil {
+		log.Fatalf("SETTLE_DLQ_PATH: %v", err)
+	}
+	eng.SetSettleDLQ(settleDLQ)
+
+	// A tripped price breaker pauses the symbol's liquidations until an admin
+	// resumes it (or, with PRICE_BREAKER_STABLE_SEC, the feed settles).
+	eng.Prices.OnBreaker(func(ev matching.BreakerEvent) {
+		msg := fmt.Sprintf("Price feed for %s paused: %.7g -> %.7g (%+.1f%%) %s; liquidations halted",
+			ev.Symbol, ev.LastPrice, ev.Proposed, ev.Move*100, ev.Action)
+		if ev.State == "resumed" {
+			msg = fmt.Sprintf("Price feed for %s resumed (%s); liquidations active", ev.Symbol, ev.Reason)
+		}
+		s.PublishAll(store.LogEntry{Message: msg, Source: "engine", EventType: "stream_warning", Data: ev})
+	})
+
+	// OB_MARK_NETWORK feeds that network's order-book reference price (see
+	// OB_PRICE_MODE) into the mark price of the symbols the engine trades.
+	if markNet := cfg.Watcher.MarkNetwork; markNet != "" {
+		tradable := make(map[string]bool, len(symbolCfgs))
+		for _, cfg := range eng.Symbols() {
+			tradable[cfg.Symbol] = true
+		}
+		watcher.OnReferencePrice(func(network, symbol string, price float64) {
+			if network == markNet && tradable[symbol] {
+				eng.Prices.SetMarkPrice(symbol, price, matching.SourceOrderbook)
+			}
+		})
+	}
+
+	// Per-token price alerts follow the mark price from every feed.
+	eng.Prices.OnUpdate(s.CheckAlerts)
+
 	eng.Start(ctx)
 
 	// ── SDEX client (uses Horizon for real DEX execution) ─────────────────────
-	usdcIssuer := os.Getenv("USDC_ISSUER")
+	usdcIssuer := cfg.Soroban.USDCIssuer
 	if usdcIssuer == "" {
 		usdcIssuer = sdex.USDCIssuerTestnet
 	}
@@ -192,7 +254,7 @@ func main() {
 
 	// ── Re-register persisted positions into the liquidation engine ───────────
 	for _, pos := range posStore.All() {
-		eng.Liquidation.AddPosition(&matching.OpenPosition{
+		if err := eng.Liquidation.AddPosition(&matching.OpenPosition{
 			UserToken:        pos.UserToken,
 			Symbol:           pos.Symbol,
 			Side:             string(pos.Side),
@@ -200,69 +262,247 @@ func main() {
 			Leverage:         pos.Leverage,
 			CollateralAmount: pos.CollateralUSDC,
 			DebtAmount:       pos.TotalUSDC,
-		})
+		}); err != nil {
+			fmt.Printf("[startup] could not restore liquidation watch for %s: %v\n", pos.UserAddr, err)
+			continue
+		}
 		fmt.Printf("[startup] restored liquidation watch: user=%s side=%s entry=%.6f\n",
 			pos.UserAddr, pos.Side, pos.EntryPrice)
 	}
 
 	// ── HTTP handlers ─────────────────────────────────────────────────────────
+	strictJSON := cfg.Server.StrictContentType
 	tokenH := &handler.TokenHandler{Store: s}
-	logsH := &handler.LogsHandler{Store: s}
-	streamH := &handler.StreamHandler{Store: s}
+	logsH := &handler.LogsHandler{Store: s, StrictContentType: strictJSON}
+	streamH := &handler.StreamHandler{
+		Store:       s,
+		MaxLifetime: time.Duration(cfg.Server.SSEMaxLifetimeSec) * time.Second,
+	}
 	skillsH := &handler.SkillsHandler{Store: s}
-	proxyH := &handler.ProxyHandler{Store: s, FrontendURL: frontendURL}
-	ctxH := &handler.ContextHandler{Store: s}
+	proxyH := &handler.ProxyHandler{
+		Store:       s,
+		FrontendURL: frontendURL,
+		Allowed:     handler.BridgeAllowlist(strings.Split(cfg.Server.BridgeExtraPaths, ",")...),
+		Breaker: handler.NewBreaker(
+			cfg.Server.ProxyBreakerFailures,
+			time.Duration(cfg.Server.ProxyBreakerCooldownSec)*time.Second,
+		),
+	}
+	healthH := &handler.HealthHandler{Proxy: proxyH.Breaker}
+	versionH := &handler.VersionHandler{Build: build}
+	ctxH := &handler.ContextHandler{Store: s, AdminSecret: adminSecret, StrictContentType: strictJSON}
 	ordersH := &handler.OrdersHandler{
 		Engine:          eng,
 		Store:           s,
-		Soroban:         sorobanClient,
 		SettlementToken: settlementToken,
+		MaxDepth:        cfg.Server.BookSnapshotMaxDepth,
+
+		StrictContentType: strictJSON,
+	}
+	if sorobanClient != nil { // a nil *soroban.Client would still be a non-nil PositionChain
+		ordersH.Soroban = sorobanClient
+	}
+	alertMapping, err := handler.ParseAlertMapping(cfg.Signal.AlertMapping)
+	if err != nil {
+		log.Fatalf("TRADINGVIEW_ALERT_MAPPING: %v", err)
+	}
+	pricesH := &handler.PricesHandler{
+		Engine:            eng,
+		Alerts:            alertMapping,
+		AdminSecret:       adminSecret,
+		StrictContentType: strictJSON,
+	}
+	symbolsH := &handler.SymbolsHandler{Engine: eng}
+	tradesH := &handler.TradesHandler{Engine: eng}
+	alertsH := &handler.AlertsHandler{Store: s}
+	signalSources, err := handler.ParseSignalSources(cfg.Signal.Webhooks)
+	if err != nil {
+		log.Fatalf("SIGNAL_WEBHOOKS: %v", err)
 	}
-	pricesH := &handler.PricesHandler{Engine: eng}
-	adminH := &handler.AdminHandler{Soroban: sorobanClient}
+	signalH := &handler.SignalHandler{
+		Engine:         eng,
+		Orders:         ordersH,
+		Sources:        signalSources,
+		Alerts:         alertMapping,
+		MaxSlippageBps: cfg.Signal.MaxSlippageBps,
+	}
+	adminH := &handler.AdminHandler{
+		Soroban:   sorobanClient,
+		Engine:    eng,
+		Store:     s,
+		Insights:  watcher.Insights,
+		SettleDLQ: settleDLQ,
+
+		AdminSecret: adminSecret,
+	}
+	openAPIH := &handler.OpenAPIHandler{}
 	posH := &handler.PositionsHandler{
 		Store:     s,
 		Positions: posStore,
 		SDEX:      sdexClient,
 	}
 
+	// ADMIN_IP_ALLOWLIST (CIDRs) gates the admin and price-feed routes by
+	// source address before their secret is even checked; empty = any source.
+	adminIPs, err := middleware.ParseCIDRs(cfg.Server.AdminIPAllowlist)
+	if err != nil {
+		log.Fatalf("ADMIN_IP_ALLOWLIST: %v", err)
+	}
+	trustForwarded := cfg.Server.TrustForwardedFor
+	adminOnly := func(h http.HandlerFunc) http.Handler {
+		return middleware.RequireIP(adminIPs, trustForwarded, h)
+	}
+
+	// With ADMIN_PORT the admin routes get their own mux and listener, so
+	// the network can keep them away from the public port; otherwise they
+	// share the main mux.
 	mux := http.NewServeMux()
+	adminMux := mux
+	if cfg.Server.AdminPort != "" {
+		adminMux = http.NewServeMux()
+		adminMux.HandleFunc("/healthz", healthH.Get)
+	}
 
 	// Core routes
+	mux.HandleFunc("/healthz", healthH.Get)
+	mux.HandleFunc("/api/version", versionH.Get)
+	mux.HandleFunc("/api/openapi.json", openAPIH.Get)
 	mux.HandleFunc("/api/token/generate", tokenH.Generate)
-	mux.HandleFunc("/api/logs", logsH.Post)
-	mux.HandleFunc("/api/logs/stream", streamH.Stream)
-	mux.HandleFunc("/api/skills", skillsH.List)
-	mux.HandleFunc("/api/context", ctxH.Handle)
-	mux.HandleFunc("/api/bridge/", proxyH.Handle)
-
-	// Matching engine routes
-	mux.HandleFunc("/api/orders", ordersH.Handle)
+	mux.Handle("/api/logs", middleware.RequireToken(s, http.HandlerFunc(logsH.Handle)))
+	mux.Handle("/api/logs/stream", middleware.RequireToken(s, http.HandlerFunc(streamH.Stream)))
+	mux.Handle("/api/skills", middleware.RequireToken(s, http.HandlerFunc(skillsH.List)))
+	mux.Handle("/api/context", middleware.RequireToken(s, http.HandlerFunc(ctxH.Handle)))
+	mux.Handle("/api/context/watch", middleware.RequireToken(s, http.HandlerFunc(ctxH.Unwatch)))
+	mux.Handle("/api/context/history", middleware.RequireToken(s, http.HandlerFunc(ctxH.History)))
+	mux.Handle("/api/account/summary", middleware.RequireToken(s, http.HandlerFunc(ctxH.Summary)))
+	mux.Handle("/api/bridge/", middleware.RequireToken(s, http.HandlerFunc(proxyH.Handle)))
+
+	// Matching engine routes (GET /api/orders is a public book snapshot)
+	mux.Handle("/api/orders", middleware.RequireToken(s, http.HandlerFunc(ordersH.Handle), http.MethodPost))
+	mux.Handle("/api/orders/status", middleware.RequireToken(s, http.HandlerFunc(ordersH.Status)))
+	mux.HandleFunc("/api/orders/risk-check", ordersH.RiskCheck)
+	mux.HandleFunc("/api/orders/quote", ordersH.Quote)
 	mux.HandleFunc("/api/prices", pricesH.Get)
-	mux.HandleFunc("/api/price/update", pricesH.Update)
+	mux.HandleFunc("/api/prices/status", pricesH.Status)
+	mux.HandleFunc("/api/prices/stream", pricesH.Stream)
+	adminMux.Handle("/api/price/update", adminOnly(pricesH.Webhook))
+	adminMux.Handle("/api/price/update/strict", adminOnly(pricesH.Update))
+	mux.HandleFunc("/api/symbols", symbolsH.List)
+	mux.HandleFunc("/api/trades", tradesH.List)
+	mux.Handle("/api/alerts", middleware.RequireToken(s, http.HandlerFunc(alertsH.Handle)))
+
+	// Signal-to-order bridge: places real orders, so it is strictly opt-in.
+	if cfg.Signal.Enabled {
+		if len(signalSources) == 0 {
+			log.Fatal("SIGNAL_TRADING_ENABLED=true but SIGNAL_WEBHOOKS is empty")
+		}
+		mux.HandleFunc("/api/signal", signalH.Handle)
+		fmt.Printf("[signal] automated trading enabled for %d webhook(s)\n", len(signalSources))
+	}
 
 	// Admin / Contract Controller routes (Bearer ADMIN_SECRET required)
-	mux.HandleFunc("/api/admin/settle", adminH.Settle)
-	mux.HandleFunc("/api/admin/position", adminH.OpenPosition)
-	mux.HandleFunc("/api/admin/position/close", adminH.ClosePosition)
+	adminMux.Handle("/api/admin/settle", adminOnly(adminH.Settle))
+	adminMux.Handle("/api/admin/settle/preview", adminOnly(adminH.SettlePreview))
+	adminMux.Handle("/api/admin/position", adminOnly(adminH.OpenPosition))
+	adminMux.Handle("/api/admin/position/close", adminOnly(adminH.ClosePosition))
+	adminMux.Handle("/api/position/margin", adminOnly(adminH.Margin))
+	adminMux.Handle("/api/admin/connections", adminOnly(adminH.Connections))
+	adminMux.Handle("/api/admin/agent/disconnect", adminOnly(adminH.DisconnectAgent))
+	adminMux.Handle("/api/admin/positions", adminOnly(adminH.Positions))
+	adminMux.Handle("/api/admin/open-interest", adminOnly(adminH.OpenInterest))
+	adminMux.Handle("/api/admin/liquidation/check", adminOnly(adminH.CheckLiquidations))
+	adminMux.Handle("/api/admin/insight-state", adminOnly(adminH.InsightState))
+	adminMux.Handle("/api/admin/price-breakers", adminOnly(adminH.PriceBreakers))
+	adminMux.Handle("/api/admin/orders/clear", adminOnly(adminH.ClearBook))
+	adminMux.Handle("/api/admin/engine/stats", adminOnly(adminH.EngineStats))
+	adminMux.Handle("/api/admin/prices/pause", adminOnly(adminH.PausePrices))
+	adminMux.Handle("/api/admin/prices/resume", adminOnly(adminH.ResumePrices))
+	adminMux.Handle("/api/admin/settle-dlq", adminOnly(adminH.SettleDeadLetters))
+	adminMux.Handle("/api/admin/settle-dlq/retry", adminOnly(adminH.RetrySettlement))
+	adminMux.Handle("/api/context/batch", adminOnly(ctxH.Batch))
 
 	// SDEX leveraged position routes
-	mux.HandleFunc("/api/positions/open", posH.Open)
-	mux.HandleFunc("/api/positions/close", posH.Close)
-	mux.HandleFunc("/api/positions", posH.Get)
+	mux.Handle("/api/positions/open", middleware.RequireToken(s, http.HandlerFunc(posH.Open)))
+	mux.Handle("/api/positions/close", middleware.RequireToken(s, http.HandlerFunc(posH.Close)))
+	mux.Handle("/api/positions", middleware.RequireToken(s, http.HandlerFunc(posH.Get)))
 
-	allowedOrigin := os.Getenv("ALLOWED_ORIGIN")
-	if allowedOrigin == "" {
-		allowedOrigin = "*"
+	wrap := func(h http.Handler) http.Handler {
+		return middleware.RequestID(middleware.Gzip(middleware.CORS(h, cfg.Server.AllowedOrigin), cfg.Server.GzipMinBytes))
 	}
-	wrapped := middleware.CORS(mux, allowedOrigin)
+	wrapped := wrap(mux)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8090"
+	if adminPort := cfg.Server.AdminPort; adminPort != "" {
+		fmt.Printf("admin routes listening on :%s\n", adminPort)
+		go func() {
+			if err := serveAdmin(":"+adminPort, wrap(adminMux), cfg.Server); err != nil {
+				log.Fatalf("admin server: %v", err)
+			}
+		}()
 	}
+
+	port := cfg.Server.Port
 	fmt.Printf("listening on :%s (frontend=%s rpc=%s)\n", port, frontendURL, rpcURL)
-	if err := http.ListenAndServe(":"+port, wrapped); err != nil {
+	if err := serve(":"+port, wrapped, cfg.Server); err != nil {
 		fmt.Printf("server error: %v\n", err)
 	}
 }
+
+// serve runs the HTTP server. With TLS_CERT and TLS_KEY it serves HTTPS from
+// those files; with AUTOCERT_DOMAINS it obtains Let's Encrypt certificates for
+// the listed hosts (answering HTTP-01 challenges on :80); otherwise it serves
+// plain HTTP for a TLS-terminating proxy in front.
+func serve(addr string, h http.Handler, sc config.Server) error {
+	srv := &http.Server{Addr: addr, Handler: h}
+	certFile, keyFile := sc.TLSCert, sc.TLSKey
+	domains := sc.AutocertDomains
+
+	switch {
+	case certFile != "" && keyFile != "":
+		fmt.Printf("[tls] serving HTTPS with certificate %s\n", certFile)
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	case certFile != "" || keyFile != "":
+		return errors.New("TLS_CERT and TLS_KEY must be set together")
+	case domains != "":
+		var hosts []string
+		for _, d := range strings.Split(domains, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				hosts = append(hosts, d)
+			}
+		}
+		cacheDir := sc.AutocertCacheDir
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(hosts...),
+			Cache:      autocert.DirCache(cacheDir),
+		}
+		srv.TLSConfig = m.TLSConfig()
+		go func() {
+			if err := http.ListenAndServe(":80", m.HTTPHandler(nil)); err != nil {
+				log.Printf("[tls] ACME challenge listener on :80: %v", err)
+			}
+		}()
+		fmt.Printf("[tls] serving HTTPS with Let's Encrypt certificates for %s\n", strings.Join(hosts, ", "))
+		return srv.ListenAndServeTLS("", "")
+	default:
+		return srv.ListenAndServe()
+	}
+}
+
+// serveAdmin runs the ADMIN_PORT listener: HTTPS from ADMIN_TLS_CERT and
+// ADMIN_TLS_KEY, else from TLS_CERT and TLS_KEY, else plain HTTP. Autocert
+// certificates are not used here — they are issued for the public hosts, not
+// the admin one — so config validation refuses AUTOCERT_DOMAINS with
+// ADMIN_PORT unless the admin listener has a certificate of its own.
+func serveAdmin(addr string, h http.Handler, sc config.Server) error {
+	srv := &http.Server{Addr: addr, Handler: h}
+	certFile, keyFile := sc.AdminTLSCert, sc.AdminTLSKey
+	if certFile == "" {
+		certFile, keyFile = sc.TLSCert, sc.TLSKey
+	}
+	if certFile != "" && keyFile != "" {
+		fmt.Printf("[tls] admin routes serving HTTPS with certificate %s\n", certFile)
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	}
+	log.Printf("[tls] WARNING: admin routes on %s are plain HTTP; keep the port off untrusted networks or set ADMIN_TLS_CERT/ADMIN_TLS_KEY", addr)
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPICoversRoutes fails when a route is registered in main.go but
+// missing from internal/handler/openapi.json, or documented but not served.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var routes []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc") {
+			return true
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			path, _ := strconv.Unquote(lit.Value)
+			routes = append(routes, path)
+		}
+		return true
+	})
+	if len(routes) == 0 {
+		t.Fatal("found no mux routes in main.go")
+	}
+
+	raw, err := os.ReadFile("internal/handler/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("openapi = %q, want 3.x", doc.OpenAPI)
+	}
+
+	var documented []string
+	for p := range doc.Paths {
+		// Subtree patterns ("/api/bridge/") are documented with a path parameter.
+		if i := strings.Index(p, "{"); i >= 0 {
+			p = p[:i]
+		}
+		documented = append(documented, p)
+	}
+	slices.Sort(routes)
+	slices.Sort(documented)
+	for _, r := range routes {
+		if !slices.Contains(documented, r) {
+			t.Errorf("route %s is not in openapi.json", r)
+		}
+	}
+	for _, d := range documented {
+		if !slices.Contains(routes, d) {
+			t.Errorf("openapi.json documents %s, which main.go does not register", d)
+		}
+	}
+}
@@ -21,6 +21,23 @@ interface LogEntry {
   event_type?: string;
 }
 
+// Named SSE events the bridge sends besides insight and context_update.
+// EventSource only delivers a named event to a listener for that name, so
+// each needs one; onmessage never sees them.
+const BRIDGE_EVENTS = [
+  'fill',
+  'order_cancelled',
+  'liquidation',
+  'alert',
+  'margin_warning',
+  'stream_warning',
+  'agent_request',
+  'agent_response',
+];
+
+// Events a trader must not miss, highlighted in the terminal.
+const CRITICAL_EVENTS = new Set(['liquidation', 'alert', 'margin_warning', 'stream_warning']);
+
 interface RightSidebarProps {
   isVisible: boolean;
   onToggle: () => void;
@@ -167,6 +184,16 @@ export default function RightSidebar({
         } catch { /* ignore */ }
       });
 
+      // Fills, cancellations, risk warnings and agent call traces.
+      for (const type of BRIDGE_EVENTS) {
+        es.addEventListener(type, (event) => {
+          try {
+            const entry: LogEntry = JSON.parse((event as MessageEvent).data);
+            setLogs((prev) => [...prev, { ...entry, event_type: type }]);
+          } catch { /* ignore */ }
+        });
+      }
+
       es.onerror = () => { /* auto-reconnect */ };
     } catch {
       setConnState('disconnected');
@@ -606,6 +633,8 @@ Start by calling GET ${BRIDGE_URL}/api/context?token=${token} to see the user's
                                   ? { color: '#facc15' }
                                   : entry.event_type === 'context_update'
                                   ? { color: '#00ff94' }
+                                  : entry.event_type && CRITICAL_EVENTS.has(entry.event_type)
+                                  ? { color: '#f87171' }
                                   : undefined
                               }
                             >